@@ -172,21 +172,613 @@ INSERT INTO sensor_types (name, unit, description, min_value, max_value) VALUES
 ('disk_usage', 'GB', 'Využití disku', 0, 10000)
 ON CONFLICT DO NOTHING;
 
--- 2. Registrace virtuálních senzorů (Topic -> ID)
--- Tady definujeme mapování pro MQTT zprávy, které bude náš monitor posílat.
-INSERT INTO sensors (sensor_type_id, mqtt_topic, friendly_name, is_active) VALUES 
--- CPU
-((SELECT id FROM sensor_types WHERE name = 'cpu_load'), '/msh/system/cpu', 'System CPU Load', true),
--- RAM
-((SELECT id FROM sensor_types WHERE name = 'ram_usage'), '/msh/system/ram_used', 'System RAM Used', true),
-((SELECT id FROM sensor_types WHERE name = 'ram_usage'), '/msh/system/app_ram', 'IoT Stack RAM', true),
--- DISK
-((SELECT id FROM sensor_types WHERE name = 'disk_usage'), '/msh/system/disk_used', 'Root Disk Used', true);
-
--- Registrace senzorů pro CELKOVOU kapacitu
-INSERT INTO sensors (sensor_type_id, mqtt_topic, friendly_name, is_active) VALUES 
--- RAM Total
-((SELECT id FROM sensor_types WHERE name = 'ram_usage'), '/msh/system/ram_total', 'System RAM Total', true),
--- Disk Total
-((SELECT id FROM sensor_types WHERE name = 'disk_usage'), '/msh/system/disk_total', 'System Disk Total', true)
-ON CONFLICT DO NOTHING;
\ No newline at end of file
+-- 2. Registrace senzorů (Topic -> ID)
+-- Senzory system-monitoru se NEseedují ručně. Každý monitor při startu pošle přihlášku
+-- na topic 'registry/announce' a sensor-ingestor mu založí senzory ve tvaru
+-- /msh/system/<host>/<metrika> (cpu, ram_used, ram_total, app_ram, disk_used, disk_total).
+-- Díky tomu lze monitor spustit na libovolném počtu strojů bez úprav DB.
+
+-- ==========================================
+-- 6. Karanténa neznámých MQTT topiců
+-- ==========================================
+-- Ingestor sem ukládá zprávy z topiců, které nejsou v tabulce 'sensors'.
+-- Admin je v dashboardu schválí (vznikne senzor) nebo trvale ignoruje.
+CREATE TABLE discovered_topics (
+    id SERIAL PRIMARY KEY,
+    mqtt_topic VARCHAR(255) NOT NULL UNIQUE,
+    first_seen TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    message_count BIGINT NOT NULL DEFAULT 0,
+    sample_payload TEXT,                           -- Poslední přijatý payload (zkrácený)
+    inferred_type VARCHAR(20),                     -- 'number', 'boolean', 'json', 'text'
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'  -- 'pending', 'approved', 'ignored'
+        CHECK (status IN ('pending', 'approved', 'ignored')),
+    sensor_id INTEGER REFERENCES sensors(id) ON DELETE SET NULL, -- Vyplněno po schválení
+    decided_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_discovered_topics_status ON discovered_topics(status, last_seen DESC);
+
+-- ==========================================
+-- 7. Příkazy pro akční členy (relé, zásuvky)
+-- ==========================================
+-- Senzor typu 'switch' s vyplněným command_topic je ovladatelný z dashboardu.
+-- Stav zařízení dál chodí na jeho mqtt_topic, příkazy jdou na command_topic.
+ALTER TABLE sensors ADD COLUMN command_topic VARCHAR(255);
+
+-- Historie všech odeslaných příkazů (audit + ladění nespolehlivých zařízení)
+CREATE TABLE command_history (
+    id BIGSERIAL PRIMARY KEY,
+    correlation_id VARCHAR(64) NOT NULL UNIQUE,    -- Náhodné ID posílané v payloadu příkazu
+    sensor_id INTEGER NOT NULL REFERENCES sensors(id) ON DELETE CASCADE,
+    command_topic VARCHAR(255) NOT NULL,
+    requested_value DOUBLE PRECISION NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'  -- 'pending', 'confirmed', 'timeout', 'failed'
+        CHECK (status IN ('pending', 'confirmed', 'timeout', 'failed')),
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    confirmed_at TIMESTAMPTZ,
+    confirmed_value DOUBLE PRECISION,              -- Hodnota, kterou zařízení ohlásilo
+    error TEXT
+);
+
+CREATE INDEX idx_command_history_sensor ON command_history(sensor_id, requested_at DESC);
+
+-- ==========================================
+-- 8. Automatizační pravidla (Rules Engine)
+-- ==========================================
+-- Podmínky a akce jsou JSON (formát viz services/rules-engine/types.go).
+-- Pravidlo se spustí (fáze 'fire'), když podmínky platí alespoň debounce_seconds,
+-- a uvolní (fáze 'release'), když platí release_conditions (nebo přestanou platit conditions).
+CREATE TABLE automation_rules (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    dry_run BOOLEAN NOT NULL DEFAULT false,        -- Jen vyhodnocovat a logovat, akce neprovádět
+    conditions JSONB NOT NULL,
+    release_conditions JSONB,                      -- Hystereze (např. vypnout až pod 60 %)
+    actions JSONB NOT NULL,                        -- Seznam akcí: mqtt / webhook
+    release_actions JSONB,
+    debounce_seconds INTEGER NOT NULL DEFAULT 0 CHECK (debounce_seconds >= 0),
+    cooldown_seconds INTEGER NOT NULL DEFAULT 0 CHECK (cooldown_seconds >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()  -- Mění trigger níže (engine podle toho pravidlo překompiluje a resetuje stav)
+);
+
+-- updated_at hlídá trigger, aby ho nešlo zapomenout (ruční UPDATE podmínek by engine jinak přehlédl)
+CREATE TRIGGER update_automation_rules_modtime
+    BEFORE UPDATE ON automation_rules
+    FOR EACH ROW
+    EXECUTE FUNCTION update_modified_column();
+
+-- Log spuštění pravidel (čte ho home-api: GET /api/rule-executions)
+CREATE TABLE rule_executions (
+    id BIGSERIAL PRIMARY KEY,
+    rule_id INTEGER NOT NULL REFERENCES automation_rules(id) ON DELETE CASCADE,
+    executed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    phase VARCHAR(10) NOT NULL CHECK (phase IN ('fire', 'release')),
+    dry_run BOOLEAN NOT NULL,
+    success BOOLEAN NOT NULL,
+    sensor_values JSONB,                           -- Hodnoty senzorů v okamžiku spuštění
+    action_results JSONB                           -- Výsledek každé akce
+);
+
+CREATE INDEX idx_rule_executions_rule ON rule_executions(rule_id, executed_at DESC);
+
+-- Příklad: ventilátor v koupelně (vlhkost senzor 5, relé na topicu /msh/bathroom/fan/set)
+-- INSERT INTO automation_rules (name, conditions, release_conditions, actions, release_actions, debounce_seconds, cooldown_seconds)
+-- VALUES ('Ventilátor koupelna',
+--     '{"type": "threshold", "sensor_id": 5, "op": ">", "value": 70}',
+--     '{"type": "threshold", "sensor_id": 5, "op": "<", "value": 60}',
+--     '[{"type": "mqtt", "topic": "/msh/bathroom/fan/set", "payload": "1"}]',
+--     '[{"type": "mqtt", "topic": "/msh/bathroom/fan/set", "payload": "0"}]',
+--     60, 300);
+
+-- ==========================================
+-- 9. Scény a časové rozvrhy (Scheduler)
+-- ==========================================
+-- Scéna = pojmenovaná sada MQTT zpráv, např. "Večer": [{"topic": "...", "payload": "1", "qos": 1}]
+-- Aktivovat ji lze rozvrhem nebo ručně přes home-api (POST /api/scenes/{id}/activate).
+CREATE TABLE scenes (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT,
+    actions JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Rozvrh spouští buď scénu, nebo vlastní seznam akcí (stejný formát jako scenes.actions).
+CREATE TABLE schedules (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    kind VARCHAR(10) NOT NULL CHECK (kind IN ('cron', 'sun')),
+    cron_expr VARCHAR(100),                        -- kind 'cron': "30 6 * * 1-5" = pracovní dny 06:30
+    sun_event VARCHAR(10) CHECK (sun_event IN ('sunrise', 'sunset')), -- kind 'sun'
+    offset_minutes INTEGER NOT NULL DEFAULT 0,     -- kind 'sun': -30 = půl hodiny před západem
+    days SMALLINT[],                               -- kind 'sun': ISO dny (1 = pondělí), NULL = každý den
+    timezone VARCHAR(50),                          -- NULL = TZ služby (Europe/Prague)
+    scene_id INTEGER REFERENCES scenes(id) ON DELETE CASCADE,
+    actions JSONB,
+    -- Co se zmeškanými běhy (služba neběžela): 'skip', 'run_once', 'run_all'
+    catch_up VARCHAR(10) NOT NULL DEFAULT 'skip' CHECK (catch_up IN ('skip', 'run_once', 'run_all')),
+    catch_up_max_age_seconds INTEGER NOT NULL DEFAULT 3600, -- Starší zmeškané běhy se nedohánějí
+    last_run_at TIMESTAMPTZ,                       -- Plánovaný čas posledního zpracovaného běhu
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (scene_id IS NOT NULL OR actions IS NOT NULL),
+    CHECK ((kind = 'cron' AND cron_expr IS NOT NULL) OR (kind = 'sun' AND sun_event IS NOT NULL))
+);
+
+-- Log běhů rozvrhů
+CREATE TABLE schedule_runs (
+    id BIGSERIAL PRIMARY KEY,
+    schedule_id INTEGER NOT NULL REFERENCES schedules(id) ON DELETE CASCADE,
+    scene_id INTEGER REFERENCES scenes(id) ON DELETE SET NULL,
+    planned_at TIMESTAMPTZ NOT NULL,
+    executed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    catch_up BOOLEAN NOT NULL DEFAULT false,       -- true = dohnaný zmeškaný běh
+    success BOOLEAN NOT NULL,
+    error TEXT
+);
+
+CREATE INDEX idx_schedule_runs_schedule ON schedule_runs(schedule_id, executed_at DESC);
+
+-- Příklady:
+-- INSERT INTO schedules (name, kind, cron_expr, actions, catch_up)
+-- VALUES ('Topení ráno', 'cron', '30 6 * * 1-5', '[{"topic": "/msh/heater/set", "payload": "1"}]', 'run_once');
+-- INSERT INTO scenes (name, actions) VALUES ('Veranda', '[{"topic": "/msh/porch/light/set", "payload": "1"}]');
+-- INSERT INTO schedules (name, kind, sun_event, offset_minutes, scene_id) VALUES ('Veranda při západu', 'sun', 'sunset', 0, 1);
+
+-- ==========================================
+-- 10. Virtuální senzory
+-- ==========================================
+-- Virtuální senzor je běžný řádek v 'sensors' (má vlastní mqtt_topic i typ), jeho hodnotu ale
+-- počítá služba virtual-sensors z jiných senzorů a publikuje ji na ten topic. Ingestor, DB,
+-- grafy i alerty s ním tedy zachází stejně jako s fyzickým senzorem.
+-- Výraz: $<id senzoru> nebo ${<mqtt topic>}, operátory + - * / ^, funkce dewpoint, avg, min, max, abs.
+CREATE TABLE virtual_sensors (
+    sensor_id INTEGER PRIMARY KEY REFERENCES sensors(id) ON DELETE CASCADE,
+    expression TEXT NOT NULL,
+    max_input_age_seconds INTEGER NOT NULL DEFAULT 600, -- Starší vstupy = výsledek se nepočítá
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO sensor_types (name, unit, description, min_value, max_value) VALUES
+('percent', '%', 'Obecná procentní hodnota (např. volná RAM)', 0, 100)
+ON CONFLICT DO NOTHING;
+
+-- Příklad: volná RAM v % pro stroj 'rpi1'
+-- INSERT INTO sensors (sensor_type_id, mqtt_topic, friendly_name, location)
+-- SELECT id, '/msh/virtual/rpi1/ram_free_pct', 'Volná RAM rpi1', 'Server' FROM sensor_types WHERE name = 'percent';
+-- INSERT INTO virtual_sensors (sensor_id, expression)
+-- SELECT id, '100 * (1 - ${/msh/system/rpi1/ram_used} / ${/msh/system/rpi1/ram_total})'
+-- FROM sensors WHERE mqtt_topic = '/msh/virtual/rpi1/ram_free_pct';
+
+-- ==========================================
+-- 11. Kalibrace senzorů
+-- ==========================================
+-- Ingestor přepočte surovou hodnotu před validací min/max:
+--   1. value = raw * scale + offset_value
+--   2. pokud je zadaná tabulka 'points', lineární interpolace: [{"raw": 0, "actual": 0.5}, {"raw": 100, "actual": 98}]
+-- Kalibrace se NEPŘEPISUJÍ - změna = nový řádek s novým effective_from. Platí vždy poslední
+-- řádek s effective_from <= čas měření, takže je dohledatelné, s jakou kalibrací data vznikla.
+CREATE TABLE sensor_calibrations (
+    id SERIAL PRIMARY KEY,
+    sensor_id INTEGER NOT NULL REFERENCES sensors(id) ON DELETE CASCADE,
+    effective_from TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    scale DOUBLE PRECISION NOT NULL DEFAULT 1,
+    offset_value DOUBLE PRECISION NOT NULL DEFAULT 0,
+    points JSONB,                                  -- Volitelná tabulka bodů (alespoň 2)
+    note TEXT,                                     -- Např. "porovnáno s referenčním teploměrem"
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (sensor_id, effective_from)
+);
+
+-- Příklady:
+-- DS18B20 měří o 0.7 °C víc:     INSERT INTO sensor_calibrations (sensor_id, offset_value) VALUES (5, -0.7);
+-- Zařízení posílá desetiny °C:    INSERT INTO sensor_calibrations (sensor_id, scale) VALUES (6, 0.1);
+-- Zařízení posílá °F (-> °C):     INSERT INTO sensor_calibrations (sensor_id, scale, offset_value) VALUES (7, 0.5555556, -17.777778);
+
+-- ==========================================
+-- 12. Filtry špiček a odlehlých hodnot
+-- ==========================================
+-- Ingestor porovnává hodnotu (po kalibraci a min/max) s nedávnou historií senzoru v paměti.
+-- Každý filtr je aktivní, jen když má vyplněné parametry (NULL = vypnuto):
+--   rate:   max_rate_per_min                        - max. změna za minutu vůči poslední hodnotě
+--   median: median_window + median_max_deviation    - max. odchylka od mediánu posledních N hodnot
+--   zscore: zscore_window + zscore_threshold        - max. počet směrodatných odchylek od průměru okna
+-- action: 'drop' = hodnotu zahodit, 'flag' = jen zaznamenat a hodnotu propustit (ladění filtru).
+-- Po 5 odmítnutích v řadě Ingestor změnu přijme jako skutečnou (přesun senzoru, zapnuté topení).
+CREATE TABLE sensor_filters (
+    sensor_id INTEGER PRIMARY KEY REFERENCES sensors(id) ON DELETE CASCADE,
+    max_rate_per_min DOUBLE PRECISION CHECK (max_rate_per_min > 0),
+    median_window INTEGER CHECK (median_window BETWEEN 3 AND 100),
+    median_max_deviation DOUBLE PRECISION CHECK (median_max_deviation > 0),
+    zscore_window INTEGER CHECK (zscore_window BETWEEN 5 AND 1000),
+    zscore_threshold DOUBLE PRECISION CHECK (zscore_threshold > 0),
+    action VARCHAR(10) NOT NULL DEFAULT 'drop' CHECK (action IN ('drop', 'flag')),
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER update_sensor_filters_modtime
+    BEFORE UPDATE ON sensor_filters
+    FOR EACH ROW
+    EXECUTE FUNCTION update_modified_column();
+
+-- Audit rozhodnutí filtrů (zapisuje Ingestor dávkově).
+-- action: dropped = zahozeno, flagged = jen označeno, accepted = přijato po sérii odmítnutí
+CREATE TABLE filter_decisions (
+    id BIGSERIAL PRIMARY KEY,
+    sensor_id INTEGER NOT NULL REFERENCES sensors(id) ON DELETE CASCADE,
+    time TIMESTAMPTZ NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    filter VARCHAR(10) NOT NULL,          -- rate | median | zscore
+    action VARCHAR(10) NOT NULL,          -- dropped | flagged | accepted
+    reference_value DOUBLE PRECISION,     -- Poslední hodnota / medián / průměr okna
+    detail TEXT
+);
+CREATE INDEX idx_filter_decisions_sensor_time ON filter_decisions (sensor_id, time DESC);
+
+-- Příklad: teploměr se nemění rychleji než o 2 °C za minutu, špičky proti mediánu 5 hodnot > 3 °C pryč
+-- INSERT INTO sensor_filters (sensor_id, max_rate_per_min, median_window, median_max_deviation) VALUES (5, 2, 5, 3);
+
+-- ==========================================
+-- 13. Odmítnuté zprávy (dead-letter)
+-- ==========================================
+-- Ingestor sem ukládá zprávy, které neprošly validací, a zároveň je publikuje na
+-- DEADLETTER_TOPIC. Tabulku drží na DEADLETTER_MAX_ROWS nejnovějších řádků.
+-- reason: invalid_number | invalid_value | below_min | above_max
+-- Payload je BYTEA - zařízení může poslat cokoliv, i neplatné UTF-8.
+CREATE TABLE rejected_messages (
+    id BIGSERIAL PRIMARY KEY,
+    received_at TIMESTAMPTZ NOT NULL,
+    topic TEXT NOT NULL,
+    payload BYTEA NOT NULL,
+    sensor_id INTEGER REFERENCES sensors(id) ON DELETE SET NULL,
+    reason VARCHAR(20) NOT NULL,
+    detail TEXT,
+    resubmitted_at TIMESTAMPTZ             -- Kdy bylo naposledy požádáno o znovuzpracování
+);
+CREATE INDEX idx_rejected_messages_sensor ON rejected_messages (sensor_id, id DESC);
+CREATE INDEX idx_rejected_messages_reason ON rejected_messages (reason, id DESC);
+
+-- ==========================================
+-- 14. Deadband komprese historie
+-- ==========================================
+-- Data Persister ukládá do 'sensor_data' jen body, které se od posledního uloženého liší
+-- víc než o abs_threshold NEBO pct_threshold (% poslední uložené hodnoty), případně když od
+-- posledního uloženého bodu uplynulo max_silence_seconds (heartbeat). Před bodem se změnou
+-- uloží i poslední přeskočený bod, takže schodový graf zůstává správný.
+-- Nastavení lze zadat pro typ senzoru (sensor_type_id) nebo konkrétní senzor (sensor_id).
+-- Řádek senzoru má přednost před řádkem typu - i vypnutý (enabled = false) deadband pro senzor vypne.
+-- Bez obou prahů (0) se ukládá každá změna hodnoty + heartbeat.
+CREATE TABLE deadband_settings (
+    id SERIAL PRIMARY KEY,
+    sensor_type_id INTEGER UNIQUE REFERENCES sensor_types(id) ON DELETE CASCADE,
+    sensor_id INTEGER UNIQUE REFERENCES sensors(id) ON DELETE CASCADE,
+    abs_threshold DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (abs_threshold >= 0),
+    pct_threshold DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (pct_threshold >= 0),
+    max_silence_seconds INTEGER NOT NULL DEFAULT 900 CHECK (max_silence_seconds >= 0), -- 0 = bez heartbeatu
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    CHECK ((sensor_type_id IS NULL) <> (sensor_id IS NULL))   -- Právě jedno z nich
+);
+
+-- Úspora: denní počty přijatých a skutečně uložených bodů (zapisuje Data Persister).
+CREATE TABLE deadband_stats (
+    sensor_id INTEGER NOT NULL REFERENCES sensors(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    received BIGINT NOT NULL DEFAULT 0,
+    stored BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (sensor_id, day)
+);
+
+-- Příklady:
+-- Teploty: ukládat změnu o víc než 0.1 °C, jinak aspoň každých 15 minut
+-- INSERT INTO deadband_settings (sensor_type_id, abs_threshold, max_silence_seconds)
+-- SELECT id, 0.1, 900 FROM sensor_types WHERE name = 'temperature';
+-- Senzor 5 chceme ukládat celý:
+-- INSERT INTO deadband_settings (sensor_id, enabled) VALUES (5, false);
+
+-- ==========================================
+-- 15. Import historie (backfill)
+-- ==========================================
+-- Backfill (POST /api/backfill nebo 'home-api backfill') vkládá jen body, které pro daný senzor
+-- a čas v sensor_data ještě nejsou. Index zrychlí tuto kontrolu i běžné dotazy na historii senzoru.
+CREATE INDEX IF NOT EXISTS idx_sensor_data_sensor_time ON sensor_data (sensor_id, time DESC);
+
+-- Příklad (dry-run, časy bez zóny v pražském čase):
+--   curl -X POST --data-binary @logger.csv \
+--     'http://localhost:8880/api/backfill?sensor_topic=/msh/living/temp&timezone=Europe/Prague&dry_run=true'
+
+-- ==========================================
+-- 16. Zastaralé hodnoty (stale)
+-- ==========================================
+-- Home API u každého senzoru vrací 'last_seen' (čas měření poslední hodnoty) a 'is_stale'.
+-- Senzor je zastaralý, pokud poslední hodnota je starší než práh jeho typu; typ bez prahu
+-- (NULL) používá výchozí práh Home API (ENV STALE_AFTER, default 15 min).
+-- Poslední stav drží Valkey jako hash 'sensor:latest:{id}' (v, t, q, seq, s) - ne v této DB.
+ALTER TABLE sensor_types ADD COLUMN IF NOT EXISTS stale_after_seconds INTEGER
+    CHECK (stale_after_seconds > 0);
+
+-- Příklady:
+-- Metriky system-monitoru chodí každých pár sekund - po 2 minutách ticha je něco špatně
+-- UPDATE sensor_types SET stale_after_seconds = 120 WHERE name IN ('cpu_load', 'ram_usage', 'disk_usage');
+-- Spínače hlásí stav jen při změně - mohou mlčet celé dny
+-- UPDATE sensor_types SET stale_after_seconds = 7 * 24 * 3600 WHERE name = 'switch';
+
+-- ==========================================
+-- 17. Agregace historie a retence po vrstvách
+-- ==========================================
+-- Surová 'sensor_data' rostla donekonečna a dotaz na měsíc či rok procházel miliony řádků.
+-- Continuous aggregates drží předpočítané buckety (avg/min/max/počet) ve třech vrstvách.
+-- Každá vrstva má vlastní retenci - čím hrubší, tím déle:
+--
+--   vrstva            bucket    retence
+--   sensor_data       (surová)  90 dní
+--   sensor_data_5m    5 minut   1 rok
+--   sensor_data_1h    1 hodina  2 roky
+--   sensor_data_1d    1 den     navždy
+--
+-- Home API podle rozsahu a požadovaného rozlišení grafu samo vybere nejhrubší vrstvu, která
+-- stačí (a ještě má data). Retence v Home API (ENV RETENTION_RAW, RETENTION_5M, RETENTION_1H)
+-- MUSÍ odpovídat politikám níže, jinak API sáhne do vrstvy, kde už data nejsou.
+--
+-- Průměr je průměr ULOŽENÝCH bodů. U senzorů s deadband kompresí (sekce 14) je proto
+-- vychýlený k úsekům s častými změnami - pro časově vážený průměr slouží /api/sensors/{id}/stats.
+--
+-- materialized_only = false: dotaz na agregaci doplní ještě nezmaterializovaný konec
+-- ze surových dat (real-time aggregation), takže graf končí "teď", ne u posledního refreshe.
+-- Okna refreshe (start_offset) jsou kratší než retence surových dat - refresh tak nikdy
+-- nepřepočítá bucket, jehož surová data už retence smazala.
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS sensor_data_5m
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT time_bucket(INTERVAL '5 minutes', time) AS bucket,
+       sensor_id,
+       avg(value) AS avg_value,
+       min(value) AS min_value,
+       max(value) AS max_value,
+       count(*)   AS sample_count
+FROM sensor_data
+GROUP BY bucket, sensor_id
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS sensor_data_1h
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT time_bucket(INTERVAL '1 hour', time) AS bucket,
+       sensor_id,
+       avg(value) AS avg_value,
+       min(value) AS min_value,
+       max(value) AS max_value,
+       count(*)   AS sample_count
+FROM sensor_data
+GROUP BY bucket, sensor_id
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS sensor_data_1d
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT time_bucket(INTERVAL '1 day', time) AS bucket,
+       sensor_id,
+       avg(value) AS avg_value,
+       min(value) AS min_value,
+       max(value) AS max_value,
+       count(*)   AS sample_count
+FROM sensor_data
+GROUP BY bucket, sensor_id
+WITH NO DATA;
+
+-- Refresh: jak často a jak daleko zpět se agregace přepočítávají.
+-- end_offset nechává poslední (neúplný) bucket real-time agregaci.
+SELECT add_continuous_aggregate_policy('sensor_data_5m',
+    start_offset => INTERVAL '3 days', end_offset => INTERVAL '5 minutes',
+    schedule_interval => INTERVAL '5 minutes', if_not_exists => TRUE);
+SELECT add_continuous_aggregate_policy('sensor_data_1h',
+    start_offset => INTERVAL '7 days', end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '1 hour', if_not_exists => TRUE);
+SELECT add_continuous_aggregate_policy('sensor_data_1d',
+    start_offset => INTERVAL '30 days', end_offset => INTERVAL '1 day',
+    schedule_interval => INTERVAL '1 day', if_not_exists => TRUE);
+
+-- Retence po vrstvách (sensor_data_1d bez retence = navždy)
+SELECT add_retention_policy('sensor_data', INTERVAL '90 days', if_not_exists => TRUE);
+SELECT add_retention_policy('sensor_data_5m', INTERVAL '1 year', if_not_exists => TRUE);
+SELECT add_retention_policy('sensor_data_1h', INTERVAL '2 years', if_not_exists => TRUE);
+
+-- Po importu starých dat (backfill, sekce 15) mimo okno refreshe je nutné agregace
+-- přepočítat ručně, jinak import uvidí jen surová data. U dat starších než retence surové
+-- vrstvy (90 dní) hned po importu - při dalším běhu je retence smaže a v agregacích zůstanou
+-- jen tehdy, pokud se do nich předtím přepočítaly:
+--   CALL refresh_continuous_aggregate('sensor_data_5m', '2024-01-01', '2024-02-01');
+--   CALL refresh_continuous_aggregate('sensor_data_1h', '2024-01-01', '2024-02-01');
+--   CALL refresh_continuous_aggregate('sensor_data_1d', '2024-01-01', '2024-02-01');
+
+-- ==========================================
+-- 18. Nečíselné hodnoty (boolean, enum, text, geo)
+-- ==========================================
+-- value_kind určuje, jak ingestor čte payload a kam se hodnota ukládá:
+--   number  - číslo do 'sensor_data' (výchozí, vše dosavadní)
+--   boolean - true/false, on/off, 1/0, open/closed...
+--   enum    - jeden ze stavů v enum_values (např. stav alarmu)
+--   text    - volný text (verze firmware)
+--   geo     - poloha: JSON {"lat":..,"lon":..,"alt":..,"acc":..} nebo "lat,lon[,alt]"
+-- Nečíselné hodnoty jdou do hypertabulky 'sensor_states' (agregace ze sekce 17 se jich netýkají).
+-- Neplatná hodnota (neznámý stav, špatné souřadnice) skončí v rejected_messages s reason 'invalid_value'.
+ALTER TABLE sensor_types ADD COLUMN IF NOT EXISTS value_kind VARCHAR(10) NOT NULL DEFAULT 'number'
+    CHECK (value_kind IN ('number', 'boolean', 'enum', 'text', 'geo'));
+ALTER TABLE sensor_types ADD COLUMN IF NOT EXISTS enum_values TEXT[];   -- Jen pro value_kind = 'enum'
+
+-- Vyplněné jsou jen sloupce odpovídající druhu (kind je druh typu v době zápisu).
+CREATE TABLE IF NOT EXISTS sensor_states (
+    time TIMESTAMPTZ NOT NULL,
+    sensor_id INTEGER NOT NULL REFERENCES sensors(id),
+    kind VARCHAR(10) NOT NULL,
+    value_bool BOOLEAN,                -- boolean
+    value_text TEXT,                   -- enum, text
+    latitude DOUBLE PRECISION,         -- geo (WGS84)
+    longitude DOUBLE PRECISION,
+    altitude DOUBLE PRECISION,         -- m, volitelné
+    accuracy DOUBLE PRECISION          -- m, volitelné
+);
+SELECT create_hypertable('sensor_states', 'time', if_not_exists => TRUE);
+CREATE INDEX IF NOT EXISTS idx_sensor_states_sensor_time ON sensor_states (sensor_id, time DESC);
+SELECT add_retention_policy('sensor_states', INTERVAL '2 years', if_not_exists => TRUE);
+
+-- Příklady:
+INSERT INTO sensor_types (name, unit, description, value_kind) VALUES
+('contact', NULL, 'Dveřní/okenní kontakt (otevřeno/zavřeno)', 'boolean'),
+('firmware', NULL, 'Verze firmware zařízení', 'text'),
+('location', NULL, 'GPS poloha', 'geo')
+ON CONFLICT (name) DO NOTHING;
+INSERT INTO sensor_types (name, unit, description, value_kind, enum_values) VALUES
+('alarm_state', NULL, 'Stav zabezpečení', 'enum', ARRAY['disarmed', 'armed_home', 'armed_away', 'triggered'])
+ON CONFLICT (name) DO NOTHING;
+-- INSERT INTO sensors (sensor_type_id, mqtt_topic, friendly_name)
+-- SELECT id, '/msh/car/location', 'Auto' FROM sensor_types WHERE name = 'location';
+
+-- ==========================================
+-- 19. Počítadla a spotřeba (vodoměr, elektroměr, pulzy)
+-- ==========================================
+-- Typ s is_counter posílá KUMULATIVNÍ stav počítadla. Home API z rozdílů odečtů počítá spotřebu
+-- po hodinách/dnech/týdnech/měsících (GET /api/sensors/{id}/consumption, viz consumption.go):
+--   - pokles do 10 % = šum odečtu (nepočítá se),
+--   - pokles z horní čtvrtiny rozsahu do dolní čtvrtiny u typu s counter_max = přetečení
+--     (např. 16bit čítač 65536),
+--   - jiný pokles = reset počítadla (restart zařízení, počítá se od nuly).
+-- Čítač pulzů převedete na litry/kWh kalibrací (sekce 11, scale = jednotek na pulz);
+-- counter_max je pak v jednotce PO kalibraci. Filtry špiček (sekce 12) počítadlům nenastavujte -
+-- reset by zahodily jako špičku.
+ALTER TABLE sensor_types ADD COLUMN IF NOT EXISTS is_counter BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE sensor_types ADD COLUMN IF NOT EXISTS counter_max DOUBLE PRECISION
+    CHECK (counter_max > 0);   -- Hodnota, po které počítadlo přeteče na 0; NULL = nepřetéká
+
+-- Tarify (volitelné): cena za jednotku spotřeby senzoru. Tarify se NEPŘEPISUJÍ - změna ceny
+-- = nový řádek s novým effective_from (jako kalibrace). Úsek spotřeby se ocení tarifem
+-- platným na jeho začátku.
+CREATE TABLE IF NOT EXISTS meter_tariffs (
+    id SERIAL PRIMARY KEY,
+    sensor_id INTEGER NOT NULL REFERENCES sensors(id) ON DELETE CASCADE,
+    effective_from TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    price_per_unit NUMERIC(12, 6) NOT NULL CHECK (price_per_unit >= 0),  -- Cena za jednotku typu (např. Kč/l)
+    currency VARCHAR(3) NOT NULL DEFAULT 'CZK',
+    UNIQUE (sensor_id, effective_from)
+);
+
+-- Příklady:
+-- Vodoměr posílá litry a po restartu počítá od nuly
+UPDATE sensor_types SET is_counter = true WHERE name = 'volume';
+-- Voda za 140 Kč/m³ = 0.14 Kč/l
+-- INSERT INTO meter_tariffs (sensor_id, effective_from, price_per_unit)
+-- SELECT id, '2026-01-01', 0.14 FROM sensors WHERE mqtt_topic = '/msh/water/main';
+-- Čítač pulzů (1 pulz = 0.5 l) v 16bit registru: přeteče po 65536 pulzech = 32768 l
+-- INSERT INTO sensor_types (name, unit, description, is_counter, counter_max)
+-- VALUES ('water_pulses', 'l', 'Vodoměr s pulzním výstupem', true, 32768);
+
+-- ==========================================
+-- 20. Časové transformace (integrál, derivace)
+-- ==========================================
+-- Jako virtuální senzor (sekce 10): výstup je běžný senzor s vlastním topicem a typem (jednotkou),
+-- hodnotu počítá služba virtual-sensors. Na rozdíl od výrazu pracuje s ČASEM mezi měřeními zdroje:
+--   integral   - lichoběžníkový součet: energie z výkonu, objem z průtoku (výstup = počítadlo)
+--   derivative - změna za jednotku času: průtok z vodoměru, výkon z elektroměru
+-- time_unit_seconds: jednotka času výsledku (3600 = za hodinu, 60 = za minutu)
+-- factor:            převod jednotky (W -> kWh: time_unit 3600, factor 0.001)
+-- max_gap_seconds:   delší mezera mezi body zdroje se nepočítá (senzor byl offline) - integrál
+--                    na dalším bodu naváže, derivace čeká na další bod
+-- Integrál po restartu služby navazuje na poslední uloženou hodnotu výstupu.
+CREATE TABLE IF NOT EXISTS sensor_transforms (
+    sensor_id INTEGER PRIMARY KEY REFERENCES sensors(id) ON DELETE CASCADE,   -- Výstup
+    source_sensor_id INTEGER NOT NULL REFERENCES sensors(id) ON DELETE CASCADE,
+    kind VARCHAR(10) NOT NULL CHECK (kind IN ('integral', 'derivative')),
+    time_unit_seconds INTEGER NOT NULL DEFAULT 3600 CHECK (time_unit_seconds > 0),
+    factor DOUBLE PRECISION NOT NULL DEFAULT 1,
+    max_gap_seconds INTEGER NOT NULL DEFAULT 600 CHECK (max_gap_seconds > 0),
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (sensor_id <> source_sensor_id)
+);
+
+INSERT INTO sensor_types (name, unit, description, is_counter) VALUES
+('power', 'W', 'Okamžitý výkon', false),
+('energy', 'kWh', 'Spotřebovaná energie (počítadlo)', true),
+('flow', 'l/min', 'Okamžitý průtok', false)
+ON CONFLICT (name) DO NOTHING;
+
+-- Příklady:
+-- Energie v kWh z výkonu zásuvky ve W (odečty nejvýše 5 minut od sebe)
+-- INSERT INTO sensors (sensor_type_id, mqtt_topic, friendly_name)
+-- SELECT id, '/msh/virtual/washer/energy', 'Pračka - energie' FROM sensor_types WHERE name = 'energy';
+-- INSERT INTO sensor_transforms (sensor_id, source_sensor_id, kind, time_unit_seconds, factor, max_gap_seconds)
+-- SELECT o.id, s.id, 'integral', 3600, 0.001, 300
+-- FROM sensors o, sensors s WHERE o.mqtt_topic = '/msh/virtual/washer/energy' AND s.mqtt_topic = '/msh/washer/power';
+-- Průtok v l/min z vodoměru v litrech
+-- INSERT INTO sensors (sensor_type_id, mqtt_topic, friendly_name)
+-- SELECT id, '/msh/virtual/water/flow', 'Průtok vody' FROM sensor_types WHERE name = 'flow';
+-- INSERT INTO sensor_transforms (sensor_id, source_sensor_id, kind, time_unit_seconds, max_gap_seconds)
+-- SELECT o.id, s.id, 'derivative', 60, 900
+-- FROM sensors o, sensors s WHERE o.mqtt_topic = '/msh/virtual/water/flow' AND s.mqtt_topic = '/msh/water/main';
+
+-- ==========================================
+-- 21. Zařízení (dostupnost, baterie, signál)
+-- ==========================================
+-- Fyzické zařízení (např. ESP32 se čtyřmi senzory) - senzory na něj odkazují přes sensors.device_id.
+-- Dostupnost: zařízení publikuje 'online' na availability_topic a při připojení si u brokeru nastaví
+-- Last Will (LWT) 'offline' - broker ho odešle sám, když spojení vypadne. Ingestor topic poslouchá
+-- (retained zprávu dostane hned po startu) a stav zapisuje do sloupců online/status_changed_at.
+-- Zařízení bez availability_topic posoudí Home API podle senzorů (online = některý senzor není zastaralý).
+-- Diagnostika: baterie, signál WiFi a firmware se plní z topiců v device_diagnostics (viz níže).
+-- Zařízení se může přihlásit samo (objekt "device" v registraci, viz sensor-ingestor/registry.go).
+CREATE TABLE IF NOT EXISTS devices (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) UNIQUE NOT NULL,              -- Identifikátor zařízení (hostname, MAC, ...)
+    friendly_name VARCHAR(100),
+    model VARCHAR(100),
+    location VARCHAR(100),
+    availability_topic VARCHAR(255) UNIQUE,         -- NULL = dostupnost podle senzorů
+    payload_online VARCHAR(50) NOT NULL DEFAULT 'online',
+    payload_offline VARCHAR(50) NOT NULL DEFAULT 'offline',
+    online BOOLEAN,                                 -- NULL = zatím nevíme
+    status_changed_at TIMESTAMPTZ,
+    battery_voltage DOUBLE PRECISION,               -- V
+    rssi DOUBLE PRECISION,                          -- dBm
+    firmware VARCHAR(100),
+    diagnostics_updated_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE sensors ADD COLUMN IF NOT EXISTS device_id INTEGER REFERENCES devices(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_sensors_device ON sensors (device_id);
+
+-- Diagnostické topicy: hodnota je celý payload, nebo pole JSONu podle json_path (klíče oddělené
+-- tečkou, např. Tasmota 'tele/<zařízení>/STATE' -> 'Wifi.Signal'). Topic může být i běžný senzor
+-- (baterie jako senzor s historií) - ingestor ho pak zpracuje oběma způsoby.
+CREATE TABLE IF NOT EXISTS device_diagnostics (
+    device_id INTEGER NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    field VARCHAR(10) NOT NULL CHECK (field IN ('battery', 'rssi', 'firmware')),
+    mqtt_topic VARCHAR(255) NOT NULL,
+    json_path VARCHAR(100),                         -- NULL = celý payload
+    PRIMARY KEY (device_id, field)
+);
+
+-- Příklady:
+-- ESP32 v obýváku s LWT a diagnostikou v jednom JSONu
+-- INSERT INTO devices (name, friendly_name, model, location, availability_topic)
+-- VALUES ('esp32-obyvak', 'Čidla obývák', 'ESP32-WROOM', 'Obývák', '/msh/esp32-obyvak/status');
+-- INSERT INTO device_diagnostics (device_id, field, mqtt_topic, json_path)
+-- SELECT id, f.field, '/msh/esp32-obyvak/diag', f.path
+-- FROM devices, (VALUES ('battery', 'battery'), ('rssi', 'wifi.rssi'), ('firmware', 'version')) AS f(field, path)
+-- WHERE name = 'esp32-obyvak';
+-- UPDATE sensors SET device_id = (SELECT id FROM devices WHERE name = 'esp32-obyvak')
+-- WHERE mqtt_topic LIKE '/msh/esp32-obyvak/%';
+--
+-- Sparkplug B uzel (bez SPARKPLUG_AUTO_REGISTER): metriky mají kanonický topic bez typu zprávy
+-- (spBv1.0/<group>/<edge_node>[/<device>]/<metrika>), dostupnost hlásí ingestor z BIRTH/DEATH
+-- na <kanonický topic uzlu>/$state - viz sensor-ingestor/sparkplug.go
+-- INSERT INTO devices (name, friendly_name, model, availability_topic)
+-- VALUES ('spBv1.0/plant1/plc1', 'PLC hala 1', 'Sparkplug B', 'spBv1.0/plant1/plc1/$state');
+-- UPDATE sensors SET device_id = (SELECT id FROM devices WHERE name = 'spBv1.0/plant1/plc1')
+-- WHERE mqtt_topic LIKE 'spBv1.0/plant1/plc1/%';
+
+-- Jednotky ze Sparkplug (vlastnost engUnit) bývají delší než značky typu '°C'. Ingestor je při
+-- automatické registraci ořízne na 50 znaků (sparkplug.go, spMaxUnit) - sloupec musí stačit.
+ALTER TABLE sensor_types ALTER COLUMN unit TYPE VARCHAR(50);
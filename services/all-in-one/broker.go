@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"sync"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	mqttserver "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+)
+
+// inprocBrokerURL je jen formální adresa pro paho klienty služeb.
+// Skutečné spojení otevírá Broker.Connect (v paměti), takže na hostname nezáleží.
+const inprocBrokerURL = "tcp://all-in-one:1883"
+
+// Broker je vestavěný MQTT broker (mochi-mqtt) nahrazující samostatný Mosquitto.
+// Má dva vstupy:
+//   - TCP listener pro zařízení (ESP, Tasmota, system-monitor na jiném stroji...),
+//   - listener v paměti pro služby v tomto procesu (bez TCP, bez portu).
+//
+// Služby pořád mluví plnohodnotným MQTT (QoS, retained, reconnect), jen "drát" je net.Pipe.
+type Broker struct {
+	server *mqttserver.Server
+	inproc *memListener
+}
+
+// StartBroker vytvoří broker, zaregistruje listenery a spustí je (neblokuje).
+func StartBroker(listenAddr string, logger *slog.Logger) (*Broker, error) {
+	server := mqttserver.New(&mqttserver.Options{Logger: logger})
+
+	// Autentizaci neřešíme (stejně jako výchozí Mosquitto v docker-compose) - povolíme vše.
+	if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+		return nil, fmt.Errorf("auth hook: %w", err)
+	}
+
+	b := &Broker{server: server, inproc: newMemListener()}
+	if err := server.AddListener(listeners.NewNet("inproc", b.inproc)); err != nil {
+		return nil, fmt.Errorf("listener v paměti: %w", err)
+	}
+	if listenAddr != "" {
+		tcp := listeners.NewTCP(listeners.Config{ID: "tcp", Address: listenAddr})
+		if err := server.AddListener(tcp); err != nil {
+			return nil, fmt.Errorf("TCP listener %s: %w", listenAddr, err)
+		}
+	}
+
+	// Serve spustí listenery v goroutinách a hned se vrátí.
+	if err := server.Serve(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Connect má signaturu mqtt.OpenConnectionFunc - předává se službám v Config.MQTTConnect.
+// Paho místo vytáčení TCP dostane konec roury, jejíž druhý konec obslouží broker.
+func (b *Broker) Connect(_ *url.URL, _ mqtt.ClientOptions) (net.Conn, error) {
+	return b.inproc.Dial()
+}
+
+// Close odpojí všechny klienty a zastaví listenery. Volat až po ukončení služeb.
+func (b *Broker) Close() error {
+	return b.server.Close()
+}
+
+// memListener je net.Listener bez sítě: Dial vytvoří net.Pipe a jeden konec předá Accept.
+type memListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newMemListener() *memListener {
+	return &memListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+// Dial otevře nové spojení k brokeru (volá paho při Connect i při reconnectu).
+func (l *memListener) Dial() (net.Conn, error) {
+	server, client := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *memListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *memListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *memListener) Addr() net.Addr { return memAddr{} }
+
+// memAddr je adresa listeneru v paměti (jen pro logy brokeru).
+type memAddr struct{}
+
+func (memAddr) Network() string { return "memory" }
+func (memAddr) String() string  { return "inproc" }
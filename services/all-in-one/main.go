@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	persister "data-persister"
+	homeapi "home-api"
+	logcollector "log-collector"
+	ingestor "sensor-ingestor"
+	"storage"
+	sysmonitor "system-monitor"
+	dashboard "web-dashboard"
+)
+
+// All-in-one: celý základní stack v JEDNÉ binárce (např. Raspberry Pi bez Dockeru).
+// Běží zde sensor-ingestor, data-persister, home-api, web-dashboard, system-monitor
+// a log-collector jako goroutiny + vestavěný MQTT broker místo Mosquitta.
+// Zvenku jsou potřeba jen TimescaleDB a Valkey - s STORAGE_BACKEND=bolt ani ty ne
+// (data v jednom souboru, viz balíček storage).
+//
+// Propojení uvnitř procesu:
+//   - služby <-> broker: MQTT spojení v paměti (net.Pipe), viz broker.go
+//   - dashboard -> Home API: přímé volání http.Handleru (bez sítě)
+func main() {
+	// 1. Logger - každá služba dostane vlastní atribut "service", ať jdou logy rozlišit
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	slog.SetDefault(logger)
+	serviceLogger := func(name string) *slog.Logger { return logger.With("service", name) }
+
+	cfg := LoadConfig()
+	logger.Info("Startuji all-in-one", "config", cfg)
+
+	// 2. Context zrušený signálem SIGINT (Ctrl+C) nebo SIGTERM (docker stop)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// 3. Vestavěný MQTT broker (musí běžet dřív než jakákoli služba)
+	broker, err := StartBroker(cfg.MQTTListen, serviceLogger("mqtt-broker"))
+	if err != nil {
+		logger.Error("Kritická chyba: Nelze spustit MQTT broker", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("MQTT broker běží", "listen", cfg.MQTTListen)
+
+	// 3b. Vestavěné úložiště (STORAGE_BACKEND=bolt) - jedna instance pro všechny služby,
+	// soubor bbolt smí mít otevřený jen jeden proces. S Postgres si spojení otevírá každá služba sama.
+	var store storage.Store
+	switch cfg.StorageBackend {
+	case storage.BackendPostgres:
+	case storage.BackendBolt:
+		store, err = storage.Open(ctx, storage.Options{
+			Backend:   storage.BackendBolt,
+			BoltPath:  cfg.BoltPath,
+			Retention: cfg.Retention,
+		})
+		if err != nil {
+			logger.Error("Kritická chyba: Nelze otevřít vestavěné úložiště", "path", cfg.BoltPath, "error", err)
+			broker.Close()
+			os.Exit(1)
+		}
+		logger.Info("Vestavěné úložiště otevřeno", "path", cfg.BoltPath, "retention", cfg.Retention)
+		cfg.PostgresURL, cfg.ValkeyAddr = "", "" // Služby nesmí zkoušet TimescaleDB ani Valkey
+	default:
+		logger.Error("Kritická chyba: Neznámý STORAGE_BACKEND (povoleno: postgres, bolt)", "backend", cfg.StorageBackend)
+		broker.Close()
+		os.Exit(1)
+	}
+
+	// 4. Konfigurace služeb
+	// Každá služba si načte svoje ENV jako obvykle, pak přepíšeme sdílené hodnoty.
+
+	ingestorCfg := ingestor.LoadConfig()
+	ingestorCfg.MQTTBroker, ingestorCfg.MQTTClientID, ingestorCfg.MQTTConnect = inprocBrokerURL, "sensor-ingestor", broker.Connect
+	ingestorCfg.InputTopic = cfg.SensorTopic
+	ingestorCfg.OutputTopic = cfg.EventsTopic
+	ingestorCfg.PostgresURL = cfg.PostgresURL
+	ingestorCfg.Store = store
+	ingestorCfg.HTTPPort = "" // Health server nepotřebujeme - /health má Home API i dashboard
+
+	persisterCfg := persister.LoadConfig()
+	persisterCfg.MQTTBroker, persisterCfg.MQTTClientID, persisterCfg.MQTTConnect = inprocBrokerURL, "data-persister", broker.Connect
+	persisterCfg.InputTopic = cfg.EventsTopic
+	persisterCfg.PostgresURL = cfg.PostgresURL
+	persisterCfg.ValkeyAddr = cfg.ValkeyAddr
+	persisterCfg.Store = store
+	persisterCfg.HTTPPort = "" // Health servery služeb by se praly o port - /health má Home API i dashboard
+
+	apiCfg := homeapi.LoadConfig()
+	apiCfg.MQTTBroker, apiCfg.MQTTClientID, apiCfg.MQTTConnect = inprocBrokerURL, "home-api", broker.Connect
+	apiCfg.PostgresURL = cfg.PostgresURL
+	apiCfg.ValkeyAddr = cfg.ValkeyAddr
+	apiCfg.Store = store
+	apiCfg.HTTPPort = cfg.APIPort
+	apiCfg.ResubmitTopic = ingestorCfg.ResubmitTopic
+	if store != nil {
+		apiCfg.RetentionRaw = cfg.Retention // Vestavěné úložiště má jen surová data s vlastní retencí
+	}
+
+	monitorCfg := sysmonitor.LoadConfig()
+	monitorCfg.MQTTBroker, monitorCfg.MQTTClientID, monitorCfg.MQTTConnect = inprocBrokerURL, "system-monitor-"+monitorCfg.Host, broker.Connect
+	monitorCfg.RegistryTopic = ingestorCfg.RegistryTopic
+	monitorCfg.HTTPPort = ""
+
+	collectorCfg := logcollector.LoadConfig()
+	collectorCfg.MQTTBroker, collectorCfg.MQTTClientID, collectorCfg.MQTTConnect = inprocBrokerURL, "log-collector", broker.Connect
+	collectorCfg.LogDir = cfg.LogDir
+	collectorCfg.HTTPPort = ""
+
+	// 5. Home API sestavíme předem - dashboard potřebuje jeho handler (volání v paměti)
+	api, err := homeapi.New(ctx, apiCfg, serviceLogger("home-api"))
+	if err != nil {
+		logger.Error("Kritická chyba: Nelze spustit Home API", "error", err)
+		closeStore(store, logger)
+		broker.Close()
+		os.Exit(1)
+	}
+
+	dashboardCfg := dashboard.LoadConfig()
+	dashboardCfg.HTTPPort = cfg.DashboardPort
+	dashboardCfg.APIURL = "http://home-api" // Jen základ URL - požadavky jdou přímo do handleru
+	dashboardCfg.APIHandler = api.Handler()
+	dashboardCfg.MQTTBroker, dashboardCfg.MQTTClientID, dashboardCfg.MQTTConnect = inprocBrokerURL, "web-dashboard", broker.Connect
+
+	// 6. Spuštění služeb
+	// Selhání jedné služby ukončí celý proces (stejně jako spadlý kontejner) - supervisor
+	// (systemd, Docker) ho pak restartuje celý, místo aby běžel napůl.
+	svcCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var failedMu sync.Mutex
+	failed := false
+	start := func(name string, run func(ctx context.Context) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := run(svcCtx); err != nil {
+				logger.Error("Služba selhala, ukončuji vše", "service", name, "error", err)
+				failedMu.Lock()
+				failed = true
+				failedMu.Unlock()
+				cancel()
+			}
+		}()
+	}
+
+	start("sensor-ingestor", func(ctx context.Context) error {
+		return ingestor.Run(ctx, ingestorCfg, serviceLogger("sensor-ingestor"))
+	})
+	start("data-persister", func(ctx context.Context) error {
+		return persister.Run(ctx, persisterCfg, serviceLogger("data-persister"))
+	})
+	start("home-api", api.Serve)
+	start("web-dashboard", func(ctx context.Context) error {
+		return dashboard.Run(ctx, dashboardCfg, serviceLogger("web-dashboard"))
+	})
+	start("system-monitor", func(ctx context.Context) error {
+		return sysmonitor.Run(ctx, monitorCfg, serviceLogger("system-monitor"))
+	})
+	start("log-collector", func(ctx context.Context) error {
+		return logcollector.Run(ctx, collectorCfg, serviceLogger("log-collector"))
+	})
+
+	// 7. Čekáme na signál (nebo selhání služby)
+	<-svcCtx.Done()
+	logger.Info("Ukončuji all-in-one...")
+
+	// 8. Jedna sekvence ukončení:
+	//    a) služby doběhnou (persister uloží čekající body deadbandu, ingestor flushne buffery)
+	//       - broker při tom ještě běží, takže odhlášení a poslední publikace projdou,
+	//    b) zavřeme Home API (DB, Valkey, MQTT) a vestavěné úložiště,
+	//    c) nakonec broker.
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(cfg.ShutdownTimeout):
+		logger.Warn("Služby nedoběhly v časovém limitu, končím natvrdo", "timeout", cfg.ShutdownTimeout)
+	}
+
+	api.Close()
+	closeStore(store, logger)
+	broker.Close()
+	logger.Info("All-in-one ukončen")
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// closeStore zavře vestavěné úložiště (nil = služby používají TimescaleDB, nic nezavíráme).
+func closeStore(store storage.Store, logger *slog.Logger) {
+	if store == nil {
+		return
+	}
+	if err := store.Close(); err != nil {
+		logger.Error("Zavření vestavěného úložiště selhalo", "error", err)
+	}
+}
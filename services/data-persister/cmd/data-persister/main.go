@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	persister "data-persister"
+)
+
+// Samostatná binárka služby Data Persister (Docker image).
+// Veškerá logika je v balíčku persister - stejný kód běží i v režimu all-in-one.
+func main() {
+	// 1. Logger (JSON na stdout - standard pro kontejnery)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	slog.SetDefault(logger)
+
+	// 2. Context zrušený signálem SIGINT (Ctrl+C) nebo SIGTERM (Docker stop) = graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// 3. Běh služby (blokuje do signálu)
+	if err := persister.Run(ctx, persister.LoadConfig(), logger); err != nil {
+		logger.Error("Kritická chyba", "error", err)
+		os.Exit(1)
+	}
+}
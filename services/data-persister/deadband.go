@@ -0,0 +1,182 @@
+package persister
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// --- DEADBAND KOMPRESE ---
+// Senzor, který každých 5 sekund posílá stejných 21.0 °C, by do 'sensor_data' zapsal
+// 17 280 téměř identických řádků denně. Deadband ukládá bod jen tehdy, když:
+//   - se hodnota od posledního ULOŽENÉHO bodu změnila víc než o absolutní práh
+//     (abs_threshold) nebo o procentní práh (pct_threshold), nebo
+//   - od posledního uloženého bodu uplynul "heartbeat" (max_silence) - graf tak ví,
+//     že senzor žije a hodnota se opravdu nemění.
+//
+// "Lossless-aware": Před bodem, který změnu přinesl, uložíme i poslední přeskočený bod.
+// Schodový graf pak drží starou hodnotu až do okamžiku těsně před změnou, místo aby
+// čáru vedl šikmo přes celou tichou periodu.
+//
+// Nečíselné senzory (SensorEvent.State) prahy nepoužívají - uloží se každá změna stavu
+// a heartbeat.
+//
+// Aktuální hodnota ve Valkey se aktualizuje vždy - deadband se týká jen historie.
+
+// DeadbandConfig je nastavení pro jeden senzor (tabulka 'deadband_settings').
+// Nulový práh = tato podmínka se nepoužije. Bez obou prahů se ukládá každá změna hodnoty.
+type DeadbandConfig struct {
+	AbsThreshold float64
+	PctThreshold float64       // V procentech poslední uložené hodnoty
+	MaxSilence   time.Duration // 0 = bez heartbeatu
+}
+
+// deadbandState je stav jednoho senzoru.
+type deadbandState struct {
+	stored  SensorEvent  // Poslední uložený bod
+	pending *SensorEvent // Poslední přeskočený bod (nil = žádný)
+}
+
+// DeadbandStats jsou počty bodů jednoho senzoru od posledního zápisu statistik.
+type DeadbandStats struct {
+	Received int64
+	Stored   int64
+}
+
+// Deadband rozhoduje, které body uložit. Bezpečné pro souběžné volání.
+type Deadband struct {
+	mu      sync.Mutex
+	configs map[int64]DeadbandConfig // sensor_id -> nastavení (chybí = ukládá se vše)
+	states  map[int64]*deadbandState
+	stats   map[int64]*DeadbandStats
+}
+
+// NewDeadband - konstruktor
+func NewDeadband() *Deadband {
+	return &Deadband{
+		configs: make(map[int64]DeadbandConfig),
+		states:  make(map[int64]*deadbandState),
+		stats:   make(map[int64]*DeadbandStats),
+	}
+}
+
+// SetConfigs vymění nastavení (po načtení z DB). Stav senzorů zůstává - nový práh
+// se uplatní od dalšího bodu. Senzoru s vypnutým deadbandem se případný čekající bod
+// uloží spolu s jeho dalším bodem (viz decide).
+func (d *Deadband) SetConfigs(configs map[int64]DeadbandConfig) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.configs = configs
+}
+
+// Process vrátí body, které se mají uložit do historie (0, 1 nebo 2 body v časovém pořadí).
+func (d *Deadband) Process(event SensorEvent) []SensorEvent {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stats := d.statsFor(event.SensorID)
+	stats.Received++
+
+	out := d.decide(event)
+	stats.Stored += int64(len(out))
+	return out
+}
+
+// decide je jádro rozhodování. Volat pod zámkem.
+func (d *Deadband) decide(event SensorEvent) []SensorEvent {
+	cfg, enabled := d.configs[event.SensorID]
+	st, known := d.states[event.SensorID]
+
+	if !enabled {
+		// Deadband vypnutý - uložíme vše. Případný čekající bod z doby, kdy byl zapnutý, pošleme první.
+		if known {
+			delete(d.states, event.SensorID)
+			if st.pending != nil {
+				return []SensorEvent{*st.pending, event}
+			}
+		}
+		return []SensorEvent{event}
+	}
+
+	if !known {
+		// První bod senzoru (nebo po restartu) ukládáme vždy.
+		d.states[event.SensorID] = &deadbandState{stored: event}
+		return []SensorEvent{event}
+	}
+
+	// Bod starší než poslední uložený (např. znovu odeslaná zpráva z dead-letteru)
+	// uložíme bez vlivu na stav - deadband pracuje jen s tokem "vpřed".
+	if event.Timestamp.Before(st.stored.Timestamp) {
+		return []SensorEvent{event}
+	}
+
+	var changed bool
+	if event.State != nil || st.stored.State != nil {
+		// Nečíselný stav (boolean, enum, text, geo): prahy nedávají smysl, ukládá se každá změna.
+		changed = !event.State.Equal(st.stored.State)
+	} else {
+		delta := math.Abs(event.Value - st.stored.Value)
+		changed = (cfg.AbsThreshold > 0 && delta > cfg.AbsThreshold) ||
+			(cfg.PctThreshold > 0 && delta > math.Abs(st.stored.Value)*cfg.PctThreshold/100) ||
+			(cfg.AbsThreshold == 0 && cfg.PctThreshold == 0 && delta > 0) // Bez prahů = ukládat jen změny
+	}
+	heartbeat := cfg.MaxSilence > 0 && event.Timestamp.Sub(st.stored.Timestamp) >= cfg.MaxSilence
+
+	switch {
+	case changed:
+		out := make([]SensorEvent, 0, 2)
+		if st.pending != nil {
+			out = append(out, *st.pending) // Konec "ploché" části před změnou
+		}
+		out = append(out, event)
+		st.stored, st.pending = event, nil
+		return out
+	case heartbeat:
+		st.stored, st.pending = event, nil
+		return []SensorEvent{event}
+	default:
+		p := event
+		st.pending = &p
+		return nil
+	}
+}
+
+// FlushPending vrátí (a zapomene) všechny čekající přeskočené body.
+// Volá se při ukončení služby, aby se neztratil konec ploché části.
+func (d *Deadband) FlushPending() []SensorEvent {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var out []SensorEvent
+	for id, st := range d.states {
+		if st.pending != nil {
+			out = append(out, *st.pending)
+			d.statsFor(id).Stored++
+			st.stored, st.pending = *st.pending, nil
+		}
+	}
+	return out
+}
+
+// TakeStats vrátí nasbírané počty a vynuluje je.
+func (d *Deadband) TakeStats() map[int64]DeadbandStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := make(map[int64]DeadbandStats, len(d.stats))
+	for id, s := range d.stats {
+		out[id] = *s
+	}
+	d.stats = make(map[int64]*DeadbandStats)
+	return out
+}
+
+// statsFor vrátí počitadla senzoru (založí je). Volat pod zámkem.
+func (d *Deadband) statsFor(sensorID int64) *DeadbandStats {
+	s, ok := d.stats[sensorID]
+	if !ok {
+		s = &DeadbandStats{}
+		d.stats[sensorID] = s
+	}
+	return s
+}
@@ -15,8 +15,21 @@ require (
 	github.com/jackc/pgpassfile v1.0.0 // indirect
 	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
 	github.com/jackc/puddle/v2 v2.2.2 // indirect
+	go.etcd.io/bbolt v1.4.3 // indirect
 	golang.org/x/crypto v0.42.0 // indirect
 	golang.org/x/net v0.44.0 // indirect
 	golang.org/x/sync v0.17.0 // indirect
+	golang.org/x/sys v0.36.0 // indirect
 	golang.org/x/text v0.29.0 // indirect
 )
+
+require (
+	presence v0.0.0
+	storage v0.0.0
+)
+
+// Sdílené balíčky (úložiště, presence) nejsou publikované moduly - bereme je ze sousedních adresářů.
+replace (
+	presence => ../presence
+	storage => ../storage
+)
@@ -1,4 +1,4 @@
-package main
+package persister
 
 import (
 	"context"
@@ -7,25 +7,45 @@ import (
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
+	"presence"
+	"storage"
 )
 
 // Repository zapouzdřuje práci s databázemi.
 // Zbytek aplikace (main) neví, jak se píše SQL, jen volá metody repozitáře.
+// Historie a poslední hodnoty jdou přes storage.Store (TimescaleDB + Valkey, nebo vestavěné
+// úložiště), deadband přímo do TimescaleDB.
 type Repository struct {
-	pgPool *pgxpool.Pool // Pool spojení do TimescaleDB
-	redis  *redis.Client // Klient pro Valkey
+	store  storage.Store // Historie + poslední hodnoty
+	pgPool *pgxpool.Pool // Pool spojení do TimescaleDB; nil = bez DB (deadband se nepoužije)
+	redis  *redis.Client // Klient pro Valkey; nil = úložiště předané v Config.Store
 }
 
-// NewRepository vytvoří a ověří připojení k oběma databázím.
+// NewRepository vytvoří a ověří připojení k databázím.
+// S Config.Store se Valkey nepřipojuje; prázdná PostgresURL = ani TimescaleDB.
 func NewRepository(ctx context.Context, cfg Config) (*Repository, error) {
+	r := &Repository{store: cfg.Store}
+
 	// 1. Připojení k Postgres
-	pool, err := pgxpool.New(ctx, cfg.PostgresURL)
-	if err != nil {
-		return nil, fmt.Errorf("chyba konfigurace DB: %w", err)
+	if cfg.PostgresURL != "" {
+		pool, err := pgxpool.New(ctx, cfg.PostgresURL)
+		if err != nil {
+			return nil, fmt.Errorf("chyba konfigurace DB: %w", err)
+		}
+		// Ověření spojení (Ping)
+		if err := pool.Ping(ctx); err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("DB není dostupná: %w", err)
+		}
+		r.pgPool = pool
+	}
+
+	// Úložiště předané zvenku (all-in-one) - Valkey nepotřebujeme.
+	if r.store != nil {
+		return r, nil
 	}
-	// Ověření spojení (Ping)
-	if err := pool.Ping(ctx); err != nil {
-		return nil, fmt.Errorf("DB není dostupná: %w", err)
+	if r.pgPool == nil {
+		return nil, fmt.Errorf("bez POSTGRES_URL je nutné předat úložiště (Config.Store)")
 	}
 
 	// 2. Připojení k Valkey (Redis)
@@ -34,43 +54,128 @@ func NewRepository(ctx context.Context, cfg Config) (*Repository, error) {
 	})
 	// Ověření spojení
 	if err := rdb.Ping(ctx).Err(); err != nil {
+		r.pgPool.Close()
 		return nil, fmt.Errorf("Valkey není dostupný: %w", err)
 	}
+	r.redis = rdb
+	r.store = storage.NewPostgres(r.pgPool, rdb)
 
-	return &Repository{pgPool: pool, redis: rdb}, nil
+	return r, nil
 }
 
 // Close uzavře spojení při ukončení aplikace.
+// Úložiště předané v Config.Store patří volajícímu - to neuzavíráme.
 func (r *Repository) Close() {
-	r.pgPool.Close()
-	r.redis.Close()
+	if r.pgPool != nil {
+		r.pgPool.Close()
+	}
+	if r.redis != nil {
+		r.redis.Close()
+	}
 }
 
-// SaveMeasurement uloží data do obou úložišť (Hot Path & Cold Path).
-func (r *Repository) SaveMeasurement(ctx context.Context, event SensorEvent) error {
+// AddChecks přidá databáze jako závislosti readiness (vestavěné úložiště je soubor - bez kontroly).
+func (r *Repository) AddChecks(p *presence.Presence) {
+	if r.pgPool != nil {
+		p.AddCheck("postgres", r.pgPool.Ping)
+	}
+	if r.redis != nil {
+		p.AddCheck("valkey", func(ctx context.Context) error { return r.redis.Ping(ctx).Err() })
+	}
+}
 
-	// A. Uložení do TimescaleDB (Historie)
-	// Toto je naše "Cold Storage" nebo "Source of Truth".
-	// INSERT je optimalizovaný pro TimescaleDB hypertable.
-	query := `INSERT INTO sensor_data (time, sensor_id, value) VALUES ($1, $2, $3)`
+// SaveHistory uloží bod do historie (TimescaleDB nebo vestavěné úložiště).
+// Toto je naše "Cold Storage" nebo "Source of Truth". Které body se sem dostanou,
+// rozhoduje deadband (viz deadband.go).
+func (r *Repository) SaveHistory(ctx context.Context, event SensorEvent) error {
+	// V TimescaleDB jde o INSERT optimalizovaný pro hypertable ('sensor_data', stav do 'sensor_states').
+	err := r.store.WritePoints(ctx, []storage.Point{
+		{SensorID: event.SensorID, Time: event.Timestamp, Value: event.Value, State: event.State},
+	})
+	if err != nil {
+		return fmt.Errorf("chyba zápisu historie: %w", err)
+	}
+	return nil
+}
 
-	_, err := r.pgPool.Exec(ctx, query, event.Timestamp, event.SensorID, event.Value)
+// SaveLatest uloží aktuální hodnotu (Valkey nebo vestavěné úložiště). Volá se pro KAŽDÝ bod
+// (i ten, který deadband do historie neuloží) - dashboard tak vždy ukazuje čerstvou hodnotu.
+// Vrací false, pokud uložená hodnota je novější (např. znovu odeslaná stará zpráva).
+func (r *Repository) SaveLatest(ctx context.Context, event SensorEvent) (bool, error) {
+	// Toto je "Hot Storage" pro Dashboard. Přepisujeme stále dokola poslední stav senzoru.
+	// Ve Valkey hash "sensor:latest:{id}" (hodnota, čas měření, kvalita, pořadí zápisu, stav).
+	written, err := r.store.SetLatest(ctx, storage.LatestValue{
+		SensorID: event.SensorID,
+		Value:    event.Value,
+		Time:     event.Timestamp,
+		Quality:  event.Quality,
+		State:    event.State,
+	})
 	if err != nil {
-		return fmt.Errorf("chyba insertu do PG: %w", err)
+		// Chyba cache není kritická pro integritu dat (máme je v historii),
+		// ale měli bychom o ní vědět.
+		return false, fmt.Errorf("chyba update poslední hodnoty: %w", err)
 	}
 
-	// B. Uložení do Valkey (Aktuální stav)
-	// Toto je "Hot Storage" pro Dashboard. Přepisujeme stále dokola poslední hodnotu.
-	// Klíč: "sensor:last:{id}" (např. "sensor:last:5")
-	key := fmt.Sprintf("sensor:last:%d", event.SensorID)
+	return written, nil
+}
 
-	// Ukládáme hodnotu s expirací 24h (aby zmizely mrtvé senzory z cache)
-	err = r.redis.Set(ctx, key, event.Value, 24*time.Hour).Err()
+// LoadDeadbandConfigs načte nastavení deadbandu pro všechny senzory.
+// Nastavení senzoru má přednost před nastavením jeho typu - i když je vypnuté
+// (tak lze deadband pro jeden senzor vypnout, přestože ho typ má zapnutý).
+// Bez TimescaleDB vrací prázdné nastavení (ukládá se vše).
+func (r *Repository) LoadDeadbandConfigs(ctx context.Context) (map[int64]DeadbandConfig, error) {
+	if r.pgPool == nil {
+		return nil, nil
+	}
+	query := `
+		SELECT s.id, d.abs_threshold, d.pct_threshold, d.max_silence_seconds
+		FROM sensors s
+		JOIN LATERAL (
+			SELECT * FROM deadband_settings d
+			WHERE d.sensor_id = s.id OR d.sensor_type_id = s.sensor_type_id
+			ORDER BY d.sensor_id NULLS LAST
+			LIMIT 1
+		) d ON true
+		WHERE d.enabled = true
+	`
+	rows, err := r.pgPool.Query(ctx, query)
 	if err != nil {
-		// Redis chyba není kritická pro integritu dat (máme je v PG),
-		// ale měli bychom o ní vědět.
-		return fmt.Errorf("chyba update Valkey: %w", err)
+		return nil, fmt.Errorf("SQL query (deadband) failed: %w", err)
+	}
+	defer rows.Close()
+
+	configs := make(map[int64]DeadbandConfig)
+	for rows.Next() {
+		var id int64
+		var silenceSec int
+		var c DeadbandConfig
+		if err := rows.Scan(&id, &c.AbsThreshold, &c.PctThreshold, &silenceSec); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		c.MaxSilence = time.Duration(silenceSec) * time.Second
+		configs[id] = c
 	}
+	return configs, rows.Err()
+}
 
+// SaveDeadbandStats přičte počty přijatých a uložených bodů k dennímu součtu senzoru.
+// Bez TimescaleDB se statistiky jen logují (viz saveStats v run.go).
+func (r *Repository) SaveDeadbandStats(ctx context.Context, day time.Time, stats map[int64]DeadbandStats) error {
+	if r.pgPool == nil {
+		return nil
+	}
+	query := `
+		INSERT INTO deadband_stats (sensor_id, day, received, stored)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (sensor_id, day) DO UPDATE SET
+			received = deadband_stats.received + EXCLUDED.received,
+			stored   = deadband_stats.stored + EXCLUDED.stored
+	`
+	for id, s := range stats {
+		if _, err := r.pgPool.Exec(ctx, query, id, day, s.Received, s.Stored); err != nil {
+			return fmt.Errorf("chyba zápisu statistik deadbandu: %w", err)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,157 @@
+package persister
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"presence"
+)
+
+// Run spustí Data Persister a blokuje, dokud není zrušen ctx (signál, all-in-one shutdown).
+// Chyba se vrací jen při startu (DB, MQTT, subscribe) - o ukončení procesu rozhoduje volající.
+func Run(ctx context.Context, cfg Config, logger *slog.Logger) error {
+	// 1. Logger dostáváme od volajícího (cmd/ nebo all-in-one)
+	logger.Info("Startuji Data Persister", "config", cfg)
+
+	// 2. Inicializace Repozitáře (DB + Redis)
+	repo, err := NewRepository(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("připojení k databázím selhalo: %w", err)
+	}
+	defer repo.Close()
+	logger.Info("Databáze připojeny")
+
+	// 2a. Presence a health endpointy (stav služby a jejích závislostí, viz modul presence)
+	pres := presence.New("data-persister", cfg.PresenceTopic, cfg.PresenceInterval, logger)
+	repo.AddChecks(pres)
+	if cfg.HTTPPort != "" {
+		go pres.ServeHealth(ctx, cfg.HTTPPort)
+	}
+
+	// 2b. Deadband komprese historie (nastavení v 'deadband_settings')
+	deadband := NewDeadband()
+	reloadDeadband := func() {
+		loadCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		configs, err := repo.LoadDeadbandConfigs(loadCtx)
+		if err != nil {
+			// Bez nastavení se ukládá vše (stejně jako dřív) - data neztratíme.
+			logger.Error("Načtení nastavení deadbandu selhalo", "error", err)
+			return
+		}
+		deadband.SetConfigs(configs)
+		logger.Info("Nastavení deadbandu načteno", "sensors", len(configs))
+	}
+	reloadDeadband()
+
+	// saveStats zapíše úsporu do 'deadband_stats' a zaloguje souhrn.
+	saveStats := func() {
+		stats := deadband.TakeStats()
+		if len(stats) == 0 {
+			return
+		}
+		var received, stored int64
+		for _, s := range stats {
+			received += s.Received
+			stored += s.Stored
+		}
+		statsCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := repo.SaveDeadbandStats(statsCtx, time.Now().UTC().Truncate(24*time.Hour), stats); err != nil {
+			logger.Error("Zápis statistik deadbandu selhal", "error", err)
+		}
+		logger.Info("Deadband: úspora zápisů", "received", received, "stored", stored,
+			"saved_pct", fmt.Sprintf("%.1f", 100*float64(received-stored)/float64(received)))
+	}
+
+	// saveHistory uloží body vybrané deadbandem (vlastní timeout, aby DB operace nevisela věčně).
+	saveHistory := func(points []SensorEvent) {
+		for _, p := range points {
+			saveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := repo.SaveHistory(saveCtx, p); err != nil {
+				logger.Error("Chyba při ukládání dat", "sensor_id", p.SensorID, "error", err)
+			} else {
+				// Úspěch (Logujeme jen debug, v produkci by to bylo moc spamu)
+				logger.Debug("Data uložena", "sensor_id", p.SensorID, "val", p.Value)
+			}
+			cancel()
+		}
+	}
+
+	// 3. MQTT Klient Setup
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(cfg.MQTTBroker)
+	opts.SetClientID(cfg.MQTTClientID)
+	opts.SetCustomOpenConnectionFn(cfg.MQTTConnect)
+	pres.SetWill(opts) // Last Will "offline" - musí být nastavená před připojením
+
+	// --- HLAVNÍ LOGIKA ---
+	opts.SetDefaultPublishHandler(func(client mqtt.Client, msg mqtt.Message) {
+		// A. Deserializace JSONu
+		var event SensorEvent
+		if err := json.Unmarshal(msg.Payload(), &event); err != nil {
+			logger.Error("Neplatný JSON formát", "payload", string(msg.Payload()), "error", err)
+			return
+		}
+
+		// B. Aktuální hodnota do Valkey - vždy (vytvoříme context s timeoutem, aby operace nevisela věčně)
+		saveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if written, err := repo.SaveLatest(saveCtx, event); err != nil {
+			logger.Error("Chyba při ukládání aktuální hodnoty", "sensor_id", event.SensorID, "error", err)
+		} else if !written {
+			// Starší bod (znovu odeslaný z dead-letteru) - do historie ano, novější stav nepřepisuje.
+			logger.Debug("Aktuální hodnota je novější, bod jde jen do historie", "sensor_id", event.SensorID, "time", event.Timestamp)
+		}
+
+		// C. Historie do TimescaleDB - jen body, které propustí deadband
+		saveHistory(deadband.Process(event))
+	})
+
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("MQTT connection failed: %w", token.Error())
+	}
+	defer client.Disconnect(250)
+	pres.AddCheck("mqtt", presence.MQTTProbe(client))
+
+	// 4. Subscribe (posloucháme na výstupu z Ingestoru)
+	if token := client.Subscribe(cfg.InputTopic, 0, nil); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("subscribe %s failed: %w", cfg.InputTopic, token.Error())
+	}
+	logger.Info("Poslouchám na topicu", "topic", cfg.InputTopic)
+
+	// 4b. Služba je připravená - "online" + stav závislostí (obnova každý PRESENCE_INTERVAL)
+	go pres.Run(ctx, client)
+
+	// 5. Periodické úlohy deadbandu + Graceful Shutdown
+	reloadTicker := time.NewTicker(cfg.DeadbandReloadInterval)
+	defer reloadTicker.Stop()
+	statsTicker := time.NewTicker(cfg.DeadbandStatsInterval)
+	defer statsTicker.Stop()
+
+	for {
+		select {
+		case <-reloadTicker.C:
+			reloadDeadband()
+		case <-statsTicker.C:
+			saveStats()
+		case <-ctx.Done():
+			logger.Info("Vypínám službu...")
+
+			// Nejdřív přestaneme přijímat zprávy, pak uložíme čekající body
+			// (konce "plochých" úseků) a statistiky.
+			client.Unsubscribe(cfg.InputTopic).Wait()
+			saveHistory(deadband.FlushPending())
+			saveStats()
+			pres.Offline(client)
+			return nil
+		}
+	}
+}
@@ -1,11 +1,17 @@
-package main
+package persister
 
-import "time"
+import (
+	"time"
+
+	"storage"
+)
 
 // SensorEvent je struktura příchozí zprávy z MQTT (z topicu events/...).
 // Musí odpovídat JSONu, který generuje služba 'sensor-ingestor'.
 type SensorEvent struct {
-	SensorID  int64     `json:"sensor_id"` // ID senzoru (Foreign Key do DB)
-	Value     float64   `json:"value"`     // Naměřená hodnota
-	Timestamp time.Time `json:"timestamp"` // Čas měření (UTC)
+	SensorID  int64          `json:"sensor_id"` // ID senzoru (Foreign Key do DB)
+	Value     float64        `json:"value"`     // Naměřená hodnota (u nečíselného senzoru číselná podoba stavu)
+	State     *storage.State `json:"state"`     // Nečíselná hodnota (boolean, enum, text, geo); nil = číslo
+	Timestamp time.Time      `json:"timestamp"` // Čas měření (UTC)
+	Quality   []string       `json:"quality"`   // Příznaky kvality od Ingestoru ("suspect", "resubmitted")
 }
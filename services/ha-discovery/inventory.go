@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// LoadInventory načte všechny senzory včetně neaktivních.
+// Neaktivní potřebujeme také - podle nich poznáme, které entity v HA máme smazat.
+func LoadInventory(ctx context.Context, db *pgxpool.Pool) ([]InventorySensor, error) {
+	query := `
+		SELECT s.id, s.mqtt_topic, COALESCE(s.friendly_name, s.mqtt_topic), COALESCE(s.location, ''),
+		       COALESCE(s.is_active, false), st.name, COALESCE(st.unit, ''),
+		       COALESCE(st.value_kind, 'number')
+		FROM sensors s
+		JOIN sensor_types st ON s.sensor_type_id = st.id
+		ORDER BY s.id ASC
+	`
+
+	rows, err := db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("SQL query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var sensors []InventorySensor
+	for rows.Next() {
+		var s InventorySensor
+		if err := rows.Scan(&s.ID, &s.Topic, &s.Name, &s.Location, &s.Active, &s.TypeName, &s.Unit, &s.Kind); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		sensors = append(sensors, s)
+	}
+	return sensors, rows.Err()
+}
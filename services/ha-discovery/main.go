@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"presence"
+)
+
+func main() {
+	// 1. Setup Logger
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	slog.SetDefault(logger)
+
+	cfg := LoadConfig()
+	logger.Info("Startuji HA Discovery", "config", cfg)
+
+	// 2. Připojení k DB (čteme jen inventář senzorů)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dbPool, err := pgxpool.New(ctx, cfg.PostgresURL)
+	if err != nil {
+		logger.Error("Kritická chyba: Nelze se připojit k DB", "error", err)
+		os.Exit(1)
+	}
+	defer dbPool.Close()
+
+	// 3. MQTT Klient
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(cfg.MQTTBroker)
+	opts.SetClientID(cfg.MQTTClientID)
+
+	// Presence: Last Will "offline" se musí nastavit před připojením (viz modul presence)
+	pres := presence.New("ha-discovery", cfg.PresenceTopic, cfg.PresenceInterval, logger)
+	pres.SetWill(opts)
+
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		logger.Error("MQTT connection failed", "error", token.Error())
+		os.Exit(1)
+	}
+	// Defery běží pozpátku - "offline" odejde před odpojením
+	defer client.Disconnect(250)
+	defer pres.Offline(client)
+
+	// Závislosti: broker a DB. Health a presence běží do zrušení ctx.
+	pres.AddCheck("mqtt", presence.MQTTProbe(client))
+	pres.AddCheck("postgres", dbPool.Ping)
+	if cfg.HTTPPort != "" {
+		go pres.ServeHealth(ctx, cfg.HTTPPort)
+	}
+	go pres.Run(ctx, client)
+
+	publisher := NewPublisher(client, cfg, logger)
+
+	// 4. Zjistíme, co už je v HA publikované z minulého běhu (retained zprávy).
+	if err := publisher.LoadRetained(2 * time.Second); err != nil {
+		logger.Error("Načtení existujících discovery zpráv selhalo", "error", err)
+	}
+
+	// sync načte inventář a srovná ho s HA.
+	sync := func() {
+		syncCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		sensors, err := LoadInventory(syncCtx, dbPool)
+		if err != nil {
+			logger.Error("Načtení inventáře selhalo", "error", err)
+			return
+		}
+		publisher.Sync(sensors)
+	}
+
+	// První synchronizace ještě před odběrem hodnot, aby byly známé state topicy.
+	sync()
+
+	// 5. Subscribe na normalizované hodnoty (výstup Ingestoru)
+	if token := client.Subscribe(cfg.EventsTopic, 0, publisher.HandleEvent); token.Wait() && token.Error() != nil {
+		logger.Error("Subscribe failed", "topic", cfg.EventsTopic, "error", token.Error())
+		os.Exit(1)
+	}
+	logger.Info("Poslouchám na topicu", "topic", cfg.EventsTopic)
+
+	// 6. Periodická synchronizace (přidání, přejmenování, deaktivace senzorů v DB)
+	ticker := time.NewTicker(cfg.SyncInterval)
+	defer ticker.Stop()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	for {
+		select {
+		case <-sigChan:
+			logger.Info("Vypínám službu...")
+			return
+		case <-ticker.C:
+			sync()
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// objectIDPrefix odlišuje naše entity od ostatních discovery zpráv na brokeru.
+const objectIDPrefix = "dashboarder_"
+
+// Publisher udržuje discovery zprávy v Home Assistantu v souladu s inventářem v DB
+// a přeposílá normalizované hodnoty na state topicy.
+type Publisher struct {
+	client mqtt.Client
+	cfg    Config
+	logger *slog.Logger
+
+	// mu chrání obě mapy - Sync běží v hlavní smyčce, HandleEvent v MQTT goroutině.
+	mu sync.RWMutex
+
+	// published: config topic -> naposledy publikovaný payload.
+	// Díky tomu posíláme discovery zprávu jen tehdy, když se opravdu změnila.
+	published map[string][]byte
+
+	// stateTopics: sensor ID -> state topic (jen aktivní senzory).
+	stateTopics map[int64]string
+}
+
+// NewPublisher - konstruktor
+func NewPublisher(client mqtt.Client, cfg Config, logger *slog.Logger) *Publisher {
+	return &Publisher{
+		client:      client,
+		cfg:         cfg,
+		logger:      logger,
+		published:   make(map[string][]byte),
+		stateTopics: make(map[int64]string),
+	}
+}
+
+// configTopic: homeassistant/sensor/dashboarder_<id>/config
+func (p *Publisher) configTopic(sensorID int64) string {
+	return fmt.Sprintf("%s/sensor/%s%d/config", p.cfg.DiscoveryPrefix, objectIDPrefix, sensorID)
+}
+
+// stateTopic: dashboarder/sensor/<id>/state
+func (p *Publisher) stateTopic(sensorID int64) string {
+	return fmt.Sprintf("%s/%d/state", p.cfg.StateTopicPrefix, sensorID)
+}
+
+// sensorIDFromConfigTopic je opak configTopic. Vrací false pro cizí topicy.
+func (p *Publisher) sensorIDFromConfigTopic(topic string) (int64, bool) {
+	rest, ok := strings.CutPrefix(topic, p.cfg.DiscoveryPrefix+"/sensor/"+objectIDPrefix)
+	if !ok {
+		return 0, false
+	}
+	idStr, ok := strings.CutSuffix(rest, "/config")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	return id, err == nil
+}
+
+// LoadRetained zjistí, které discovery zprávy už na brokeru visí (retained) z minulého běhu.
+// Bez toho bychom po restartu nevěděli, že senzor smazaný "mezitím" máme z HA odstranit.
+func (p *Publisher) LoadRetained(wait time.Duration) error {
+	filter := p.cfg.DiscoveryPrefix + "/sensor/+/config"
+
+	token := p.client.Subscribe(filter, 1, func(_ mqtt.Client, msg mqtt.Message) {
+		if _, ok := p.sensorIDFromConfigTopic(msg.Topic()); !ok || len(msg.Payload()) == 0 {
+			return
+		}
+		p.mu.Lock()
+		p.published[msg.Topic()] = append([]byte(nil), msg.Payload()...)
+		p.mu.Unlock()
+	})
+	if token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+
+	// Retained zprávy broker posílá hned po subscribe. Chvíli počkáme a odběr zrušíme.
+	time.Sleep(wait)
+	p.client.Unsubscribe(filter).Wait()
+
+	p.mu.RLock()
+	p.logger.Info("Načteny existující discovery zprávy", "count", len(p.published))
+	p.mu.RUnlock()
+	return nil
+}
+
+// Sync porovná inventář s publikovaným stavem:
+//   - nový nebo změněný (přejmenovaný) aktivní senzor -> publikujeme config (retained)
+//   - deaktivovaný nebo smazaný senzor -> prázdný retained payload (HA entitu odstraní)
+func (p *Publisher) Sync(sensors []InventorySensor) {
+	desired := make(map[string][]byte)
+	stateTopics := make(map[int64]string)
+
+	for _, s := range sensors {
+		if !s.Active {
+			continue
+		}
+		payload, err := json.Marshal(p.buildConfig(s))
+		if err != nil {
+			p.logger.Error("Serializace discovery configu selhala", "sensor_id", s.ID, "error", err)
+			continue
+		}
+		desired[p.configTopic(s.ID)] = payload
+		stateTopics[s.ID] = p.stateTopic(s.ID)
+	}
+
+	// 1. Pod zámkem jen zjistíme rozdíly a přepneme state topicy. Publikovat pod zámkem nesmíme:
+	// HandleEvent běží v MQTT routeru a čeká na stejný zámek - zaseknutý router by nepustil
+	// ani PUBACKy, na které by publikace čekala.
+	p.mu.Lock()
+	var changed, removed []string
+	for topic, payload := range desired {
+		if !bytes.Equal(p.published[topic], payload) {
+			changed = append(changed, topic)
+		}
+	}
+	for topic := range p.published {
+		if _, ok := desired[topic]; !ok {
+			removed = append(removed, topic)
+		}
+	}
+	p.stateTopics = stateTopics
+	p.mu.Unlock()
+
+	// 2. Publikace mimo zámek. Co selže, zůstane v 'published' beze změny a zkusí se při příští synchronizaci.
+	added, deleted := 0, 0
+	for _, topic := range changed {
+		if err := p.publish(topic, desired[topic]); err != nil {
+			p.logger.Error("Publikace discovery configu selhala", "topic", topic, "error", err)
+			continue
+		}
+		p.mu.Lock()
+		p.published[topic] = desired[topic]
+		p.mu.Unlock()
+		added++
+	}
+
+	for _, topic := range removed {
+		// Prázdný retained payload = pokyn pro HA entitu smazat (a broker retained zprávu zahodí).
+		if err := p.publish(topic, nil); err != nil {
+			p.logger.Error("Odstranění discovery configu selhalo", "topic", topic, "error", err)
+			continue
+		}
+		if id, ok := p.sensorIDFromConfigTopic(topic); ok {
+			p.publish(p.stateTopic(id), nil)
+		}
+		p.mu.Lock()
+		delete(p.published, topic)
+		p.mu.Unlock()
+		deleted++
+	}
+
+	if added > 0 || deleted > 0 {
+		p.logger.Info("Discovery synchronizováno", "published", added, "removed", deleted, "active", len(desired))
+	}
+}
+
+// HandleEvent přepošle normalizovanou hodnotu na state topic senzoru.
+func (p *Publisher) HandleEvent(_ mqtt.Client, msg mqtt.Message) {
+	var event SensorEvent
+	if err := json.Unmarshal(msg.Payload(), &event); err != nil {
+		p.logger.Warn("Neplatný JSON formát", "payload", string(msg.Payload()), "error", err)
+		return
+	}
+
+	p.mu.RLock()
+	topic, ok := p.stateTopics[event.SensorID]
+	p.mu.RUnlock()
+	if !ok {
+		return // Senzor není (nebo ještě není) v HA publikovaný
+	}
+
+	value, ok := haState(event)
+	if !ok {
+		p.logger.Warn("Stav bez hodnoty", "sensor_id", event.SensorID, "kind", event.State.Kind)
+		return
+	}
+
+	// Retained: HA po restartu hned zobrazí poslední hodnotu.
+	if token := p.client.Publish(topic, 0, true, value); token.Wait() && token.Error() != nil {
+		p.logger.Error("Publikace stavu selhala", "topic", topic, "error", token.Error())
+	}
+}
+
+// haState převede hodnotu události na payload state topicu. Číslo jde jako text ("21.5"),
+// dvoustavová hodnota jako ON/OFF, enum a text beze změny. Poloha jde jako JSON s atributy,
+// které HA zná z device_trackeru (latitude, longitude...) - entita je čte přes
+// json_attributes_topic a stav skládá value_template (viz buildConfig).
+func haState(event SensorEvent) ([]byte, bool) {
+	st := event.State
+	switch {
+	case st == nil:
+		return []byte(strconv.FormatFloat(event.Value, 'f', -1, 64)), true
+	case st.Bool != nil:
+		if *st.Bool {
+			return []byte("ON"), true
+		}
+		return []byte("OFF"), true
+	case st.Text != nil:
+		return []byte(*st.Text), true
+	case st.Geo != nil:
+		payload, err := json.Marshal(haGeoAttributes{
+			Latitude: st.Geo.Lat, Longitude: st.Geo.Lon, Altitude: st.Geo.Alt, GPSAccuracy: st.Geo.Acc,
+		})
+		return payload, err == nil
+	}
+	return nil, false
+}
+
+// haGeoAttributes jsou atributy polohy v zápisu Home Assistantu.
+type haGeoAttributes struct {
+	Latitude    float64  `json:"latitude"`
+	Longitude   float64  `json:"longitude"`
+	Altitude    *float64 `json:"altitude,omitempty"`
+	GPSAccuracy *float64 `json:"gps_accuracy,omitempty"`
+}
+
+// publishTimeout: Nejdelší čekání na potvrzení (PUBACK) jedné discovery zprávy.
+const publishTimeout = 5 * time.Second
+
+// publish pošle retained zprávu s QoS 1 (discovery zprávy nesmí vypadnout).
+// Na potvrzení čekáme omezeně - při výpadku brokeru se synchronizace nesmí zaseknout.
+func (p *Publisher) publish(topic string, payload []byte) error {
+	token := p.client.Publish(topic, 1, true, payload)
+	if !token.WaitTimeout(publishTimeout) {
+		return fmt.Errorf("broker nepotvrdil zprávu do %s", publishTimeout)
+	}
+	return token.Error()
+}
+
+// buildConfig sestaví discovery payload pro jeden senzor.
+func (p *Publisher) buildConfig(s InventorySensor) HASensorConfig {
+	objectID := fmt.Sprintf("%s%d", objectIDPrefix, s.ID)
+
+	// Zařízení v HA = místnost (location). Senzory bez umístění spadnou pod společný hub.
+	device := HADevice{
+		Identifiers:  []string{"dashboarder_hub"},
+		Name:         "Dashboarder",
+		Manufacturer: "dashboarder-go",
+		Model:        "IoT Home Hub",
+	}
+	if s.Location != "" {
+		device.Identifiers = []string{"dashboarder_loc_" + sanitizeID(s.Location)}
+		device.Name = "Dashboarder " + s.Location
+	}
+
+	cfg := HASensorConfig{
+		Name:              s.Name,
+		UniqueID:          objectID,
+		ObjectID:          objectID,
+		StateTopic:        p.stateTopic(s.ID),
+		UnitOfMeasurement: haUnit(s.Unit),
+		DeviceClass:       haDeviceClass(s.TypeName),
+		Device:            device,
+	}
+
+	// Nečíselné senzory (viz haState) nemají jednotku ani device_class a HA pro ně nesmí
+	// počítat statistiky - 'measurement' s textovým stavem by entitu shodil do 'unavailable'.
+	if s.Kind != "" && s.Kind != "number" {
+		cfg.UnitOfMeasurement = ""
+		cfg.DeviceClass = ""
+		if s.Kind == "geo" {
+			cfg.ValueTemplate = "{{ value_json.latitude }},{{ value_json.longitude }}"
+			cfg.JSONAttrTopic = cfg.StateTopic
+		}
+		return cfg
+	}
+
+	// Spojité veličiny označíme jako 'measurement' (HA pak počítá dlouhodobé statistiky).
+	// Binární stav (switch) statistiky nepotřebuje.
+	if s.TypeName != "switch" {
+		cfg.StateClass = "measurement"
+	}
+	return cfg
+}
+
+// haDeviceClass mapuje název typu ze sensor_types na device_class v Home Assistantu.
+// Neznámé typy device_class nemají (HA je zobrazí jako obecný senzor).
+func haDeviceClass(typeName string) string {
+	switch typeName {
+	case "temperature":
+		return "temperature"
+	case "humidity":
+		return "humidity"
+	case "pressure":
+		return "atmospheric_pressure"
+	case "voltage":
+		return "voltage"
+	case "freq":
+		return "frequency"
+	case "volume":
+		return "volume"
+	case "ram_usage", "disk_usage":
+		return "data_size"
+	}
+	return ""
+}
+
+// haUnit převede jednotku z DB na zápis, který HA očekává pro daný device_class.
+func haUnit(unit string) string {
+	switch unit {
+	case "l":
+		return "L"
+	case "rpms":
+		return "rpm"
+	}
+	return unit
+}
+
+// sanitizeID nahradí znaky, které nepatří do identifikátoru (mezery, diakritika zůstává).
+func sanitizeID(s string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "_", "/", "_").Replace(s))
+}
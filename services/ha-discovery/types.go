@@ -0,0 +1,64 @@
+package main
+
+import "time"
+
+// SensorEvent je normalizovaná zpráva z Ingestoru (topic events/data).
+// Musí odpovídat JSONu, který generuje služba 'sensor-ingestor'.
+type SensorEvent struct {
+	SensorID  int64       `json:"sensor_id"`
+	Value     float64     `json:"value"` // U nečíselného senzoru jen číselná podoba stavu (viz State)
+	State     *EventState `json:"state,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// EventState je hodnota nečíselného senzoru (boolean, enum, text, geo).
+// Odpovídá storage.State, který posílá ingestor. Vyplněné je jen pole odpovídající Kind.
+type EventState struct {
+	Kind string    `json:"kind"`
+	Bool *bool     `json:"bool,omitempty"`
+	Text *string   `json:"text,omitempty"` // enum i text
+	Geo  *EventGeo `json:"geo,omitempty"`
+}
+
+// EventGeo je poloha z EventState.
+type EventGeo struct {
+	Lat float64  `json:"lat"`
+	Lon float64  `json:"lon"`
+	Alt *float64 `json:"alt,omitempty"`
+	Acc *float64 `json:"acc,omitempty"`
+}
+
+// InventorySensor je jeden řádek inventáře (sensors + sensor_types).
+type InventorySensor struct {
+	ID       int64
+	Topic    string
+	Name     string
+	Location string
+	Active   bool
+	TypeName string
+	Unit     string
+	Kind     string // sensor_types.value_kind: number | boolean | enum | text | geo
+}
+
+// HADevice popisuje "zařízení" v Home Assistantu, pod které se entity seskupí.
+type HADevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model,omitempty"`
+}
+
+// HASensorConfig je payload discovery zprávy pro komponentu 'sensor'.
+// Formát viz https://www.home-assistant.io/integrations/sensor.mqtt/
+type HASensorConfig struct {
+	Name              string   `json:"name"`
+	UniqueID          string   `json:"unique_id"`
+	ObjectID          string   `json:"object_id"`
+	StateTopic        string   `json:"state_topic"`
+	UnitOfMeasurement string   `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string   `json:"device_class,omitempty"`
+	StateClass        string   `json:"state_class,omitempty"`
+	ValueTemplate     string   `json:"value_template,omitempty"`
+	JSONAttrTopic     string   `json:"json_attributes_topic,omitempty"`
+	Device            HADevice `json:"device"`
+}
@@ -1,10 +1,16 @@
-package main
+package homeapi
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 // APIHandler sdružuje metody pro obsluhu HTTP požadavků.
@@ -28,13 +34,77 @@ func (h *APIHandler) RegisterRoutes(mux *http.ServeMux) {
 	// Endpoint pro detail senzoru (Graf).
 	// {id} je tzv. Path Value - proměnná v URL.
 	mux.HandleFunc("GET /api/sensors/{id}/history", h.handleGetHistory)
+
+	// Více řad v jednom grafu (různé senzory nebo stejný senzor v jiném období), viz compare.go
+	mux.HandleFunc("GET /api/history", h.handleMultiHistory)
+
+	// Statistiky senzoru za okno (souhrn + dny/týdny/měsíce v lokální zóně), viz stats.go
+	mux.HandleFunc("GET /api/sensors/{id}/stats", h.handleSensorStats)
+
+	// Dvoustavové senzory (spínač, kontakt): intervaly stavů a doba zapnutí, viz intervals.go
+	mux.HandleFunc("GET /api/sensors/{id}/intervals", h.handleSensorIntervals)
+	mux.HandleFunc("GET /api/sensors/{id}/on-time", h.handleSensorOnTime)
+
+	// Počítadla (vodoměr, pulzy): spotřeba po hodinách/dnech/měsících a cena, viz consumption.go
+	mux.HandleFunc("GET /api/sensors/{id}/consumption", h.handleSensorConsumption)
+
+	// Přehled služeb (presence zprávy z MQTT, drží se v paměti), viz services.go
+	mux.HandleFunc("GET /api/services", h.handleListServices)
+
+	// Ostatní routy pracují přímo s tabulkami TimescaleDB. Bez DB (vestavěné úložiště)
+	// vrací 503 - viz requireDB.
+
+	// Typy senzorů (pro formuláře v UI)
+	mux.HandleFunc("GET /api/sensor-types", h.requireDB(h.handleListSensorTypes))
+
+	// Zařízení: dostupnost, baterie, signál a jejich senzory, viz devices.go
+	mux.HandleFunc("GET /api/devices", h.requireDB(h.handleListDevices))
+
+	// Karanténa neznámých topiců (schválení / ignorování)
+	mux.HandleFunc("GET /api/discovered", h.requireDB(h.handleListDiscovered))
+	mux.HandleFunc("POST /api/discovered/{id}/approve", h.requireDB(h.handleApproveDiscovered))
+	mux.HandleFunc("POST /api/discovered/{id}/ignore", h.requireDB(h.handleIgnoreDiscovered))
+
+	// Příkazy pro akční členy (switch) a jejich historie
+	mux.HandleFunc("POST /api/sensors/{id}/command", h.requireDB(h.handleSendCommand))
+	mux.HandleFunc("GET /api/sensors/{id}/commands", h.requireDB(h.handleCommandHistory))
+
+	// Automatizační pravidla (vyhodnocuje rules-engine) a log jejich spuštění
+	mux.HandleFunc("GET /api/rules", h.requireDB(h.handleListRules))
+	mux.HandleFunc("GET /api/rule-executions", h.requireDB(h.handleListRuleExecutions))
+
+	// Scény (ruční aktivace) a časové rozvrhy (spouští scheduler)
+	mux.HandleFunc("GET /api/scenes", h.requireDB(h.handleListScenes))
+	mux.HandleFunc("POST /api/scenes/{id}/activate", h.requireDB(h.handleActivateScene))
+	mux.HandleFunc("GET /api/schedules", h.requireDB(h.handleListSchedules))
+
+	// Audit filtrů špiček (co Ingestor zahodil nebo označil)
+	mux.HandleFunc("GET /api/filter-decisions", h.requireDB(h.handleListFilterDecisions))
+
+	// Odmítnuté zprávy (dead-letter) a jejich znovuodeslání po opravě metadat
+	mux.HandleFunc("GET /api/rejects", h.requireDB(h.handleListRejects))
+	mux.HandleFunc("GET /api/rejects/summary", h.requireDB(h.handleRejectSummary))
+	mux.HandleFunc("POST /api/rejects/{id}/resubmit", h.requireDB(h.handleResubmitReject))
+
+	// Úspora zápisů díky deadband kompresi
+	mux.HandleFunc("GET /api/deadband/stats", h.requireDB(h.handleDeadbandStats))
+
+	// Import historie (CSV/NDJSON) - stejná logika jako příkaz 'home-api backfill'
+	mux.HandleFunc("POST /api/backfill", h.requireDB(h.handleBackfill))
 }
 
-// handleListSensors: GET /api/sensors
+// handleListSensors: GET /api/sensors?units=imperial
 func (h *APIHandler) handleListSensors(w http.ResponseWriter, r *http.Request) {
 	// Získání kontextu z requestu (pro timeouty a cancelation)
 	ctx := r.Context()
 
+	// Soustava jednotek (volitelná, default metrická)
+	units, err := ParseUnitSystem(r.URL.Query().Get("units"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Volání business logiky
 	sensors, err := h.svc.GetAllSensors(ctx)
 	if err != nil {
@@ -42,6 +112,7 @@ func (h *APIHandler) handleListSensors(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Interní chyba serveru", http.StatusInternalServerError)
 		return
 	}
+	ConvertSensors(sensors, units)
 
 	// Nastavení hlavičky, že vracíme JSON
 	w.Header().Set("Content-Type", "application/json")
@@ -53,7 +124,8 @@ func (h *APIHandler) handleListSensors(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleGetHistory: GET /api/sensors/{id}/history?range=24h
+// handleGetHistory: GET /api/sensors/{id}/history?range=24h&resolution=5m&units=imperial
+// Vrstvu historie, ze které data pocházejí (raw, 5m, 1h, 1d), vrací hlavička X-History-Tier.
 func (h *APIHandler) handleGetHistory(w http.ResponseWriter, r *http.Request) {
 	// 1. Extrakce ID z URL (Go 1.22 feature)
 	idStr := r.PathValue("id")
@@ -70,18 +142,597 @@ func (h *APIHandler) handleGetHistory(w http.ResponseWriter, r *http.Request) {
 		rangeParam = "24h" // Defaultní hodnota, pokud parametr chybí
 	}
 
-	// 3. Volání business logiky
-	points, err := h.svc.GetHistory(r.Context(), id, rangeParam)
+	// 3. Volání business logiky (rozlišení volitelné, viz tiers.go)
+	points, tier, err := h.svc.GetHistory(r.Context(), id, rangeParam, r.URL.Query().Get("resolution"))
+	if err != nil {
+		h.writeServiceError(w, "Chyba při načítání dat", err)
+		return
+	}
+
+	// 4. Převod jednotek (metrická soustava převádí případné imperiální typy, viz units.go)
+	units, err := ParseUnitSystem(r.URL.Query().Get("units"))
 	if err != nil {
-		h.logger.Error("Chyba při získávání historie", "id", id, "error", err)
-		http.Error(w, "Chyba při načítání dat", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if len(points) > 0 {
+		unit, err := h.svc.GetSensorUnit(r.Context(), id)
+		if err != nil {
+			h.writeServiceError(w, "Chyba při zjišťování jednotky senzoru", err)
+			return
+		}
+		ConvertHistory(points, unit, units)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-History-Tier", tier)
 	json.NewEncoder(w).Encode(points)
 }
 
+// handleListSensorTypes: GET /api/sensor-types
+func (h *APIHandler) handleListSensorTypes(w http.ResponseWriter, r *http.Request) {
+	types, err := h.svc.GetSensorTypes(r.Context())
+	if err != nil {
+		h.writeServiceError(w, "Chyba při získávání typů senzorů", err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, types)
+}
+
+// handleListDiscovered: GET /api/discovered?status=pending
+func (h *APIHandler) handleListDiscovered(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", "pending", "approved", "ignored":
+	default:
+		http.Error(w, "Neplatný status (pending|approved|ignored)", http.StatusBadRequest)
+		return
+	}
+
+	topics, err := h.svc.GetDiscoveredTopics(r.Context(), status)
+	if err != nil {
+		h.writeServiceError(w, "Chyba při získávání karantény", err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, topics)
+}
+
+// handleApproveDiscovered: POST /api/discovered/{id}/approve
+// Tělo: {"sensor_type_id": 1, "friendly_name": "Teploměr sklep", "location": "Sklep"}
+func (h *APIHandler) handleApproveDiscovered(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	var req ApproveTopicRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Neplatný JSON", http.StatusBadRequest)
+		return
+	}
+
+	sensorID, err := h.svc.ApproveDiscoveredTopic(r.Context(), id, req)
+	if err != nil {
+		h.writeServiceError(w, "Chyba při schvalování topicu", err)
+		return
+	}
+	h.writeJSON(w, http.StatusCreated, map[string]int64{"sensor_id": sensorID})
+}
+
+// handleIgnoreDiscovered: POST /api/discovered/{id}/ignore
+func (h *APIHandler) handleIgnoreDiscovered(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.svc.IgnoreDiscoveredTopic(r.Context(), id); err != nil {
+		h.writeServiceError(w, "Chyba při ignorování topicu", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSendCommand: POST /api/sensors/{id}/command
+// Tělo: {"value": 1}. Odpověď čeká na potvrzení od zařízení (max COMMAND_TIMEOUT).
+//   - 200 OK: zařízení stav potvrdilo
+//   - 504 Gateway Timeout: příkaz odeslán, ale potvrzení nepřišlo
+//   - 502 Bad Gateway: příkaz se nepodařilo odeslat do MQTT
+func (h *APIHandler) handleSendCommand(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	var req CommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Neplatný JSON", http.StatusBadRequest)
+		return
+	}
+
+	cmd, err := h.svc.SendCommand(r.Context(), id, req)
+	if err != nil && cmd == nil {
+		h.writeServiceError(w, "Chyba při odesílání příkazu", err)
+		return
+	}
+	if err != nil {
+		// Příkaz proběhl, jen se nepodařilo uložit výsledek - klientovi výsledek i tak vrátíme.
+		h.logger.Error("Chyba při ukládání výsledku příkazu", "error", err)
+	}
+
+	status := http.StatusOK
+	switch cmd.Status {
+	case "timeout":
+		status = http.StatusGatewayTimeout
+	case "failed":
+		status = http.StatusBadGateway
+	}
+	h.writeJSON(w, status, cmd)
+}
+
+// handleCommandHistory: GET /api/sensors/{id}/commands?limit=20
+func (h *APIHandler) handleCommandHistory(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	limit := queryInt(r, "limit", 20, 1, 500)
+	history, err := h.svc.GetCommandHistory(r.Context(), id, limit)
+	if err != nil {
+		h.writeServiceError(w, "Chyba při získávání historie příkazů", err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, history)
+}
+
+// handleListRules: GET /api/rules
+func (h *APIHandler) handleListRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.svc.GetRules(r.Context())
+	if err != nil {
+		h.writeServiceError(w, "Chyba při získávání pravidel", err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, rules)
+}
+
+// handleListRuleExecutions: GET /api/rule-executions?rule_id=3&limit=50
+// Bez rule_id vrací log všech pravidel.
+func (h *APIHandler) handleListRuleExecutions(w http.ResponseWriter, r *http.Request) {
+	var ruleID int64
+	if v := r.URL.Query().Get("rule_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Neplatné rule_id (musí být kladné číslo)", http.StatusBadRequest)
+			return
+		}
+		ruleID = id
+	}
+
+	limit := queryInt(r, "limit", 50, 1, 500)
+	executions, err := h.svc.GetRuleExecutions(r.Context(), ruleID, limit)
+	if err != nil {
+		h.writeServiceError(w, "Chyba při získávání logu pravidel", err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, executions)
+}
+
+// handleListScenes: GET /api/scenes
+func (h *APIHandler) handleListScenes(w http.ResponseWriter, r *http.Request) {
+	scenes, err := h.svc.GetScenes(r.Context())
+	if err != nil {
+		h.writeServiceError(w, "Chyba při získávání scén", err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, scenes)
+}
+
+// handleActivateScene: POST /api/scenes/{id}/activate
+// Vrací výsledek každé MQTT zprávy. Pokud některá selhala, status je 502.
+func (h *APIHandler) handleActivateScene(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	results, err := h.svc.ActivateScene(r.Context(), id)
+	if err != nil {
+		h.writeServiceError(w, "Chyba při aktivaci scény", err)
+		return
+	}
+
+	status := http.StatusOK
+	for _, res := range results {
+		if !res.OK {
+			status = http.StatusBadGateway
+		}
+	}
+	h.writeJSON(w, status, results)
+}
+
+// handleListSchedules: GET /api/schedules
+func (h *APIHandler) handleListSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules, err := h.svc.GetSchedules(r.Context())
+	if err != nil {
+		h.writeServiceError(w, "Chyba při získávání rozvrhů", err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, schedules)
+}
+
+// handleListFilterDecisions: GET /api/filter-decisions?sensor_id=5&action=dropped&limit=100
+func (h *APIHandler) handleListFilterDecisions(w http.ResponseWriter, r *http.Request) {
+	var sensorID int64
+	if v := r.URL.Query().Get("sensor_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Neplatné sensor_id (musí být kladné číslo)", http.StatusBadRequest)
+			return
+		}
+		sensorID = id
+	}
+
+	limit := queryInt(r, "limit", 100, 1, 1000)
+	decisions, err := h.svc.GetFilterDecisions(r.Context(), sensorID, r.URL.Query().Get("action"), limit)
+	if err != nil {
+		h.writeServiceError(w, "Chyba při získávání auditu filtrů", err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, decisions)
+}
+
+// handleListRejects: GET /api/rejects?sensor_id=5&reason=above_max&limit=100
+func (h *APIHandler) handleListRejects(w http.ResponseWriter, r *http.Request) {
+	var sensorID int64
+	if v := r.URL.Query().Get("sensor_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Neplatné sensor_id (musí být kladné číslo)", http.StatusBadRequest)
+			return
+		}
+		sensorID = id
+	}
+
+	limit := queryInt(r, "limit", 100, 1, 1000)
+	rejects, err := h.svc.GetRejects(r.Context(), sensorID, r.URL.Query().Get("reason"), limit)
+	if err != nil {
+		h.writeServiceError(w, "Chyba při získávání odmítnutých zpráv", err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, rejects)
+}
+
+// handleRejectSummary: GET /api/rejects/summary
+func (h *APIHandler) handleRejectSummary(w http.ResponseWriter, r *http.Request) {
+	summary, err := h.svc.GetRejectSummary(r.Context())
+	if err != nil {
+		h.writeServiceError(w, "Chyba při získávání přehledu odmítnutých zpráv", err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, summary)
+}
+
+// handleResubmitReject: POST /api/rejects/{id}/resubmit
+// Zpracování v Ingestoru je asynchronní - 202 Accepted znamená "odesláno", ne "uloženo".
+func (h *APIHandler) handleResubmitReject(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	reject, err := h.svc.ResubmitReject(r.Context(), id)
+	if err != nil {
+		h.writeServiceError(w, "Chyba při znovuodeslání zprávy", err)
+		return
+	}
+	h.writeJSON(w, http.StatusAccepted, reject)
+}
+
+// handleDeadbandStats: GET /api/deadband/stats?days=7
+func (h *APIHandler) handleDeadbandStats(w http.ResponseWriter, r *http.Request) {
+	days := queryInt(r, "days", 7, 1, 365)
+	stats, err := h.svc.GetDeadbandStats(r.Context(), days)
+	if err != nil {
+		h.writeServiceError(w, "Chyba při získávání statistik deadbandu", err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, stats)
+}
+
+// maxBackfillBody omezuje velikost nahrávaného souboru (větší importy přes příkaz 'backfill').
+const maxBackfillBody = 100 << 20 // 100 MB
+
+// handleBackfill: POST /api/backfill?sensor_topic=/msh/living/temp&timezone=Europe/Prague&dry_run=true
+// Tělo požadavku je samotný soubor (CSV nebo NDJSON), parametry jsou v query:
+// format, time_column, value_column, sensor_column, sensor_id, sensor_topic, time_format,
+// timezone, delimiter, decimal_comma, calibrate, dry_run.
+func (h *APIHandler) handleBackfill(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	opts := BackfillOptions{
+		Format:       q.Get("format"),
+		TimeColumn:   q.Get("time_column"),
+		ValueColumn:  q.Get("value_column"),
+		SensorColumn: q.Get("sensor_column"),
+		SensorTopic:  q.Get("sensor_topic"),
+		TimeFormat:   q.Get("time_format"),
+		Timezone:     q.Get("timezone"),
+		DecimalComma: q.Get("decimal_comma") == "true",
+		Calibrate:    q.Get("calibrate") == "true",
+		DryRun:       q.Get("dry_run") == "true",
+	}
+	// Formát lze odvodit i z Content-Type (application/x-ndjson)
+	if opts.Format == "" && strings.Contains(r.Header.Get("Content-Type"), "ndjson") {
+		opts.Format = "ndjson"
+	}
+	if v := q.Get("sensor_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Neplatné sensor_id (musí být kladné číslo)", http.StatusBadRequest)
+			return
+		}
+		opts.SensorID = id
+	}
+	if v := q.Get("delimiter"); v != "" {
+		if utf8.RuneCountInString(v) != 1 {
+			http.Error(w, "Oddělovač musí být jeden znak", http.StatusBadRequest)
+			return
+		}
+		opts.Delimiter, _ = utf8.DecodeRuneInString(v)
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxBackfillBody)
+	report, err := h.svc.Backfill(r.Context(), body, opts)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Soubor je příliš velký, použijte příkaz 'home-api backfill'", http.StatusRequestEntityTooLarge)
+			return
+		}
+		h.writeServiceError(w, "Chyba při importu historie", err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, report)
+}
+
+// handleMultiHistory: GET /api/history?series=1&series=1@168h&range=24h&bucket=15m&units=imperial
+func (h *APIHandler) handleMultiHistory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	units, err := ParseUnitSystem(q.Get("units"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts := CompareOptions{Range: q.Get("range"), Units: units}
+
+	// Řady lze zadat opakovaným parametrem i čárkami (series=1,2,1@168h)
+	for _, v := range q["series"] {
+		for _, raw := range strings.Split(v, ",") {
+			if raw = strings.TrimSpace(raw); raw == "" {
+				continue
+			}
+			spec, err := ParseSeriesSpec(raw)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			opts.Series = append(opts.Series, spec)
+		}
+	}
+	if v := q.Get("bucket"); v != "" {
+		if opts.Bucket, err = time.ParseDuration(v); err != nil {
+			http.Error(w, "Neplatný bucket (např. 5m)", http.StatusBadRequest)
+			return
+		}
+	}
+
+	history, err := h.svc.GetMultiHistory(r.Context(), opts)
+	if err != nil {
+		h.writeServiceError(w, "Chyba při načítání řad", err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, history)
+}
+
+// handleSensorStats: GET /api/sensors/{id}/stats?range=7d&bucket=day&tz=Europe/Prague&above=25&below=18
+// Okno je 'range' (zpětně od teď), nebo 'from'/'to' (RFC3339 nebo datum v zóně 'tz').
+func (h *APIHandler) handleSensorStats(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+
+	units, err := ParseUnitSystem(q.Get("units"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts := StatsOptions{
+		Range:    q.Get("range"),
+		From:     q.Get("from"),
+		To:       q.Get("to"),
+		Timezone: q.Get("tz"),
+		Bucket:   q.Get("bucket"),
+		Units:    units,
+	}
+	// Prahy jsou volitelné; neplatné číslo je chyba klienta, ne tichý default
+	if opts.Above, err = queryFloat(r, "above"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Below, err = queryFloat(r, "below"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stats, err := h.svc.GetStats(r.Context(), id, opts)
+	if err != nil {
+		h.writeServiceError(w, "Chyba při výpočtu statistik", err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, stats)
+}
+
+// binaryOptions přečte společné parametry /intervals a /on-time.
+func binaryOptions(r *http.Request) BinaryOptions {
+	q := r.URL.Query()
+	return BinaryOptions{
+		Range:    q.Get("range"),
+		From:     q.Get("from"),
+		To:       q.Get("to"),
+		Timezone: q.Get("tz"),
+		Bucket:   q.Get("bucket"),
+		State:    q.Get("state"),
+	}
+}
+
+// handleSensorIntervals: GET /api/sensors/{id}/intervals?range=24h&state=on
+// Okno je stejné jako u statistik ('range', nebo 'from'/'to' v zóně 'tz').
+func (h *APIHandler) handleSensorIntervals(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	intervals, err := h.svc.GetIntervals(r.Context(), id, binaryOptions(r))
+	if err != nil {
+		h.writeServiceError(w, "Chyba při výpočtu intervalů", err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, intervals)
+}
+
+// handleSensorOnTime: GET /api/sensors/{id}/on-time?range=168h&bucket=day&tz=Europe/Prague
+func (h *APIHandler) handleSensorOnTime(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	onTime, err := h.svc.GetOnTime(r.Context(), id, binaryOptions(r))
+	if err != nil {
+		h.writeServiceError(w, "Chyba při výpočtu doby zapnutí", err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, onTime)
+}
+
+// handleSensorConsumption: GET /api/sensors/{id}/consumption?range=720h&bucket=day&tz=Europe/Prague
+// Okno je stejné jako u statistik, bucket: hour | day | week | month.
+func (h *APIHandler) handleSensorConsumption(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	consumption, err := h.svc.GetConsumption(r.Context(), id, ConsumptionOptions{
+		Range:    q.Get("range"),
+		From:     q.Get("from"),
+		To:       q.Get("to"),
+		Timezone: q.Get("tz"),
+		Bucket:   q.Get("bucket"),
+	})
+	if err != nil {
+		h.writeServiceError(w, "Chyba při výpočtu spotřeby", err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, consumption)
+}
+
+// handleListServices: GET /api/services
+func (h *APIHandler) handleListServices(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, h.svc.services.List(time.Now().UTC()))
+}
+
+// handleListDevices: GET /api/devices
+func (h *APIHandler) handleListDevices(w http.ResponseWriter, r *http.Request) {
+	devices, err := h.svc.GetDevices(r.Context())
+	if err != nil {
+		h.writeServiceError(w, "Chyba při načítání zařízení", err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, devices)
+}
+
+// --- POMOCNÉ FUNKCE ---
+
+// requireDB obalí handler, který potřebuje TimescaleDB. Bez DB (vestavěné úložiště)
+// odpoví 503 místo pádu na nil poolu.
+func (h *APIHandler) requireDB(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.svc.db == nil {
+			http.Error(w, "Funkce vyžaduje TimescaleDB (běží vestavěné úložiště)", http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// queryInt přečte celé číslo z query stringu. Chybějící nebo neplatná hodnota = def,
+// výsledek je oříznutý do intervalu <min, max>.
+func queryInt(r *http.Request, key string, def, min, max int) int {
+	v, err := strconv.Atoi(r.URL.Query().Get(key))
+	if err != nil {
+		return def
+	}
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// queryFloat přečte volitelné desetinné číslo z query stringu (chybí = nil).
+func queryFloat(r *http.Request, key string) (*float64, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("neplatný parametr '%s' (musí být číslo)", key)
+	}
+	return &f, nil
+}
+
+// pathID vytáhne číselné {id} z URL. Při chybě rovnou odpoví 400 a vrátí false.
+func pathID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Neplatné ID (musí být číslo)", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// writeJSON nastaví hlavičky, status a zapíše JSON odpověď.
+func (h *APIHandler) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.logger.Error("Chyba při zápisu JSON odpovědi", "error", err)
+	}
+}
+
+// writeServiceError převede chybu ze Service na HTTP status.
+// Validační a stavové chyby vracíme klientovi (pomůžou mu), interní jen logujeme.
+func (h *APIHandler) writeServiceError(w http.ResponseWriter, msg string, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		h.logger.Error(msg, "error", err)
+		http.Error(w, "Interní chyba serveru", http.StatusInternalServerError)
+	}
+}
+
 // CorsMiddleware je "obalová" funkce (Middleware).
 // Přidává HTTP hlavičky, které povolí prohlížeči (např. React appce na localhost:3000)
 // volat toto API běžící na jiném portu/doméně.
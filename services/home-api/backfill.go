@@ -0,0 +1,596 @@
+package homeapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"storage"
+)
+
+// --- IMPORT HISTORIE (BACKFILL) ---
+// Data ze starého loggeru nebo z SD karty zařízení dostaneme do 'sensor_data' bez ručního SQL.
+// Vstup je CSV (s hlavičkou) nebo NDJSON (jeden JSON objekt na řádek). Sloupce se mapují
+// podle názvu, senzor se hledá podle ID nebo mqtt_topic (pevně pro celý soubor, nebo ze sloupce).
+//
+// Každý řádek projde stejnou validací jako v Ingestoru: číslo, aktivní senzor, volitelně
+// kalibrace platná v čase měření a limity min/max typu senzoru. Kódy důvodů odmítnutí
+// odpovídají dead-letteru Ingestoru (invalid_number, below_min, above_max) + vlastní pro import.
+// Senzory nečíselných typů (boolean, enum, text, geo - viz postgres.sql sekce 18) import odmítá.
+//
+// Import je IDEMPOTENTNÍ: body se nahrají do dočasné tabulky a do 'sensor_data' se vloží jen ty,
+// které tam pro daný senzor a čas ještě nejsou. Stejný soubor lze tedy pustit znovu bez duplicit.
+// Dry-run provede vše včetně porovnání s DB, ale transakci vrátí (rollback).
+//
+// Používá ho endpoint POST /api/backfill i příkaz 'home-api backfill' (viz backfill_cmd.go).
+
+const (
+	// maxBackfillRows omezuje velikost jednoho importu (body držíme v paměti).
+	maxBackfillRows = 2_000_000
+
+	// maxReportErrors: kolik odmítnutých řádků vypíšeme jednotlivě (počty jsou vždy úplné).
+	maxReportErrors = 100
+
+	// futureTolerance: měření "z budoucnosti" je skoro jistě chyba časové zóny nebo formátu.
+	futureTolerance = 5 * time.Minute
+)
+
+// Kódy důvodů odmítnutí řádku.
+const (
+	BackfillInvalidNumber  = "invalid_number"
+	BackfillBelowMin       = "below_min"
+	BackfillAboveMax       = "above_max"
+	BackfillInvalidTime    = "invalid_time"
+	BackfillUnknownSensor  = "unknown_sensor"
+	BackfillInactiveSensor = "inactive_sensor"
+	BackfillMissingField   = "missing_field"
+	BackfillNotNumeric     = "not_numeric" // Senzor nečíselného typu (boolean, enum, text, geo)
+)
+
+// BackfillOptions popisuje formát vstupu a mapování sloupců.
+type BackfillOptions struct {
+	Format string // csv | ndjson
+
+	TimeColumn   string // Výchozí "time"
+	ValueColumn  string // Výchozí "value"
+	SensorColumn string // Sloupec s ID nebo mqtt_topic senzoru (prázdné = pevný senzor níže)
+
+	// Pevný senzor pro celý soubor (když SensorColumn není zadán). Stačí jedno z nich.
+	SensorID    int64
+	SensorTopic string
+
+	// TimeFormat: rfc3339 (výchozí, snese i "2006-01-02 15:04:05" bez zóny), unix, unix_ms,
+	// nebo Go layout (např. "02.01.2006 15:04").
+	TimeFormat string
+	// Timezone: zóna pro časy BEZ uvedené zóny (výchozí UTC), např. "Europe/Prague".
+	Timezone string
+
+	Delimiter    rune // CSV oddělovač (výchozí ',')
+	DecimalComma bool // Hodnoty s desetinnou čárkou ("21,5")
+
+	Calibrate bool // Surová data z SD karty - použít kalibraci platnou v čase měření
+	DryRun    bool
+}
+
+// BackfillRowError je jeden odmítnutý řádek v reportu.
+type BackfillRowError struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+	Detail string `json:"detail"`
+}
+
+// BackfillSensorReport je souhrn pro jeden senzor.
+type BackfillSensorReport struct {
+	SensorID int64     `json:"sensor_id"`
+	Topic    string    `json:"topic"`
+	Valid    int       `json:"valid"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+}
+
+// BackfillReport je výsledek importu (i dry-runu).
+type BackfillReport struct {
+	DryRun     bool                   `json:"dry_run"`
+	Rows       int                    `json:"rows"`       // Datových řádků ve vstupu
+	Valid      int                    `json:"valid"`      // Prošlo validací
+	Rejected   int                    `json:"rejected"`   // Neprošlo validací
+	Inserted   int64                  `json:"inserted"`   // Vloženo (u dry-runu: vložilo by se)
+	Duplicates int64                  `json:"duplicates"` // Už v DB nebo opakované ve vstupu
+	ByReason   map[string]int         `json:"by_reason"`
+	Sensors    []BackfillSensorReport `json:"sensors"`
+	Errors     []BackfillRowError     `json:"errors"` // Prvních maxReportErrors odmítnutí
+}
+
+// backfillSensor je senzor s tím, co potřebujeme k validaci.
+type backfillSensor struct {
+	ID           int64
+	Topic        string
+	Active       bool
+	MinValue     *float64
+	MaxValue     *float64
+	Kind         string // sensor_types.value_kind
+	Calibrations []storage.Calibration
+}
+
+// backfillPoint je jeden validní bod čekající na vložení.
+type backfillPoint struct {
+	Time     time.Time
+	SensorID int64
+	Value    float64
+}
+
+// rowGetter vrací hodnotu pole podle názvu sloupce (false = pole chybí).
+type rowGetter func(name string) (string, bool)
+
+// Backfill načte vstup, zvaliduje ho a (mimo dry-run) vloží chybějící body do 'sensor_data'.
+// Chyba v parametrech nebo nečitelný vstup vrací ErrInvalid; chyby jednotlivých řádků jsou v reportu.
+func (s *Service) Backfill(ctx context.Context, r io.Reader, opts BackfillOptions) (*BackfillReport, error) {
+	opts, loc, err := normalizeBackfillOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. Senzory (a případně kalibrace) pro validaci
+	byID, byTopic, err := s.loadBackfillSensors(ctx, opts.Calibrate)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixed *backfillSensor
+	if opts.SensorColumn == "" {
+		fixed = lookupBackfillSensor(byID, byTopic, opts.SensorTopic)
+		if opts.SensorID > 0 {
+			fixed = byID[opts.SensorID]
+		}
+		if fixed == nil {
+			return nil, fmt.Errorf("%w: senzor %d/%q neexistuje", ErrInvalid, opts.SensorID, opts.SensorTopic)
+		}
+	}
+
+	report := &BackfillReport{DryRun: opts.DryRun, ByReason: make(map[string]int)}
+	reject := func(line int, reason, detail string) {
+		report.Rejected++
+		report.ByReason[reason]++
+		if len(report.Errors) < maxReportErrors {
+			report.Errors = append(report.Errors, BackfillRowError{Line: line, Reason: reason, Detail: detail})
+		}
+	}
+
+	// 2. Čtení a validace řádků
+	var points []backfillPoint
+	now := time.Now()
+	err = readBackfillRows(r, opts, func(line int, get rowGetter) error {
+		report.Rows++
+		if report.Rows > maxBackfillRows {
+			return fmt.Errorf("%w: vstup má víc než %d řádků, rozdělte ho", ErrInvalid, maxBackfillRows)
+		}
+
+		// Senzor
+		sensor := fixed
+		if sensor == nil {
+			key, ok := get(opts.SensorColumn)
+			if !ok || key == "" {
+				reject(line, BackfillMissingField, "chybí sloupec "+opts.SensorColumn)
+				return nil
+			}
+			if sensor = lookupBackfillSensor(byID, byTopic, key); sensor == nil {
+				reject(line, BackfillUnknownSensor, fmt.Sprintf("senzor '%s' neexistuje", key))
+				return nil
+			}
+		}
+		if !sensor.Active {
+			reject(line, BackfillInactiveSensor, fmt.Sprintf("senzor %d není aktivní", sensor.ID))
+			return nil
+		}
+		if storage.IsStateKind(sensor.Kind) {
+			reject(line, BackfillNotNumeric, fmt.Sprintf("senzor %d má nečíselné hodnoty (%s) - import umí jen čísla", sensor.ID, sensor.Kind))
+			return nil
+		}
+
+		// Čas
+		rawTime, ok := get(opts.TimeColumn)
+		if !ok || rawTime == "" {
+			reject(line, BackfillMissingField, "chybí sloupec "+opts.TimeColumn)
+			return nil
+		}
+		t, err := parseBackfillTime(rawTime, opts.TimeFormat, loc)
+		if err != nil {
+			reject(line, BackfillInvalidTime, err.Error())
+			return nil
+		}
+		if t.After(now.Add(futureTolerance)) {
+			reject(line, BackfillInvalidTime, fmt.Sprintf("čas %s je v budoucnosti (špatná zóna?)", t.Format(time.RFC3339)))
+			return nil
+		}
+
+		// Hodnota - stejně jako Ingestor: číslo -> kalibrace -> min/max
+		rawValue, ok := get(opts.ValueColumn)
+		if !ok {
+			reject(line, BackfillMissingField, "chybí sloupec "+opts.ValueColumn)
+			return nil
+		}
+		if opts.DecimalComma {
+			rawValue = strings.Replace(rawValue, ",", ".", 1)
+		}
+		val, err := strconv.ParseFloat(strings.TrimSpace(rawValue), 64)
+		if err != nil || math.IsNaN(val) || math.IsInf(val, 0) {
+			reject(line, BackfillInvalidNumber, fmt.Sprintf("hodnota '%s' není platné číslo", rawValue))
+			return nil
+		}
+		if cal, ok := storage.ActiveCalibration(sensor.Calibrations, t); ok {
+			val = cal.Apply(val)
+		}
+		if sensor.MinValue != nil && val < *sensor.MinValue {
+			reject(line, BackfillBelowMin, fmt.Sprintf("hodnota %.2f je pod minimálním limitem %.2f", val, *sensor.MinValue))
+			return nil
+		}
+		if sensor.MaxValue != nil && val > *sensor.MaxValue {
+			reject(line, BackfillAboveMax, fmt.Sprintf("hodnota %.2f je nad maximálním limitem %.2f", val, *sensor.MaxValue))
+			return nil
+		}
+
+		points = append(points, backfillPoint{Time: t.UTC(), SensorID: sensor.ID, Value: val})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Valid = len(points)
+	report.Sensors = summarizeBackfill(points, byID)
+
+	if len(points) == 0 {
+		return report, nil
+	}
+
+	// 3. Vložení (idempotentní) - v dry-runu stejný postup, jen s rollbackem
+	inserted, err := s.insertBackfill(ctx, points, opts.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	report.Inserted = inserted
+	report.Duplicates = int64(len(points)) - inserted
+
+	s.logger.Info("Backfill dokončen", "dry_run", opts.DryRun, "rows", report.Rows, "valid", report.Valid,
+		"rejected", report.Rejected, "inserted", report.Inserted, "duplicates", report.Duplicates)
+	return report, nil
+}
+
+// insertBackfill nahraje body do dočasné tabulky a vloží jen ty, které v 'sensor_data' ještě nejsou.
+// Duplicity uvnitř vstupu (stejný senzor a čas) se vloží jen jednou - vyhrává první výskyt.
+func (s *Service) insertBackfill(ctx context.Context, points []backfillPoint, dryRun bool) (int64, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	// Rollback po Commitu nic nedělá - u dry-runu je to jediný konec transakce.
+	defer tx.Rollback(context.Background())
+
+	// ON COMMIT DROP: tabulka zmizí s koncem transakce, souběžné importy se nepotkají
+	// (dočasné tabulky jsou vidět jen ve vlastním spojení).
+	if _, err := tx.Exec(ctx, `
+		CREATE TEMP TABLE backfill_points (
+			seq BIGINT, time TIMESTAMPTZ, sensor_id INTEGER, value DOUBLE PRECISION
+		) ON COMMIT DROP
+	`); err != nil {
+		return 0, fmt.Errorf("vytvoření dočasné tabulky selhalo: %w", err)
+	}
+
+	_, err = tx.CopyFrom(ctx,
+		pgx.Identifier{"backfill_points"},
+		[]string{"seq", "time", "sensor_id", "value"},
+		pgx.CopyFromSlice(len(points), func(i int) ([]any, error) {
+			p := points[i]
+			return []any{int64(i), p.Time, p.SensorID, p.Value}, nil
+		}),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("nahrání bodů selhalo: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO sensor_data (time, sensor_id, value)
+		SELECT DISTINCT ON (b.sensor_id, b.time) b.time, b.sensor_id, b.value
+		FROM backfill_points b
+		WHERE NOT EXISTS (
+			SELECT 1 FROM sensor_data d
+			WHERE d.sensor_id = b.sensor_id AND d.time = b.time
+		)
+		ORDER BY b.sensor_id, b.time, b.seq
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("vložení do sensor_data selhalo: %w", err)
+	}
+
+	if dryRun {
+		return tag.RowsAffected(), nil // defer -> rollback
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// loadBackfillSensors načte všechny senzory (i neaktivní - kvůli srozumitelnému důvodu odmítnutí).
+func (s *Service) loadBackfillSensors(ctx context.Context, withCalibrations bool) (map[int64]*backfillSensor, map[string]*backfillSensor, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT s.id, s.mqtt_topic, COALESCE(s.is_active, false), st.min_value, st.max_value,
+		       COALESCE(st.value_kind, 'number')
+		FROM sensors s
+		JOIN sensor_types st ON st.id = s.sensor_type_id
+	`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("db query failed: %w", err)
+	}
+	defer rows.Close()
+
+	byID := make(map[int64]*backfillSensor)
+	byTopic := make(map[string]*backfillSensor)
+	for rows.Next() {
+		var sn backfillSensor
+		if err := rows.Scan(&sn.ID, &sn.Topic, &sn.Active, &sn.MinValue, &sn.MaxValue, &sn.Kind); err != nil {
+			return nil, nil, err
+		}
+		byID[sn.ID] = &sn
+		byTopic[sn.Topic] = &sn
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if !withCalibrations {
+		return byID, byTopic, nil
+	}
+
+	// Všechny verze kalibrací - historická data potřebují tu, která platila v čase měření.
+	calRows, err := s.db.Query(ctx, `
+		SELECT sensor_id, effective_from, scale, offset_value, points
+		FROM sensor_calibrations
+		ORDER BY sensor_id, effective_from ASC
+	`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("db query (calibrations) failed: %w", err)
+	}
+	defer calRows.Close()
+
+	for calRows.Next() {
+		var sensorID int64
+		var c storage.Calibration
+		var points []byte
+		if err := calRows.Scan(&sensorID, &c.EffectiveFrom, &c.Scale, &c.Offset, &points); err != nil {
+			return nil, nil, err
+		}
+		// Neplatnou verzi přeskočí i Ingestor (jede dál na poslední platné starší) - backfill
+		// musí přepočítat stejně.
+		if c.Points, err = storage.ParseCalibrationPoints(points); err != nil {
+			s.logger.Warn("Neplatná kalibrační tabulka, přeskakuji", "sensor_id", sensorID, "effective_from", c.EffectiveFrom, "error", err)
+			continue
+		}
+		if sn, ok := byID[sensorID]; ok {
+			sn.Calibrations = append(sn.Calibrations, c)
+		}
+	}
+	return byID, byTopic, calRows.Err()
+}
+
+// lookupBackfillSensor najde senzor podle ID (číslo) nebo mqtt_topic.
+func lookupBackfillSensor(byID map[int64]*backfillSensor, byTopic map[string]*backfillSensor, key string) *backfillSensor {
+	key = strings.TrimSpace(key)
+	if sn, ok := byTopic[key]; ok {
+		return sn
+	}
+	if id, err := strconv.ParseInt(key, 10, 64); err == nil {
+		return byID[id]
+	}
+	return nil
+}
+
+// normalizeBackfillOptions doplní výchozí hodnoty a ověří parametry.
+func normalizeBackfillOptions(opts BackfillOptions) (BackfillOptions, *time.Location, error) {
+	if opts.Format == "" {
+		opts.Format = "csv"
+	}
+	if opts.Format != "csv" && opts.Format != "ndjson" {
+		return opts, nil, fmt.Errorf("%w: format musí být csv nebo ndjson", ErrInvalid)
+	}
+	if opts.TimeColumn == "" {
+		opts.TimeColumn = "time"
+	}
+	if opts.ValueColumn == "" {
+		opts.ValueColumn = "value"
+	}
+	if opts.TimeFormat == "" {
+		opts.TimeFormat = "rfc3339"
+	}
+	if opts.Delimiter == 0 {
+		opts.Delimiter = ','
+	}
+	if opts.SensorColumn == "" && opts.SensorID == 0 && opts.SensorTopic == "" {
+		return opts, nil, fmt.Errorf("%w: zadejte sensor_column, nebo pevný sensor_id / sensor_topic", ErrInvalid)
+	}
+
+	loc := time.UTC
+	if opts.Timezone != "" {
+		l, err := time.LoadLocation(opts.Timezone)
+		if err != nil {
+			return opts, nil, fmt.Errorf("%w: neznámá časová zóna %q", ErrInvalid, opts.Timezone)
+		}
+		loc = l
+	}
+	return opts, loc, nil
+}
+
+// localLayouts jsou běžné zápisy času BEZ zóny (interpretují se v zadané zóně).
+var localLayouts = []string{
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04",
+}
+
+// parseBackfillTime převede text na čas podle formátu.
+func parseBackfillTime(raw, format string, loc *time.Location) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	switch format {
+	case "unix", "unix_ms":
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("'%s' není unixový čas", raw)
+		}
+		if format == "unix_ms" {
+			return time.UnixMilli(int64(n)), nil
+		}
+		sec, frac := math.Modf(n)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+
+	case "rfc3339":
+		if t, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+			return t, nil
+		}
+		for _, layout := range localLayouts {
+			if t, err := time.ParseInLocation(layout, raw, loc); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("'%s' není čas ve formátu RFC3339 ani 'YYYY-MM-DD hh:mm:ss'", raw)
+
+	default:
+		// Vlastní Go layout. Pokud obsahuje zónu, ParseInLocation ji respektuje.
+		t, err := time.ParseInLocation(format, raw, loc)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("'%s' neodpovídá formátu '%s'", raw, format)
+		}
+		return t, nil
+	}
+}
+
+// readBackfillRows přečte vstup po řádcích a pro každý datový řádek zavolá 'fn'.
+// Chyba vrácená z 'fn' čtení ukončí. Nečitelný vstup (rozbité CSV) vrací ErrInvalid.
+func readBackfillRows(r io.Reader, opts BackfillOptions, fn func(line int, get rowGetter) error) error {
+	if opts.Format == "ndjson" {
+		return readNDJSON(r, fn)
+	}
+	return readCSV(r, opts.Delimiter, fn)
+}
+
+func readCSV(r io.Reader, delimiter rune, fn func(line int, get rowGetter) error) error {
+	cr := csv.NewReader(r)
+	cr.Comma = delimiter
+	cr.FieldsPerRecord = -1 // Kratší řádky hlásíme jako missing_field, ne jako chybu celého souboru
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("%w: nelze přečíst hlavičku CSV: %w", ErrInvalid, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		// BOM na začátku souboru (export z Excelu) by jinak byl součástí názvu prvního sloupce.
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: chyba CSV: %w", ErrInvalid, err)
+		}
+		line, _ := cr.FieldPos(0)
+
+		get := func(name string) (string, bool) {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return "", false
+			}
+			return record[i], true
+		}
+		if err := fn(line, get); err != nil {
+			return err
+		}
+	}
+}
+
+func readNDJSON(r io.Reader, fn func(line int, get rowGetter) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		// UseNumber: číslo si necháme jako text, ať ho parsujeme stejně jako v CSV.
+		var obj map[string]any
+		dec := json.NewDecoder(strings.NewReader(text))
+		dec.UseNumber()
+		if err := dec.Decode(&obj); err != nil {
+			obj = nil // Řádek, který není objekt - všechna pole "chybí"
+		}
+
+		get := func(name string) (string, bool) {
+			v, ok := obj[name]
+			if !ok || v == nil {
+				return "", false
+			}
+			switch val := v.(type) {
+			case string:
+				return val, true
+			case json.Number:
+				return val.String(), true
+			case bool:
+				if val {
+					return "1", true
+				}
+				return "0", true
+			default:
+				return fmt.Sprint(val), true
+			}
+		}
+		if err := fn(line, get); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%w: chyba čtení NDJSON: %w", ErrInvalid, err)
+	}
+	return nil
+}
+
+// summarizeBackfill spočítá souhrn validních bodů po senzorech.
+func summarizeBackfill(points []backfillPoint, byID map[int64]*backfillSensor) []BackfillSensorReport {
+	bySensor := make(map[int64]*BackfillSensorReport)
+	for _, p := range points {
+		rep, ok := bySensor[p.SensorID]
+		if !ok {
+			rep = &BackfillSensorReport{SensorID: p.SensorID, Topic: byID[p.SensorID].Topic, From: p.Time, To: p.Time}
+			bySensor[p.SensorID] = rep
+		}
+		rep.Valid++
+		if p.Time.Before(rep.From) {
+			rep.From = p.Time
+		}
+		if p.Time.After(rep.To) {
+			rep.To = p.Time
+		}
+	}
+
+	out := make([]BackfillSensorReport, 0, len(bySensor))
+	for _, rep := range bySensor {
+		out = append(out, *rep)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].SensorID < out[j].SensorID })
+	return out
+}
@@ -0,0 +1,96 @@
+package homeapi
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// --- PŘÍKAZ 'backfill' ---
+// Import historie z příkazové řádky (bez HTTP, přímo do DB). Používá stejnou logiku
+// jako endpoint POST /api/backfill (viz backfill.go).
+//
+// Příklady:
+//   home-api backfill -sensor-topic /msh/living/temp -timezone Europe/Prague -dry-run stary_logger.csv
+//   home-api backfill -format ndjson -sensor-column topic -calibrate sd_karta.ndjson
+//   cat data.csv | home-api backfill -sensor-id 5 -delimiter ';' -decimal-comma -time-format "02.01.2006 15:04" -
+//
+// Report (JSON) jde na stdout, logy na stderr. Návratový kód 1 = import neproběhl.
+
+// RunBackfillCommand zpracuje argumenty za 'backfill' a vrátí návratový kód procesu.
+func RunBackfillCommand(args []string) int {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	var opts BackfillOptions
+	var delimiter string
+	fs.StringVar(&opts.Format, "format", "csv", "formát vstupu: csv | ndjson")
+	fs.StringVar(&opts.TimeColumn, "time-column", "time", "sloupec s časem")
+	fs.StringVar(&opts.ValueColumn, "value-column", "value", "sloupec s hodnotou")
+	fs.StringVar(&opts.SensorColumn, "sensor-column", "", "sloupec s ID nebo mqtt_topic senzoru")
+	fs.Int64Var(&opts.SensorID, "sensor-id", 0, "pevné ID senzoru pro celý soubor")
+	fs.StringVar(&opts.SensorTopic, "sensor-topic", "", "pevný mqtt_topic senzoru pro celý soubor")
+	fs.StringVar(&opts.TimeFormat, "time-format", "rfc3339", "rfc3339 | unix | unix_ms | Go layout")
+	fs.StringVar(&opts.Timezone, "timezone", "UTC", "zóna pro časy bez uvedené zóny")
+	fs.StringVar(&delimiter, "delimiter", ",", "oddělovač CSV (jeden znak)")
+	fs.BoolVar(&opts.DecimalComma, "decimal-comma", false, "hodnoty s desetinnou čárkou")
+	fs.BoolVar(&opts.Calibrate, "calibrate", false, "přepočítat surová data kalibrací platnou v čase měření")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "jen ověřit a spočítat, nic neukládat")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Použití: home-api backfill [volby] SOUBOR (nebo - pro stdin)")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+	if utf8.RuneCountInString(delimiter) != 1 {
+		logger.Error("Oddělovač musí být jeden znak", "delimiter", delimiter)
+		return 1
+	}
+	opts.Delimiter, _ = utf8.DecodeRuneInString(delimiter)
+
+	// Vstup: soubor nebo stdin
+	var input io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			logger.Error("Nelze otevřít soubor", "path", path, "error", err)
+			return 1
+		}
+		defer f.Close()
+		input = f
+	}
+
+	// Stačí DB - Valkey ani MQTT import nepotřebuje.
+	cfg := LoadConfig()
+	ctx := context.Background()
+	dbPool, err := pgxpool.New(ctx, cfg.PostgresURL)
+	if err != nil {
+		logger.Error("Nelze se připojit k DB", "error", err)
+		return 1
+	}
+	defer dbPool.Close()
+
+	svc := NewService(cfg, dbPool, nil, nil, logger)
+	report, err := svc.Backfill(ctx, input, opts)
+	if err != nil {
+		logger.Error("Backfill selhal", "error", err)
+		return 1
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+	return 0
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	homeapi "home-api"
+)
+
+// Samostatná binárka Home API (Docker image).
+// Veškerá logika je v balíčku homeapi - stejný kód běží i v režimu all-in-one.
+func main() {
+	// 0. Příkazy (jednorázové úlohy místo HTTP serveru): home-api backfill ...
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		os.Exit(homeapi.RunBackfillCommand(os.Args[2:]))
+	}
+
+	// 1. Nastavení logování na JSON (standard pro kontejnery)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	slog.SetDefault(logger)
+
+	// 2. Context zrušený signálem SIGINT (Ctrl+C) nebo SIGTERM (Docker stop) = graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// 3. Běh služby (blokuje do signálu)
+	if err := homeapi.Run(ctx, homeapi.LoadConfig(), logger); err != nil {
+		logger.Error("Kritická chyba", "error", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,334 @@
+package homeapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jackc/pgx/v5"
+)
+
+// --- PŘÍKAZY PRO AKČNÍ ČLENY ---
+// Průběh jednoho příkazu:
+//  1. Záznam do 'command_history' se stavem 'pending' a náhodným correlation ID.
+//  2. Publikace JSONu {"correlation_id": "...", "value": 1} na command_topic senzoru.
+//  3. Čekání na potvrzení: zařízení musí na svém state topicu (mqtt_topic senzoru)
+//     poslat JSON se stejným correlation_id. Zpráva s CIZÍM correlation_id (odpověď na jiný
+//     příkaz) potvrzením není. Zařízení, které correlation_id neposílá, potvrdí příkaz
+//     požadovanou hodnotou - ale jen zprávou přijatou PO odeslání příkazu.
+//     Potvrzení je zároveň nový stav zařízení: sensor-ingestor z JSONu vezme 'value'
+//     (unwrapValue) a uloží ho do historie i cache jako prostý payload.
+//  4. Podle výsledku stav 'confirmed', 'timeout' nebo 'failed'.
+
+// CommandMessage je payload, který posíláme zařízení.
+type CommandMessage struct {
+	CorrelationID string  `json:"correlation_id"`
+	Value         float64 `json:"value"`
+}
+
+// stateUpdate je jedna zpráva ze state topicu zařízení.
+type stateUpdate struct {
+	Value         *float64  // nil, pokud payload nešel přečíst jako číslo
+	CorrelationID string    // Vyplněno, pokud zařízení poslalo JSON s correlation_id
+	Received      time.Time // Kdy zprávu přijal handler
+}
+
+// StateWatcher odebírá state topicy zařízení a předává zprávy čekajícím příkazům.
+// Topic si předplatí až při prvním příkazu a pak už odběr drží (zařízení se ovládají opakovaně).
+type StateWatcher struct {
+	client mqtt.Client
+	logger *slog.Logger
+
+	mu         sync.Mutex
+	subscribed map[string]bool
+	waiters    map[string]map[chan stateUpdate]struct{} // topic -> sada čekajících
+
+	// correlating: Topicy, na kterých zařízení posílá correlation_id. Takové zařízení
+	// musí potvrzovat correlation ID - samotná hodnota pak potvrzením není.
+	correlating map[string]bool
+}
+
+// NewStateWatcher - konstruktor
+func NewStateWatcher(client mqtt.Client, logger *slog.Logger) *StateWatcher {
+	return &StateWatcher{
+		client:      client,
+		logger:      logger,
+		subscribed:  make(map[string]bool),
+		waiters:     make(map[string]map[chan stateUpdate]struct{}),
+		correlating: make(map[string]bool),
+	}
+}
+
+// Watch zaregistruje čekajícího na topicu. Volající MUSÍ zavolat vrácenou funkci 'stop'.
+// Registrujeme PŘED odesláním příkazu, jinak by rychlé zařízení mohlo odpovědět dřív, než posloucháme.
+func (w *StateWatcher) Watch(topic string) (<-chan stateUpdate, func(), error) {
+	ch := make(chan stateUpdate, 4)
+
+	w.mu.Lock()
+	if w.waiters[topic] == nil {
+		w.waiters[topic] = make(map[chan stateUpdate]struct{})
+	}
+	w.waiters[topic][ch] = struct{}{}
+	needSubscribe := !w.subscribed[topic]
+	w.mu.Unlock()
+
+	stop := func() {
+		w.mu.Lock()
+		delete(w.waiters[topic], ch)
+		w.mu.Unlock()
+	}
+
+	if needSubscribe {
+		token := w.client.Subscribe(topic, 1, w.handle)
+		if token.Wait() && token.Error() != nil {
+			stop()
+			return nil, nil, fmt.Errorf("subscribe na %s selhal: %w", topic, token.Error())
+		}
+		w.mu.Lock()
+		w.subscribed[topic] = true
+		w.mu.Unlock()
+	}
+
+	return ch, stop, nil
+}
+
+// handle je MQTT callback pro všechny sledované state topicy.
+func (w *StateWatcher) handle(_ mqtt.Client, msg mqtt.Message) {
+	// Retained zpráva je starý stav (poslaný před příkazem) - potvrzením být nemůže.
+	if msg.Retained() {
+		return
+	}
+
+	update := parseStatePayload(msg.Payload())
+	update.Received = time.Now()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if update.CorrelationID != "" {
+		w.correlating[msg.Topic()] = true
+	}
+	for ch := range w.waiters[msg.Topic()] {
+		select {
+		case ch <- update:
+		default: // Čekající nestíhá číst - zprávu pro něj zahodíme, handler nesmí blokovat
+		}
+	}
+}
+
+// Correlates vrací, zda zařízení na topicu posílá correlation_id (od startu API).
+func (w *StateWatcher) Correlates(topic string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.correlating[topic]
+}
+
+// parseStatePayload přečte stav zařízení. Podporuje prosté číslo ("1"),
+// textové ON/OFF a JSON {"value": 1, "correlation_id": "..."}.
+func parseStatePayload(payload []byte) stateUpdate {
+	raw := strings.TrimSpace(string(payload))
+
+	if v, err := strconv.ParseFloat(raw, 64); err == nil {
+		return stateUpdate{Value: &v}
+	}
+
+	switch strings.ToLower(raw) {
+	case "on", "true":
+		v := 1.0
+		return stateUpdate{Value: &v}
+	case "off", "false":
+		v := 0.0
+		return stateUpdate{Value: &v}
+	}
+
+	var msg struct {
+		CorrelationID string   `json:"correlation_id"`
+		Value         *float64 `json:"value"`
+	}
+	if err := json.Unmarshal(payload, &msg); err == nil {
+		return stateUpdate{Value: msg.Value, CorrelationID: msg.CorrelationID}
+	}
+
+	return stateUpdate{}
+}
+
+// newCorrelationID vygeneruje náhodné ID příkazu (128 bitů, hex).
+func newCorrelationID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// SendCommand odešle příkaz akčnímu členu a počká na potvrzení nebo timeout.
+// Vrácený CommandDTO má stav 'confirmed', 'timeout' nebo 'failed'.
+func (s *Service) SendCommand(ctx context.Context, sensorID int64, req CommandRequest) (*CommandDTO, error) {
+	// 1. Validace: senzor musí existovat, být typu 'switch' a mít command_topic.
+	var stateTopic, typeName string
+	var commandTopic *string
+	var active bool
+	err := s.db.QueryRow(ctx, `
+		SELECT s.mqtt_topic, s.command_topic, st.name, COALESCE(s.is_active, false)
+		FROM sensors s
+		JOIN sensor_types st ON s.sensor_type_id = st.id
+		WHERE s.id = $1`, sensorID).Scan(&stateTopic, &commandTopic, &typeName, &active)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, fmt.Errorf("%w: senzor %d není aktivní", ErrInvalid, sensorID)
+	}
+	if typeName != "switch" || commandTopic == nil || *commandTopic == "" {
+		return nil, fmt.Errorf("%w: senzor %d není ovladatelný (chybí command_topic nebo není typu switch)", ErrInvalid, sensorID)
+	}
+	if req.Value != 0 && req.Value != 1 {
+		return nil, fmt.Errorf("%w: switch přijímá pouze hodnoty 0 a 1", ErrInvalid)
+	}
+
+	corrID, err := newCorrelationID()
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Záznam do historie (pending)
+	cmd := &CommandDTO{
+		CorrelationID:  corrID,
+		SensorID:       sensorID,
+		CommandTopic:   *commandTopic,
+		RequestedValue: req.Value,
+		Status:         "pending",
+	}
+	err = s.db.QueryRow(ctx, `
+		INSERT INTO command_history (correlation_id, sensor_id, command_topic, requested_value, status)
+		VALUES ($1, $2, $3, $4, 'pending')
+		RETURNING id, requested_at`,
+		corrID, sensorID, cmd.CommandTopic, req.Value).Scan(&cmd.ID, &cmd.RequestedAt)
+	if err != nil {
+		return nil, fmt.Errorf("zápis do historie příkazů selhal: %w", err)
+	}
+
+	// 3. Začneme poslouchat state topic (ještě před odesláním!)
+	updates, stop, err := s.states.Watch(stateTopic)
+	if err != nil {
+		return s.finishCommand(cmd, "failed", nil, err.Error())
+	}
+	defer stop()
+
+	// 4. Odeslání příkazu (QoS 1 - broker doručení potvrdí)
+	payload, _ := json.Marshal(CommandMessage{CorrelationID: corrID, Value: req.Value})
+	publishedAt := time.Now() // Stav přijatý dřív je odpověď na něco jiného
+	token := s.mqtt.Publish(cmd.CommandTopic, 1, false, payload)
+	if !token.WaitTimeout(s.cfg.CommandTimeout) || token.Error() != nil {
+		msg := "publikace příkazu nebyla potvrzena brokerem"
+		if token.Error() != nil {
+			msg = token.Error().Error()
+		}
+		return s.finishCommand(cmd, "failed", nil, msg)
+	}
+	s.logger.Info("Příkaz odeslán", "sensor_id", sensorID, "topic", cmd.CommandTopic, "value", req.Value, "correlation_id", corrID)
+
+	// 5. Čekání na potvrzení
+	timeout := time.NewTimer(s.cfg.CommandTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case u := <-updates:
+			if commandConfirmed(u, corrID, req.Value, publishedAt, s.states.Correlates(stateTopic)) {
+				return s.finishCommand(cmd, "confirmed", u.Value, "")
+			}
+		case <-timeout.C:
+			return s.finishCommand(cmd, "timeout", nil, fmt.Sprintf("zařízení nepotvrdilo stav do %s", s.cfg.CommandTimeout))
+		case <-ctx.Done():
+			// Klient odešel (zavřel spojení). Příkaz už ale letí - zaznamenáme timeout.
+			return s.finishCommand(cmd, "timeout", nil, "požadavek zrušen klientem")
+		}
+	}
+}
+
+// commandConfirmed rozhodne, zda zpráva ze state topicu potvrzuje příkaz 'corrID':
+//   - stejné correlation ID potvrzuje vždy,
+//   - cizí correlation ID nikdy (odpověď na souběžný příkaz na stejné zařízení),
+//   - bez correlation ID potvrdí požadovaná hodnota, jen pokud přišla po odeslání příkazu
+//     a zařízení correlation ID neposílá vůbec (jinak by ji mohl vyvolat jiný příkaz).
+func commandConfirmed(u stateUpdate, corrID string, requested float64, publishedAt time.Time, deviceCorrelates bool) bool {
+	switch {
+	case u.CorrelationID == corrID:
+		return true
+	case u.CorrelationID != "":
+		return false
+	case deviceCorrelates || u.Value == nil || u.Received.Before(publishedAt):
+		return false
+	default:
+		return math.Abs(*u.Value-requested) < 1e-9
+	}
+}
+
+// finishCommand zapíše výsledek příkazu do historie a vrátí aktualizované DTO.
+// Používá vlastní context: výsledek chceme uložit i tehdy, když klient mezitím odešel.
+func (s *Service) finishCommand(cmd *CommandDTO, status string, value *float64, errMsg string) (*CommandDTO, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cmd.Status = status
+	cmd.ConfirmedValue = value
+	if errMsg != "" {
+		cmd.Error = &errMsg
+	}
+
+	err := s.db.QueryRow(ctx, `
+		UPDATE command_history
+		SET status = $2,
+		    confirmed_at = CASE WHEN $2 = 'confirmed' THEN NOW() END,
+		    confirmed_value = $3,
+		    error = NULLIF($4, '')
+		WHERE id = $1
+		RETURNING confirmed_at`, cmd.ID, status, value, errMsg).Scan(&cmd.ConfirmedAt)
+	if err != nil {
+		return cmd, fmt.Errorf("zápis výsledku příkazu selhal: %w", err)
+	}
+
+	if status != "confirmed" {
+		s.logger.Warn("Příkaz nepotvrzen", "sensor_id", cmd.SensorID, "status", status, "error", errMsg)
+	}
+	return cmd, nil
+}
+
+// GetCommandHistory vrací posledních 'limit' příkazů pro senzor (nejnovější první).
+func (s *Service) GetCommandHistory(ctx context.Context, sensorID int64, limit int) ([]CommandDTO, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, correlation_id, sensor_id, command_topic, requested_value, status,
+		       requested_at, confirmed_at, confirmed_value, error
+		FROM command_history
+		WHERE sensor_id = $1
+		ORDER BY requested_at DESC
+		LIMIT $2`, sensorID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("db query failed: %w", err)
+	}
+	defer rows.Close()
+
+	history := make([]CommandDTO, 0)
+	for rows.Next() {
+		var c CommandDTO
+		if err := rows.Scan(&c.ID, &c.CorrelationID, &c.SensorID, &c.CommandTopic, &c.RequestedValue, &c.Status,
+			&c.RequestedAt, &c.ConfirmedAt, &c.ConfirmedValue, &c.Error); err != nil {
+			return nil, err
+		}
+		history = append(history, c)
+	}
+	return history, rows.Err()
+}
@@ -0,0 +1,198 @@
+package homeapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"storage"
+)
+
+// --- POROVNÁNÍ VÍCE ŘAD ---
+// GET /api/history?series=1&series=4&series=1@168h&range=24h vrací několik řad zarovnaných
+// do SPOLEČNÝCH bucketů (stejná časová osa pro všechny). Dashboard je pak může vykreslit
+// do jednoho grafu bez dopočítávání na straně prohlížeče.
+//
+// Řada je "<id senzoru>" nebo "<id>@<posun>": posun vezme stejný senzor o danou dobu dříve
+// a jeho časy přičte, takže "1@168h" je "minulý týden" položený přes tento týden.
+//
+// Hodnota bucketu je průměr bodů v bucketu; prázdný bucket je null (v grafu mezera).
+// Data se čtou z nejhrubší vrstvy historie, která velikosti bucketu stačí (viz tiers.go).
+
+const (
+	// maxCompareSeries: Víc řad se do jednoho grafu stejně nevejde (a každá je jeden dotaz).
+	maxCompareSeries = 8
+
+	// maxCompareBuckets: Horní mez délky časové osy (bodů na řadu).
+	maxCompareBuckets = 2000
+
+	// targetCompareBuckets: Cílový počet bucketů při automatické volbě velikosti.
+	targetCompareBuckets = 300
+)
+
+// compareBucketSizes jsou "hezké" velikosti bucketů pro automatickou volbu (vzestupně).
+var compareBucketSizes = []time.Duration{
+	10 * time.Second, 30 * time.Second,
+	time.Minute, 5 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+// SeriesSpec je jedna požadovaná řada.
+type SeriesSpec struct {
+	SensorID int64
+	Offset   time.Duration // 0 = stejné okno; >0 = o tolik dříve
+}
+
+// ParseSeriesSpec přečte řadu ve tvaru "<id>" nebo "<id>@<posun>" (např. "5@168h").
+func ParseSeriesSpec(raw string) (SeriesSpec, error) {
+	idStr, offStr, hasOffset := strings.Cut(raw, "@")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || id <= 0 {
+		return SeriesSpec{}, fmt.Errorf("%w: neplatná řada %q (očekáváno <id> nebo <id>@<posun>)", ErrInvalid, raw)
+	}
+	spec := SeriesSpec{SensorID: id}
+	if hasOffset {
+		off, err := time.ParseDuration(offStr)
+		if err != nil || off < 0 {
+			return SeriesSpec{}, fmt.Errorf("%w: neplatný posun %q u řady %q (např. 168h)", ErrInvalid, offStr, raw)
+		}
+		spec.Offset = off
+	}
+	return spec, nil
+}
+
+// CompareOptions jsou parametry porovnání.
+type CompareOptions struct {
+	Series []SeriesSpec
+	Range  string        // Délka okna zpětně od teď (default 24h)
+	Bucket time.Duration // 0 = automaticky podle délky okna
+	Units  UnitSystem
+}
+
+// SeriesDTO je jedna řada porovnání. Values odpovídají polím Times v MultiHistoryDTO.
+type SeriesDTO struct {
+	SensorID int64      `json:"sensor_id"`
+	Name     string     `json:"name"`
+	Unit     string     `json:"unit"`
+	Offset   string     `json:"offset,omitempty"` // Např. "168h0m0s"; prázdné = bez posunu
+	Tier     string     `json:"tier"`             // Vrstva historie (raw, 5m, 1h, 1d), viz tiers.go
+	Values   []*float64 `json:"values"`           // nil = v bucketu nebyla data
+}
+
+// MultiHistoryDTO je odpověď endpointu /api/history.
+type MultiHistoryDTO struct {
+	From          time.Time   `json:"from"`
+	To            time.Time   `json:"to"`
+	BucketSeconds int64       `json:"bucket_seconds"`
+	Times         []time.Time `json:"times"` // Začátky bucketů (společná osa X)
+	Series        []SeriesDTO `json:"series"`
+}
+
+// GetMultiHistory načte řady z opts a zarovná je do společných bucketů.
+func (s *Service) GetMultiHistory(ctx context.Context, opts CompareOptions) (*MultiHistoryDTO, error) {
+	// 1. Validace
+	if len(opts.Series) == 0 {
+		return nil, fmt.Errorf("%w: chybí parametr 'series'", ErrInvalid)
+	}
+	if len(opts.Series) > maxCompareSeries {
+		return nil, fmt.Errorf("%w: nejvýše %d řad", ErrInvalid, maxCompareSeries)
+	}
+	rng := opts.Range
+	if rng == "" {
+		rng = "24h"
+	}
+	dur, err := time.ParseDuration(rng)
+	if err != nil || dur <= 0 {
+		return nil, fmt.Errorf("%w: neplatný rozsah %q (např. 24h)", ErrInvalid, rng)
+	}
+	bucket := opts.Bucket
+	if bucket == 0 {
+		bucket = autoBucket(dur)
+	}
+	if bucket < time.Second {
+		return nil, fmt.Errorf("%w: bucket musí být alespoň 1s", ErrInvalid)
+	}
+	if dur/bucket > maxCompareBuckets {
+		return nil, fmt.Errorf("%w: příliš malý bucket pro rozsah %s (max. %d bodů)", ErrInvalid, rng, maxCompareBuckets)
+	}
+
+	// 2. Společná osa: začátek zarovnaný na násobek bucketu, aby se osa mezi dotazy neposouvala
+	to := time.Now().UTC()
+	from := to.Add(-dur).Truncate(bucket)
+	n := int(to.Sub(from)/bucket) + 1
+	times := make([]time.Time, n)
+	for i := range times {
+		times[i] = from.Add(time.Duration(i) * bucket)
+	}
+
+	result := &MultiHistoryDTO{From: from, To: to, BucketSeconds: int64(bucket / time.Second), Times: times}
+
+	// 3. Řady: posunuté okno se načte o Offset dříve a časy se posunou zpět na osu
+	for _, spec := range opts.Series {
+		sensor, err := s.store.SensorByID(ctx, spec.SensorID)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, fmt.Errorf("%w: senzor %d", ErrNotFound, spec.SensorID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if storage.IsStateKind(sensor.Kind) {
+			return nil, fmt.Errorf("%w: senzor %d nemá číselné hodnoty (%s)", ErrInvalid, spec.SensorID, sensor.Kind)
+		}
+		// Vrstvu historie volíme podle velikosti bucketu (viz tiers.go) - měsíc po hodinách
+		// tak čte hodinovou agregaci, ne statisíce surových řádků.
+		raw, tier, err := s.readTiered(ctx, spec.SensorID, from.Add(-spec.Offset), to.Add(-spec.Offset), bucket)
+		if err != nil {
+			return nil, fmt.Errorf("history query failed: %w", err)
+		}
+
+		unit := ""
+		if sensor.Unit != nil {
+			unit = *sensor.Unit
+		}
+		unit, convert := unitConverter(unit, opts.Units)
+
+		series := SeriesDTO{SensorID: sensor.ID, Name: sensor.Name, Unit: unit, Tier: tier.Name, Values: make([]*float64, n)}
+		if spec.Offset > 0 {
+			series.Offset = spec.Offset.String()
+		}
+
+		// Průměr v bucketu: součty a počty, na konci dělení. Bod agregace váží počtem
+		// surových bodů, takže průměr z 5min bucketů je stejný jako ze surových dat.
+		sums := make([]float64, n)
+		counts := make([]int64, n)
+		for _, p := range raw {
+			i := int(p.Time.Add(spec.Offset).Sub(from) / bucket)
+			if i < 0 || i >= n {
+				continue
+			}
+			v := p.Value
+			if convert != nil {
+				v = convert(v)
+			}
+			sums[i] += v * float64(p.Count)
+			counts[i] += p.Count
+		}
+		for i := range sums {
+			if counts[i] > 0 {
+				avg := sums[i] / float64(counts[i])
+				series.Values[i] = &avg
+			}
+		}
+		result.Series = append(result.Series, series)
+	}
+	return result, nil
+}
+
+// autoBucket vybere nejmenší "hezký" bucket, se kterým má osa nejvýše targetCompareBuckets bodů.
+func autoBucket(dur time.Duration) time.Duration {
+	for _, b := range compareBucketSizes {
+		if dur/b <= targetCompareBuckets {
+			return b
+		}
+	}
+	return compareBucketSizes[len(compareBucketSizes)-1]
+}
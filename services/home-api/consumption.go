@@ -0,0 +1,298 @@
+package homeapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"storage"
+)
+
+// --- SPOTŘEBA Z POČÍTADEL ---
+// Vodoměr, elektroměr nebo čítač pulzů posílá KUMULATIVNÍ stav (typ s is_counter, viz
+// postgres.sql sekce 19). Graf stavu počítadla nic neřekne - zajímá nás spotřeba za hodinu,
+// den nebo měsíc, tedy rozdíly mezi odečty:
+//
+//	GET /api/sensors/{id}/consumption?range=720h&bucket=day
+//
+// Pokles hodnoty mezi dvěma odečty:
+//   - pokles do 10 % je šum odečtu - spotřeba 0 a výchozím bodem zůstává vyšší hodnota,
+//     aby se stejný úsek po návratu nezapočítal dvakrát,
+//   - typ má counter_max, předchozí odečet byl v horní čtvrtině rozsahu a nový je v dolní
+//     čtvrtině -> PŘETEČENÍ (spotřeba = counter_max - předchozí + nový),
+//   - jinak RESET (restart zařízení počítá od nuly, spotřeba = nový odečet).
+//
+// Spotřeba mezi dvěma odečty se do bucketů rozdělí ÚMĚRNĚ ČASU (odečet jednou za hodinu
+// nepřipíše celou hodinu do bucketu, ve kterém přišel). První odečet okna navazuje na poslední
+// odečet před oknem (nejvýše METER_LOOKBACK zpět).
+//
+// Cena: tabulka meter_tariffs (jen s TimescaleDB) - cena za jednotku platná od effective_from.
+// Úsek spotřeby se ocení tarifem platným na jeho začátku. Bez tarifu odpověď cenu neobsahuje.
+//
+// Stejně jako statistiky se spotřeba počítá ze SUROVÝCH dat - okno začínající před hranicí
+// retence surové vrstvy (RETENTION_RAW) se odmítne (400), viz requireRawData ve stats.go.
+
+// ConsumptionBucketHour: Spotřeba po hodinách (jen /consumption, statistiky po hodinách nejsou).
+const ConsumptionBucketHour = "hour"
+
+// counterResetRatio: Pokles pod tento podíl předchozího odečtu je reset, menší pokles je šum.
+const counterResetRatio = 0.9
+
+// counterRolloverBand: Přetečení = pokles z horní čtvrtiny rozsahu (counter_max) do dolní čtvrtiny.
+const counterRolloverBand = 0.25
+
+// ConsumptionOptions jsou parametry dotazu. Okno a zóna mají stejný význam jako u statistik.
+type ConsumptionOptions struct {
+	Range    string
+	From     string
+	To       string
+	Timezone string
+	Bucket   string // hour | day (výchozí) | week | month
+}
+
+// Tariff je cena za jednotku spotřeby platná od EffectiveFrom (řádek meter_tariffs).
+type Tariff struct {
+	EffectiveFrom time.Time
+	PricePerUnit  float64
+	Currency      string
+}
+
+// ConsumptionBucket je spotřeba jedné hodiny/dne/týdne/měsíce (hranice v lokální zóně).
+type ConsumptionBucket struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Consumption float64   `json:"consumption"`
+	Cost        *float64  `json:"cost,omitempty"`
+}
+
+// ConsumptionDTO je odpověď endpointu /api/sensors/{id}/consumption.
+type ConsumptionDTO struct {
+	SensorID  int64               `json:"sensor_id"`
+	Unit      string              `json:"unit"`
+	From      time.Time           `json:"from"`
+	To        time.Time           `json:"to"`
+	Timezone  string              `json:"timezone"`
+	Bucket    string              `json:"bucket"`
+	Total     float64             `json:"total"`
+	Cost      *float64            `json:"cost,omitempty"`     // null = senzor nemá tarif
+	Currency  string              `json:"currency,omitempty"` // Měna tarifu (např. "CZK")
+	Readings  int                 `json:"readings"`           // Počet odečtů v okně
+	Resets    int                 `json:"resets"`             // Počet resetů počítadla v okně
+	Rollovers int                 `json:"rollovers"`          // Počet přetečení v okně
+	Buckets   []ConsumptionBucket `json:"buckets"`
+}
+
+// counterSegment je spotřeba mezi dvěma po sobě jdoucími odečty.
+type counterSegment struct {
+	From, To time.Time
+	Delta    float64
+}
+
+// GetConsumption spočítá spotřebu počítadla po bucketech za okno z opts.
+func (s *Service) GetConsumption(ctx context.Context, sensorID int64, opts ConsumptionOptions) (*ConsumptionDTO, error) {
+	// 1. Validace parametrů (okno, zóna, bucket)
+	if opts.Bucket == "" {
+		opts.Bucket = StatsBucketDay
+	}
+	switch opts.Bucket {
+	case ConsumptionBucketHour, StatsBucketDay, StatsBucketWeek, StatsBucketMonth:
+	default:
+		return nil, fmt.Errorf("%w: neplatný bucket %q (hour, day, week, month)", ErrInvalid, opts.Bucket)
+	}
+	loc, err := s.statsLocation(opts.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	from, to, err := statsWindow(StatsOptions{Range: opts.Range, From: opts.From, To: opts.To}, loc, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireRawData(from, now); err != nil {
+		return nil, err
+	}
+	end := minTime(to, now.UTC())
+
+	// 2. Senzor musí být počítadlo
+	sensor, err := s.store.SensorByID(ctx, sensorID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("%w: senzor %d", ErrNotFound, sensorID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !sensor.Counter {
+		return nil, fmt.Errorf("%w: senzor %d není počítadlo (typ %s nemá is_counter)", ErrInvalid, sensorID, sensor.Type)
+	}
+
+	// 3. Odečty včetně posledního před oknem a tarify
+	points, err := s.store.ReadRange(ctx, sensorID, from.Add(-s.cfg.MeterLookback), to)
+	if err != nil {
+		return nil, fmt.Errorf("history query failed: %w", err)
+	}
+	tariffs, err := s.loadTariffs(ctx, sensorID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ConsumptionDTO{
+		SensorID: sensorID,
+		From:     from,
+		To:       to,
+		Timezone: loc.String(),
+		Bucket:   opts.Bucket,
+	}
+	if sensor.Unit != nil {
+		result.Unit = *sensor.Unit
+	}
+	if len(tariffs) > 0 {
+		result.Cost = new(float64)
+		result.Currency = tariffs[len(tariffs)-1].Currency
+	}
+
+	// 4. Odečty -> úseky spotřeby (resety a přetečení počítáme jen v okně)
+	var segments []counterSegment
+	var prev *storage.Point
+	for i := range points {
+		p := points[i]
+		if !p.Time.Before(from) {
+			result.Readings++
+		}
+		if prev == nil {
+			prev = &points[i]
+			continue
+		}
+		delta, event := counterDelta(prev.Value, p.Value, sensor.CounterMax)
+		inWindow := !p.Time.Before(from) && p.Time.Before(end)
+		switch {
+		case event == counterRollover && inWindow:
+			result.Rollovers++
+		case event == counterReset && inWindow:
+			result.Resets++
+		}
+		if delta > 0 {
+			segments = append(segments, counterSegment{From: prev.Time, To: p.Time, Delta: delta})
+		}
+		if event != counterNoise {
+			prev = &points[i] // Při šumu zůstává výchozím bodem vyšší předchozí odečet
+		}
+	}
+
+	// 5. Rozdělení úseků do bucketů (úměrně času) a ocenění. Úseky i buckety jdou po sobě,
+	// takže úseky, které skončily před bucketem, už další buckety nepotřebují (k).
+	k := 0
+	for start := bucketStart(from.In(loc), opts.Bucket); start.Before(to); start = nextBucket(start, opts.Bucket) {
+		next := nextBucket(start, opts.Bucket)
+		bucket := ConsumptionBucket{Start: start, End: next}
+		if len(tariffs) > 0 {
+			bucket.Cost = new(float64)
+		}
+		bFrom, bEnd := maxTime(start, from), minTime(next, end)
+		for k < len(segments) && segments[k].To.Before(bFrom) {
+			k++
+		}
+		for _, seg := range segments[k:] {
+			if !seg.From.Before(bEnd) {
+				break
+			}
+			part, at := segmentShare(seg, bFrom, bEnd)
+			if part == 0 {
+				continue
+			}
+			bucket.Consumption += part
+			if t, ok := activeTariff(tariffs, at); ok {
+				*bucket.Cost += part * t.PricePerUnit
+			}
+		}
+		result.Total += bucket.Consumption
+		if bucket.Cost != nil {
+			*result.Cost += *bucket.Cost
+		}
+		result.Buckets = append(result.Buckets, bucket)
+	}
+	return result, nil
+}
+
+// Výsledek porovnání dvou odečtů (viz counterDelta).
+const (
+	counterNormal   = ""
+	counterRollover = "rollover"
+	counterReset    = "reset"
+	counterNoise    = "noise"
+)
+
+// counterDelta vrátí spotřebu mezi odečty prev -> v a co se s počítadlem stalo.
+// Pořadí je důležité: malý pokles je vždy šum. Přetečení uznáme, jen když předchozí odečet
+// byl těsně pod counter_max a nový těsně nad nulou (obojí v pásmu counterRolloverBand) -
+// jinak by reset na 0 z poloviny rozsahu přidal falešnou spotřebu "do konce rozsahu".
+func counterDelta(prev, v float64, counterMax *float64) (float64, string) {
+	switch {
+	case v >= prev:
+		return v - prev, counterNormal
+	case v >= prev*counterResetRatio:
+		return 0, counterNoise
+	case counterMax != nil && prev >= *counterMax*(1-counterRolloverBand) && v < *counterMax*counterRolloverBand:
+		return *counterMax - prev + v, counterRollover
+	default:
+		return v, counterReset
+	}
+}
+
+// segmentShare vrátí část spotřeby úseku, která připadá na okno [from, end), a začátek
+// této části (podle něj se vybírá tarif). Úsek s nulovou délkou patří oknu, do kterého padne jeho konec.
+func segmentShare(seg counterSegment, from, end time.Time) (float64, time.Time) {
+	if !from.Before(end) {
+		return 0, time.Time{}
+	}
+	length := seg.To.Sub(seg.From)
+	if length <= 0 {
+		if !seg.To.Before(from) && seg.To.Before(end) {
+			return seg.Delta, seg.To
+		}
+		return 0, time.Time{}
+	}
+	start, stop := maxTime(seg.From, from), minTime(seg.To, end)
+	if !start.Before(stop) {
+		return 0, time.Time{}
+	}
+	return seg.Delta * float64(stop.Sub(start)) / float64(length), start
+}
+
+// loadTariffs načte tarify senzoru seřazené podle effective_from. Bez TimescaleDB tarify nejsou.
+func (s *Service) loadTariffs(ctx context.Context, sensorID int64) ([]Tariff, error) {
+	if s.db == nil {
+		return nil, nil
+	}
+	rows, err := s.db.Query(ctx, `
+		SELECT effective_from, price_per_unit::float8, currency
+		FROM meter_tariffs
+		WHERE sensor_id = $1
+		ORDER BY effective_from ASC
+	`, sensorID)
+	if err != nil {
+		return nil, fmt.Errorf("db query (tariffs) failed: %w", err)
+	}
+	defer rows.Close()
+
+	var tariffs []Tariff
+	for rows.Next() {
+		var t Tariff
+		if err := rows.Scan(&t.EffectiveFrom, &t.PricePerUnit, &t.Currency); err != nil {
+			return nil, err
+		}
+		tariffs = append(tariffs, t)
+	}
+	return tariffs, rows.Err()
+}
+
+// activeTariff vybere tarif platný v okamžiku 't' (poslední s effective_from <= t).
+// Seznam musí být seřazený podle EffectiveFrom vzestupně (jako storage.ActiveCalibration).
+func activeTariff(list []Tariff, t time.Time) (Tariff, bool) {
+	for i := len(list) - 1; i >= 0; i-- {
+		if !list[i].EffectiveFrom.After(t) {
+			return list[i], true
+		}
+	}
+	return Tariff{}, false
+}
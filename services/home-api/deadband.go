@@ -0,0 +1,39 @@
+package homeapi
+
+import (
+	"context"
+	"fmt"
+)
+
+// --- ÚSPORA DEADBANDU ---
+// Data Persister ukládá do historie jen body, které propustí deadband (viz tabulka
+// 'deadband_settings'), a denně sčítá přijaté a uložené body do 'deadband_stats'.
+
+// GetDeadbandStats vrací úsporu zápisů po senzorech za posledních 'days' dní (největší úspora první).
+func (s *Service) GetDeadbandStats(ctx context.Context, days int) ([]DeadbandStatsDTO, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT d.sensor_id, COALESCE(s.friendly_name, s.mqtt_topic), SUM(d.received), SUM(d.stored)
+		FROM deadband_stats d
+		JOIN sensors s ON s.id = d.sensor_id
+		WHERE d.day > CURRENT_DATE - $1::int
+		GROUP BY d.sensor_id, s.friendly_name, s.mqtt_topic
+		ORDER BY SUM(d.received) - SUM(d.stored) DESC
+	`, days)
+	if err != nil {
+		return nil, fmt.Errorf("db query failed: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make([]DeadbandStatsDTO, 0)
+	for rows.Next() {
+		var st DeadbandStatsDTO
+		if err := rows.Scan(&st.SensorID, &st.SensorName, &st.Received, &st.Stored); err != nil {
+			return nil, err
+		}
+		if st.Received > 0 {
+			st.SavedPct = 100 * float64(st.Received-st.Stored) / float64(st.Received)
+		}
+		stats = append(stats, st)
+	}
+	return stats, rows.Err()
+}
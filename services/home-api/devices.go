@@ -0,0 +1,209 @@
+package homeapi
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// --- ZAŘÍZENÍ ---
+// Fyzická zařízení (tabulka 'devices', postgres.sql sekce 21) a jejich senzory na jeden pohled:
+//
+//	GET /api/devices
+//
+// Stav (status):
+//   - zařízení s availability_topic: poslední online/offline z topicu (LWT) - ingestor ho zapisuje
+//     do devices.online; dokud nic nepřišlo, je "unknown",
+//   - zařízení bez něj: "online", pokud některý jeho senzor není zastaralý, jinak "offline"
+//     (bez senzorů "unknown").
+//
+// Varování (warnings) shrnují zdraví pro dashboard: offline, zastaralé senzory, slabá baterie
+// (pod DEVICE_LOW_BATTERY) a slabý signál (pod DEVICE_WEAK_RSSI).
+
+// Stav zařízení (DeviceDTO.Status) a zdroj, ze kterého je odvozený (DeviceDTO.StatusSource).
+const (
+	DeviceOnline  = "online"
+	DeviceOffline = "offline"
+	DeviceUnknown = "unknown"
+
+	DeviceSourceAvailability = "availability"
+	DeviceSourceSensors      = "sensors"
+)
+
+// Varování u zařízení (DeviceDTO.Warnings).
+const (
+	DeviceWarnOffline     = "offline"
+	DeviceWarnStale       = "stale_sensors"
+	DeviceWarnLowBattery  = "low_battery"
+	DeviceWarnWeakSignal  = "weak_signal"
+	DeviceWarnNoDiagnosis = "no_diagnostics" // Diagnostika je nastavená, ale zatím nic nepřišlo
+)
+
+// DeviceSensorDTO je senzor zařízení (zkrácený SensorDTO).
+type DeviceSensorDTO struct {
+	ID       int64      `json:"id"`
+	Name     string     `json:"name"`
+	Topic    string     `json:"topic"`
+	Unit     string     `json:"unit"`
+	Value    *float64   `json:"current_value"`
+	LastSeen *time.Time `json:"last_seen"`
+	IsStale  bool       `json:"is_stale"`
+}
+
+// DeviceDTO je zařízení se stavem, diagnostikou a senzory.
+type DeviceDTO struct {
+	ID           int64   `json:"id"`
+	Name         string  `json:"name"`
+	FriendlyName *string `json:"friendly_name"`
+	Model        *string `json:"model"`
+	Location     *string `json:"location"`
+
+	Status          string     `json:"status"`        // online | offline | unknown
+	StatusSource    string     `json:"status_source"` // availability | sensors
+	StatusChangedAt *time.Time `json:"status_changed_at"`
+	LastSeen        *time.Time `json:"last_seen"` // Nejnovější hodnota některého senzoru
+
+	BatteryVoltage       *float64   `json:"battery_voltage"`
+	RSSI                 *float64   `json:"rssi"`
+	Firmware             *string    `json:"firmware"`
+	DiagnosticsUpdatedAt *time.Time `json:"diagnostics_updated_at"`
+
+	Sensors      []DeviceSensorDTO `json:"sensors"`
+	StaleSensors int               `json:"stale_sensors"`
+	Warnings     []string          `json:"warnings"`
+}
+
+// GetDevices vrací všechna zařízení seřazená podle jména.
+func (s *Service) GetDevices(ctx context.Context) ([]DeviceDTO, error) {
+	// 1. Zařízení
+	rows, err := s.db.Query(ctx, `
+		SELECT d.id, d.name, d.friendly_name, d.model, d.location, d.availability_topic IS NOT NULL,
+		       d.online, d.status_changed_at, d.battery_voltage, d.rssi, d.firmware, d.diagnostics_updated_at,
+		       EXISTS (SELECT 1 FROM device_diagnostics dd WHERE dd.device_id = d.id)
+		FROM devices d
+		ORDER BY COALESCE(d.friendly_name, d.name) ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("db query (devices) failed: %w", err)
+	}
+	defer rows.Close()
+
+	devices := make([]DeviceDTO, 0)
+	index := make(map[int64]int) // id zařízení -> pozice v 'devices'
+	hasAvailability := make(map[int64]bool)
+	online := make(map[int64]*bool)
+	hasDiagnostics := make(map[int64]bool)
+	for rows.Next() {
+		var d DeviceDTO
+		var avail, diag bool
+		var on *bool
+		if err := rows.Scan(&d.ID, &d.Name, &d.FriendlyName, &d.Model, &d.Location, &avail,
+			&on, &d.StatusChangedAt, &d.BatteryVoltage, &d.RSSI, &d.Firmware, &d.DiagnosticsUpdatedAt, &diag); err != nil {
+			return nil, err
+		}
+		d.Sensors = make([]DeviceSensorDTO, 0)
+		index[d.ID] = len(devices)
+		hasAvailability[d.ID], online[d.ID], hasDiagnostics[d.ID] = avail, on, diag
+		devices = append(devices, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return devices, nil
+	}
+
+	// 2. Přiřazení senzorů k zařízením
+	owner := make(map[int64]int64) // id senzoru -> id zařízení
+	sensorRows, err := s.db.Query(ctx, `SELECT id, device_id FROM sensors WHERE device_id IS NOT NULL AND is_active`)
+	if err != nil {
+		return nil, fmt.Errorf("db query (device sensors) failed: %w", err)
+	}
+	defer sensorRows.Close()
+	for sensorRows.Next() {
+		var sensorID, deviceID int64
+		if err := sensorRows.Scan(&sensorID, &deviceID); err != nil {
+			return nil, err
+		}
+		owner[sensorID] = deviceID
+	}
+	if err := sensorRows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 3. Senzory s posledními hodnotami a zastaráním (stejný výpočet jako seznam senzorů)
+	sensors, err := s.GetAllSensors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, sensor := range sensors {
+		deviceID, ok := owner[sensor.ID]
+		if !ok {
+			continue
+		}
+		d := &devices[index[deviceID]]
+		d.Sensors = append(d.Sensors, DeviceSensorDTO{
+			ID:       sensor.ID,
+			Name:     sensor.Name,
+			Topic:    sensor.Topic,
+			Unit:     sensor.Unit,
+			Value:    sensor.CurrentValue,
+			LastSeen: sensor.LastSeen,
+			IsStale:  sensor.IsStale,
+		})
+		if sensor.IsStale {
+			d.StaleSensors++
+		}
+		if sensor.LastSeen != nil && (d.LastSeen == nil || sensor.LastSeen.After(*d.LastSeen)) {
+			d.LastSeen = sensor.LastSeen
+		}
+	}
+
+	// 4. Stav a varování
+	for i := range devices {
+		d := &devices[i]
+		if hasAvailability[d.ID] {
+			d.StatusSource = DeviceSourceAvailability
+			d.Status = DeviceUnknown
+			if on := online[d.ID]; on != nil {
+				d.Status = DeviceOffline
+				if *on {
+					d.Status = DeviceOnline
+				}
+			}
+		} else {
+			d.StatusSource = DeviceSourceSensors
+			switch {
+			case len(d.Sensors) == 0:
+				d.Status = DeviceUnknown
+			case d.StaleSensors < len(d.Sensors):
+				d.Status = DeviceOnline
+			default:
+				d.Status = DeviceOffline
+			}
+		}
+		d.Warnings = s.deviceWarnings(d, hasDiagnostics[d.ID])
+	}
+	return devices, nil
+}
+
+// deviceWarnings sestaví varování zařízení (prázdný seznam = vše v pořádku).
+func (s *Service) deviceWarnings(d *DeviceDTO, hasDiagnostics bool) []string {
+	warnings := make([]string, 0)
+	if d.Status == DeviceOffline {
+		warnings = append(warnings, DeviceWarnOffline)
+	} else if d.StaleSensors > 0 {
+		// U offline zařízení jsou zastaralé senzory samozřejmost - hlásíme jen u běžícího
+		warnings = append(warnings, DeviceWarnStale)
+	}
+	if d.BatteryVoltage != nil && *d.BatteryVoltage < s.cfg.DeviceLowBattery {
+		warnings = append(warnings, DeviceWarnLowBattery)
+	}
+	if d.RSSI != nil && *d.RSSI < s.cfg.DeviceWeakRSSI {
+		warnings = append(warnings, DeviceWarnWeakSignal)
+	}
+	if hasDiagnostics && d.DiagnosticsUpdatedAt == nil {
+		warnings = append(warnings, DeviceWarnNoDiagnosis)
+	}
+	return warnings
+}
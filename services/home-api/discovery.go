@@ -0,0 +1,154 @@
+package homeapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// --- KARANTÉNA NEZNÁMÝCH TOPICŮ ---
+// Ingestor ukládá zprávy z neznámých topiců do tabulky 'discovered_topics'.
+// Zde je admin může schválit (vznikne skutečný senzor) nebo trvale ignorovat.
+
+// GetSensorTypes vrací všechny typy senzorů (pro výběr v UI).
+func (s *Service) GetSensorTypes(ctx context.Context) ([]SensorTypeDTO, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, name, unit, description, min_value, max_value, COALESCE(value_kind, 'number')
+		FROM sensor_types
+		ORDER BY name ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("db query failed: %w", err)
+	}
+	defer rows.Close()
+
+	types := make([]SensorTypeDTO, 0)
+	for rows.Next() {
+		var t SensorTypeDTO
+		if err := rows.Scan(&t.ID, &t.Name, &t.Unit, &t.Description, &t.MinValue, &t.MaxValue, &t.ValueKind); err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+	}
+	return types, rows.Err()
+}
+
+// GetDiscoveredTopics vrací topicy z karantény. Prázdný status = všechny.
+func (s *Service) GetDiscoveredTopics(ctx context.Context, status string) ([]DiscoveredTopicDTO, error) {
+	query := `
+		SELECT id, mqtt_topic, first_seen, last_seen, message_count, sample_payload,
+		       inferred_type, status, sensor_id, decided_at
+		FROM discovered_topics
+		WHERE ($1 = '' OR status = $1)
+		ORDER BY last_seen DESC
+	`
+	rows, err := s.db.Query(ctx, query, status)
+	if err != nil {
+		return nil, fmt.Errorf("db query failed: %w", err)
+	}
+	defer rows.Close()
+
+	topics := make([]DiscoveredTopicDTO, 0)
+	for rows.Next() {
+		var t DiscoveredTopicDTO
+		if err := rows.Scan(&t.ID, &t.Topic, &t.FirstSeen, &t.LastSeen, &t.MessageCount, &t.SamplePayload,
+			&t.InferredType, &t.Status, &t.SensorID, &t.DecidedAt); err != nil {
+			return nil, err
+		}
+		topics = append(topics, t)
+	}
+	return topics, rows.Err()
+}
+
+// ApproveDiscoveredTopic založí z topicu v karanténě skutečný senzor.
+// Vrací ID nového senzoru. Ingestor ho začne přijímat po nejbližší obnově cache (do 1 minuty).
+func (s *Service) ApproveDiscoveredTopic(ctx context.Context, id int64, req ApproveTopicRequest) (int64, error) {
+	if req.SensorTypeID <= 0 {
+		return 0, fmt.Errorf("%w: chybí sensor_type_id", ErrInvalid)
+	}
+	name := strings.TrimSpace(req.FriendlyName)
+	if name == "" {
+		return 0, fmt.Errorf("%w: chybí friendly_name", ErrInvalid)
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// FOR UPDATE: zamkneme řádek, aby dva admini neschválili stejný topic současně.
+	var topic, status string
+	err = tx.QueryRow(ctx, `SELECT mqtt_topic, status FROM discovered_topics WHERE id = $1 FOR UPDATE`, id).
+		Scan(&topic, &status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if status == "approved" {
+		return 0, fmt.Errorf("%w: topic už byl schválen", ErrConflict)
+	}
+
+	var typeExists bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM sensor_types WHERE id = $1)`, req.SensorTypeID).Scan(&typeExists); err != nil {
+		return 0, err
+	}
+	if !typeExists {
+		return 0, fmt.Errorf("%w: typ senzoru %d neexistuje", ErrInvalid, req.SensorTypeID)
+	}
+
+	// Topic mohl mezitím vzniknout jinou cestou (registrace, ruční SQL).
+	var sensorID int64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO sensors (sensor_type_id, mqtt_topic, friendly_name, location, is_active)
+		VALUES ($1, $2, $3, NULLIF($4, ''), true)
+		ON CONFLICT (mqtt_topic) DO NOTHING
+		RETURNING id`,
+		req.SensorTypeID, topic, name, strings.TrimSpace(req.Location)).Scan(&sensorID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("%w: senzor s topicem %s už existuje", ErrConflict, topic)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE discovered_topics SET status = 'approved', sensor_id = $2, decided_at = NOW()
+		WHERE id = $1`, id, sensorID); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	s.logger.Info("Topic schválen jako senzor", "topic", topic, "sensor_id", sensorID)
+	return sensorID, nil
+}
+
+// IgnoreDiscoveredTopic trvale ignoruje topic - Ingestor jeho zprávy přestane evidovat.
+func (s *Service) IgnoreDiscoveredTopic(ctx context.Context, id int64) error {
+	tag, err := s.db.Exec(ctx, `
+		UPDATE discovered_topics SET status = 'ignored', decided_at = NOW()
+		WHERE id = $1 AND status <> 'approved'`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		// Buď neexistuje, nebo je schválený (schválený topic už je senzor - ignorovat nedává smysl).
+		var exists bool
+		if err := s.db.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM discovered_topics WHERE id = $1)`, id).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+		return fmt.Errorf("%w: schválený topic nelze ignorovat", ErrConflict)
+	}
+	return nil
+}
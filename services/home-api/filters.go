@@ -0,0 +1,46 @@
+package homeapi
+
+import (
+	"context"
+	"fmt"
+)
+
+// --- AUDIT FILTRŮ ŠPIČEK ---
+// Ingestor zapisuje každé rozhodnutí filtrů (zahozeno / jen označeno) do 'filter_decisions'.
+// Z API je log dostupný pro kontrolu, jestli filtr není nastavený příliš přísně.
+
+// GetFilterDecisions vrací rozhodnutí filtrů (nejnovější první).
+// sensorID 0 = všechny senzory, action "" = všechny akce.
+func (s *Service) GetFilterDecisions(ctx context.Context, sensorID int64, action string, limit int) ([]FilterDecisionDTO, error) {
+	switch action {
+	case "", "dropped", "flagged", "accepted":
+	default:
+		return nil, fmt.Errorf("%w: action musí být dropped, flagged nebo accepted", ErrInvalid)
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT d.id, d.sensor_id, COALESCE(s.friendly_name, s.mqtt_topic), d.time, d.value,
+		       d.filter, d.action, d.reference_value, d.detail
+		FROM filter_decisions d
+		JOIN sensors s ON s.id = d.sensor_id
+		WHERE ($1 = 0 OR d.sensor_id = $1)
+		  AND ($2 = '' OR d.action = $2)
+		ORDER BY d.time DESC
+		LIMIT $3
+	`, sensorID, action, limit)
+	if err != nil {
+		return nil, fmt.Errorf("db query failed: %w", err)
+	}
+	defer rows.Close()
+
+	decisions := make([]FilterDecisionDTO, 0)
+	for rows.Next() {
+		var d FilterDecisionDTO
+		if err := rows.Scan(&d.ID, &d.SensorID, &d.SensorName, &d.Time, &d.Value,
+			&d.Filter, &d.Action, &d.ReferenceValue, &d.Detail); err != nil {
+			return nil, err
+		}
+		decisions = append(decisions, d)
+	}
+	return decisions, rows.Err()
+}
@@ -0,0 +1,284 @@
+package homeapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"storage"
+)
+
+// --- INTERVALY DVOUSTAVOVÝCH SENZORŮ ---
+// Spínač (typ 'switch', 0/1) nebo kontakt (value_kind 'boolean') odpovídá na otázky
+// "jak dlouho dnes topil kotel" a "kdy bylo otevřené okno" - čárový graf 0/1 ne.
+// Řadu proto převedeme na INTERVALY stejného stavu:
+//
+//	GET /api/sensors/{id}/intervals  - seznam intervalů (začátek, konec, trvání), počet přechodů
+//	GET /api/sensors/{id}/on-time    - doba zapnutí a počet přechodů po dnech/týdnech/měsících
+//
+// Stav platí od svého bodu do další ZMĚNY (opakovaný stejný stav - heartbeat - interval
+// nerozdělí). Poslední stav platí do konce okna, nejdéle do "teď".
+//
+// Senzor hlásí typicky jen změny, takže stav na začátku okna je poslední bod PŘED oknem.
+// Hledáme ho nejvýše BINARY_LOOKBACK zpět; starší stav neznáme a úsek do prvního bodu
+// okna je "unknown" (nepočítá se do zapnuto ani vypnuto).
+//
+// Číselný senzor: nenulová hodnota = zapnuto. Výčet, text a poloha dvoustavové nejsou (400).
+
+// Filtr intervalů (parametr 'state').
+const (
+	IntervalStateOn  = "on"
+	IntervalStateOff = "off"
+)
+
+// BinaryOptions jsou parametry dotazu. Okno a zóna mají stejný význam jako u statistik.
+type BinaryOptions struct {
+	Range    string
+	From     string
+	To       string
+	Timezone string
+	Bucket   string // Jen /on-time: day (výchozí) | week | month
+	State    string // Jen /intervals: "" = všechny | on | off
+}
+
+// StateInterval je úsek, po který měl senzor stejný stav (oříznutý na okno dotazu).
+type StateInterval struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Seconds float64   `json:"seconds"`
+	On      bool      `json:"on"`
+	Ongoing bool      `json:"ongoing,omitempty"` // Stav trvá dodnes (konec = "teď")
+}
+
+// OnTimeSummary jsou součty za okno nebo jeden bucket.
+type OnTimeSummary struct {
+	OnSeconds      float64 `json:"on_seconds"`
+	OffSeconds     float64 `json:"off_seconds"`
+	UnknownSeconds float64 `json:"unknown_seconds"` // Stav nebyl znám (před prvním bodem)
+	OnRatio        float64 `json:"on_ratio"`        // Podíl zapnuto ze známého času (0-1)
+	Transitions    int     `json:"transitions"`     // Počet změn stavu (obou směrů)
+	SwitchOns      int     `json:"switch_ons"`      // Z toho zapnutí (vypnuto -> zapnuto)
+}
+
+// OnTimeBucket je souhrn jednoho dne/týdne/měsíce (hranice v lokální zóně).
+type OnTimeBucket struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	OnTimeSummary
+}
+
+// BinaryIntervalsDTO je odpověď endpointu /api/sensors/{id}/intervals.
+type BinaryIntervalsDTO struct {
+	SensorID     int64           `json:"sensor_id"`
+	From         time.Time       `json:"from"`
+	To           time.Time       `json:"to"`
+	InitialState *bool           `json:"initial_state"` // Stav na začátku okna (null = neznámý)
+	Summary      OnTimeSummary   `json:"summary"`
+	Intervals    []StateInterval `json:"intervals"`
+}
+
+// OnTimeDTO je odpověď endpointu /api/sensors/{id}/on-time.
+type OnTimeDTO struct {
+	SensorID int64          `json:"sensor_id"`
+	From     time.Time      `json:"from"`
+	To       time.Time      `json:"to"`
+	Timezone string         `json:"timezone"`
+	Bucket   string         `json:"bucket"`
+	Summary  OnTimeSummary  `json:"summary"`
+	Buckets  []OnTimeBucket `json:"buckets"`
+}
+
+// binaryChange je změna stavu (body se stejným stavem jako předchozí jsou vynechané).
+type binaryChange struct {
+	Time time.Time
+	On   bool
+}
+
+// GetIntervals vrací intervaly stavů senzoru v okně z opts.
+func (s *Service) GetIntervals(ctx context.Context, sensorID int64, opts BinaryOptions) (*BinaryIntervalsDTO, error) {
+	if opts.State != "" && opts.State != IntervalStateOn && opts.State != IntervalStateOff {
+		return nil, fmt.Errorf("%w: neplatný stav %q (on nebo off)", ErrInvalid, opts.State)
+	}
+	now := time.Now()
+	from, to, end, _, changes, err := s.binarySeries(ctx, sensorID, opts, now)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BinaryIntervalsDTO{
+		SensorID:  sensorID,
+		From:      from,
+		To:        to,
+		Summary:   summarizeBinary(changes, from, end),
+		Intervals: make([]StateInterval, 0),
+	}
+	if len(changes) > 0 && !changes[0].Time.After(from) {
+		result.InitialState = &changes[0].On
+	}
+	for _, iv := range binaryIntervals(changes, from, end, now) {
+		if opts.State == "" || (opts.State == IntervalStateOn) == iv.On {
+			result.Intervals = append(result.Intervals, iv)
+		}
+	}
+	return result, nil
+}
+
+// GetOnTime vrací dobu zapnutí a počty přechodů po dnech/týdnech/měsících.
+func (s *Service) GetOnTime(ctx context.Context, sensorID int64, opts BinaryOptions) (*OnTimeDTO, error) {
+	if opts.Bucket == "" {
+		opts.Bucket = StatsBucketDay
+	}
+	switch opts.Bucket {
+	case StatsBucketDay, StatsBucketWeek, StatsBucketMonth:
+	default:
+		return nil, fmt.Errorf("%w: neplatný bucket %q (day, week, month)", ErrInvalid, opts.Bucket)
+	}
+	from, to, end, loc, changes, err := s.binarySeries(ctx, sensorID, opts, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	result := &OnTimeDTO{
+		SensorID: sensorID,
+		From:     from,
+		To:       to,
+		Timezone: loc.String(),
+		Bucket:   opts.Bucket,
+		Summary:  summarizeBinary(changes, from, end),
+	}
+	// Buckety podle kalendáře v lokální zóně (DST: den má 23/25 h), oříznuté na okno dotazu
+	for start := bucketStart(from.In(loc), opts.Bucket); start.Before(to); start = nextBucket(start, opts.Bucket) {
+		next := nextBucket(start, opts.Bucket)
+		bFrom, bEnd := maxTime(start, from), minTime(next, end)
+		bucket := OnTimeBucket{Start: start, End: next}
+		if bFrom.Before(bEnd) {
+			bucket.OnTimeSummary = summarizeBinary(changes, bFrom, bEnd)
+		}
+		result.Buckets = append(result.Buckets, bucket)
+	}
+	return result, nil
+}
+
+// binarySeries načte změny stavu senzoru pro okno z opts (včetně posledního stavu před oknem).
+// Vrací okno [from, to), konec známých dat 'end' (nejdéle 'now'), zónu a změny.
+func (s *Service) binarySeries(ctx context.Context, sensorID int64, opts BinaryOptions, now time.Time) (from, to, end time.Time, loc *time.Location, changes []binaryChange, err error) {
+	// 1. Okno a zóna (stejná pravidla jako statistiky, viz stats.go)
+	if loc, err = s.statsLocation(opts.Timezone); err != nil {
+		return
+	}
+	if from, to, err = statsWindow(StatsOptions{Range: opts.Range, From: opts.From, To: opts.To}, loc, now); err != nil {
+		return
+	}
+	if err = s.requireRawData(from, now); err != nil {
+		return
+	}
+	end = minTime(to, now.UTC())
+
+	// 2. Senzor musí být dvoustavový (boolean) nebo číselný
+	sensor, err := s.store.SensorByID(ctx, sensorID)
+	if errors.Is(err, storage.ErrNotFound) {
+		err = fmt.Errorf("%w: senzor %d", ErrNotFound, sensorID)
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	// 3. Body včetně lookbacku před oknem
+	lookFrom := from.Add(-s.cfg.BinaryLookback)
+	var points []storage.Point
+	switch sensor.Kind {
+	case storage.KindBoolean:
+		points, err = s.store.ReadStates(ctx, sensorID, lookFrom, to)
+	case "", storage.KindNumber:
+		points, err = s.store.ReadRange(ctx, sensorID, lookFrom, to)
+	default:
+		err = fmt.Errorf("%w: senzor %d není dvoustavový (%s)", ErrInvalid, sensorID, sensor.Kind)
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("history query failed: %w", err)
+		return
+	}
+
+	// 4. Jen změny. Poslední bod před oknem posuneme na 'from' - to je stav na začátku okna.
+	for _, p := range points {
+		on := p.Value != 0
+		if p.State != nil {
+			on = p.State.Bool != nil && *p.State.Bool
+		}
+		t := maxTime(p.Time, from)
+		n := len(changes)
+		switch {
+		case n > 0 && changes[n-1].On == on:
+			continue // Stejný stav (heartbeat) interval nerozdělí
+		case n > 0 && !changes[n-1].Time.After(from) && !t.After(from):
+			changes[n-1] = binaryChange{Time: t, On: on} // Novější stav před oknem nahradí starší
+		default:
+			changes = append(changes, binaryChange{Time: t, On: on})
+		}
+	}
+	return
+}
+
+// binaryIntervals převede změny na intervaly v okně [from, end). Poslední interval je
+// Ongoing, pokud okno sahá až do "teď" (stav trvá dodnes).
+func binaryIntervals(changes []binaryChange, from, end, now time.Time) []StateInterval {
+	var out []StateInterval
+	for i, c := range changes {
+		next := end
+		if i+1 < len(changes) {
+			next = minTime(changes[i+1].Time, end)
+		}
+		start := maxTime(c.Time, from)
+		if !start.Before(next) {
+			continue
+		}
+		out = append(out, StateInterval{
+			Start:   start,
+			End:     next,
+			Seconds: next.Sub(start).Seconds(),
+			On:      c.On,
+			Ongoing: i == len(changes)-1 && !end.Before(now),
+		})
+	}
+	return out
+}
+
+// summarizeBinary sečte dobu v každém stavu a přechody v okně [from, end).
+// Přechod je změna, před kterou byl stav známý (první známý stav přechodem není).
+func summarizeBinary(changes []binaryChange, from, end time.Time) OnTimeSummary {
+	var sum OnTimeSummary
+	known := from // Od kdy stav známe (čas před prvním bodem je "unknown")
+	if len(changes) == 0 || changes[0].Time.After(from) {
+		if len(changes) > 0 {
+			known = minTime(changes[0].Time, end)
+		} else {
+			known = end
+		}
+		sum.UnknownSeconds = known.Sub(from).Seconds()
+	}
+
+	for i, c := range changes {
+		next := end
+		if i+1 < len(changes) {
+			next = minTime(changes[i+1].Time, end)
+		}
+		if start := maxTime(c.Time, from); start.Before(next) {
+			if c.On {
+				sum.OnSeconds += next.Sub(start).Seconds()
+			} else {
+				sum.OffSeconds += next.Sub(start).Seconds()
+			}
+		}
+		if i > 0 && !c.Time.Before(from) && c.Time.Before(end) {
+			sum.Transitions++
+			if c.On {
+				sum.SwitchOns++
+			}
+		}
+	}
+	sum.OnRatio = ratio(sum.OnSeconds, sum.OnSeconds+sum.OffSeconds)
+	return sum
+}
@@ -0,0 +1,141 @@
+package homeapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// --- ODMÍTNUTÉ ZPRÁVY (DEAD-LETTER) ---
+// Ingestor ukládá zprávy, které neprošly validací, do tabulky 'rejected_messages'.
+// Home API je umí vypsat (filtr podle senzoru a důvodu) a po opravě metadat znovu odeslat:
+// zpráva jde na RESUBMIT_TOPIC, Ingestor ji zpracuje znovu s původním časem přijetí.
+
+// rejectReasons jsou kódy důvodů, které Ingestor zapisuje (viz sensor-ingestor/deadletter.go).
+var rejectReasons = map[string]bool{"invalid_number": true, "invalid_value": true, "below_min": true, "above_max": true}
+
+// resubmitMessage je zpráva pro Ingestor. Payload jako []byte (base64) zachová i binární obsah.
+type resubmitMessage struct {
+	RejectID   int64     `json:"reject_id"`
+	Topic      string    `json:"topic"`
+	Payload    []byte    `json:"payload"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// GetRejects vrací odmítnuté zprávy (nejnovější první).
+// sensorID 0 = všechny senzory, reason "" = všechny důvody.
+func (s *Service) GetRejects(ctx context.Context, sensorID int64, reason string, limit int) ([]RejectDTO, error) {
+	if reason != "" && !rejectReasons[reason] {
+		return nil, fmt.Errorf("%w: neznámý důvod '%s'", ErrInvalid, reason)
+	}
+
+	return s.queryRejects(ctx, `
+		WHERE ($1 = 0 OR r.sensor_id = $1)
+		  AND ($2 = '' OR r.reason = $2)
+		ORDER BY r.id DESC
+		LIMIT $3
+	`, sensorID, reason, limit)
+}
+
+// queryRejects načte odmítnuté zprávy se jménem senzoru. 'where' je zbytek dotazu (WHERE/ORDER/LIMIT).
+func (s *Service) queryRejects(ctx context.Context, where string, args ...any) ([]RejectDTO, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT r.id, r.received_at, r.topic, r.payload, r.sensor_id, s.friendly_name,
+		       r.reason, r.detail, r.resubmitted_at
+		FROM rejected_messages r
+		LEFT JOIN sensors s ON s.id = r.sensor_id
+	`+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("db query failed: %w", err)
+	}
+	defer rows.Close()
+
+	rejects := make([]RejectDTO, 0)
+	for rows.Next() {
+		var r RejectDTO
+		var payload []byte
+		if err := rows.Scan(&r.ID, &r.ReceivedAt, &r.Topic, &payload, &r.SensorID, &r.SensorName,
+			&r.Reason, &r.Detail, &r.ResubmittedAt); err != nil {
+			return nil, err
+		}
+		r.Payload = string(payload)
+		rejects = append(rejects, r)
+	}
+	return rejects, rows.Err()
+}
+
+// ResubmitReject pošle odmítnutou zprávu Ingestoru ke zpracování a označí ji jako znovu odeslanou.
+// Výsledek zpracování je asynchronní - pokud zpráva neprojde ani teď, objeví se jako nový záznam.
+func (s *Service) ResubmitReject(ctx context.Context, id int64) (*RejectDTO, error) {
+	var msg resubmitMessage
+	err := s.db.QueryRow(ctx, `SELECT id, topic, payload, received_at FROM rejected_messages WHERE id = $1`, id).
+		Scan(&msg.RejectID, &msg.Topic, &msg.Payload, &msg.ReceivedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	token := s.mqtt.Publish(s.cfg.ResubmitTopic, 1, false, data)
+	if !token.WaitTimeout(5 * time.Second) {
+		return nil, fmt.Errorf("publikace nebyla potvrzena brokerem")
+	}
+	if token.Error() != nil {
+		return nil, token.Error()
+	}
+
+	tag, err := s.db.Exec(ctx, `UPDATE rejected_messages SET resubmitted_at = NOW() WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrNotFound // Mezitím smazáno (ořezání tabulky)
+	}
+
+	rejects, err := s.queryRejects(ctx, `WHERE r.id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(rejects) == 0 {
+		return nil, ErrNotFound
+	}
+	r := rejects[0]
+
+	s.logger.Info("Odmítnutá zpráva znovu odeslána", "reject_id", id, "topic", r.Topic)
+	return &r, nil
+}
+
+// GetRejectSummary vrací počty odmítnutých zpráv podle senzoru a důvodu.
+// Dashboard z nich skládá filtr (a hned je vidět, které zařízení zlobí nejvíc).
+func (s *Service) GetRejectSummary(ctx context.Context) ([]RejectSummaryDTO, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT r.sensor_id, s.friendly_name, r.reason, COUNT(*), MAX(r.received_at)
+		FROM rejected_messages r
+		LEFT JOIN sensors s ON s.id = r.sensor_id
+		GROUP BY r.sensor_id, s.friendly_name, r.reason
+		ORDER BY COUNT(*) DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("db query failed: %w", err)
+	}
+	defer rows.Close()
+
+	summary := make([]RejectSummaryDTO, 0)
+	for rows.Next() {
+		var r RejectSummaryDTO
+		if err := rows.Scan(&r.SensorID, &r.SensorName, &r.Reason, &r.Count, &r.LastAt); err != nil {
+			return nil, err
+		}
+		summary = append(summary, r)
+	}
+	return summary, rows.Err()
+}
@@ -0,0 +1,64 @@
+package homeapi
+
+import (
+	"context"
+	"fmt"
+)
+
+// --- AUTOMATIZAČNÍ PRAVIDLA ---
+// Pravidla vyhodnocuje služba 'rules-engine'. Home API je jen zpřístupňuje ke čtení
+// spolu s logem spuštění (co se kdy spustilo, s jakými hodnotami a jak dopadly akce).
+
+// GetRules vrací všechna pravidla včetně vypnutých.
+func (s *Service) GetRules(ctx context.Context) ([]RuleDTO, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT r.id, r.name, r.enabled, r.dry_run, r.conditions, r.release_conditions,
+		       r.actions, r.release_actions, r.debounce_seconds, r.cooldown_seconds, r.updated_at,
+		       (SELECT MAX(e.executed_at) FROM rule_executions e WHERE e.rule_id = r.id AND e.phase = 'fire')
+		FROM automation_rules r
+		ORDER BY r.id ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("db query failed: %w", err)
+	}
+	defer rows.Close()
+
+	rules := make([]RuleDTO, 0)
+	for rows.Next() {
+		var r RuleDTO
+		if err := rows.Scan(&r.ID, &r.Name, &r.Enabled, &r.DryRun, &r.Conditions, &r.ReleaseConditions,
+			&r.Actions, &r.ReleaseActions, &r.DebounceSeconds, &r.CooldownSeconds, &r.UpdatedAt, &r.LastFired); err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// GetRuleExecutions vrací log spuštění (nejnovější první). ruleID 0 = všechna pravidla.
+func (s *Service) GetRuleExecutions(ctx context.Context, ruleID int64, limit int) ([]RuleExecutionDTO, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT e.id, e.rule_id, r.name, e.executed_at, e.phase, e.dry_run, e.success,
+		       e.sensor_values, e.action_results
+		FROM rule_executions e
+		JOIN automation_rules r ON r.id = e.rule_id
+		WHERE ($1 = 0 OR e.rule_id = $1)
+		ORDER BY e.executed_at DESC
+		LIMIT $2
+	`, ruleID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("db query failed: %w", err)
+	}
+	defer rows.Close()
+
+	executions := make([]RuleExecutionDTO, 0)
+	for rows.Next() {
+		var e RuleExecutionDTO
+		if err := rows.Scan(&e.ID, &e.RuleID, &e.RuleName, &e.ExecutedAt, &e.Phase, &e.DryRun, &e.Success,
+			&e.SensorValues, &e.ActionResults); err != nil {
+			return nil, err
+		}
+		executions = append(executions, e)
+	}
+	return executions, rows.Err()
+}
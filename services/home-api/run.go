@@ -0,0 +1,170 @@
+package homeapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"presence"
+	"storage"
+)
+
+// App je sestavené Home API: připojení (DB, Valkey, MQTT) + HTTP handler se všemi routami.
+// Samostatná binárka ho jen spustí přes Run; all-in-one navíc předá Handler() dashboardu,
+// který pak volá API přímo v paměti (bez HTTP přes síť).
+type App struct {
+	cfg     Config
+	logger  *slog.Logger
+	db      *pgxpool.Pool
+	rdb     *redis.Client
+	mqtt    mqtt.Client
+	handler http.Handler
+
+	// presence: stav Home API pro ostatní (retained zpráva + health endpointy), viz modul presence
+	presence *presence.Presence
+}
+
+// New připojí databáze a MQTT a sestaví router. Při chybě uklidí, co už bylo otevřeno.
+func New(ctx context.Context, cfg Config, logger *slog.Logger) (*App, error) {
+	app := &App{cfg: cfg, logger: logger}
+	app.presence = presence.New("home-api", cfg.PresenceTopic, cfg.PresenceInterval, logger)
+
+	// 3. Připojení k Databázi (Postgres/TimescaleDB)
+	// pgxpool vytvoří sadu spojení, které se recyklují (Thread-safe).
+	// Prázdná POSTGRES_URL = bez TimescaleDB (vestavěné úložiště v cfg.Store, jen základní routy).
+	if cfg.PostgresURL != "" {
+		dbPool, err := pgxpool.New(ctx, cfg.PostgresURL)
+		if err != nil {
+			return nil, fmt.Errorf("nelze se připojit k DB: %w", err)
+		}
+		app.db = dbPool
+		app.presence.AddCheck("postgres", dbPool.Ping)
+	}
+
+	// 4. Úložiště senzorů, historie a posledních hodnot
+	// Předané zvenku (all-in-one), jinak TimescaleDB + Valkey (Redis).
+	store := cfg.Store
+	if store == nil {
+		if app.db == nil {
+			return nil, fmt.Errorf("bez POSTGRES_URL je nutné předat úložiště (Config.Store)")
+		}
+		app.rdb = redis.NewClient(&redis.Options{
+			Addr: cfg.ValkeyAddr,
+		})
+		// Rychlý Ping pro ověření, že Redis žije
+		if err := app.rdb.Ping(ctx).Err(); err != nil {
+			app.Close()
+			return nil, fmt.Errorf("nelze se připojit k Valkey: %w", err)
+		}
+		app.presence.AddCheck("valkey", func(ctx context.Context) error { return app.rdb.Ping(ctx).Err() })
+		store = storage.NewPostgres(app.db, app.rdb)
+	}
+
+	// 4b. Připojení k MQTT (příkazy pro akční členy)
+	// AutoReconnect + ResumeSubs: po výpadku brokeru se obnoví i odběry state topiců.
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.MQTTBroker).
+		SetClientID(cfg.MQTTClientID).
+		SetAutoReconnect(true).
+		SetCleanSession(false).
+		SetResumeSubs(true).
+		SetCustomOpenConnectionFn(cfg.MQTTConnect)
+	app.presence.SetWill(opts) // Last Will "offline" - musí být nastavená před připojením
+	mqttClient := mqtt.NewClient(opts)
+	if token := mqttClient.Connect(); token.Wait() && token.Error() != nil {
+		app.Close()
+		return nil, fmt.Errorf("nelze se připojit k MQTT: %w", token.Error())
+	}
+	app.mqtt = mqttClient
+	app.presence.AddCheck("mqtt", presence.MQTTProbe(mqttClient))
+
+	// 5. Inicializace komponent (Wiring)
+	// Vytvoříme službu s připojenými DB
+	// Pozor: prázdný &slog.Logger{} nemá handler a první zalogování by spadlo (nil pointer).
+	svc := NewService(cfg, app.db, store, mqttClient, logger)
+
+	// 5b. Přehled služeb: presence zprávy všech služeb (retained - přijdou hned po přihlášení)
+	if err := svc.services.Subscribe(mqttClient, cfg.PresenceSubscribe); err != nil {
+		app.Close()
+		return nil, fmt.Errorf("subscribe %s selhal: %w", cfg.PresenceSubscribe, err)
+	}
+	// Vytvoříme API handler, který používá službu
+	api := NewAPIHandler(svc, logger)
+
+	// 6. Nastavení Routeru
+	mux := http.NewServeMux()
+	api.RegisterRoutes(mux)
+
+	// Health endpointy: /health/live (proces běží), /health/ready a /health (závislosti OK)
+	app.presence.RegisterHealth(mux)
+
+	// Handler obalíme CorsMiddlewarem, aby fungovalo volání z frontendu.
+	app.handler = CorsMiddleware(mux)
+	return app, nil
+}
+
+// Handler vrací kompletní HTTP handler API (routy + CORS).
+func (a *App) Handler() http.Handler {
+	return a.handler
+}
+
+// Serve spustí HTTP server na cfg.HTTPPort a blokuje do zrušení ctx.
+// Po zrušení doběhnou rozpracované požadavky (max. 5 s), pak server skončí.
+func (a *App) Serve(ctx context.Context) error {
+	server := &http.Server{
+		Addr:    ":" + a.cfg.HTTPPort,
+		Handler: a.handler,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	a.logger.Info("HTTP server naslouchá", "address", server.Addr)
+
+	// Presence "online" + stav závislostí, obnova každý PRESENCE_INTERVAL
+	go a.presence.Run(ctx, a.mqtt)
+
+	// ListenAndServe je blokující volání - zde program "visí" a obsluhuje requesty.
+	// ErrServerClosed = řádné ukončení přes Shutdown, nejde o chybu.
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("server spadl: %w", err)
+	}
+	return nil
+}
+
+// Close uzavře MQTT, Valkey i DB. Volá se až po doběhnutí Serve.
+// Úložiště předané v Config.Store patří volajícímu - to neuzavíráme.
+func (a *App) Close() {
+	if a.mqtt != nil {
+		a.presence.Offline(a.mqtt) // Řádné ukončení - Last Will by broker neposlal
+		a.mqtt.Disconnect(250)
+	}
+	if a.rdb != nil {
+		a.rdb.Close()
+	}
+	if a.db != nil {
+		a.db.Close()
+	}
+}
+
+// Run spustí Home API a blokuje, dokud není zrušen ctx (signál, all-in-one shutdown).
+func Run(ctx context.Context, cfg Config, logger *slog.Logger) error {
+	logger.Info("Startuji Home API", "port", cfg.HTTPPort)
+
+	app, err := New(ctx, cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	return app.Serve(ctx)
+}
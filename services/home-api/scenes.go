@@ -0,0 +1,102 @@
+package homeapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// --- SCÉNY A ROZVRHY ---
+// Rozvrhy spouští služba 'scheduler'. Home API umí scény vypsat a ručně aktivovat
+// (odešle jejich MQTT zprávy stejně, jako by to udělal scheduler).
+
+// GetScenes vrací všechny scény.
+func (s *Service) GetScenes(ctx context.Context) ([]SceneDTO, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, name, description, actions
+		FROM scenes
+		ORDER BY name ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("db query failed: %w", err)
+	}
+	defer rows.Close()
+
+	scenes := make([]SceneDTO, 0)
+	for rows.Next() {
+		var sc SceneDTO
+		if err := rows.Scan(&sc.ID, &sc.Name, &sc.Description, &sc.Actions); err != nil {
+			return nil, err
+		}
+		scenes = append(scenes, sc)
+	}
+	return scenes, rows.Err()
+}
+
+// ActivateScene odešle všechny MQTT zprávy scény. Vrací výsledek každé zprávy;
+// selhání jedné zprávy nezastaví ostatní.
+func (s *Service) ActivateScene(ctx context.Context, id int64) ([]SceneActionResult, error) {
+	var raw []byte
+	err := s.db.QueryRow(ctx, `SELECT actions FROM scenes WHERE id = $1`, id).Scan(&raw)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var actions []SceneAction
+	if err := json.Unmarshal(raw, &actions); err != nil {
+		return nil, fmt.Errorf("%w: scéna %d má neplatné akce: %v", ErrInvalid, id, err)
+	}
+
+	results := make([]SceneActionResult, 0, len(actions))
+	for _, a := range actions {
+		res := SceneActionResult{Topic: a.Topic, OK: true}
+
+		qos := byte(1)
+		if a.QoS != nil && *a.QoS <= 2 {
+			qos = *a.QoS
+		}
+		token := s.mqtt.Publish(a.Topic, qos, a.Retain, a.Payload)
+		if !token.WaitTimeout(5 * time.Second) {
+			res.OK, res.Error = false, "publikace nebyla potvrzena brokerem"
+		} else if token.Error() != nil {
+			res.OK, res.Error = false, token.Error().Error()
+		}
+		results = append(results, res)
+	}
+
+	s.logger.Info("Scéna aktivována", "scene_id", id, "actions", len(actions))
+	return results, nil
+}
+
+// GetSchedules vrací všechny rozvrhy včetně vypnutých.
+func (s *Service) GetSchedules(ctx context.Context) ([]ScheduleDTO, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT s.id, s.name, s.enabled, s.kind, s.cron_expr, s.sun_event, s.offset_minutes,
+		       s.timezone, s.scene_id, sc.name, s.catch_up, s.last_run_at
+		FROM schedules s
+		LEFT JOIN scenes sc ON sc.id = s.scene_id
+		ORDER BY s.id ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("db query failed: %w", err)
+	}
+	defer rows.Close()
+
+	schedules := make([]ScheduleDTO, 0)
+	for rows.Next() {
+		var sc ScheduleDTO
+		if err := rows.Scan(&sc.ID, &sc.Name, &sc.Enabled, &sc.Kind, &sc.CronExpr, &sc.SunEvent, &sc.OffsetMinutes,
+			&sc.Timezone, &sc.SceneID, &sc.SceneName, &sc.CatchUp, &sc.LastRunAt); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, sc)
+	}
+	return schedules, rows.Err()
+}
@@ -1,81 +1,112 @@
-package main
+package homeapi
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog" // Nutný import pro logování
-	"strconv"
 	"time"
 
+	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/redis/go-redis/v9"
+	"storage"
+)
+
+// Chybové stavy, které API převádí na HTTP status kódy (viz writeServiceError).
+var (
+	ErrNotFound = errors.New("záznam nenalezen")   // -> 404
+	ErrConflict = errors.New("konflikt stavu")     // -> 409
+	ErrInvalid  = errors.New("neplatný požadavek") // -> 400
 )
 
 // Service zapouzdřuje logiku získávání dat.
 type Service struct {
-	db    *pgxpool.Pool
-	redis *redis.Client
+	cfg   Config
+	db    *pgxpool.Pool // nil = bez TimescaleDB (vestavěné úložiště), viz requireDB v api.go
+	store storage.Store // Senzory, historie a poslední hodnoty (TimescaleDB + Valkey nebo vestavěné)
+	mqtt  mqtt.Client   // Odesílání příkazů akčním členům
 	// Přidáme logger do service, abychom mohli debugovat dotazy
 	logger *slog.Logger
+
+	// states sleduje state topicy zařízení a předává potvrzení čekajícím příkazům.
+	states *StateWatcher
+
+	// services drží poslední presence zprávy všech služeb (viz services.go).
+	services *ServiceRegistry
 }
 
 // Upravený konstruktor - přijímá i logger
-func NewService(db *pgxpool.Pool, rdb *redis.Client, logger *slog.Logger) *Service {
+func NewService(cfg Config, db *pgxpool.Pool, store storage.Store, mq mqtt.Client, logger *slog.Logger) *Service {
 	return &Service{
+		cfg:    cfg,
 		db:     db,
-		redis:  rdb,
+		store:  store,
+		mqtt:   mq,
 		logger: logger,
+		states: NewStateWatcher(mq, logger),
+
+		services: NewServiceRegistry(cfg.PresenceInterval, logger),
 	}
 }
 
-// GetAllSensors vrací seznam senzorů + aktuální hodnoty z Redisu.
+// GetAllSensors vrací seznam senzorů + aktuální hodnoty z cache (Valkey).
 func (s *Service) GetAllSensors(ctx context.Context) ([]SensorDTO, error) {
 	s.logger.Info("DEBUG: Začínám GetAllSensors")
 
-	// 1. SQL DOTAZ (Metadata)
-	query := `
-		SELECT s.id, s.mqtt_topic, s.friendly_name, st.name, st.unit
-		FROM sensors s
-		JOIN sensor_types st ON s.sensor_type_id = st.id
-		WHERE s.is_active = true
-		ORDER BY s.id ASC
-	`
-	rows, err := s.db.Query(ctx, query)
+	// 1. Metadata (aktivní senzory seřazené podle ID)
+	list, err := s.store.ActiveSensors(ctx)
 	if err != nil {
-		s.logger.Error("CHYBA: SQL dotaz na senzory selhal", "error", err)
+		s.logger.Error("CHYBA: Načtení senzorů selhalo", "error", err)
 		return nil, fmt.Errorf("db query failed: %w", err)
 	}
-	defer rows.Close()
 
+	// 2. Poslední hodnoty (Live Data) - jedním dotazem pro všechny senzory
+	ids := make([]int64, len(list))
+	for i, sensor := range list {
+		ids[i] = sensor.ID
+	}
+	latest, err := s.store.Latest(ctx, ids)
+	if err != nil {
+		// Chyba cache (spojení atd.) - senzory vrátíme bez hodnot, ať dashboard aspoň něco ukáže.
+		s.logger.Error("CHYBA: Načtení posledních hodnot selhalo", "error", err)
+	}
+
+	now := time.Now().UTC()
 	var sensors []SensorDTO
-	for rows.Next() {
-		var dto SensorDTO
-		if err := rows.Scan(&dto.ID, &dto.Topic, &dto.Name, &dto.Type, &dto.Unit); err != nil {
-			s.logger.Error("CHYBA: Scan řádku selhal", "error", err)
-			return nil, err
+	for _, sensor := range list {
+		dto := SensorDTO{
+			ID:           sensor.ID,
+			Topic:        sensor.Topic,
+			Name:         sensor.Name,
+			Type:         sensor.Type,
+			Controllable: sensor.Controllable,
+			Virtual:      sensor.Virtual,
+			Counter:      sensor.Counter,
+			Kind:         sensor.Kind,
+			EnumValues:   sensor.EnumValues,
+		}
+		if sensor.Unit != nil {
+			dto.Unit = *sensor.Unit
 		}
 
-		// 2. REDIS LOOKUP (Live Data)
-		key := fmt.Sprintf("sensor:last:%d", dto.ID)
-
-		// Získáme hodnotu z Redisu
-		valStr, err := s.redis.Get(ctx, key).Result()
+		// Práh zastarání: vlastní práh typu, jinak výchozí (STALE_AFTER)
+		staleAfter := sensor.StaleAfter
+		if staleAfter <= 0 {
+			staleAfter = s.cfg.StaleAfter
+		}
 
-		if err == redis.Nil {
-			// Klíč neexistuje = Senzor ještě neposlal data, nebo Persister nezapisuje do Redisu.
-			s.logger.Warn("DEBUG: Redis klíč nenalezen", "key", key)
-		} else if err != nil {
-			// Jiná chyba Redisu (spojení atd.)
-			s.logger.Error("CHYBA: Redis GET selhal", "key", key, "error", err)
+		if lv, ok := latest[sensor.ID]; ok {
+			dto.CurrentValue = &lv.Value
+			dto.LastSeen = &lv.Time
+			dto.Quality = lv.Quality
+			dto.CurrentState = lv.State
+			dto.IsStale = now.Sub(lv.Time) > staleAfter
 		} else {
-			// Úspěch
-			val, parseErr := strconv.ParseFloat(valStr, 64)
-			if parseErr == nil {
-				dto.CurrentValue = &val
-				// Logujeme jen občas nebo pro debug
-				// s.logger.Debug("DEBUG: Načtena hodnota z Redisu", "key", key, "val", val)
-			} else {
-				s.logger.Error("CHYBA: Nelze parsovat hodnotu z Redisu", "val", valStr)
+			// Bez hodnoty nevíme nic aktuálního - senzor je zastaralý.
+			dto.IsStale = true
+			if err == nil {
+				// Hodnota chybí = Senzor ještě neposlal data, nebo Persister nezapisuje do cache.
+				s.logger.Warn("DEBUG: Poslední hodnota nenalezena", "sensor_id", sensor.ID)
 			}
 		}
 
@@ -87,13 +118,20 @@ func (s *Service) GetAllSensors(ctx context.Context) ([]SensorDTO, error) {
 }
 
 // GetHistory vrací data pro graf. Zde často vzniká chyba s časem.
-func (s *Service) GetHistory(ctx context.Context, sensorID int64, durationStr string) ([]HistoryPoint, error) {
-	s.logger.Info("DEBUG: Začínám GetHistory", "sensor_id", sensorID, "range", durationStr)
+// Okno je posledních 'durationStr' (např. "24h"). resolution: "" = automaticky podle délky okna (cca 300 bodů), "raw" = surová data,
+// jinak doba (např. "1h"). Podle rozlišení se vybere vrstva historie (viz tiers.go);
+// její název vrací jako druhou hodnotu.
+func (s *Service) GetHistory(ctx context.Context, sensorID int64, durationStr, resolution string) ([]HistoryPoint, string, error) {
+	s.logger.Info("DEBUG: Začínám GetHistory", "sensor_id", sensorID, "range", durationStr, "resolution", resolution)
 
 	// 1. Validace času
 	dur, err := time.ParseDuration(durationStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid duration format: %w", err)
+		return nil, "", fmt.Errorf("%w: invalid duration format: %v", ErrInvalid, err)
+	}
+	res, err := parseResolution(resolution, dur)
+	if err != nil {
+		return nil, "", err
 	}
 
 	// Výpočet startovního času.
@@ -107,38 +145,70 @@ func (s *Service) GetHistory(ctx context.Context, sensorID int64, durationStr st
 		"sensor_id", sensorID,
 	)
 
-	// 2. SQL Select
-	query := `
-		SELECT time, value
-		FROM sensor_data
-		WHERE sensor_id = $1 AND time >= $2
-		ORDER BY time ASC
-	`
+	// 2. Nečíselný senzor (boolean, enum, text, geo) má vlastní historii stavů - bez agregací,
+	// protože průměr stavů nedává smysl. Vrací se vždy všechny změny v okně.
+	sensor, err := s.store.SensorByID(ctx, sensorID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, "", fmt.Errorf("%w: senzor %d", ErrNotFound, sensorID)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if storage.IsStateKind(sensor.Kind) {
+		states, err := s.store.ReadStates(ctx, sensorID, startTime, endTime.Add(24*time.Hour))
+		if err != nil {
+			return nil, "", fmt.Errorf("state history query failed: %w", err)
+		}
+		points := make([]HistoryPoint, len(states))
+		for i, p := range states {
+			points[i] = HistoryPoint{Time: p.Time, Value: stateNumber(p.State), State: p.State}
+		}
+		return points, "raw", nil
+	}
 
-	rows, err := s.db.Query(ctx, query, sensorID, startTime)
+	// 3. Čtení historie od startTime. Horní mez necháme den "v budoucnosti" - body od senzoru
+	// s předbíhajícími hodinami se tak v grafu ukážou stejně jako dřív (dotaz neměl horní mez).
+	raw, tier, err := s.readTiered(ctx, sensorID, startTime, endTime.Add(24*time.Hour), res)
 	if err != nil {
 		s.logger.Error("CHYBA: SQL History selhal", "error", err)
-		return nil, fmt.Errorf("history query failed: %w", err)
+		return nil, "", fmt.Errorf("history query failed: %w", err)
 	}
-	defer rows.Close()
-
-	points := make([]HistoryPoint, 0, 100)
 
-	for rows.Next() {
-		var p HistoryPoint
-		if err := rows.Scan(&p.Time, &p.Value); err != nil {
-			s.logger.Error("CHYBA: Scan historie selhal", "error", err)
-			return nil, err
-		}
-		points = append(points, p)
+	points := make([]HistoryPoint, 0, len(raw))
+	for _, p := range raw {
+		points = append(points, HistoryPoint{Time: p.Time, Value: p.Value})
 	}
 
-	s.logger.Info("DEBUG: GetHistory dokončeno", "points_count", len(points))
+	s.logger.Info("DEBUG: GetHistory dokončeno", "points_count", len(points), "tier", tier.Name)
 
 	if len(points) == 0 {
 		// Varování: Pokud DB vrací 0 bodů, buď tam nejsou data, nebo je špatně časové okno.
 		s.logger.Warn("DEBUG: DB vrátila prázdný výsledek! Zkontroluj čas senzorů vs serveru.")
 	}
 
-	return points, nil
+	return points, tier.Name, nil
+}
+
+// stateNumber: Číselná podoba stavu (boolean = 1/0, ostatní 0) - stejná, jakou Ingestor
+// posílá v SensorEvent.Value.
+func stateNumber(st *storage.State) float64 {
+	if st != nil && st.Bool != nil && *st.Bool {
+		return 1
+	}
+	return 0
+}
+
+// parseResolution převede parametr 'resolution' na dobu ("" = automaticky, "raw" = 0).
+func parseResolution(raw string, window time.Duration) (time.Duration, error) {
+	switch raw {
+	case "":
+		return autoBucket(window), nil
+	case "raw":
+		return 0, nil
+	}
+	res, err := time.ParseDuration(raw)
+	if err != nil || res < 0 {
+		return 0, fmt.Errorf("%w: neplatné rozlišení %q (např. 5m nebo raw)", ErrInvalid, raw)
+	}
+	return res, nil
 }
@@ -0,0 +1,151 @@
+package homeapi
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"presence"
+)
+
+// --- PŘEHLED SLUŽEB ---
+// Každá služba publikuje retained presence zprávu (viz modul presence) na presence/<služba>.
+// Home API odebírá PRESENCE_SUBSCRIBE (presence/+), drží poslední zprávu každé služby v paměti
+// a vrací je přes:
+//
+//	GET /api/services
+//
+// Stav (state) služby:
+//   - offline:  služba se odhlásila, nebo za ni broker poslal Last Will,
+//   - stale:    "online", ale zpráva se neobnovila déle než 3 intervaly (proces zamrzl,
+//     nebo broker o výpadku zatím neví),
+//   - degraded: online, ale některá závislost (DB, Valkey, MQTT) hlásí chybu,
+//   - online:   vše v pořádku.
+//
+// Po restartu Home API přijdou retained zprávy hned po přihlášení k odběru - přehled je
+// úplný okamžitě. Službu, která už neexistuje, odstraní prázdná retained zpráva na jejím topicu.
+
+// Stav služby v přehledu (ServiceDTO.State).
+const (
+	ServiceOnline   = "online"
+	ServiceOffline  = "offline"
+	ServiceStale    = "stale"
+	ServiceDegraded = "degraded"
+)
+
+// staleIntervals: Po kolika vynechaných intervalech obnovy je služba zastaralá.
+const staleIntervals = 3
+
+// ServiceDTO je poslední presence zpráva služby s vyhodnoceným stavem.
+type ServiceDTO struct {
+	presence.Message
+	Topic      string    `json:"topic"`
+	ReceivedAt time.Time `json:"received_at"`
+	State      string    `json:"state"` // online | degraded | stale | offline
+}
+
+// serviceEntry je přijatá presence zpráva (čas příjmu kvůli službám s rozjetými hodinami).
+type serviceEntry struct {
+	msg        presence.Message
+	topic      string
+	receivedAt time.Time
+}
+
+// ServiceRegistry sbírá presence zprávy služeb z MQTT.
+type ServiceRegistry struct {
+	fallbackInterval time.Duration // Interval pro zprávy bez interval_seconds
+	logger           *slog.Logger
+
+	// mu chrání mapu - handle běží v MQTT goroutině, List v HTTP handlerech.
+	mu       sync.Mutex
+	services map[string]serviceEntry // topic -> poslední zpráva
+}
+
+// NewServiceRegistry - konstruktor
+func NewServiceRegistry(fallbackInterval time.Duration, logger *slog.Logger) *ServiceRegistry {
+	return &ServiceRegistry{
+		fallbackInterval: fallbackInterval,
+		logger:           logger,
+		services:         make(map[string]serviceEntry),
+	}
+}
+
+// Subscribe přihlásí odběr presence topiců (retained zprávy přijdou hned).
+func (r *ServiceRegistry) Subscribe(client mqtt.Client, filter string) error {
+	token := client.Subscribe(filter, 1, r.handle)
+	token.Wait()
+	return token.Error()
+}
+
+// handle je MQTT callback pro presence zprávy.
+func (r *ServiceRegistry) handle(_ mqtt.Client, msg mqtt.Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Prázdná retained zpráva = admin službu z přehledu odstranil
+	if len(msg.Payload()) == 0 {
+		delete(r.services, msg.Topic())
+		return
+	}
+
+	var p presence.Message
+	if err := json.Unmarshal(msg.Payload(), &p); err != nil || p.Service == "" {
+		r.logger.Warn("Neplatná presence zpráva", "topic", msg.Topic(), "payload", string(msg.Payload()), "error", err)
+		return
+	}
+	r.services[msg.Topic()] = serviceEntry{msg: p, topic: msg.Topic(), receivedAt: time.Now().UTC()}
+}
+
+// List vrací služby seřazené podle jména s vyhodnoceným stavem.
+func (r *ServiceRegistry) List(now time.Time) []ServiceDTO {
+	r.mu.Lock()
+	list := make([]ServiceDTO, 0, len(r.services))
+	for _, e := range r.services {
+		list = append(list, ServiceDTO{
+			Message:    e.msg,
+			Topic:      e.topic,
+			ReceivedAt: e.receivedAt,
+			State:      r.state(e, now),
+		})
+	}
+	r.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Service != list[j].Service {
+			return list[i].Service < list[j].Service
+		}
+		return list[i].Host < list[j].Host
+	})
+	return list
+}
+
+// state vyhodnotí stav služby ze zprávy a stáří jejího příjmu.
+func (r *ServiceRegistry) state(e serviceEntry, now time.Time) string {
+	if !strings.EqualFold(e.msg.Status, presence.StatusOnline) {
+		return ServiceOffline
+	}
+	interval := time.Duration(e.msg.IntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = r.fallbackInterval
+	}
+	// Retained zpráva přijde i po restartu Home API - čas příjmu o čerstvosti nic neříká,
+	// rozhoduje čas odeslání. Hodiny služby napřed ale nesmí zastarání oddálit (starší z obou).
+	last := e.receivedAt
+	if !e.msg.UpdatedAt.IsZero() {
+		last = minTime(e.msg.UpdatedAt, e.receivedAt)
+	}
+	if now.Sub(last) > staleIntervals*interval {
+		return ServiceStale
+	}
+	for _, d := range e.msg.Dependencies {
+		if d.Status != presence.DependencyOK {
+			return ServiceDegraded
+		}
+	}
+	return ServiceOnline
+}
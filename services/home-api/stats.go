@@ -0,0 +1,429 @@
+package homeapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"storage"
+)
+
+// --- STATISTIKY SENZORU ---
+// GET /api/sensors/{id}/stats počítá souhrn za libovolné okno přímo z historie
+// (TimescaleDB i vestavěné úložiště), takže pro reporty už není nutné exportovat surová data.
+//
+// Časově vážené veličiny (integrál, časově vážený průměr, doba nad/pod prahem) berou historii
+// jako SCHODOVÝ graf: hodnota platí od svého času do dalšího bodu. Tak ji ukládá i deadband
+// v persisteru (viz postgres.sql, sekce 14), takže výsledek nezkresluje komprese.
+// Poslední bod platí do konce okna (nejpozději do "teď"). Úsek před prvním bodem okna
+// se nepočítá - hodnota z doby před oknem se nedohledává (u souhrnů po dnech/týdnech/měsících
+// se ale hodnota z předchozího bucketu přenáší).
+//
+// Prosté statistiky (počet, průměr, směrodatná odchylka, percentily) jsou počítané z uložených
+// bodů - u senzoru s deadbandem jsou proto vychýlené k úsekům s častými změnami.
+//
+// Statistiky se počítají vždy ze SUROVÝCH dat (agregace by rozmazaly min/max, jejich časy
+// i percentily). Okno začínající před hranicí retence surové vrstvy (RETENTION_RAW, viz
+// tiers.go) proto odmítneme (400) - jinak by tiše pokrylo jen tu část, která v DB ještě je.
+
+// maxStatsWindow: Nejdelší okno jednoho dotazu (body se zpracovávají v paměti).
+const maxStatsWindow = 366 * 24 * time.Hour
+
+// Velikosti bucketů souhrnů (parametr 'bucket').
+const (
+	StatsBucketDay   = "day"
+	StatsBucketWeek  = "week" // Týden začíná pondělím
+	StatsBucketMonth = "month"
+)
+
+// StatsOptions jsou parametry dotazu. Okno je buď Range (zpětně od teď), nebo From/To.
+type StatsOptions struct {
+	Range    string // Např. "24h"; použije se, pokud chybí From
+	From     string // RFC3339, "2006-01-02" nebo "2006-01-02T15:04" (bez zóny = v Timezone)
+	To       string // Stejný formát jako From; prázdné = teď
+	Timezone string // IANA zóna pro buckety a časy bez zóny; prázdné = výchozí zóna API
+	Bucket   string // "" (jen souhrn) | day | week | month
+
+	// Prahy pro dobu nad/pod hodnotou (nil = nepočítá se). V jednotkách odpovědi (viz Units).
+	Above *float64
+	Below *float64
+
+	Units UnitSystem
+}
+
+// StatPoint je hodnota s časem (min, max, první, poslední).
+type StatPoint struct {
+	Value float64   `json:"v"`
+	Time  time.Time `json:"t"`
+}
+
+// ThresholdStat je doba, po kterou byla hodnota nad/pod prahem.
+type ThresholdStat struct {
+	Threshold float64 `json:"threshold"`
+	Seconds   float64 `json:"seconds"`
+	Ratio     float64 `json:"ratio"` // Podíl pokrytého času (0-1)
+}
+
+// Stats jsou statistiky jednoho okna. Bez bodů je vyplněn jen Count (= 0).
+type Stats struct {
+	Count int        `json:"count"`
+	Min   *StatPoint `json:"min,omitempty"`
+	Max   *StatPoint `json:"max,omitempty"`
+	First *StatPoint `json:"first,omitempty"`
+	Last  *StatPoint `json:"last,omitempty"`
+
+	Mean   *float64 `json:"mean,omitempty"`   // Aritmetický průměr bodů
+	StdDev *float64 `json:"stddev,omitempty"` // Směrodatná odchylka bodů (populační)
+	P50    *float64 `json:"p50,omitempty"`
+	P95    *float64 `json:"p95,omitempty"`
+
+	// Časově vážené veličiny (schodový graf)
+	CoveredSeconds   float64  `json:"covered_seconds"`              // Čas, pro který známe hodnotu
+	TimeWeightedMean *float64 `json:"time_weighted_mean,omitempty"` // Integrál / pokrytý čas
+	Integral         *float64 `json:"integral_h,omitempty"`         // Hodnota × hodina (např. W -> Wh)
+
+	Above *ThresholdStat `json:"above,omitempty"`
+	Below *ThresholdStat `json:"below,omitempty"`
+}
+
+// StatsBucket jsou statistiky jednoho dne/týdne/měsíce (hranice v lokální zóně).
+type StatsBucket struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Stats
+}
+
+// SensorStatsDTO je odpověď endpointu /api/sensors/{id}/stats.
+type SensorStatsDTO struct {
+	SensorID int64         `json:"sensor_id"`
+	Unit     string        `json:"unit"`
+	From     time.Time     `json:"from"`
+	To       time.Time     `json:"to"`
+	Timezone string        `json:"timezone"`
+	Summary  Stats         `json:"summary"`
+	Bucket   string        `json:"bucket,omitempty"`
+	Buckets  []StatsBucket `json:"buckets,omitempty"`
+}
+
+// GetStats spočítá statistiky senzoru za okno z opts (souhrn + volitelně buckety).
+func (s *Service) GetStats(ctx context.Context, sensorID int64, opts StatsOptions) (*SensorStatsDTO, error) {
+	// 1. Validace parametrů (okno, zóna, bucket)
+	loc, err := s.statsLocation(opts.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	from, to, err := statsWindow(opts, loc, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireRawData(from, now); err != nil {
+		return nil, err
+	}
+	switch opts.Bucket {
+	case "", StatsBucketDay, StatsBucketWeek, StatsBucketMonth:
+	default:
+		return nil, fmt.Errorf("%w: neznámý bucket %q (day|week|month)", ErrInvalid, opts.Bucket)
+	}
+
+	// 2. Senzor (jednotka) a jeho historie
+	sensor, err := s.store.SensorByID(ctx, sensorID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if storage.IsStateKind(sensor.Kind) {
+		return nil, fmt.Errorf("%w: statistiky jsou jen pro číselné senzory (senzor %d je %s)", ErrInvalid, sensorID, sensor.Kind)
+	}
+	raw, err := s.store.ReadRange(ctx, sensorID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("history query failed: %w", err)
+	}
+	points := make([]HistoryPoint, len(raw))
+	for i, p := range raw {
+		points[i] = HistoryPoint{Time: p.Time, Value: p.Value}
+	}
+
+	// 3. Převod jednotek PŘED výpočtem - prahy i výsledky jsou pak v jednotce odpovědi
+	unit := ""
+	if sensor.Unit != nil {
+		unit = *sensor.Unit
+	}
+	ConvertHistory(points, unit, opts.Units)
+	unit, _ = unitConverter(unit, opts.Units)
+
+	// Poslední bod platí nejdéle do "teď" - budoucnost neznáme
+	end := to
+	if end.After(now) {
+		end = now
+	}
+
+	result := &SensorStatsDTO{
+		SensorID: sensorID,
+		Unit:     unit,
+		From:     from,
+		To:       to,
+		Timezone: loc.String(),
+		Summary:  computeStats(points, from, end, nil, opts.Above, opts.Below),
+		Bucket:   opts.Bucket,
+	}
+	if opts.Bucket != "" {
+		result.Buckets = bucketStats(points, from, to, end, loc, opts)
+	}
+	return result, nil
+}
+
+// statsLocation vrací zónu dotazu; prázdná = STATS_TIMEZONE, jinak zóna procesu (TZ).
+func (s *Service) statsLocation(name string) (*time.Location, error) {
+	if name == "" {
+		name = s.cfg.StatsTimezone
+	}
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: neznámá časová zóna %q", ErrInvalid, name)
+	}
+	return loc, nil
+}
+
+// statsWindow určí okno [from, to) z parametrů. Časy vrací v UTC.
+func statsWindow(opts StatsOptions, loc *time.Location, now time.Time) (time.Time, time.Time, error) {
+	to := now
+	if opts.To != "" {
+		t, err := parseStatsTime(opts.To, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		to = t
+	}
+
+	var from time.Time
+	if opts.From != "" {
+		t, err := parseStatsTime(opts.From, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		from = t
+	} else {
+		rng := opts.Range
+		if rng == "" {
+			rng = "24h"
+		}
+		dur, err := time.ParseDuration(rng)
+		if err != nil || dur <= 0 {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: neplatný rozsah %q (např. 24h)", ErrInvalid, rng)
+		}
+		from = to.Add(-dur)
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: začátek okna musí být před koncem", ErrInvalid)
+	}
+	if to.Sub(from) > maxStatsWindow {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: okno je delší než %d dní", ErrInvalid, int(maxStatsWindow.Hours()/24))
+	}
+	return from.UTC(), to.UTC(), nil
+}
+
+// requireRawData odmítne okno, jehož začátek je starší než retence surové vrstvy
+// (RETENTION_RAW). Výpočty ze surových dat by pro takové okno byly tiše neúplné.
+func (s *Service) requireRawData(from, now time.Time) error {
+	if s.cfg.RetentionRaw == 0 || !from.Before(now.Add(-s.cfg.RetentionRaw)) {
+		return nil
+	}
+	return fmt.Errorf("%w: začátek okna je starší než retence surových dat (%d dní)",
+		ErrInvalid, int(s.cfg.RetentionRaw.Hours()/24))
+}
+
+// parseStatsTime přijme RFC3339, nebo datum/čas bez zóny (ten se bere v lokální zóně dotazu).
+func parseStatsTime(raw string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, raw, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: neplatný čas %q (RFC3339, 2006-01-02 nebo 2006-01-02T15:04)", ErrInvalid, raw)
+}
+
+// bucketStats rozdělí okno na dny/týdny/měsíce podle lokální zóny (DST: den může mít 23/25 h)
+// a spočítá statistiky každého bucketu. Hodnota se přenáší přes hranici bucketu.
+func bucketStats(points []HistoryPoint, from, to, end time.Time, loc *time.Location, opts StatsOptions) []StatsBucket {
+	var buckets []StatsBucket
+	var carry *float64 // Poslední hodnota předchozího bucketu
+	i := 0
+	for start := bucketStart(from.In(loc), opts.Bucket); start.Before(to); {
+		next := nextBucket(start, opts.Bucket)
+
+		// Okno bucketu oříznuté na okno dotazu
+		bFrom, bTo := maxTime(start, from), minTime(next, to)
+		j := i
+		for j < len(points) && points[j].Time.Before(bTo) {
+			j++
+		}
+		st := computeStats(points[i:j], bFrom, minTime(bTo, end), carry, opts.Above, opts.Below)
+		buckets = append(buckets, StatsBucket{Start: start, End: next, Stats: st})
+		if j > i {
+			v := points[j-1].Value
+			carry = &v
+		}
+		i = j
+		start = next
+	}
+	return buckets
+}
+
+// bucketStart vrátí začátek bucketu, do kterého patří t (v zóně t).
+func bucketStart(t time.Time, bucket string) time.Time {
+	y, m, d := t.Date()
+	switch bucket {
+	case ConsumptionBucketHour:
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, t.Location())
+	case StatsBucketMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+	case StatsBucketWeek:
+		// Weekday: neděle = 0 -> posun o 6 dní zpět na pondělí
+		back := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-back, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// nextBucket vrátí začátek následujícího bucketu (AddDate respektuje kalendář i DST).
+func nextBucket(start time.Time, bucket string) time.Time {
+	switch bucket {
+	case ConsumptionBucketHour:
+		return start.Add(time.Hour) // Absolutní hodina - přes změnu času (DST) bez mezer i překryvů
+	case StatsBucketMonth:
+		return start.AddDate(0, 1, 0)
+	case StatsBucketWeek:
+		return start.AddDate(0, 0, 7)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// computeStats spočítá statistiky bodů (seřazených podle času) v okně [from, end).
+// carry = hodnota platná od 'from' do prvního bodu (nil = neznámá, úsek se nepočítá).
+func computeStats(points []HistoryPoint, from, end time.Time, carry, above, below *float64) Stats {
+	st := Stats{Count: len(points)}
+
+	// 1. Časově vážené veličiny (schodový graf)
+	var integral, aboveSec, belowSec float64 // integrál v hodnota × sekunda
+	segment := func(v float64, a, b time.Time) {
+		sec := b.Sub(a).Seconds()
+		if sec <= 0 {
+			return
+		}
+		st.CoveredSeconds += sec
+		integral += v * sec
+		if above != nil && v > *above {
+			aboveSec += sec
+		}
+		if below != nil && v < *below {
+			belowSec += sec
+		}
+	}
+	if carry != nil {
+		holdUntil := end
+		if len(points) > 0 {
+			holdUntil = points[0].Time
+		}
+		segment(*carry, from, holdUntil)
+	}
+	for i, p := range points {
+		next := end
+		if i+1 < len(points) {
+			next = points[i+1].Time
+		}
+		segment(p.Value, p.Time, minTime(next, end))
+	}
+	if st.CoveredSeconds > 0 {
+		integralH := integral / 3600
+		twm := integral / st.CoveredSeconds
+		st.Integral, st.TimeWeightedMean = &integralH, &twm
+	}
+	if above != nil {
+		st.Above = &ThresholdStat{Threshold: *above, Seconds: aboveSec, Ratio: ratio(aboveSec, st.CoveredSeconds)}
+	}
+	if below != nil {
+		st.Below = &ThresholdStat{Threshold: *below, Seconds: belowSec, Ratio: ratio(belowSec, st.CoveredSeconds)}
+	}
+
+	if len(points) == 0 {
+		return st
+	}
+
+	// 2. Prosté statistiky bodů
+	first, last := points[0], points[len(points)-1]
+	st.First = &StatPoint{Value: first.Value, Time: first.Time}
+	st.Last = &StatPoint{Value: last.Value, Time: last.Time}
+
+	minP, maxP := first, first
+	var sum float64
+	values := make([]float64, len(points))
+	for i, p := range points {
+		if p.Value < minP.Value {
+			minP = p
+		}
+		if p.Value > maxP.Value {
+			maxP = p
+		}
+		sum += p.Value
+		values[i] = p.Value
+	}
+	st.Min = &StatPoint{Value: minP.Value, Time: minP.Time}
+	st.Max = &StatPoint{Value: maxP.Value, Time: maxP.Time}
+
+	mean := sum / float64(len(points))
+	var sq float64
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	stddev := math.Sqrt(sq / float64(len(points)))
+	st.Mean, st.StdDev = &mean, &stddev
+
+	slices.Sort(values)
+	p50, p95 := percentile(values, 0.50), percentile(values, 0.95)
+	st.P50, st.P95 = &p50, &p95
+	return st
+}
+
+// percentile: lineární interpolace mezi sousedními hodnotami seřazeného pole (jako percentile_cont v SQL).
+func percentile(sorted []float64, p float64) float64 {
+	pos := p * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(pos-float64(lo))
+}
+
+func ratio(part, whole float64) float64 {
+	if whole <= 0 {
+		return 0
+	}
+	return part / whole
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
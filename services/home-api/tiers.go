@@ -0,0 +1,122 @@
+package homeapi
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// --- VRSTVY HISTORIE (surová data a agregace) ---
+// TimescaleDB drží historii ve čtyřech vrstvách (viz postgres.sql, sekce 17): surová
+// 'sensor_data' a continuous aggregates po 5 minutách, hodinách a dnech. Každá má jinou
+// retenci. Pro dotaz vybereme NEJHRUBŠÍ vrstvu, která:
+//
+//  1. ještě drží data od začátku okna (retence), a
+//  2. má bucket nejvýše rovný požadovanému rozlišení a rozlišení je jeho násobkem
+//     (buckety vrstvy pak beze zbytku padnou do bucketů odpovědi).
+//
+// Když žádná vrstva nesplní obojí (dlouhé okno s jemným rozlišením), vyhraje retence:
+// vezmeme nejjemnější vrstvu, která data ještě má.
+//
+// Bez TimescaleDB (vestavěné úložiště) agregace neexistují - čte se vždy surová historie.
+
+// historyTier je jedna vrstva historie.
+type historyTier struct {
+	Name      string        // Název pro hlavičku odpovědi ("raw", "5m", "1h", "1d")
+	View      string        // Tabulka/pohled v DB ("" = surová data přes store)
+	Bucket    time.Duration // 0 = surová data
+	Retention time.Duration // 0 = navždy
+}
+
+// tierPoint je bod vrstvy. U agregace je Value průměr bucketu a Count počet surových bodů
+// (váha při slučování do větších bucketů); surový bod má Count 1.
+type tierPoint struct {
+	Time  time.Time
+	Value float64
+	Count int64
+}
+
+// historyTiers vrací vrstvy od nejjemnější po nejhrubší (retence podle konfigurace).
+func (s *Service) historyTiers() []historyTier {
+	return []historyTier{
+		{Name: "raw", Retention: s.cfg.RetentionRaw},
+		{Name: "5m", View: "sensor_data_5m", Bucket: 5 * time.Minute, Retention: s.cfg.Retention5m},
+		{Name: "1h", View: "sensor_data_1h", Bucket: time.Hour, Retention: s.cfg.Retention1h},
+		{Name: "1d", View: "sensor_data_1d", Bucket: 24 * time.Hour},
+	}
+}
+
+// pickTier vybere vrstvu pro okno začínající 'from' a rozlišení 'resolution' (0 = surová data).
+func pickTier(tiers []historyTier, from, now time.Time, resolution time.Duration) historyTier {
+	covers := func(t historyTier) bool {
+		return t.Retention == 0 || !from.Before(now.Add(-t.Retention))
+	}
+
+	var chosen, finest *historyTier
+	for i := range tiers {
+		t := &tiers[i]
+		if !covers(*t) {
+			continue
+		}
+		if finest == nil {
+			finest = t
+		}
+		if t.Bucket == 0 || (t.Bucket <= resolution && resolution%t.Bucket == 0) {
+			chosen = t
+		}
+	}
+	switch {
+	case chosen != nil:
+		return *chosen
+	case finest != nil:
+		return *finest
+	default:
+		return tiers[len(tiers)-1] // Nemělo by nastat - nejhrubší vrstva je bez retence
+	}
+}
+
+// readTiered načte historii senzoru v okně [from, to) z vrstvy vybrané podle rozlišení.
+func (s *Service) readTiered(ctx context.Context, sensorID int64, from, to time.Time, resolution time.Duration) ([]tierPoint, historyTier, error) {
+	tier := historyTier{Name: "raw"}
+	if s.db != nil {
+		tier = pickTier(s.historyTiers(), from, time.Now(), resolution)
+	}
+
+	// 1. Surová data - přes úložiště (funguje s TimescaleDB i vestavěným souborem)
+	if tier.View == "" {
+		raw, err := s.store.ReadRange(ctx, sensorID, from, to)
+		if err != nil {
+			return nil, tier, err
+		}
+		points := make([]tierPoint, len(raw))
+		for i, p := range raw {
+			points[i] = tierPoint{Time: p.Time, Value: p.Value, Count: 1}
+		}
+		return points, tier, nil
+	}
+
+	// 2. Agregace. Bucket začínající před 'from' bereme také (obsahuje začátek okna).
+	// Název pohledu pochází z historyTiers, ne od klienta - Sprintf je tu bezpečný.
+	query := fmt.Sprintf(`
+		SELECT bucket, avg_value, sample_count
+		FROM %s
+		WHERE sensor_id = $1 AND bucket > $2 AND bucket < $3
+		ORDER BY bucket ASC
+	`, tier.View)
+
+	rows, err := s.db.Query(ctx, query, sensorID, from.Add(-tier.Bucket), to)
+	if err != nil {
+		return nil, tier, err
+	}
+	defer rows.Close()
+
+	var points []tierPoint
+	for rows.Next() {
+		var p tierPoint
+		if err := rows.Scan(&p.Time, &p.Value, &p.Count); err != nil {
+			return nil, tier, err
+		}
+		points = append(points, p)
+	}
+	return points, tier, rows.Err()
+}
@@ -1,6 +1,11 @@
-package main
+package homeapi
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+
+	"storage"
+)
 
 // SensorDTO (Data Transfer Object) slouží pro odeslání seznamu senzorů na frontend.
 // Oddělujeme databázový model od API modelu (decoupling).
@@ -25,12 +30,210 @@ type SensorDTO struct {
 	// Důvod: Hodnota může být NULL (pokud senzor ještě nic neposlal nebo data expirovala).
 	// Kdybychom použili float64, výchozí hodnota by byla 0.0, což je matoucí (je to 0 stupňů nebo chyba?).
 	CurrentValue *float64 `json:"current_value"`
+
+	// Kind: Druh hodnoty typu (number, boolean, enum, text, geo).
+	// U nečíselného senzoru nese aktuální hodnotu CurrentState; CurrentValue je jen
+	// číselná podoba (boolean = 1/0, ostatní 0) pro starší klienty.
+	Kind         string         `json:"kind"`
+	CurrentState *storage.State `json:"current_state,omitempty"`
+
+	// EnumValues: Povolené stavy výčtového typu (pro legendu časové osy stavů).
+	EnumValues []string `json:"enum_values,omitempty"`
+
+	// LastSeen: Čas měření poslední hodnoty (UTC). null = senzor zatím nic neposlal.
+	LastSeen *time.Time `json:"last_seen"`
+
+	// IsStale: Poslední hodnota je starší než práh typu senzoru (sensor_types.stale_after_seconds,
+	// jinak STALE_AFTER) nebo žádná není. Dashboard takový senzor zašedí.
+	IsStale bool `json:"is_stale"`
+
+	// Quality: Příznaky kvality poslední hodnoty ("suspect" = označil filtr špiček,
+	// "resubmitted" = znovu odeslaná zpráva). Prázdné = hodnota bez výhrad.
+	Quality []string `json:"quality,omitempty"`
+
+	// Controllable: Senzor je akční člen (typ 'switch' s command_topic) - lze mu poslat příkaz.
+	Controllable bool `json:"controllable"`
+
+	// Virtual: Hodnotu počítá služba virtual-sensors z jiných senzorů (viz tabulka virtual_sensors).
+	Virtual bool `json:"virtual"`
+
+	// Counter: Hodnota je kumulativní počítadlo (vodoměr, pulzy) - spotřebu za období vrací
+	// /api/sensors/{id}/consumption.
+	Counter bool `json:"counter"`
 }
 
 // HistoryPoint reprezentuje jeden bod v grafu.
 // Používáme velmi krátké názvy klíčů ("t", "v"), abychom šetřili přenosové pásmo (bandwidth).
 // Při tisících bodech v grafu každý ušetřený znak v JSONu hraje roli.
+//
+// U nečíselného senzoru nese bod stav ("s"), "v" je jeho číselná podoba (boolean = 1/0).
 type HistoryPoint struct {
-	Time  time.Time `json:"t"` // Časová značka osy X
-	Value float64   `json:"v"` // Hodnota na ose Y
+	Time  time.Time      `json:"t"`           // Časová značka osy X
+	Value float64        `json:"v"`           // Hodnota na ose Y
+	State *storage.State `json:"s,omitempty"` // Stav nečíselného senzoru
+}
+
+// SensorTypeDTO je typ senzoru (řádek tabulky sensor_types).
+// Dashboard ho potřebuje pro výběr typu při schvalování nového topicu.
+type SensorTypeDTO struct {
+	ID          int64    `json:"id"`
+	Name        string   `json:"name"`
+	Unit        *string  `json:"unit"`
+	Description *string  `json:"description"`
+	MinValue    *float64 `json:"min_value"`
+	MaxValue    *float64 `json:"max_value"`
+	ValueKind   string   `json:"value_kind"` // number | boolean | enum | text | geo
+}
+
+// DiscoveredTopicDTO je neznámý MQTT topic zachycený Ingestorem (karanténa).
+type DiscoveredTopicDTO struct {
+	ID            int64      `json:"id"`
+	Topic         string     `json:"topic"`
+	FirstSeen     time.Time  `json:"first_seen"`
+	LastSeen      time.Time  `json:"last_seen"`
+	MessageCount  int64      `json:"message_count"`
+	SamplePayload *string    `json:"sample_payload"`
+	InferredType  *string    `json:"inferred_type"` // number | boolean | json | text
+	Status        string     `json:"status"`        // pending | approved | ignored
+	SensorID      *int64     `json:"sensor_id"`     // Vyplněno po schválení
+	DecidedAt     *time.Time `json:"decided_at"`
+}
+
+// ApproveTopicRequest je tělo požadavku pro schválení topicu jako senzoru.
+type ApproveTopicRequest struct {
+	SensorTypeID int64  `json:"sensor_type_id"`
+	FriendlyName string `json:"friendly_name"`
+	Location     string `json:"location"`
+}
+
+// CommandRequest je tělo požadavku POST /api/sensors/{id}/command.
+type CommandRequest struct {
+	Value float64 `json:"value"` // Pro switch: 0 = vypnout, 1 = zapnout
+}
+
+// CommandDTO je jeden příkaz (výsledek odeslání i záznam z historie).
+type CommandDTO struct {
+	ID             int64      `json:"id"`
+	CorrelationID  string     `json:"correlation_id"`
+	SensorID       int64      `json:"sensor_id"`
+	CommandTopic   string     `json:"command_topic"`
+	RequestedValue float64    `json:"requested_value"`
+	Status         string     `json:"status"` // pending | confirmed | timeout | failed
+	RequestedAt    time.Time  `json:"requested_at"`
+	ConfirmedAt    *time.Time `json:"confirmed_at"`
+	ConfirmedValue *float64   `json:"confirmed_value"`
+	Error          *string    `json:"error"`
+}
+
+// RuleDTO je automatizační pravidlo (tabulka automation_rules).
+// Podmínky a akce předáváme jako surový JSON - jejich formát definuje služba rules-engine.
+type RuleDTO struct {
+	ID                int64           `json:"id"`
+	Name              string          `json:"name"`
+	Enabled           bool            `json:"enabled"`
+	DryRun            bool            `json:"dry_run"`
+	Conditions        json.RawMessage `json:"conditions"`
+	ReleaseConditions json.RawMessage `json:"release_conditions"`
+	Actions           json.RawMessage `json:"actions"`
+	ReleaseActions    json.RawMessage `json:"release_actions"`
+	DebounceSeconds   int             `json:"debounce_seconds"`
+	CooldownSeconds   int             `json:"cooldown_seconds"`
+	UpdatedAt         time.Time       `json:"updated_at"`
+	LastFired         *time.Time      `json:"last_fired"`
+}
+
+// RuleExecutionDTO je jeden záznam z logu spuštění pravidel.
+type RuleExecutionDTO struct {
+	ID            int64           `json:"id"`
+	RuleID        int64           `json:"rule_id"`
+	RuleName      string          `json:"rule_name"`
+	ExecutedAt    time.Time       `json:"executed_at"`
+	Phase         string          `json:"phase"` // fire | release
+	DryRun        bool            `json:"dry_run"`
+	Success       bool            `json:"success"`
+	SensorValues  json.RawMessage `json:"sensor_values"`
+	ActionResults json.RawMessage `json:"action_results"`
+}
+
+// SceneAction je jedna MQTT zpráva scény (stejný formát používá scheduler).
+type SceneAction struct {
+	Topic   string `json:"topic"`
+	Payload string `json:"payload"`
+	QoS     *byte  `json:"qos,omitempty"`
+	Retain  bool   `json:"retain,omitempty"`
+}
+
+// SceneDTO je pojmenovaná sada MQTT zpráv.
+type SceneDTO struct {
+	ID          int64           `json:"id"`
+	Name        string          `json:"name"`
+	Description *string         `json:"description"`
+	Actions     json.RawMessage `json:"actions"`
+}
+
+// SceneActionResult je výsledek odeslání jedné zprávy při ruční aktivaci scény.
+type SceneActionResult struct {
+	Topic string `json:"topic"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// ScheduleDTO je časový rozvrh (vyhodnocuje ho služba scheduler).
+type ScheduleDTO struct {
+	ID            int64      `json:"id"`
+	Name          string     `json:"name"`
+	Enabled       bool       `json:"enabled"`
+	Kind          string     `json:"kind"` // cron | sun
+	CronExpr      *string    `json:"cron_expr"`
+	SunEvent      *string    `json:"sun_event"`
+	OffsetMinutes int        `json:"offset_minutes"`
+	Timezone      *string    `json:"timezone"`
+	SceneID       *int64     `json:"scene_id"`
+	SceneName     *string    `json:"scene_name"`
+	CatchUp       string     `json:"catch_up"`
+	LastRunAt     *time.Time `json:"last_run_at"`
+}
+
+// FilterDecisionDTO je jeden záznam auditu filtrů špiček (tabulka filter_decisions).
+type FilterDecisionDTO struct {
+	ID             int64     `json:"id"`
+	SensorID       int64     `json:"sensor_id"`
+	SensorName     string    `json:"sensor_name"`
+	Time           time.Time `json:"time"`
+	Value          float64   `json:"value"`
+	Filter         string    `json:"filter"` // rate | median | zscore
+	Action         string    `json:"action"` // dropped | flagged | accepted
+	ReferenceValue *float64  `json:"reference_value"`
+	Detail         *string   `json:"detail"`
+}
+
+// RejectDTO je zpráva odmítnutá Ingestorem (tabulka rejected_messages).
+type RejectDTO struct {
+	ID            int64      `json:"id"`
+	ReceivedAt    time.Time  `json:"received_at"`
+	Topic         string     `json:"topic"`
+	Payload       string     `json:"payload"`
+	SensorID      *int64     `json:"sensor_id"`
+	SensorName    *string    `json:"sensor_name"`
+	Reason        string     `json:"reason"` // invalid_number | invalid_value | below_min | above_max
+	Detail        *string    `json:"detail"`
+	ResubmittedAt *time.Time `json:"resubmitted_at"`
+}
+
+// RejectSummaryDTO je počet odmítnutých zpráv jednoho senzoru s jedním důvodem.
+type RejectSummaryDTO struct {
+	SensorID   *int64    `json:"sensor_id"`
+	SensorName *string   `json:"sensor_name"`
+	Reason     string    `json:"reason"`
+	Count      int64     `json:"count"`
+	LastAt     time.Time `json:"last_at"`
+}
+
+// DeadbandStatsDTO je úspora zápisů do historie pro jeden senzor.
+type DeadbandStatsDTO struct {
+	SensorID   int64   `json:"sensor_id"`
+	SensorName string  `json:"sensor_name"`
+	Received   int64   `json:"received"` // Bodů přišlo
+	Stored     int64   `json:"stored"`   // Bodů uloženo do sensor_data
+	SavedPct   float64 `json:"saved_pct"`
 }
@@ -0,0 +1,125 @@
+package homeapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"storage"
+)
+
+// --- PŘEVODY JEDNOTEK ---
+// Data ukládáme vždy v jednotce typu senzoru (sensor_types.unit, typicky metrické).
+// Převod probíhá až při čtení: klient si řekne o ?units=imperial a API přepočte hodnoty i jednotku.
+
+// UnitSystem je soustava jednotek požadovaná klientem.
+type UnitSystem string
+
+const (
+	UnitsMetric   UnitSystem = "metric"
+	UnitsImperial UnitSystem = "imperial"
+)
+
+// ParseUnitSystem přečte parametr ?units=. Prázdný = metrická soustava.
+func ParseUnitSystem(s string) (UnitSystem, error) {
+	switch UnitSystem(s) {
+	case "", UnitsMetric:
+		return UnitsMetric, nil
+	case UnitsImperial:
+		return UnitsImperial, nil
+	default:
+		return "", fmt.Errorf("%w: neznámá soustava jednotek %q (metric|imperial)", ErrInvalid, s)
+	}
+}
+
+// unitPair je dvojice odpovídajících si jednotek a převody mezi nimi.
+type unitPair struct {
+	metric, imperial string
+	toImperial       func(float64) float64
+	toMetric         func(float64) float64
+}
+
+// linear vytvoří dvojici pro převod prostým násobením (metrická * factor = imperiální).
+func linear(metric, imperial string, factor float64) unitPair {
+	return unitPair{
+		metric:     metric,
+		imperial:   imperial,
+		toImperial: func(v float64) float64 { return v * factor },
+		toMetric:   func(v float64) float64 { return v / factor },
+	}
+}
+
+var unitPairs = []unitPair{
+	{
+		metric:     "°C",
+		imperial:   "°F",
+		toImperial: func(c float64) float64 { return c*9/5 + 32 },
+		toMetric:   func(f float64) float64 { return (f - 32) * 5 / 9 },
+	},
+	linear("hPa", "inHg", 0.0295299830714),
+	linear("mm", "in", 1/25.4),
+	linear("cm", "in", 1/2.54),
+	linear("m", "ft", 1/0.3048),
+	linear("km", "mi", 1/1.609344),
+	linear("m/s", "mph", 2.2369362921),
+	linear("km/h", "mph", 1/1.609344),
+	linear("kg", "lb", 2.2046226218),
+	linear("g", "oz", 0.0352739619),
+	linear("l", "gal", 0.2641720524),
+	linear("m³", "ft³", 35.3146667215),
+}
+
+// unitConverter vrátí cílovou jednotku a převodní funkci pro zdrojovou jednotku.
+// Jednotky bez protějšku (%, W, kWh, ppm...) zůstávají beze změny (nil funkce).
+func unitConverter(unit string, system UnitSystem) (string, func(float64) float64) {
+	for _, p := range unitPairs {
+		if system == UnitsImperial && unit == p.metric {
+			return p.imperial, p.toImperial
+		}
+		if system == UnitsMetric && unit == p.imperial {
+			return p.metric, p.toMetric
+		}
+	}
+	return unit, nil
+}
+
+// ConvertSensors přepočte aktuální hodnoty a jednotky senzorů do požadované soustavy.
+func ConvertSensors(sensors []SensorDTO, system UnitSystem) {
+	for i := range sensors {
+		unit, convert := unitConverter(sensors[i].Unit, system)
+		if convert == nil {
+			continue
+		}
+		sensors[i].Unit = unit
+		if sensors[i].CurrentValue != nil {
+			v := convert(*sensors[i].CurrentValue)
+			sensors[i].CurrentValue = &v
+		}
+	}
+}
+
+// ConvertHistory přepočte body historie senzoru s jednotkou 'unit'.
+func ConvertHistory(points []HistoryPoint, unit string, system UnitSystem) {
+	_, convert := unitConverter(unit, system)
+	if convert == nil {
+		return
+	}
+	for i := range points {
+		points[i].Value = convert(points[i].Value)
+	}
+}
+
+// GetSensorUnit vrací jednotku senzoru (podle jeho typu). Prázdný řetězec = bez jednotky.
+func (s *Service) GetSensorUnit(ctx context.Context, sensorID int64) (string, error) {
+	sensor, err := s.store.SensorByID(ctx, sensorID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if sensor.Unit == nil {
+		return "", nil
+	}
+	return *sensor.Unit, nil
+}
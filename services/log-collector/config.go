@@ -1,7 +1,10 @@
-package main
+package logcollector
 
 import (
 	"os"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
 // Config drží veškeré nastavení pro službu Log Collector.
@@ -13,6 +16,9 @@ type Config struct {
 
 	// MQTTClientID: Unikátní ID klienta.
 	MQTTClientID string
+	// MQTTConnect: Vlastní otevření spojení k brokeru (režim all-in-one: spojení v paměti
+	// na vestavěný broker). Nenačítá se z ENV; nil = běžné síťové spojení podle MQTTBroker.
+	MQTTConnect mqtt.OpenConnectionFunc `json:"-"`
 
 	// LogTopic: Topic, na kterém posloucháme logy (např. "logs/#")
 	LogTopic string
@@ -20,6 +26,14 @@ type Config struct {
 	// LogDir: Cesta k adresáři, kam budeme ukládat soubory s logy.
 	// V Dockeru to bude typicky namapovaný volume.
 	LogDir string
+
+	// Presence: retained stav služby (online/offline) a interval jeho obnovy, viz modul presence.
+	// Prázdný topic = presence se neposílá.
+	PresenceTopic    string
+	PresenceInterval time.Duration
+
+	// HTTPPort: Port health serveru (/health/live, /health/ready); prázdný = health server se nespouští.
+	HTTPPort string
 }
 
 // LoadConfig načte konfiguraci z OS. Pokud proměnná chybí, použije default.
@@ -33,6 +47,10 @@ func LoadConfig() Config {
 
 		// Defaultní cesta uvnitř kontejneru
 		LogDir: getEnv("LOG_DIR", "/var/log/iot-app"),
+
+		PresenceTopic:    getEnv("PRESENCE_TOPIC", "presence/log-collector"),
+		PresenceInterval: getEnvDuration("PRESENCE_INTERVAL", 30*time.Second),
+		HTTPPort:         getEnv("HTTP_PORT", "8080"),
 	}
 }
 
@@ -43,3 +61,13 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// getEnvDuration načte dobu trvání ve formátu Go (např. "30s", "1m").
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
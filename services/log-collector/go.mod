@@ -9,3 +9,8 @@ require (
 	golang.org/x/net v0.44.0 // indirect
 	golang.org/x/sync v0.17.0 // indirect
 )
+
+require presence v0.0.0
+
+// Sdílený balíček presence není publikovaný modul - bereme ho ze sousedního adresáře.
+replace presence => ../presence
@@ -1,31 +1,29 @@
-package main
+package logcollector
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
-	"os/signal"
 	"path/filepath"
 	"strings"
-	"syscall"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
-)
 
-func main() {
-	// 1. Inicializace Loggeru (pro vlastní diagnostiku collectoru)
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	"presence"
+)
 
-	// 2. Načtení Konfigurace (z ENV)
-	cfg := LoadConfig()
+// Run spustí Log Collector a blokuje, dokud není zrušen ctx (signál, all-in-one shutdown).
+// Chyba se vrací jen při startu (adresář, MQTT) - o ukončení procesu rozhoduje volající.
+func Run(ctx context.Context, cfg Config, logger *slog.Logger) error {
+	// 1.+2. Logger (pro vlastní diagnostiku collectoru) a konfiguraci dostáváme od volajícího
 	logger.Info("Startuji Log Collector", "config", cfg)
 
 	// 3. Příprava adresáře pro logy
 	// Používáme cestu z konfigurace (cfg.LogDir).
 	// MkdirAll vytvoří celou cestu, pokud neexistuje (např. /var/log/iot-app).
 	if err := os.MkdirAll(cfg.LogDir, 0755); err != nil {
-		logger.Error("Kritická chyba: Nelze vytvořit adresář pro logy", "dir", cfg.LogDir, "error", err)
-		os.Exit(1)
+		return fmt.Errorf("nelze vytvořit adresář pro logy %s: %w", cfg.LogDir, err)
 	}
 
 	// 4. MQTT Handler (Logika zpracování zprávy)
@@ -57,31 +55,46 @@ func main() {
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(cfg.MQTTBroker)     // Z konfigu
 	opts.SetClientID(cfg.MQTTClientID) // Z konfigu
+	opts.SetCustomOpenConnectionFn(cfg.MQTTConnect)
 	opts.SetDefaultPublishHandler(messageHandler)
 
+	// Presence: Last Will "offline" se musí nastavit před připojením (viz modul presence)
+	pres := presence.New("log-collector", cfg.PresenceTopic, cfg.PresenceInterval, logger)
+	pres.SetWill(opts)
+
 	client := mqtt.NewClient(opts)
 	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		logger.Error("Nelze se připojit k MQTT", "error", token.Error())
-		os.Exit(1)
+		return fmt.Errorf("nelze se připojit k MQTT: %w", token.Error())
 	}
+	// Defery běží pozpátku - "offline" odejde před odpojením
 	defer client.Disconnect(250)
+	defer pres.Offline(client)
+
+	pres.AddCheck("mqtt", presence.MQTTProbe(client))
+	pres.AddCheck("log_dir", func(ctx context.Context) error {
+		// Zápis do adresáře logů je jediná práce collectoru - ověříme, že adresář existuje
+		_, err := os.Stat(cfg.LogDir)
+		return err
+	})
+	if cfg.HTTPPort != "" {
+		go pres.ServeHealth(ctx, cfg.HTTPPort)
+	}
 
 	logger.Info("Připojeno k MQTT brokeru")
 
 	// 6. Subscribe
 	// Posloucháme na topicu definovaném v konfigu (default "logs/#")
 	if token := client.Subscribe(cfg.LogTopic, 0, nil); token.Wait() && token.Error() != nil {
-		logger.Error("Chyba při subscribe", "topic", cfg.LogTopic, "error", token.Error())
-		os.Exit(1)
+		return fmt.Errorf("chyba při subscribe %s: %w", cfg.LogTopic, token.Error())
 	}
 	logger.Info("Log Collector naslouchá", "topic", cfg.LogTopic)
+	go pres.Run(ctx, client)
 
-	// 7. Wait Loop (Graceful Shutdown)
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	// 7. Wait Loop (Graceful Shutdown po zrušení ctx)
+	<-ctx.Done()
 
 	logger.Info("Ukončuji Log Collector...")
+	return nil
 }
 
 // appendLogToFile připojí řádek na konec souboru.
@@ -0,0 +1,279 @@
+// Package presence je sdílený stav služeb a health endpointy. Používají ho všechny služby
+// s MQTT (stejně jako 'storage' je to lokální modul: replace presence => ../presence).
+//
+// --- PRESENCE A HEALTH ---
+//
+// Služba o sobě publikuje RETAINED zprávu na PRESENCE_TOPIC (např. presence/home-api):
+//
+//	{"service":"home-api","status":"online","version":"1a2b3c4","host":"rpi",
+//	 "started_at":"...","updated_at":"...","interval_seconds":30,
+//	 "dependencies":[{"name":"mqtt","status":"ok"},{"name":"postgres","status":"error","error":"..."}]}
+//
+// Při připojení si u brokeru nastaví Last Will se stavem "offline" - když proces spadne nebo
+// ztratí spojení, broker ho odešle (retained) sám. Řádné ukončení pošle "offline" explicitně.
+// Každý PRESENCE_INTERVAL se závislosti znovu ověří a zpráva obnoví - podle updated_at
+// pozná přehled služeb v Home API i zamrzlou službu (viz home-api/services.go).
+//
+// Health endpointy:
+//
+//	/health/live  - proces běží (vždy 200): liveness, při selhání restart
+//	/health/ready - všechny závislosti v pořádku (200), jinak 503: readiness
+//	/health       - totéž co /health/ready (healthcheck v docker-compose)
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Stav služby a závislosti v presence zprávě.
+const (
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+
+	DependencyOK    = "ok"
+	DependencyError = "error"
+)
+
+// probeTimeout: Nejdelší čekání na odpověď jedné závislosti (DB ping apod.).
+const probeTimeout = 2 * time.Second
+
+// DependencyStatus je výsledek ověření jedné závislosti.
+type DependencyStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // ok | error
+	Error  string `json:"error,omitempty"`
+}
+
+// Message je obsah retained zprávy na presence topicu.
+type Message struct {
+	Service         string             `json:"service"`
+	Status          string             `json:"status"` // online | offline
+	Version         string             `json:"version,omitempty"`
+	Host            string             `json:"host,omitempty"`
+	StartedAt       time.Time          `json:"started_at"`
+	UpdatedAt       time.Time          `json:"updated_at"`
+	IntervalSeconds int                `json:"interval_seconds,omitempty"`
+	Dependencies    []DependencyStatus `json:"dependencies,omitempty"`
+}
+
+// dependencyCheck ověří jednu závislost (nil = v pořádku).
+type dependencyCheck struct {
+	name  string
+	probe func(ctx context.Context) error
+}
+
+// Presence publikuje stav služby a obsluhuje health endpointy.
+type Presence struct {
+	service  string
+	topic    string
+	interval time.Duration
+	host     string
+	version  string
+	started  time.Time
+	logger   *slog.Logger
+
+	// mu chrání seznam kontrol - přidávají se až po sestavení závislostí (DB po MQTT).
+	mu     sync.Mutex
+	checks []dependencyCheck
+}
+
+// New - konstruktor. Prázdný topic = presence zprávy se neposílají (health endpointy ano).
+func New(service, topic string, interval time.Duration, logger *slog.Logger) *Presence {
+	host, _ := os.Hostname()
+	return &Presence{
+		service:  service,
+		topic:    topic,
+		interval: interval,
+		host:     host,
+		version:  buildVersion(),
+		started:  time.Now().UTC(),
+		logger:   logger,
+	}
+}
+
+// SetHost přepíše jméno hostitele ve zprávě (výchozí je os.Hostname, v kontejneru ID kontejneru).
+// Volat před Run.
+func (p *Presence) SetHost(host string) {
+	p.host = host
+}
+
+// AddCheck přidá závislost, kterou ověřuje readiness i presence zpráva.
+func (p *Presence) AddCheck(name string, probe func(ctx context.Context) error) {
+	p.mu.Lock()
+	p.checks = append(p.checks, dependencyCheck{name: name, probe: probe})
+	p.mu.Unlock()
+}
+
+// SetWill nastaví Last Will "offline" do MQTT options (volat PŘED mqtt.NewClient).
+func (p *Presence) SetWill(opts *mqtt.ClientOptions) {
+	if p.topic == "" {
+		return
+	}
+	opts.SetBinaryWill(p.topic, p.message(StatusOffline, nil), 1, true)
+}
+
+// Check ověří všechny závislosti. Vrací jejich stav a zda jsou všechny v pořádku.
+func (p *Presence) Check(ctx context.Context) ([]DependencyStatus, bool) {
+	p.mu.Lock()
+	checks := append([]dependencyCheck(nil), p.checks...)
+	p.mu.Unlock()
+
+	deps := make([]DependencyStatus, 0, len(checks))
+	ready := true
+	for _, c := range checks {
+		probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+		err := c.probe(probeCtx)
+		cancel()
+
+		dep := DependencyStatus{Name: c.name, Status: DependencyOK}
+		if err != nil {
+			dep.Status, dep.Error = DependencyError, err.Error()
+			ready = false
+		}
+		deps = append(deps, dep)
+	}
+	return deps, ready
+}
+
+// Run publikuje "online" se stavem závislostí hned a pak každý interval, dokud neskončí ctx.
+// "offline" při řádném ukončení pošle Offline (ještě před odpojením klienta).
+func (p *Presence) Run(ctx context.Context, client mqtt.Client) {
+	if p.topic == "" {
+		return
+	}
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		deps, _ := p.Check(ctx)
+		p.publish(client, p.message(StatusOnline, deps))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Offline pošle retained "offline" (řádné ukončení - Last Will by broker neposlal).
+func (p *Presence) Offline(client mqtt.Client) {
+	if p.topic == "" || !client.IsConnectionOpen() {
+		return
+	}
+	p.publish(client, p.message(StatusOffline, nil))
+}
+
+// RegisterHealth přidá do routeru /health/live, /health/ready a /health.
+func (p *Presence) RegisterHealth(mux *http.ServeMux) {
+	mux.HandleFunc("GET /health/live", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	ready := func(w http.ResponseWriter, r *http.Request) {
+		deps, ok := p.Check(r.Context())
+		msg := p.message(StatusOnline, deps)
+		w.Header().Set("Content-Type", "application/json")
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write(msg)
+	}
+	mux.HandleFunc("GET /health/ready", ready)
+	mux.HandleFunc("GET /health", ready)
+}
+
+// ServeHealth spustí samostatný HTTP server jen s health endpointy a blokuje do zrušení ctx.
+// Služby s vlastním HTTP serverem volají jen RegisterHealth.
+func (p *Presence) ServeHealth(ctx context.Context, port string) {
+	mux := http.NewServeMux()
+	p.RegisterHealth(mux)
+
+	server := &http.Server{Addr: ":" + port, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	p.logger.Info("Health server běží", "port", port)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		p.logger.Error("Health server spadl", "error", err)
+	}
+}
+
+// message sestaví JSON presence zprávy.
+func (p *Presence) message(status string, deps []DependencyStatus) []byte {
+	msg, _ := json.Marshal(Message{
+		Service:         p.service,
+		Status:          status,
+		Version:         p.version,
+		Host:            p.host,
+		StartedAt:       p.started,
+		UpdatedAt:       time.Now().UTC(),
+		IntervalSeconds: int(p.interval.Seconds()),
+		Dependencies:    deps,
+	})
+	return msg
+}
+
+// publish pošle retained zprávu (QoS 1 - poslední stav služby nesmí vypadnout).
+func (p *Presence) publish(client mqtt.Client, payload []byte) {
+	token := client.Publish(p.topic, 1, true, payload)
+	if !token.WaitTimeout(probeTimeout) {
+		p.logger.Warn("Publikace presence nestihla potvrzení", "topic", p.topic)
+		return
+	}
+	if token.Error() != nil {
+		p.logger.Warn("Publikace presence selhala", "topic", p.topic, "error", token.Error())
+	}
+}
+
+// MQTTProbe ověří, že je klient připojený k brokeru (paho se po výpadku připojuje sám).
+func MQTTProbe(client mqtt.Client) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if !client.IsConnectionOpen() {
+			return errors.New("nepřipojeno k MQTT brokeru")
+		}
+		return nil
+	}
+}
+
+// buildVersion vrátí verzi z informací o buildu: revizi gitu (s "-dirty" u neuložených změn),
+// jinak verzi modulu. Build bez gitu (Docker kopíruje jen zdrojáky) = "dev".
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+	var revision, modified string
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value
+		}
+	}
+	if revision != "" {
+		if len(revision) > 7 {
+			revision = revision[:7]
+		}
+		if modified == "true" {
+			revision += "-dirty"
+		}
+		return revision
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// parseActions načte a zkontroluje seznam akcí z JSONB sloupce.
+func parseActions(raw json.RawMessage) ([]ActionSpec, error) {
+	var actions []ActionSpec
+	if err := json.Unmarshal(raw, &actions); err != nil {
+		return nil, err
+	}
+
+	for i, a := range actions {
+		switch a.Type {
+		case "mqtt":
+			if a.Topic == "" {
+				return nil, fmt.Errorf("[%d] mqtt: chybí 'topic'", i)
+			}
+			if a.QoS != nil && *a.QoS > 2 {
+				return nil, fmt.Errorf("[%d] mqtt: neplatné qos %d", i, *a.QoS)
+			}
+		case "webhook":
+			u, err := url.Parse(a.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return nil, fmt.Errorf("[%d] webhook: neplatná 'url' %q", i, a.URL)
+			}
+		default:
+			return nil, fmt.Errorf("[%d] neznámý typ akce '%s'", i, a.Type)
+		}
+	}
+	return actions, nil
+}
+
+// Executor provádí akce spuštěných pravidel a zapisuje log.
+type Executor struct {
+	client mqtt.Client
+	http   *http.Client
+	store  *Store
+	logger *slog.Logger
+}
+
+// NewExecutor - konstruktor
+func NewExecutor(client mqtt.Client, store *Store, cfg Config, logger *slog.Logger) *Executor {
+	return &Executor{
+		client: client,
+		http:   &http.Client{Timeout: cfg.WebhookTimeout},
+		store:  store,
+		logger: logger,
+	}
+}
+
+// Run zpracovává frontu spuštění, dokud se nezavře context.
+// Jediná goroutina = akce se provádějí v pořadí, v jakém pravidla spustila (fire před release).
+func (x *Executor) Run(ctx context.Context, executions <-chan Execution) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ex := <-executions:
+			results := x.execute(ctx, ex)
+
+			logCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			if err := x.store.LogExecution(logCtx, ex, results); err != nil {
+				x.logger.Error("Zápis do logu pravidel selhal", "rule_id", ex.RuleID, "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// execute provede všechny akce spuštění. V dry-run režimu jen zapíše, co by se stalo.
+// Selhání jedné akce nezastaví ostatní (např. nedostupný webhook nesmí zabránit vypnutí relé).
+func (x *Executor) execute(ctx context.Context, ex Execution) []ActionResult {
+	results := make([]ActionResult, 0, len(ex.Actions))
+	for _, a := range ex.Actions {
+		res := ActionResult{Type: a.Type, Target: a.Topic, OK: true}
+		if a.Type == "webhook" {
+			res.Target = a.URL
+		}
+
+		if !ex.DryRun {
+			var err error
+			switch a.Type {
+			case "mqtt":
+				err = x.publish(a, ex)
+			case "webhook":
+				err = x.callWebhook(ctx, a, ex)
+			}
+			if err != nil {
+				res.OK = false
+				res.Error = err.Error()
+				x.logger.Warn("Akce pravidla selhala", "rule_id", ex.RuleID, "type", a.Type, "target", res.Target, "error", err)
+			}
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// publish odešle MQTT zprávu (default QoS 1, aby příkaz došel i při krátkém výpadku).
+func (x *Executor) publish(a ActionSpec, ex Execution) error {
+	qos := byte(1)
+	if a.QoS != nil {
+		qos = *a.QoS
+	}
+
+	token := x.client.Publish(a.Topic, qos, a.Retain, expandPlaceholders(a.Payload, ex))
+	if !token.WaitTimeout(5 * time.Second) {
+		return fmt.Errorf("publikace nebyla potvrzena brokerem")
+	}
+	return token.Error()
+}
+
+// callWebhook zavolá HTTP endpoint. Úspěch = odpověď 2xx.
+func (x *Executor) callWebhook(ctx context.Context, a ActionSpec, ex Execution) error {
+	method := a.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	body := expandPlaceholders(a.Body, ex)
+	if a.Body == "" {
+		body = webhookBody(ex)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, a.URL, bytes.NewReader([]byte(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range a.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := x.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024)) // Dočteme kvůli keep-alive
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook vrátil status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// webhookBody je výchozí tělo webhooku - popis spuštění ve formátu JSON.
+func webhookBody(ex Execution) string {
+	values := make(map[string]float64, len(ex.Values))
+	for id, v := range ex.Values {
+		values[strconv.FormatInt(id, 10)] = v
+	}
+	buf, _ := json.Marshal(map[string]any{
+		"rule_id":   ex.RuleID,
+		"rule_name": ex.RuleName,
+		"phase":     ex.Phase,
+		"time":      ex.Time.UTC().Format(time.RFC3339),
+		"values":    values,
+	})
+	return string(buf)
+}
+
+// expandPlaceholders nahradí ${rule_id}, ${rule_name}, ${phase} a ${time}.
+func expandPlaceholders(s string, ex Execution) string {
+	return strings.NewReplacer(
+		"${rule_id}", strconv.FormatInt(ex.RuleID, 10),
+		"${rule_name}", ex.RuleName,
+		"${phase}", ex.Phase,
+		"${time}", ex.Time.UTC().Format(time.RFC3339),
+	).Replace(s)
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// --- PODMÍNKY PRAVIDEL ---
+// JSON zápis (ConditionSpec) se při načtení pravidla "zkompiluje" do stromu objektů,
+// které implementují rozhraní Condition. Některé podmínky si drží stav (od kdy platí,
+// kdy naposledy přišla zpráva), proto se strom vytváří pro každé pravidlo zvlášť.
+
+// Reading je poslední známá hodnota senzoru.
+type Reading struct {
+	Value float64
+	Time  time.Time
+
+	// NoValue: Poslední zpráva byla nečíselný stav (enum, text, geo). Value pak nic neznamená -
+	// porovnání s číslem na něm neplatí, počítá se jen jako zpráva (no_event bez 'op').
+	NoValue bool
+}
+
+// Condition je jeden uzel stromu podmínek.
+type Condition interface {
+	// Eval vyhodnotí podmínku k okamžiku 'now' nad posledními hodnotami senzorů.
+	Eval(now time.Time, readings map[int64]Reading) bool
+	// Sensors přidá do 'ids' senzory, na kterých podmínka závisí
+	// (engine podle toho ví, která pravidla přepočítat po příchodu zprávy).
+	Sensors(ids map[int64]struct{})
+}
+
+// CompileCondition převede JSON zápis na strom podmínek a zkontroluje jeho platnost.
+// 'start' je okamžik startu služby - podmínka 'no_event' od něj počítá, dokud nepřijde první zpráva.
+func CompileCondition(spec ConditionSpec, loc *time.Location, start time.Time) (Condition, error) {
+	switch spec.Type {
+	case "threshold":
+		cmp, err := newComparison(spec, true)
+		if err != nil {
+			return nil, err
+		}
+		hold, err := parseFor(spec.For)
+		if err != nil {
+			return nil, err
+		}
+		return &thresholdCond{sensorID: spec.SensorID, cmp: cmp, hold: hold}, nil
+
+	case "no_event":
+		cmp, err := newComparison(spec, false)
+		if err != nil {
+			return nil, err
+		}
+		hold, err := parseFor(spec.For)
+		if err != nil {
+			return nil, err
+		}
+		if hold <= 0 {
+			return nil, fmt.Errorf("no_event: chybí 'for'")
+		}
+		return &noEventCond{sensorID: spec.SensorID, cmp: cmp, hold: hold, lastMatch: start}, nil
+
+	case "time":
+		return newTimeCond(spec, loc)
+
+	case "all", "any", "not":
+		if len(spec.Conditions) == 0 {
+			return nil, fmt.Errorf("%s: prázdný seznam 'conditions'", spec.Type)
+		}
+		if spec.Type == "not" && len(spec.Conditions) != 1 {
+			return nil, fmt.Errorf("not: očekávána právě jedna podmínka")
+		}
+		children := make([]Condition, 0, len(spec.Conditions))
+		for i, child := range spec.Conditions {
+			c, err := CompileCondition(child, loc, start)
+			if err != nil {
+				return nil, fmt.Errorf("%s[%d]: %w", spec.Type, i, err)
+			}
+			children = append(children, c)
+		}
+		return &groupCond{kind: spec.Type, children: children}, nil
+
+	default:
+		return nil, fmt.Errorf("neznámý typ podmínky '%s'", spec.Type)
+	}
+}
+
+// parseFor načte volitelnou dobu trvání. Prázdný řetězec = 0 (podmínka platí okamžitě).
+func parseFor(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("neplatná doba 'for': %q", s)
+	}
+	return d, nil
+}
+
+// --- POROVNÁNÍ ---
+
+// comparison je "op value" část podmínky. Nulová hodnota (op == "") vyhoví vždy.
+type comparison struct {
+	op    string
+	value float64
+}
+
+// newComparison ověří operátor. 'required' = porovnání je povinné (threshold),
+// u no_event je volitelné (bez něj se počítá každá zpráva).
+func newComparison(spec ConditionSpec, required bool) (comparison, error) {
+	if spec.SensorID <= 0 {
+		return comparison{}, fmt.Errorf("%s: chybí 'sensor_id'", spec.Type)
+	}
+	if spec.Op == "" && spec.Value == nil && !required {
+		return comparison{}, nil
+	}
+	if spec.Value == nil {
+		return comparison{}, fmt.Errorf("%s: chybí 'value'", spec.Type)
+	}
+	switch spec.Op {
+	case ">", ">=", "<", "<=", "==", "!=":
+		return comparison{op: spec.Op, value: *spec.Value}, nil
+	default:
+		return comparison{}, fmt.Errorf("%s: neznámý operátor '%s'", spec.Type, spec.Op)
+	}
+}
+
+// matchReading: Porovnání pro poslední hodnotu senzoru. Nečíselný stav vyhoví jen
+// podmínce bez operátoru - jinak by např. "value < 1" platilo při každé změně enumu (Value 0).
+func (c comparison) matchReading(r Reading) bool {
+	if r.NoValue {
+		return c.op == ""
+	}
+	return c.match(r.Value)
+}
+
+func (c comparison) match(v float64) bool {
+	switch c.op {
+	case ">":
+		return v > c.value
+	case ">=":
+		return v >= c.value
+	case "<":
+		return v < c.value
+	case "<=":
+		return v <= c.value
+	case "==":
+		return v == c.value
+	case "!=":
+		return v != c.value
+	default:
+		return true // Bez operátoru
+	}
+}
+
+// --- THRESHOLD ---
+// Platí, pokud poslední hodnota senzoru splňuje porovnání (a to nepřetržitě alespoň 'hold').
+
+type thresholdCond struct {
+	sensorID int64
+	cmp      comparison
+	hold     time.Duration
+
+	trueSince time.Time // Od kdy porovnání nepřetržitě platí (nulový čas = neplatí)
+}
+
+func (c *thresholdCond) Eval(now time.Time, readings map[int64]Reading) bool {
+	r, ok := readings[c.sensorID]
+	if !ok || !c.cmp.matchReading(r) {
+		c.trueSince = time.Time{}
+		return false
+	}
+	if c.trueSince.IsZero() {
+		c.trueSince = now
+	}
+	return now.Sub(c.trueSince) >= c.hold
+}
+
+func (c *thresholdCond) Sensors(ids map[int64]struct{}) { ids[c.sensorID] = struct{}{} }
+
+// --- NO_EVENT ---
+// Platí, pokud od senzoru alespoň 'hold' nepřišla žádná (odpovídající) zpráva.
+// Příklad "žádný pohyb 30 minut": sensor_id pohybového čidla, op "==", value 1, for "30m".
+
+type noEventCond struct {
+	sensorID int64
+	cmp      comparison
+	hold     time.Duration
+
+	lastMatch time.Time // Čas poslední odpovídající zprávy (na začátku start služby)
+}
+
+func (c *noEventCond) Eval(now time.Time, readings map[int64]Reading) bool {
+	// Engine volá Eval po každé zprávě senzoru, takže žádnou odpovídající hodnotu nepřeskočíme.
+	if r, ok := readings[c.sensorID]; ok && r.Time.After(c.lastMatch) && c.cmp.matchReading(r) {
+		c.lastMatch = r.Time
+	}
+	return now.Sub(c.lastMatch) >= c.hold
+}
+
+func (c *noEventCond) Sensors(ids map[int64]struct{}) { ids[c.sensorID] = struct{}{} }
+
+// --- TIME ---
+// Platí v časovém okně [from, to) v lokální časové zóně. Okno může přecházet přes půlnoc
+// (22:00-06:00). Volitelně jen ve vybrané dny (u okna přes půlnoc rozhoduje den začátku okna).
+
+type timeCond struct {
+	from, to int // Minuty od půlnoci
+	days     map[time.Weekday]bool
+	loc      *time.Location
+}
+
+func newTimeCond(spec ConditionSpec, loc *time.Location) (*timeCond, error) {
+	from, err := parseClock(spec.From)
+	if err != nil {
+		return nil, fmt.Errorf("time: 'from': %w", err)
+	}
+	to, err := parseClock(spec.To)
+	if err != nil {
+		return nil, fmt.Errorf("time: 'to': %w", err)
+	}
+
+	c := &timeCond{from: from, to: to, loc: loc}
+	if len(spec.Days) > 0 {
+		c.days = make(map[time.Weekday]bool)
+		for _, d := range spec.Days {
+			if d < 1 || d > 7 {
+				return nil, fmt.Errorf("time: neplatný den %d (1 = pondělí ... 7 = neděle)", d)
+			}
+			c.days[time.Weekday(d%7)] = true // ISO 7 (neděle) = Go 0
+		}
+	}
+	return c, nil
+}
+
+// parseClock převede "HH:MM" na minuty od půlnoci.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("očekáván formát HH:MM, ne %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (c *timeCond) Eval(now time.Time, _ map[int64]Reading) bool {
+	local := now.In(c.loc)
+	minute := local.Hour()*60 + local.Minute()
+	day := local.Weekday()
+
+	var inWindow bool
+	switch {
+	case c.from == c.to:
+		inWindow = true // Celý den
+	case c.from < c.to:
+		inWindow = minute >= c.from && minute < c.to
+	default: // Přes půlnoc
+		if minute >= c.from {
+			inWindow = true
+		} else if minute < c.to {
+			inWindow = true
+			day = (day + 6) % 7 // Okno začalo včera
+		}
+	}
+
+	if !inWindow {
+		return false
+	}
+	return c.days == nil || c.days[day]
+}
+
+func (c *timeCond) Sensors(map[int64]struct{}) {}
+
+// --- ALL / ANY / NOT ---
+
+type groupCond struct {
+	kind     string
+	children []Condition
+}
+
+func (c *groupCond) Eval(now time.Time, readings map[int64]Reading) bool {
+	// Vyhodnocujeme VŠECHNY potomky (žádné zkrácené vyhodnocení), protože si drží stav
+	// - např. threshold s 'for' musí vědět, že mezitím přestal platit.
+	results := make([]bool, len(c.children))
+	for i, child := range c.children {
+		results[i] = child.Eval(now, readings)
+	}
+
+	switch c.kind {
+	case "all":
+		for _, r := range results {
+			if !r {
+				return false
+			}
+		}
+		return true
+	case "any":
+		for _, r := range results {
+			if r {
+				return true
+			}
+		}
+		return false
+	default: // not
+		return !results[0]
+	}
+}
+
+func (c *groupCond) Sensors(ids map[int64]struct{}) {
+	for _, child := range c.children {
+		child.Sensors(ids)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Rule je zkompilované pravidlo včetně běhového stavu.
+//
+// Životní cyklus pravidla:
+//  1. Neaktivní: čeká, až začnou platit Conditions.
+//  2. Podmínky musí platit nepřetržitě alespoň 'debounce' (ochrana proti zákmitům).
+//  3. Od posledního spuštění musí uplynout 'cooldown' (ochrana proti cvakání relé).
+//  4. Spuštění (fáze 'fire') -> provedou se Actions, pravidlo je aktivní.
+//  5. Aktivní pravidlo se uvolní (fáze 'release'), když platí ReleaseConditions
+//     (hystereze, např. "vypnout až pod 60 %"), nebo - pokud nejsou zadané - když přestanou platit Conditions.
+type Rule struct {
+	ID        int64
+	Name      string
+	DryRun    bool
+	UpdatedAt time.Time
+
+	conditions     Condition
+	release        Condition // nil = uvolnění při !conditions
+	actions        []ActionSpec
+	releaseActions []ActionSpec
+	debounce       time.Duration
+	cooldown       time.Duration
+	sensors        map[int64]struct{}
+
+	// Běhový stav
+	active       bool
+	pendingSince time.Time // Od kdy platí podmínky (běží debounce)
+	lastFired    time.Time
+}
+
+// CompileRule převede řádek z DB na pravidlo. Chyba = pravidlo je neplatné a nebude běžet.
+func CompileRule(row RuleRow, loc *time.Location, start time.Time) (*Rule, error) {
+	r := &Rule{
+		ID:        row.ID,
+		Name:      row.Name,
+		DryRun:    row.DryRun,
+		UpdatedAt: row.UpdatedAt,
+		debounce:  time.Duration(row.DebounceSeconds) * time.Second,
+		cooldown:  time.Duration(row.CooldownSeconds) * time.Second,
+		sensors:   make(map[int64]struct{}),
+	}
+
+	var spec ConditionSpec
+	if err := json.Unmarshal(row.Conditions, &spec); err != nil {
+		return nil, fmt.Errorf("conditions: %w", err)
+	}
+	cond, err := CompileCondition(spec, loc, start)
+	if err != nil {
+		return nil, fmt.Errorf("conditions: %w", err)
+	}
+	r.conditions = cond
+	cond.Sensors(r.sensors)
+
+	if len(row.ReleaseConditions) > 0 {
+		var relSpec ConditionSpec
+		if err := json.Unmarshal(row.ReleaseConditions, &relSpec); err != nil {
+			return nil, fmt.Errorf("release_conditions: %w", err)
+		}
+		rel, err := CompileCondition(relSpec, loc, start)
+		if err != nil {
+			return nil, fmt.Errorf("release_conditions: %w", err)
+		}
+		r.release = rel
+		rel.Sensors(r.sensors)
+	}
+
+	if r.actions, err = parseActions(row.Actions); err != nil {
+		return nil, fmt.Errorf("actions: %w", err)
+	}
+	if len(r.actions) == 0 {
+		return nil, fmt.Errorf("actions: pravidlo nemá žádnou akci")
+	}
+	if len(row.ReleaseActions) > 0 {
+		if r.releaseActions, err = parseActions(row.ReleaseActions); err != nil {
+			return nil, fmt.Errorf("release_actions: %w", err)
+		}
+	}
+
+	return r, nil
+}
+
+// evaluate posune stavový automat pravidla. Vrací fázi, pokud se má něco provést ("" = nic).
+func (r *Rule) evaluate(now time.Time, readings map[int64]Reading) string {
+	// Podmínky vyhodnocujeme vždy (i v aktivním stavu), aby stavové podmínky měly aktuální stav.
+	cond := r.conditions.Eval(now, readings)
+
+	if !r.active {
+		if !cond {
+			r.pendingSince = time.Time{}
+			return ""
+		}
+		if r.pendingSince.IsZero() {
+			r.pendingSince = now
+		}
+		if now.Sub(r.pendingSince) < r.debounce {
+			return "" // Debounce: podmínky ještě neplatí dost dlouho
+		}
+		if !r.lastFired.IsZero() && now.Sub(r.lastFired) < r.cooldown {
+			return "" // Cooldown: spustíme, až vyprší (pokud podmínky pořád platí)
+		}
+		r.active = true
+		r.lastFired = now
+		return PhaseFire
+	}
+
+	released := !cond
+	if r.release != nil {
+		released = r.release.Eval(now, readings)
+	}
+	if !released {
+		return ""
+	}
+	r.active = false
+	r.pendingSince = time.Time{}
+	return PhaseRelease
+}
+
+// Engine drží pravidla, poslední hodnoty senzorů a rozhoduje o spuštění.
+// Samotné akce provádí samostatná goroutina (viz Run), aby pomalý webhook neblokoval MQTT.
+type Engine struct {
+	cfg    Config
+	logger *slog.Logger
+
+	// mu chrání pravidla i hodnoty - HandleEvent běží v MQTT goroutině, Tick a Reload v hlavní smyčce.
+	mu       sync.Mutex
+	rules    map[int64]*Rule
+	readings map[int64]Reading
+
+	executions chan Execution
+}
+
+// NewEngine - konstruktor
+func NewEngine(cfg Config, logger *slog.Logger) *Engine {
+	return &Engine{
+		cfg:        cfg,
+		logger:     logger,
+		rules:      make(map[int64]*Rule),
+		readings:   make(map[int64]Reading),
+		executions: make(chan Execution, 256),
+	}
+}
+
+// Executions vrací frontu spuštění pro vykonavatele akcí.
+func (e *Engine) Executions() <-chan Execution { return e.executions }
+
+// Seed nastaví počáteční hodnoty senzorů (poslední hodnoty z DB), aby pravidla
+// po restartu nečekala na první zprávu od každého senzoru.
+func (e *Engine) Seed(readings map[int64]Reading) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for id, r := range readings {
+		e.readings[id] = r
+	}
+}
+
+// SetRules nahradí sadu pravidel. Pravidla, která se v DB nezměnila (stejné updated_at),
+// si ponechají běhový stav - reload tedy nezpůsobí opakované spuštění aktivních pravidel.
+func (e *Engine) SetRules(rules []*Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	next := make(map[int64]*Rule, len(rules))
+	for _, r := range rules {
+		if old, ok := e.rules[r.ID]; ok && old.UpdatedAt.Equal(r.UpdatedAt) {
+			next[r.ID] = old
+			continue
+		}
+		next[r.ID] = r
+	}
+	e.rules = next
+}
+
+// HandleEvent je MQTT callback pro normalizované hodnoty.
+func (e *Engine) HandleEvent(_ mqtt.Client, msg mqtt.Message) {
+	var ev SensorEvent
+	if err := json.Unmarshal(msg.Payload(), &ev); err != nil {
+		e.logger.Warn("Neplatná zpráva události", "error", err)
+		return
+	}
+	if ev.Timestamp.IsZero() {
+		ev.Timestamp = time.Now()
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.readings[ev.SensorID] = Reading{Value: ev.Value, Time: ev.Timestamp, NoValue: !ev.numeric()}
+
+	// Přepočítáme jen pravidla, která na senzoru závisí. Ostatní obslouží Tick.
+	now := time.Now()
+	for _, r := range e.sortedRules() {
+		if _, ok := r.sensors[ev.SensorID]; ok {
+			e.step(r, now)
+		}
+	}
+}
+
+// Tick vyhodnotí všechna pravidla - kvůli časovým podmínkám (for, no_event, time).
+func (e *Engine) Tick(now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, r := range e.sortedRules() {
+		e.step(r, now)
+	}
+}
+
+// sortedRules vrací pravidla podle ID, aby pořadí spuštění bylo předvídatelné. Volat pod zámkem.
+func (e *Engine) sortedRules() []*Rule {
+	list := make([]*Rule, 0, len(e.rules))
+	for _, r := range e.rules {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// step vyhodnotí jedno pravidlo a případné spuštění zařadí do fronty. Volat pod zámkem.
+func (e *Engine) step(r *Rule, now time.Time) {
+	phase := r.evaluate(now, e.readings)
+	if phase == "" {
+		return
+	}
+
+	actions := r.actions
+	if phase == PhaseRelease {
+		actions = r.releaseActions
+	}
+
+	values := make(map[int64]float64, len(r.sensors))
+	for id := range r.sensors {
+		if reading, ok := e.readings[id]; ok && !reading.NoValue {
+			values[id] = reading.Value
+		}
+	}
+
+	ex := Execution{
+		RuleID:   r.ID,
+		RuleName: r.Name,
+		Phase:    phase,
+		DryRun:   r.DryRun || e.cfg.DryRun,
+		Time:     now,
+		Actions:  actions,
+		Values:   values,
+	}
+
+	// Fronta nesmí zablokovat MQTT handler. Při zahlcení spuštění zahodíme (a zalogujeme).
+	select {
+	case e.executions <- ex:
+		e.logger.Info("Pravidlo spuštěno", "rule_id", r.ID, "rule", r.Name, "phase", phase, "dry_run", ex.DryRun)
+	default:
+		e.logger.Error("Fronta akcí je plná, spuštění zahozeno", "rule_id", r.ID, "phase", phase)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"presence"
+)
+
+func main() {
+	// 1. Setup Logger
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	slog.SetDefault(logger)
+
+	cfg := LoadConfig()
+	logger.Info("Startuji Rules Engine", "config", cfg)
+	if cfg.DryRun {
+		logger.Warn("DRY_RUN je zapnutý: pravidla se vyhodnocují, ale žádná akce se neprovede")
+	}
+
+	// 2. Připojení k DB (pravidla + log spuštění)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dbPool, err := pgxpool.New(ctx, cfg.PostgresURL)
+	if err != nil {
+		logger.Error("Kritická chyba: Nelze se připojit k DB", "error", err)
+		os.Exit(1)
+	}
+	defer dbPool.Close()
+
+	store := NewStore(dbPool)
+	engine := NewEngine(cfg, logger)
+	start := time.Now()
+
+	// reload načte pravidla z DB a zkompiluje je. Neplatné pravidlo se přeskočí (ostatní běží dál).
+	reload := func() {
+		loadCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		rows, err := store.LoadRules(loadCtx)
+		if err != nil {
+			logger.Error("Načtení pravidel selhalo", "error", err)
+			return
+		}
+
+		rules := make([]*Rule, 0, len(rows))
+		for _, row := range rows {
+			rule, err := CompileRule(row, cfg.Location, start)
+			if err != nil {
+				logger.Error("Neplatné pravidlo, přeskakuji", "rule_id", row.ID, "rule", row.Name, "error", err)
+				continue
+			}
+			rules = append(rules, rule)
+		}
+		engine.SetRules(rules)
+		logger.Debug("Pravidla načtena", "count", len(rules))
+	}
+
+	// 3. Počáteční stav: poslední hodnoty senzorů + pravidla
+	seedCtx, seedCancel := context.WithTimeout(ctx, 10*time.Second)
+	if readings, err := store.LoadLastReadings(seedCtx); err != nil {
+		logger.Error("Načtení posledních hodnot selhalo, začínám bez nich", "error", err)
+	} else {
+		engine.Seed(readings)
+	}
+	seedCancel()
+	reload()
+
+	// 4. MQTT Klient
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(cfg.MQTTBroker)
+	opts.SetClientID(cfg.MQTTClientID)
+	opts.SetAutoReconnect(true)
+
+	// Presence: Last Will "offline" se musí nastavit před připojením (viz modul presence)
+	pres := presence.New("rules-engine", cfg.PresenceTopic, cfg.PresenceInterval, logger)
+	pres.SetWill(opts)
+
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		logger.Error("MQTT connection failed", "error", token.Error())
+		os.Exit(1)
+	}
+	// Defery běží pozpátku - "offline" odejde před odpojením
+	defer client.Disconnect(250)
+	defer pres.Offline(client)
+
+	// Závislosti: broker a DB. Health a presence běží do zrušení ctx.
+	pres.AddCheck("mqtt", presence.MQTTProbe(client))
+	pres.AddCheck("postgres", dbPool.Ping)
+	if cfg.HTTPPort != "" {
+		go pres.ServeHealth(ctx, cfg.HTTPPort)
+	}
+	go pres.Run(ctx, client)
+
+	// 5. Vykonavatel akcí běží ve vlastní goroutině
+	executor := NewExecutor(client, store, cfg, logger)
+	go executor.Run(ctx, engine.Executions())
+
+	// 6. Subscribe na normalizované hodnoty (výstup Ingestoru)
+	if token := client.Subscribe(cfg.EventsTopic, 0, engine.HandleEvent); token.Wait() && token.Error() != nil {
+		logger.Error("Subscribe failed", "topic", cfg.EventsTopic, "error", token.Error())
+		os.Exit(1)
+	}
+	logger.Info("Poslouchám na topicu", "topic", cfg.EventsTopic)
+
+	// 7. Hlavní smyčka: časové vyhodnocení + periodický reload pravidel
+	tick := time.NewTicker(cfg.TickInterval)
+	defer tick.Stop()
+	reloadTick := time.NewTicker(cfg.ReloadInterval)
+	defer reloadTick.Stop()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	for {
+		select {
+		case <-sigChan:
+			logger.Info("Vypínám službu...")
+			return
+		case now := <-tick.C:
+			engine.Tick(now)
+		case <-reloadTick.C:
+			reload()
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Store zapouzdřuje práci s DB (pravidla, log spuštění, počáteční hodnoty senzorů).
+type Store struct {
+	db *pgxpool.Pool
+}
+
+// NewStore - konstruktor
+func NewStore(db *pgxpool.Pool) *Store {
+	return &Store{db: db}
+}
+
+// LoadRules načte všechna zapnutá pravidla.
+func (s *Store) LoadRules(ctx context.Context) ([]RuleRow, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, name, dry_run, conditions, release_conditions, actions, release_actions,
+		       debounce_seconds, cooldown_seconds, updated_at
+		FROM automation_rules
+		WHERE enabled = true
+		ORDER BY id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("SQL query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var result []RuleRow
+	for rows.Next() {
+		var r RuleRow
+		if err := rows.Scan(&r.ID, &r.Name, &r.DryRun, &r.Conditions, &r.ReleaseConditions, &r.Actions,
+			&r.ReleaseActions, &r.DebounceSeconds, &r.CooldownSeconds, &r.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// LoadLastReadings vrátí poslední hodnotu každého senzoru za posledních 24 hodin.
+// Omezení časem drží dotaz jen v nejnovějších chuncích hypertabulky.
+func (s *Store) LoadLastReadings(ctx context.Context) (map[int64]Reading, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT DISTINCT ON (sensor_id) sensor_id, value, time
+		FROM sensor_data
+		WHERE time > NOW() - INTERVAL '24 hours'
+		ORDER BY sensor_id, time DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("SQL query failed: %w", err)
+	}
+	defer rows.Close()
+
+	readings := make(map[int64]Reading)
+	for rows.Next() {
+		var id int64
+		var r Reading
+		if err := rows.Scan(&id, &r.Value, &r.Time); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		readings[id] = r
+	}
+	return readings, rows.Err()
+}
+
+// LogExecution zapíše jedno spuštění pravidla do 'rule_executions'.
+func (s *Store) LogExecution(ctx context.Context, ex Execution, results []ActionResult) error {
+	success := true
+	for _, r := range results {
+		success = success && r.OK
+	}
+
+	values, err := json.Marshal(ex.Values)
+	if err != nil {
+		return err
+	}
+	actions, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(ctx, `
+		INSERT INTO rule_executions (rule_id, executed_at, phase, dry_run, success, sensor_values, action_results)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		ex.RuleID, ex.Time, ex.Phase, ex.DryRun, success, values, actions)
+	return err
+}
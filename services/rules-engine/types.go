@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SensorEvent je normalizovaná zpráva z Ingestoru (topic events/data).
+// Musí odpovídat JSONu, který generuje služba 'sensor-ingestor'.
+type SensorEvent struct {
+	SensorID  int64       `json:"sensor_id"`
+	Value     float64     `json:"value"` // U nečíselného senzoru: boolean = 1/0, ostatní 0 (viz State)
+	State     *EventState `json:"state,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// EventState je hodnota nečíselného senzoru (odpovídá storage.State v ingestoru).
+// Pravidlům stačí druh - text ani polohu s číslem porovnat nejde.
+type EventState struct {
+	Kind string `json:"kind"` // boolean | enum | text | geo
+}
+
+// numeric: Událost nese číselnou hodnotu. Dvoustavový senzor (boolean) posílá ve Value 1/0
+// a pravidla s ním pracují stejně jako se 'switch'.
+func (ev SensorEvent) numeric() bool {
+	return ev.State == nil || ev.State.Kind == "boolean"
+}
+
+// RuleRow je jeden řádek tabulky 'automation_rules' tak, jak leží v DB.
+// Podmínky a akce jsou JSONB - parsují se až při kompilaci pravidla (viz CompileRule).
+type RuleRow struct {
+	ID                int64
+	Name              string
+	DryRun            bool
+	Conditions        json.RawMessage
+	ReleaseConditions json.RawMessage // NULL = pravidlo se uvolní, jakmile přestanou platit Conditions
+	Actions           json.RawMessage
+	ReleaseActions    json.RawMessage // NULL = při uvolnění se nic nedělá
+	DebounceSeconds   int
+	CooldownSeconds   int
+	UpdatedAt         time.Time
+}
+
+// ConditionSpec je JSON zápis podmínky. Které položky se použijí, určuje 'type':
+//
+//	{"type": "threshold", "sensor_id": 5, "op": ">", "value": 70, "for": "5m"}
+//	{"type": "no_event",  "sensor_id": 7, "op": "==", "value": 1, "for": "30m"}
+//	{"type": "time",      "from": "22:00", "to": "06:00", "days": [1, 2, 3, 4, 5]}
+//	{"type": "all" | "any", "conditions": [ ... ]}
+//	{"type": "not", "conditions": [ ... ]}
+type ConditionSpec struct {
+	Type       string          `json:"type"`
+	SensorID   int64           `json:"sensor_id,omitempty"`
+	Op         string          `json:"op,omitempty"`
+	Value      *float64        `json:"value,omitempty"`
+	For        string          `json:"for,omitempty"`  // Doba trvání ve formátu Go ("90s", "30m")
+	From       string          `json:"from,omitempty"` // "HH:MM"
+	To         string          `json:"to,omitempty"`   // "HH:MM" (může být přes půlnoc)
+	Days       []int           `json:"days,omitempty"` // ISO dny v týdnu: 1 = pondělí ... 7 = neděle
+	Conditions []ConditionSpec `json:"conditions,omitempty"`
+}
+
+// ActionSpec je JSON zápis akce:
+//
+//	{"type": "mqtt", "topic": "/msh/bathroom/fan/set", "payload": "1", "qos": 1, "retain": false}
+//	{"type": "webhook", "url": "http://...", "method": "POST", "headers": {...}, "body": "..."}
+//
+// V 'payload' a 'body' lze použít zástupné řetězce ${rule_id}, ${rule_name}, ${phase} a ${time}.
+// Prázdné 'body' u webhooku = pošle se JSON s popisem spuštění (viz webhookBody).
+type ActionSpec struct {
+	Type string `json:"type"`
+
+	// MQTT
+	Topic   string `json:"topic,omitempty"`
+	Payload string `json:"payload,omitempty"`
+	QoS     *byte  `json:"qos,omitempty"` // Default 1
+	Retain  bool   `json:"retain,omitempty"`
+
+	// Webhook
+	URL     string            `json:"url,omitempty"`
+	Method  string            `json:"method,omitempty"` // Default POST
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// ActionResult je výsledek jedné akce (ukládá se do logu spuštění).
+type ActionResult struct {
+	Type   string `json:"type"`
+	Target string `json:"target"` // Topic nebo URL
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Fázi spuštění ukládáme do logu: 'fire' = podmínky začaly platit, 'release' = přestaly.
+const (
+	PhaseFire    = "fire"
+	PhaseRelease = "release"
+)
+
+// Execution je jedno spuštění pravidla čekající na provedení akcí a zápis do logu.
+type Execution struct {
+	RuleID   int64
+	RuleName string
+	Phase    string
+	DryRun   bool
+	Time     time.Time
+	Actions  []ActionSpec
+	Values   map[int64]float64 // Hodnoty senzorů pravidla v okamžiku spuštění
+}
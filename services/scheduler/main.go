@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"presence"
+)
+
+func main() {
+	// 1. Setup Logger
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	slog.SetDefault(logger)
+
+	cfg := LoadConfig()
+	logger.Info("Startuji Scheduler", "config", cfg)
+
+	// 2. Připojení k DB
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dbPool, err := pgxpool.New(ctx, cfg.PostgresURL)
+	if err != nil {
+		logger.Error("Kritická chyba: Nelze se připojit k DB", "error", err)
+		os.Exit(1)
+	}
+	defer dbPool.Close()
+
+	// 3. MQTT Klient
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(cfg.MQTTBroker)
+	opts.SetClientID(cfg.MQTTClientID)
+	opts.SetAutoReconnect(true)
+
+	// Presence: Last Will "offline" se musí nastavit před připojením (viz modul presence)
+	pres := presence.New("scheduler", cfg.PresenceTopic, cfg.PresenceInterval, logger)
+	pres.SetWill(opts)
+
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		logger.Error("MQTT connection failed", "error", token.Error())
+		os.Exit(1)
+	}
+	// Defery běží pozpátku - "offline" odejde před odpojením
+	defer client.Disconnect(250)
+	defer pres.Offline(client)
+
+	// Závislosti: broker a DB. Health a presence běží do zrušení ctx.
+	pres.AddCheck("mqtt", presence.MQTTProbe(client))
+	pres.AddCheck("postgres", dbPool.Ping)
+	if cfg.HTTPPort != "" {
+		go pres.ServeHealth(ctx, cfg.HTTPPort)
+	}
+	go pres.Run(ctx, client)
+
+	store := NewStore(dbPool)
+	scheduler := NewScheduler(client, store, cfg, logger)
+
+	// reload načte rozvrhy z DB. Neplatný rozvrh se přeskočí (ostatní běží dál).
+	reload := func() {
+		loadCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		rows, err := store.LoadSchedules(loadCtx)
+		if err != nil {
+			logger.Error("Načtení rozvrhů selhalo", "error", err)
+			return
+		}
+
+		list := make([]*Schedule, 0, len(rows))
+		for _, row := range rows {
+			sch, err := CompileSchedule(row, cfg)
+			if err != nil {
+				logger.Error("Neplatný rozvrh, přeskakuji", "schedule_id", row.ID, "schedule", row.Name, "error", err)
+				continue
+			}
+			list = append(list, sch)
+		}
+		scheduler.SetSchedules(list)
+		logger.Debug("Rozvrhy načteny", "count", len(list))
+	}
+
+	// 4. Start: načtení rozvrhů a hned první Tick - ten po výpadku vyřídí zmeškané běhy.
+	reload()
+	scheduler.Tick(ctx, time.Now())
+
+	// 5. Hlavní smyčka. Tikáme každou sekundu, rozvrhy mají minutovou přesnost.
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	reloadTick := time.NewTicker(cfg.ReloadInterval)
+	defer reloadTick.Stop()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	for {
+		select {
+		case <-sigChan:
+			logger.Info("Vypínám službu...")
+			return
+		case now := <-tick.C:
+			scheduler.Tick(ctx, now)
+		case <-reloadTick.C:
+			reload()
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Timing počítá časy běhů rozvrhu.
+type Timing interface {
+	// Next vrací první běh PO okamžiku 'after' (nulový čas = žádný další běh).
+	Next(after time.Time) time.Time
+}
+
+// cronParser přijímá standardních 5 polí a zkratky typu @daily. Sekundy nepodporujeme záměrně
+// - scheduler tiká po sekundách, ale zařízením minutová přesnost stačí.
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// starBit je bit, kterým robfig/cron označuje pole zadané jako "*" (viz dayMatches).
+const starBit = 1 << 63
+
+// searchDays omezuje hledání dalšího běhu (např. "30. února" nenastane nikdy).
+const searchDays = 366 * 5
+
+// --- CRON ---
+// Z knihovny robfig/cron používáme jen parser. Samotný výpočet dalšího běhu děláme sami
+// nad "nástěnnými hodinami" v časové zóně rozvrhu, protože knihovna při přechodu na letní čas
+// běh v přeskočené hodině vynechá a při návratu na zimní čas ho spustí dvakrát.
+//
+// Pravidla pro přechody času:
+//   - Každý čas na hodinách (den + hodina + minuta) proběhne NEJVÝŠE JEDNOU. Při návratu
+//     na zimní čas (02:00-03:00 dvakrát) se běh provede při prvním průchodu.
+//   - Běh v přeskočené hodině (jaro, 02:00-03:00) se provede v okamžiku přechodu (03:00 letního času).
+
+type cronTiming struct {
+	spec *cron.SpecSchedule
+	loc  *time.Location
+}
+
+func newCronTiming(expr string, loc *time.Location) (*cronTiming, error) {
+	sched, err := cronParser.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("neplatný cron výraz %q: %w", expr, err)
+	}
+	spec, ok := sched.(*cron.SpecSchedule)
+	if !ok {
+		return nil, fmt.Errorf("nepodporovaný cron výraz %q (@every není povolen)", expr)
+	}
+	return &cronTiming{spec: spec, loc: loc}, nil
+}
+
+func (c *cronTiming) Next(after time.Time) time.Time {
+	local := after.In(c.loc)
+	y, m, d := local.Date()
+
+	for off := 0; off < searchDays; off++ {
+		// time.Date normalizuje přetečení dne (31. + 1 = 1. dalšího měsíce)
+		day := time.Date(y, m, d+off, 12, 0, 0, 0, c.loc)
+		if !c.dayMatches(day) {
+			continue
+		}
+		for h := 0; h < 24; h++ {
+			if c.spec.Hour&(1<<uint(h)) == 0 {
+				continue
+			}
+			for min := 0; min < 60; min++ {
+				if c.spec.Minute&(1<<uint(min)) == 0 {
+					continue
+				}
+				if t := wallTime(day.Year(), day.Month(), day.Day(), h, min, c.loc); t.After(after) {
+					return t
+				}
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches odpovídá sémantice cronu: pokud jsou omezené den v měsíci I den v týdnu,
+// stačí shoda jednoho z nich (OR). Jinak se musí shodovat obě pole.
+func (c *cronTiming) dayMatches(t time.Time) bool {
+	if c.spec.Month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	domMatch := c.spec.Dom&(1<<uint(t.Day())) > 0
+	dowMatch := c.spec.Dow&(1<<uint(t.Weekday())) > 0
+	if c.spec.Dom&starBit > 0 || c.spec.Dow&starBit > 0 {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// wallTime převede čas na hodinách v zóně 'loc' na okamžik podle pravidel výše.
+func wallTime(y int, m time.Month, d, h, min int, loc *time.Location) time.Time {
+	t := time.Date(y, m, d, h, min, 0, 0, loc)
+
+	// Přeskočený čas (jaro): Go ho posune za přechod -> použijeme okamžik přechodu.
+	if t.Hour() != h || t.Minute() != min {
+		start, _ := t.ZoneBounds()
+		return start
+	}
+
+	// Dvojznačný čas (podzim): Go vrací DRUHÝ výskyt, my chceme první.
+	if earlier := t.Add(-time.Hour); earlier.Hour() == h && earlier.Minute() == min && earlier.Day() == d {
+		return earlier
+	}
+	return t
+}
+
+// --- VÝCHOD / ZÁPAD SLUNCE ---
+
+type sunTiming struct {
+	event    string // sunrise | sunset
+	offset   time.Duration
+	days     map[time.Weekday]bool // nil = každý den
+	lat, lon float64
+	loc      *time.Location
+}
+
+func newSunTiming(event string, offsetMinutes int, days []int32, lat, lon float64, loc *time.Location) (*sunTiming, error) {
+	if event != "sunrise" && event != "sunset" {
+		return nil, fmt.Errorf("neplatná sun_event %q (sunrise|sunset)", event)
+	}
+	if offsetMinutes < -720 || offsetMinutes > 720 {
+		return nil, fmt.Errorf("offset_minutes musí být v rozsahu ±720")
+	}
+
+	s := &sunTiming{event: event, offset: time.Duration(offsetMinutes) * time.Minute, lat: lat, lon: lon, loc: loc}
+	if len(days) > 0 {
+		s.days = make(map[time.Weekday]bool)
+		for _, d := range days {
+			if d < 1 || d > 7 {
+				return nil, fmt.Errorf("neplatný den %d (1 = pondělí ... 7 = neděle)", d)
+			}
+			s.days[time.Weekday(d%7)] = true
+		}
+	}
+	return s, nil
+}
+
+func (s *sunTiming) Next(after time.Time) time.Time {
+	// Začínáme den před 'after': s velkým záporným offsetem může běh padnout i do předchozího dne.
+	local := after.In(s.loc)
+	y, m, d := local.Date()
+
+	for off := -1; off < searchDays; off++ {
+		day := time.Date(y, m, d+off, 12, 0, 0, 0, s.loc)
+		if s.days != nil && !s.days[day.Weekday()] {
+			continue
+		}
+		rise, set, ok := sunTimes(day.Year(), day.Month(), day.Day(), s.lat, s.lon)
+		if !ok {
+			continue // Polární den/noc
+		}
+		t := rise
+		if s.event == "sunset" {
+			t = set
+		}
+		if t = t.Add(s.offset).Truncate(time.Minute); t.After(after) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// --- ROZVRH ---
+
+// Schedule je zkompilovaný rozvrh včetně běhového stavu.
+type Schedule struct {
+	Row     ScheduleRow
+	Timing  Timing
+	Actions []MQTTAction
+
+	lastRun time.Time // Plánovaný čas posledního zpracovaného běhu
+	nextRun time.Time // Cache - výpočet Next může být drahý (roční rozvrhy)
+}
+
+// CompileSchedule ověří řádek z DB a připraví výpočet časů.
+func CompileSchedule(row ScheduleRow, cfg Config) (*Schedule, error) {
+	loc := cfg.Location
+	if row.Timezone != nil && *row.Timezone != "" {
+		l, err := time.LoadLocation(*row.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("neznámá časová zóna %q", *row.Timezone)
+		}
+		loc = l
+	}
+
+	var timing Timing
+	var err error
+	switch row.Kind {
+	case "cron":
+		if row.CronExpr == nil {
+			return nil, fmt.Errorf("kind 'cron' vyžaduje cron_expr")
+		}
+		timing, err = newCronTiming(*row.CronExpr, loc)
+	case "sun":
+		if row.SunEvent == nil {
+			return nil, fmt.Errorf("kind 'sun' vyžaduje sun_event")
+		}
+		timing, err = newSunTiming(*row.SunEvent, row.OffsetMinutes, row.Days, cfg.Latitude, cfg.Longitude, loc)
+	default:
+		err = fmt.Errorf("neznámý kind %q", row.Kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var actions []MQTTAction
+	if err := json.Unmarshal(row.Actions, &actions); err != nil {
+		return nil, fmt.Errorf("actions: %w", err)
+	}
+	if len(actions) == 0 {
+		return nil, fmt.Errorf("rozvrh nemá žádnou akci (ani scénu)")
+	}
+	for i, a := range actions {
+		if a.Topic == "" {
+			return nil, fmt.Errorf("actions[%d]: chybí 'topic'", i)
+		}
+		if a.QoS != nil && *a.QoS > 2 {
+			return nil, fmt.Errorf("actions[%d]: neplatné qos %d", i, *a.QoS)
+		}
+	}
+
+	switch row.CatchUp {
+	case CatchUpSkip, CatchUpRunOnce, CatchUpRunAll:
+	default:
+		return nil, fmt.Errorf("neznámá politika catch_up %q", row.CatchUp)
+	}
+
+	s := &Schedule{Row: row, Timing: timing, Actions: actions, lastRun: row.LastRunAt}
+	s.nextRun = timing.Next(s.lastRun)
+	return s, nil
+}
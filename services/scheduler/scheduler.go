@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// maxCatchUpRuns omezuje politiku 'run_all' (rozvrh "každou minutu" po týdnu výpadku).
+const maxCatchUpRuns = 100
+
+// Scheduler hlídá čas běhů, provádí akce a řeší dohánění zmeškaných běhů.
+// Běží v jediné goroutině (hlavní smyčka), takže nepotřebuje zámky.
+type Scheduler struct {
+	client mqtt.Client
+	store  *Store
+	cfg    Config
+	logger *slog.Logger
+
+	schedules map[int64]*Schedule
+}
+
+// NewScheduler - konstruktor
+func NewScheduler(client mqtt.Client, store *Store, cfg Config, logger *slog.Logger) *Scheduler {
+	return &Scheduler{
+		client:    client,
+		store:     store,
+		cfg:       cfg,
+		logger:    logger,
+		schedules: make(map[int64]*Schedule),
+	}
+}
+
+// SetSchedules nahradí sadu rozvrhů. U známých rozvrhů ponecháme novější z časů
+// posledního běhu (paměť vs. DB) - pokud selhal zápis do DB, nechceme běh opakovat.
+func (s *Scheduler) SetSchedules(list []*Schedule) {
+	next := make(map[int64]*Schedule, len(list))
+	for _, sch := range list {
+		if old, ok := s.schedules[sch.Row.ID]; ok && old.lastRun.After(sch.lastRun) {
+			sch.lastRun = old.lastRun
+			sch.nextRun = sch.Timing.Next(sch.lastRun)
+		}
+		next[sch.Row.ID] = sch
+	}
+	s.schedules = next
+}
+
+// Tick zpracuje všechny rozvrhy, jejichž běh nastal.
+func (s *Scheduler) Tick(ctx context.Context, now time.Time) {
+	for _, sch := range s.schedules {
+		if sch.nextRun.IsZero() || sch.nextRun.After(now) {
+			continue
+		}
+		s.processDue(ctx, sch, now)
+	}
+}
+
+// processDue vyřeší všechny běhy rozvrhu od posledního zpracovaného do 'now'.
+//
+// Běh opožděný nejvýše o Grace je "včasný" a provede se vždy. Starší běhy jsou "zmeškané"
+// (služba neběžela, počítač spal) a řídí se politikou catch_up rozvrhu:
+//   - skip:     zmeškané běhy se zahodí
+//   - run_once: provede se jednou (za nejnovější zmeškaný), pokud zároveň neproběhne včasný běh
+//   - run_all:  provedou se všechny v pořadí (max. maxCatchUpRuns)
+//
+// Zmeškané běhy starší než catch_up_max_age se nedohánějí nikdy (topení ze včerejška nechceme).
+func (s *Scheduler) processDue(ctx context.Context, sch *Schedule, now time.Time) {
+	// 1. Posbíráme všechny běhy v intervalu (lastRun, now]
+	var due []time.Time
+	for t := sch.nextRun; !t.IsZero() && !t.After(now); t = sch.Timing.Next(t) {
+		due = append(due, t)
+		if len(due) > 10000 {
+			break // Pojistka proti nekonečné smyčce
+		}
+	}
+	last := due[len(due)-1]
+
+	// 2. Rozdělení na včasný a zmeškané
+	var onTime time.Time
+	missed := due
+	if now.Sub(last) <= s.cfg.Grace {
+		onTime = last
+		missed = due[:len(due)-1]
+	}
+
+	var fresh []time.Time
+	for _, t := range missed {
+		if now.Sub(t) <= sch.Row.CatchUpMaxAge {
+			fresh = append(fresh, t)
+		}
+	}
+
+	// 3. Politika dohánění
+	var catchUp []time.Time
+	switch sch.Row.CatchUp {
+	case CatchUpRunOnce:
+		if len(fresh) > 0 && onTime.IsZero() {
+			catchUp = fresh[len(fresh)-1:]
+		}
+	case CatchUpRunAll:
+		catchUp = fresh
+		if len(catchUp) > maxCatchUpRuns {
+			catchUp = catchUp[len(catchUp)-maxCatchUpRuns:]
+		}
+	}
+	if skipped := len(missed) - len(catchUp); skipped > 0 {
+		s.logger.Warn("Zmeškané běhy rozvrhu se nedoženou", "schedule_id", sch.Row.ID, "schedule", sch.Row.Name,
+			"skipped", skipped, "policy", sch.Row.CatchUp)
+	}
+
+	// 4. Provedení
+	for _, t := range catchUp {
+		s.run(ctx, sch, t, true)
+	}
+	if !onTime.IsZero() {
+		s.run(ctx, sch, onTime, false)
+	}
+
+	// 5. Posun stavu - i když se nic neprovedlo (skip), běhy jsou vyřízené.
+	sch.lastRun = last
+	sch.nextRun = sch.Timing.Next(last)
+	if err := s.store.SetLastRun(ctx, sch.Row.ID, last); err != nil {
+		s.logger.Error("Uložení posledního běhu selhalo", "schedule_id", sch.Row.ID, "error", err)
+	}
+	s.logger.Debug("Další běh rozvrhu", "schedule_id", sch.Row.ID, "next_run", sch.nextRun)
+}
+
+// run provede akce rozvrhu a výsledek zapíše do 'schedule_runs'.
+func (s *Scheduler) run(ctx context.Context, sch *Schedule, planned time.Time, catchUp bool) {
+	err := PublishActions(s.client, sch.Actions)
+
+	s.logger.Info("Rozvrh spuštěn", "schedule_id", sch.Row.ID, "schedule", sch.Row.Name,
+		"planned_at", planned, "catch_up", catchUp, "error", err)
+
+	if logErr := s.store.LogRun(ctx, sch.Row, planned, catchUp, err); logErr != nil {
+		s.logger.Error("Zápis běhu rozvrhu selhal", "schedule_id", sch.Row.ID, "error", logErr)
+	}
+}
+
+// PublishActions odešle všechny MQTT zprávy (default QoS 1). Selhání jedné zprávy
+// nezastaví ostatní - vrací se první chyba.
+func PublishActions(client mqtt.Client, actions []MQTTAction) error {
+	var firstErr error
+	for _, a := range actions {
+		qos := byte(1)
+		if a.QoS != nil {
+			qos = *a.QoS
+		}
+
+		var err error
+		token := client.Publish(a.Topic, qos, a.Retain, a.Payload)
+		if !token.WaitTimeout(5 * time.Second) {
+			err = fmt.Errorf("publikace na %s nebyla potvrzena brokerem", a.Topic)
+		} else if token.Error() != nil {
+			err = fmt.Errorf("publikace na %s selhala: %w", a.Topic, token.Error())
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Store zapouzdřuje práci s DB (rozvrhy, scény, log běhů).
+type Store struct {
+	db *pgxpool.Pool
+}
+
+// NewStore - konstruktor
+func NewStore(db *pgxpool.Pool) *Store {
+	return &Store{db: db}
+}
+
+// LoadSchedules načte zapnuté rozvrhy. Akce se berou ze scény, pokud ji rozvrh má.
+// Rozvrh, který ještě nikdy neběžel, počítá zmeškané běhy od svého vytvoření.
+func (s *Store) LoadSchedules(ctx context.Context) ([]ScheduleRow, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT s.id, s.name, s.kind, s.cron_expr, s.sun_event, s.offset_minutes, COALESCE(s.days, '{}'),
+		       s.timezone, s.scene_id, sc.name, COALESCE(sc.actions, s.actions, '[]'::jsonb),
+		       s.catch_up, s.catch_up_max_age_seconds, COALESCE(s.last_run_at, s.created_at)
+		FROM schedules s
+		LEFT JOIN scenes sc ON sc.id = s.scene_id
+		WHERE s.enabled = true
+		ORDER BY s.id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("SQL query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var result []ScheduleRow
+	for rows.Next() {
+		var r ScheduleRow
+		var maxAgeSeconds int
+		if err := rows.Scan(&r.ID, &r.Name, &r.Kind, &r.CronExpr, &r.SunEvent, &r.OffsetMinutes, &r.Days,
+			&r.Timezone, &r.SceneID, &r.SceneName, &r.Actions, &r.CatchUp, &maxAgeSeconds, &r.LastRunAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		r.CatchUpMaxAge = time.Duration(maxAgeSeconds) * time.Second
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// SetLastRun uloží plánovaný čas posledního zpracovaného běhu (základ pro dohánění po restartu).
+func (s *Store) SetLastRun(ctx context.Context, scheduleID int64, t time.Time) error {
+	_, err := s.db.Exec(ctx, `UPDATE schedules SET last_run_at = $2 WHERE id = $1`, scheduleID, t)
+	return err
+}
+
+// LogRun zapíše provedený běh do 'schedule_runs'.
+func (s *Store) LogRun(ctx context.Context, row ScheduleRow, planned time.Time, catchUp bool, runErr error) error {
+	var errMsg *string
+	if runErr != nil {
+		msg := runErr.Error()
+		errMsg = &msg
+	}
+
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO schedule_runs (schedule_id, scene_id, planned_at, catch_up, success, error)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		row.ID, row.SceneID, planned, catchUp, runErr == nil, errMsg)
+	return err
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// --- VÝCHOD A ZÁPAD SLUNCE ---
+// Počítáme lokálně (žádné externí API) podle "sunrise equation":
+// https://en.wikipedia.org/wiki/Sunrise_equation
+// Přesnost je kolem jedné minuty, což pro rozsvícení lampy bohatě stačí.
+
+const (
+	julianUnixEpoch = 2440587.5 // Juliánské datum 1970-01-01 00:00 UTC
+	julian2000      = 2451545.0 // Juliánské datum 2000-01-01 12:00 UTC (J2000)
+	degToRad        = math.Pi / 180
+)
+
+// sunTimes vrací východ a západ slunce pro kalendářní den (y, m, d) na dané poloze.
+// ok = false během polárního dne/noci (slunce ten den nevyjde nebo nezapadne).
+func sunTimes(y int, m time.Month, d int, lat, lon float64) (sunrise, sunset time.Time, ok bool) {
+	// 1. Pořadí dne od J2000 (zaokrouhlení nahoru z půlnoci UTC dá právě poledne daného dne)
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	jd := float64(midnight.Unix())/86400 + julianUnixEpoch
+	n := math.Ceil(jd - julian2000 + 0.0008)
+
+	// 2. Střední sluneční čas (zeměpisná délka na východ je kladná)
+	jStar := n - lon/360
+
+	// 3. Střední anomálie, rovnice středu a ekliptikální délka Slunce
+	mAnom := math.Mod(357.5291+0.98560028*jStar, 360)
+	mRad := mAnom * degToRad
+	c := 1.9148*math.Sin(mRad) + 0.0200*math.Sin(2*mRad) + 0.0003*math.Sin(3*mRad)
+	lambda := math.Mod(mAnom+c+180+102.9372, 360) * degToRad
+
+	// 4. Sluneční poledne (tranzit)
+	jTransit := julian2000 + jStar + 0.0053*math.Sin(mRad) - 0.0069*math.Sin(2*lambda)
+
+	// 5. Deklinace a hodinový úhel. -0.833° = refrakce + poloměr slunečního disku.
+	sinDecl := math.Sin(lambda) * math.Sin(23.4397*degToRad)
+	cosDecl := math.Cos(math.Asin(sinDecl))
+	latRad := lat * degToRad
+	cosOmega := (math.Sin(-0.833*degToRad) - math.Sin(latRad)*sinDecl) / (math.Cos(latRad) * cosDecl)
+	if cosOmega < -1 || cosOmega > 1 {
+		return time.Time{}, time.Time{}, false
+	}
+	omega := math.Acos(cosOmega) / degToRad
+
+	return julianToTime(jTransit - omega/360), julianToTime(jTransit + omega/360), true
+}
+
+// julianToTime převede juliánské datum na time.Time (UTC), zaokrouhleno na sekundy.
+func julianToTime(jd float64) time.Time {
+	secs := (jd - julianUnixEpoch) * 86400
+	return time.Unix(int64(math.Round(secs)), 0).UTC()
+}
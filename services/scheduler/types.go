@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ScheduleRow je jeden řádek tabulky 'schedules' tak, jak leží v DB.
+type ScheduleRow struct {
+	ID            int64
+	Name          string
+	Kind          string  // 'cron' nebo 'sun'
+	CronExpr      *string // Pro kind = 'cron' (5 polí: minuta hodina den měsíc den_v_týdnu)
+	SunEvent      *string // Pro kind = 'sun': 'sunrise' nebo 'sunset'
+	OffsetMinutes int     // Posun vůči východu/západu (záporný = před)
+	Days          []int32 // Pro kind = 'sun': ISO dny v týdnu (1 = pondělí), prázdné = každý den
+	Timezone      *string // NULL = výchozí zóna služby (TZ)
+	SceneID       *int64
+	SceneName     *string
+	Actions       json.RawMessage // Akce rozvrhu, pokud nemá scénu
+	CatchUp       string          // 'skip', 'run_once', 'run_all'
+	CatchUpMaxAge time.Duration   // Zmeškané běhy starší než tohle se nedohánějí
+	LastRunAt     time.Time       // Plánovaný čas posledního zpracovaného běhu
+}
+
+// MQTTAction je jedna MQTT zpráva scény nebo rozvrhu.
+// Stejný formát používá home-api při ruční aktivaci scény.
+type MQTTAction struct {
+	Topic   string `json:"topic"`
+	Payload string `json:"payload"`
+	QoS     *byte  `json:"qos,omitempty"` // Default 1
+	Retain  bool   `json:"retain,omitempty"`
+}
+
+// Politiky dohánění zmeškaných běhů (např. po výpadku služby).
+const (
+	CatchUpSkip    = "skip"     // Zmeškané běhy zahodit
+	CatchUpRunOnce = "run_once" // Provést jednou (za nejnovější zmeškaný běh)
+	CatchUpRunAll  = "run_all"  // Provést všechny zmeškané běhy v pořadí
+)
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	ingestor "sensor-ingestor"
+)
+
+// Samostatná binárka Sensor Ingestoru (Docker image).
+// Veškerá logika je v balíčku ingestor - stejný kód běží i v režimu all-in-one.
+func main() {
+	// 1. Logger na stdout (ingestor k němu po připojení přidá kopii do MQTT)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	slog.SetDefault(logger)
+
+	// 2. Context zrušený signálem SIGINT (Ctrl+C) nebo SIGTERM (Docker stop) = graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// 3. Běh služby (blokuje do signálu)
+	if err := ingestor.Run(ctx, ingestor.LoadConfig(), logger); err != nil {
+		// Docker kontejner se restartuje a zkusí to znovu.
+		logger.Error("Kritická chyba", "error", err)
+		os.Exit(1)
+	}
+}
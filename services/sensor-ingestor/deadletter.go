@@ -0,0 +1,210 @@
+package ingestor
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// --- DEAD-LETTER (ODMÍTNUTÉ ZPRÁVY) ---
+// Zpráva, která neprošla validací (není číslo, je mimo min/max), dříve skončila jen jako
+// warning v logu a nebylo vidět, co zařízení doopravdy poslalo. Teď ji:
+//   1. publikujeme na dead-letter topic (původní topic, payload, kód důvodu, čas) - pro
+//      kohokoliv, kdo chce odmítnuté zprávy sledovat živě,
+//   2. uložíme do tabulky 'rejected_messages', kterou držíme na maximálním počtu řádků.
+//
+// Dead-letter topic musí ležet MIMO INPUT_TOPIC i mimo topicy událostí, jinak bychom
+// odmítnuté zprávy zpracovávali znovu (nebo by je persister bral jako data).
+//
+// Po opravě metadat (limity, kalibrace) lze zprávu z dashboardu "znovu odeslat": Home API ji
+// pošle na RESUBMIT_TOPIC a Ingestor ji zpracuje znovu s PŮVODNÍM časem přijetí.
+
+// Kódy důvodů odmítnutí (sloupec 'reason'). Neznámé topicy sem nepatří - ty řeší karanténa.
+const (
+	ReasonInvalidNumber = "invalid_number"
+	ReasonInvalidValue  = "invalid_value" // Nečíselný senzor: neznámý stav, neplatná poloha...
+	ReasonBelowMin      = "below_min"
+	ReasonAboveMax      = "above_max"
+)
+
+// maxPendingRejects chrání paměť, pokud DB delší dobu nepřijímá zápisy.
+const maxPendingRejects = 1000
+
+// RejectError je chyba validace s kódem důvodu. Volající ji rozpozná přes errors.As.
+type RejectError struct {
+	Reason   string
+	SensorID int64
+	Err      error
+}
+
+func (e *RejectError) Error() string { return e.Err.Error() }
+func (e *RejectError) Unwrap() error { return e.Err }
+
+// DeadLetterMessage je zpráva na dead-letter topicu.
+// Payload posíláme jako text - naprostá většina zařízení posílá čitelné hodnoty.
+type DeadLetterMessage struct {
+	Service    string    `json:"service"`
+	Topic      string    `json:"topic"`
+	Payload    string    `json:"payload"`
+	Reason     string    `json:"reason"`
+	Detail     string    `json:"detail"`
+	SensorID   int64     `json:"sensor_id"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// ResubmitMessage posílá Home API na RESUBMIT_TOPIC. Payload je []byte (v JSONu base64),
+// aby se přesně zachoval i binární obsah.
+type ResubmitMessage struct {
+	RejectID   int64     `json:"reject_id"`
+	Topic      string    `json:"topic"`
+	Payload    []byte    `json:"payload"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// rejectedMessage je jeden řádek čekající na zápis do DB.
+type rejectedMessage struct {
+	Topic      string
+	Payload    []byte
+	Reason     string
+	Detail     string
+	SensorID   int64
+	ReceivedAt time.Time
+}
+
+// DeadLetterService publikuje a ukládá odmítnuté zprávy.
+type DeadLetterService struct {
+	client  mqtt.Client
+	db      *pgxpool.Pool // nil = zprávy se jen publikují, do DB se neukládají
+	topic   string
+	maxRows int
+	logger  *slog.Logger
+
+	// mu chrání frontu - Reject volá MQTT handler, Flush jiná goroutina.
+	mu      sync.Mutex
+	pending []rejectedMessage
+}
+
+// NewDeadLetterService - konstruktor
+func NewDeadLetterService(client mqtt.Client, db *pgxpool.Pool, topic string, maxRows int, logger *slog.Logger) *DeadLetterService {
+	return &DeadLetterService{
+		client:  client,
+		db:      db,
+		topic:   topic,
+		maxRows: maxRows,
+		logger:  logger,
+	}
+}
+
+// Reject publikuje odmítnutou zprávu na dead-letter topic a zařadí ji k uložení.
+func (d *DeadLetterService) Reject(topic string, payload []byte, receivedAt time.Time, rej *RejectError) {
+	msg := DeadLetterMessage{
+		Service:    "sensor-ingestor",
+		Topic:      topic,
+		Payload:    string(payload),
+		Reason:     rej.Reason,
+		Detail:     rej.Error(),
+		SensorID:   rej.SensorID,
+		ReceivedAt: receivedAt,
+	}
+	if data, err := json.Marshal(msg); err == nil {
+		// Nečekáme na potvrzení - dead-letter je diagnostika, nesmí brzdit zpracování.
+		d.client.Publish(d.topic, 0, false, data)
+	}
+
+	// Bez DB (vestavěné úložiště) zůstávají odmítnuté zprávy jen na dead-letter topicu.
+	if d.db == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.pending) >= maxPendingRejects {
+		return
+	}
+	d.pending = append(d.pending, rejectedMessage{
+		Topic:      topic,
+		Payload:    append([]byte(nil), payload...),
+		Reason:     rej.Reason,
+		Detail:     rej.Error(),
+		SensorID:   rej.SensorID,
+		ReceivedAt: receivedAt,
+	})
+}
+
+// Flush zapíše odmítnuté zprávy do DB a ořízne tabulku na maxRows nejnovějších řádků.
+func (d *DeadLetterService) Flush(ctx context.Context) error {
+	d.mu.Lock()
+	batch := d.pending
+	d.pending = nil
+	d.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	_, err := d.db.CopyFrom(ctx,
+		pgx.Identifier{"rejected_messages"},
+		[]string{"received_at", "topic", "payload", "sensor_id", "reason", "detail"},
+		pgx.CopyFromSlice(len(batch), func(i int) ([]any, error) {
+			r := batch[i]
+			return []any{r.ReceivedAt, r.Topic, r.Payload, r.SensorID, r.Reason, r.Detail}, nil
+		}),
+	)
+	if err != nil {
+		// COPY je jeden příkaz - při chybě se nezapsalo nic, zprávy zkusíme při dalším flushi
+		d.restore(batch)
+		return err
+	}
+
+	// Omezení velikosti: smažeme vše starší než maxRows-tý nejnovější řádek.
+	tag, err := d.db.Exec(ctx, `
+		DELETE FROM rejected_messages
+		WHERE id <= (SELECT id FROM rejected_messages ORDER BY id DESC OFFSET $1 LIMIT 1)
+	`, d.maxRows)
+	if err != nil {
+		return err
+	}
+
+	d.logger.Info("Odmítnuté zprávy uloženy", "count", len(batch), "pruned", tag.RowsAffected())
+	return nil
+}
+
+// restore vrátí nezapsanou dávku na začátek 'pending' (před zprávy, které mezitím přibyly).
+// Limit maxPendingRejects platí dál - při přetečení zahodíme nejnovější, jako Reject.
+func (d *DeadLetterService) restore(batch []rejectedMessage) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.pending = append(batch, d.pending...)
+	if len(d.pending) > maxPendingRejects {
+		d.pending = d.pending[:maxPendingRejects]
+	}
+}
+
+// StartAutoFlush periodicky zapisuje odmítnuté zprávy do DB.
+func (d *DeadLetterService) StartAutoFlush(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := d.Flush(flushCtx); err != nil {
+				d.logger.Error("Závěrečný flush odmítnutých zpráv selhal", "error", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := d.Flush(ctx); err != nil {
+				d.logger.Error("Flush odmítnutých zpráv selhal", "error", err)
+			}
+		}
+	}
+}
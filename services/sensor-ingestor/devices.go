@@ -0,0 +1,355 @@
+package ingestor
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// --- ZAŘÍZENÍ: DOSTUPNOST A DIAGNOSTIKA ---
+// Senzory patří fyzickým zařízením (tabulka 'devices', viz postgres.sql sekce 21).
+// Ingestor sleduje dva druhy topiců zařízení:
+//
+//   - availability_topic: zařízení publikuje 'online' a jako Last Will nastaví 'offline'
+//     (broker ho odešle, když spojení vypadne) -> sloupce online/status_changed_at,
+//   - diagnostické topicy (device_diagnostics): baterie, RSSI, firmware -> stejnojmenné sloupce.
+//
+// Topicy pod INPUT_TOPIC už odebíráme - zprávu předá handleMessage (Observe); dostupnost
+// Sparkplug zařízení hlásí SparkplugService (BIRTH/DEATH, viz sparkplug.go). Ostatní
+// (např. Tasmota 'tele/.../LWT') si DeviceService odebírá sám. Zápisy do DB se sbírají
+// a zapisují dávkově jako karanténa (DEVICE_FLUSH_INTERVAL) - diagnostika chodí často.
+
+// Pole diagnostiky (device_diagnostics.field) a interní pole dostupnosti.
+const (
+	DiagBattery   = "battery"
+	DiagRSSI      = "rssi"
+	DiagFirmware  = "firmware"
+	diagAvailable = "availability"
+)
+
+// deviceWatch říká, co z topicu plní u kterého zařízení.
+type deviceWatch struct {
+	DeviceID int64
+	Field    string // battery | rssi | firmware | availability
+	JSONPath string // Diagnostika: pole JSONu ("" = celý payload)
+
+	PayloadOnline  string // Dostupnost: payload pro online
+	PayloadOffline string // Dostupnost: payload pro offline
+}
+
+// deviceUpdate jsou nasbírané změny jednoho zařízení do příštího flushe (nil = beze změny).
+type deviceUpdate struct {
+	Online   *bool
+	StatusAt time.Time
+	Battery  *float64
+	RSSI     *float64
+	Firmware *string
+	DiagAt   *time.Time
+}
+
+// DeviceService sleduje topicy zařízení a zapisuje jejich stav do tabulky 'devices'.
+type DeviceService struct {
+	db      *pgxpool.Pool
+	client  mqtt.Client
+	handled []string // Topicy pod těmito filtry dostáváme jinudy (handleMessage, Sparkplug)
+	logger  *slog.Logger
+
+	// mu chrání mapy - Observe běží v MQTT goroutinách, Load a Flush na pozadí.
+	mu         sync.Mutex
+	watches    map[string][]deviceWatch // topic -> co z něj plníme
+	subscribed map[string]bool          // Vlastní odběry (topicy mimo inputTopic)
+	pending    map[int64]*deviceUpdate
+}
+
+// NewDeviceService - konstruktor
+func NewDeviceService(db *pgxpool.Pool, client mqtt.Client, handled []string, logger *slog.Logger) *DeviceService {
+	return &DeviceService{
+		db:         db,
+		client:     client,
+		handled:    handled,
+		logger:     logger,
+		watches:    make(map[string][]deviceWatch),
+		subscribed: make(map[string]bool),
+		pending:    make(map[int64]*deviceUpdate),
+	}
+}
+
+// Load načte z DB topicy zařízení a srovná vlastní odběry (nové přihlásí, zrušené odhlásí).
+func (d *DeviceService) Load(ctx context.Context) error {
+	watches := make(map[string][]deviceWatch)
+
+	// 1. Dostupnost
+	rows, err := d.db.Query(ctx, `
+		SELECT id, availability_topic, payload_online, payload_offline
+		FROM devices
+		WHERE availability_topic IS NOT NULL
+	`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var w deviceWatch
+		var topic string
+		if err := rows.Scan(&w.DeviceID, &topic, &w.PayloadOnline, &w.PayloadOffline); err != nil {
+			rows.Close()
+			return err
+		}
+		w.Field = diagAvailable
+		watches[topic] = append(watches[topic], w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// 2. Diagnostika
+	rows, err = d.db.Query(ctx, `SELECT device_id, field, mqtt_topic, COALESCE(json_path, '') FROM device_diagnostics`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var w deviceWatch
+		var topic string
+		if err := rows.Scan(&w.DeviceID, &w.Field, &topic, &w.JSONPath); err != nil {
+			rows.Close()
+			return err
+		}
+		watches[topic] = append(watches[topic], w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// 3. Výměna mapy a rozdíl odběrů (Subscribe/Unsubscribe až mimo zámek - handler bere stejný zámek)
+	d.mu.Lock()
+	d.watches = watches
+	var subscribe, unsubscribe []string
+	for topic := range watches {
+		if !d.subscribed[topic] && !d.isHandled(topic) {
+			subscribe = append(subscribe, topic)
+		}
+	}
+	for topic := range d.subscribed {
+		if _, ok := watches[topic]; !ok {
+			unsubscribe = append(unsubscribe, topic)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, topic := range subscribe {
+		// QoS 1 - změna dostupnosti nesmí vypadnout; retained stav přijde hned po přihlášení.
+		token := d.client.Subscribe(topic, 1, func(_ mqtt.Client, msg mqtt.Message) {
+			d.Observe(msg.Topic(), msg.Payload())
+		})
+		if token.Wait() && token.Error() != nil {
+			d.logger.Error("Odběr topicu zařízení selhal", "topic", topic, "error", token.Error())
+			continue
+		}
+		d.mu.Lock()
+		d.subscribed[topic] = true
+		d.mu.Unlock()
+	}
+	for _, topic := range unsubscribe {
+		if token := d.client.Unsubscribe(topic); token.Wait() && token.Error() != nil {
+			d.logger.Error("Odhlášení topicu zařízení selhalo", "topic", topic, "error", token.Error())
+			continue
+		}
+		d.mu.Lock()
+		delete(d.subscribed, topic)
+		d.mu.Unlock()
+	}
+	return nil
+}
+
+// Observe zpracuje zprávu z topicu. Vrací true, pokud topic patří některému zařízení
+// (handleMessage pak neznámý topic nedá do karantény).
+func (d *DeviceService) Observe(topic string, payload []byte) bool {
+	now := time.Now().UTC()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	watches, ok := d.watches[topic]
+	if !ok {
+		return false
+	}
+
+	for _, w := range watches {
+		upd := d.pending[w.DeviceID]
+		if upd == nil {
+			upd = &deviceUpdate{}
+			d.pending[w.DeviceID] = upd
+		}
+
+		if w.Field == diagAvailable {
+			s := strings.TrimSpace(string(payload))
+			var online bool
+			switch {
+			case strings.EqualFold(s, w.PayloadOnline):
+				online = true
+			case strings.EqualFold(s, w.PayloadOffline):
+				online = false
+			default:
+				d.logger.Debug("Neznámý payload dostupnosti", "topic", topic, "payload", s)
+				continue
+			}
+			upd.Online = &online
+			upd.StatusAt = now
+			continue
+		}
+
+		raw, ok := diagnosticValue(payload, w.JSONPath)
+		if !ok {
+			d.logger.Debug("Diagnostika zařízení nenalezena v payloadu", "topic", topic, "json_path", w.JSONPath)
+			continue
+		}
+		switch w.Field {
+		case DiagFirmware:
+			upd.Firmware = &raw
+		case DiagBattery, DiagRSSI:
+			v, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				d.logger.Debug("Diagnostika zařízení není číslo", "topic", topic, "field", w.Field, "value", raw)
+				continue
+			}
+			if w.Field == DiagBattery {
+				upd.Battery = &v
+			} else {
+				upd.RSSI = &v
+			}
+		}
+		upd.DiagAt = &now
+	}
+	return true
+}
+
+// Flush zapíše nasbírané změny do DB.
+func (d *DeviceService) Flush(ctx context.Context) error {
+	// Read-Copy-Update jako u karantény
+	d.mu.Lock()
+	batch := d.pending
+	d.pending = make(map[int64]*deviceUpdate)
+	d.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	// SET vidí PŮVODNÍ hodnoty řádku - status_changed_at se posune jen při skutečné změně stavu.
+	query := `
+		UPDATE devices SET
+			status_changed_at = CASE WHEN $2::boolean IS NOT NULL AND online IS DISTINCT FROM $2
+			                         THEN $3 ELSE status_changed_at END,
+			online                 = COALESCE($2, online),
+			battery_voltage        = COALESCE($4, battery_voltage),
+			rssi                   = COALESCE($5, rssi),
+			firmware               = COALESCE($6, firmware),
+			diagnostics_updated_at = COALESCE($7, diagnostics_updated_at)
+		WHERE id = $1
+	`
+	for id, u := range batch {
+		if _, err := d.db.Exec(ctx, query, id, u.Online, u.StatusAt, u.Battery, u.RSSI, u.Firmware, u.DiagAt); err != nil {
+			return err
+		}
+		if u.Online != nil {
+			d.logger.Debug("Stav zařízení zapsán", "device_id", id, "online", *u.Online)
+		}
+	}
+	return nil
+}
+
+// StartAutoFlush periodicky zapisuje stav zařízení a obnovuje seznam jejich topiců.
+func (d *DeviceService) StartAutoFlush(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Poslední flush - typicky zachytí i 'offline' ze shutdownu zařízení
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := d.Flush(flushCtx); err != nil {
+				d.logger.Error("Závěrečný zápis stavu zařízení selhal", "error", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := d.Flush(ctx); err != nil {
+				d.logger.Error("Zápis stavu zařízení selhal", "error", err)
+			}
+			if err := d.Load(ctx); err != nil {
+				d.logger.Error("Načtení topiců zařízení selhalo", "error", err)
+			}
+		}
+	}
+}
+
+// isHandled ověří, zda zprávy z topicu dostáváme jinudy (vlastní odběr by je zdvojil).
+func (d *DeviceService) isHandled(topic string) bool {
+	for _, filter := range d.handled {
+		if filter != "" && topicMatches(filter, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// diagnosticValue vytáhne hodnotu z payloadu: celý payload, nebo pole JSONu podle cesty
+// "a.b.c". Čísla vrací v textové podobě (firmware "1.2" i verze jako číslo 12).
+func diagnosticValue(payload []byte, path string) (string, bool) {
+	if path == "" {
+		s := strings.TrimSpace(string(payload))
+		return s, s != ""
+	}
+
+	var cur any
+	dec := json.NewDecoder(strings.NewReader(string(payload)))
+	dec.UseNumber() // Číslo necháme v původním zápisu (žádné 1e+06)
+	if err := dec.Decode(&cur); err != nil {
+		return "", false
+	}
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := cur.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		if cur, ok = obj[key]; !ok {
+			return "", false
+		}
+	}
+
+	switch v := cur.(type) {
+	case string:
+		return v, v != ""
+	case json.Number:
+		return v.String(), true
+	default:
+		return "", false // Objekt, pole, bool nebo null diagnostikou není
+	}
+}
+
+// topicMatches ověří, zda topic odpovídá MQTT filtru se zástupnými znaky + a #.
+func topicMatches(filter, topic string) bool {
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+	for i, part := range f {
+		if part == "#" {
+			return true
+		}
+		if i >= len(t) {
+			return false
+		}
+		if part != "+" && part != t[i] {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
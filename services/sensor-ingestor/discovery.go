@@ -0,0 +1,242 @@
+package ingestor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// --- KARANTÉNA NEZNÁMÝCH TOPICŮ ---
+// Zpráva z topicu, který není v tabulce 'sensors', se dříve jen zalogovala a zmizela.
+// Teď si ji zapamatujeme v tabulce 'discovered_topics' (první/poslední výskyt, počet zpráv,
+// ukázka payloadu a odhadnutý typ). Admin ji pak v dashboardu schválí jako senzor, nebo ignoruje.
+//
+// Zprávy nezapisujeme do DB jednotlivě (neznámé zařízení může posílat každou sekundu),
+// ale agregujeme je v paměti a periodicky "flushujeme" jedním upsertem na topic.
+
+const (
+	// maxSampleLen omezuje velikost ukázky payloadu uložené v DB.
+	maxSampleLen = 256
+
+	// maxPendingTopics chrání paměť před zaplavením náhodnými topicy mezi dvěma flushi.
+	maxPendingTopics = 1000
+)
+
+// discoveredSample je agregace zpráv jednoho neznámého topicu od posledního flushe.
+type discoveredSample struct {
+	FirstSeen    time.Time
+	LastSeen     time.Time
+	Count        int64
+	Payload      string
+	InferredType string
+}
+
+// DiscoveryService sbírá zprávy z neznámých topiců.
+type DiscoveryService struct {
+	db     *pgxpool.Pool
+	logger *slog.Logger
+
+	// mu chrání obě mapy - Record volá MQTT handler, flush běží v jiné goroutině.
+	mu      sync.Mutex
+	pending map[string]*discoveredSample
+	ignored map[string]bool // Topicy, které admin trvale ignoroval
+}
+
+// NewDiscoveryService - konstruktor
+func NewDiscoveryService(db *pgxpool.Pool, logger *slog.Logger) *DiscoveryService {
+	return &DiscoveryService{
+		db:      db,
+		logger:  logger,
+		pending: make(map[string]*discoveredSample),
+		ignored: make(map[string]bool),
+	}
+}
+
+// Record zaznamená zprávu z neznámého topicu. Je rychlé (jen práce s mapou).
+// Vrací false, pokud je topic trvale ignorovaný a zprávu máme tiše zahodit.
+func (d *DiscoveryService) Record(topic string, payload []byte) bool {
+	now := time.Now().UTC()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.ignored[topic] {
+		return false
+	}
+
+	sample, ok := d.pending[topic]
+	if !ok {
+		if len(d.pending) >= maxPendingTopics {
+			// Přetečení - nový topic zahodíme, zachytí se při některém z dalších flushů.
+			return true
+		}
+		sample = &discoveredSample{FirstSeen: now}
+		d.pending[topic] = sample
+	}
+
+	sample.LastSeen = now
+	sample.Count++
+	sample.Payload = truncateSample(payload)
+	sample.InferredType = inferPayloadType(payload)
+	return true
+}
+
+// Flush zapíše nasbírané agregace do DB.
+func (d *DiscoveryService) Flush(ctx context.Context) error {
+	// Read-Copy-Update: vyměníme mapu pod zámkem a do DB zapisujeme bez něj.
+	d.mu.Lock()
+	batch := d.pending
+	d.pending = make(map[string]*discoveredSample)
+	d.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	// Upsert: nový topic se založí, u známého se posune last_seen a přičte počet.
+	// first_seen se při konfliktu NEMĚNÍ. Stav (pending/ignored/approved) také ne.
+	query := `
+		INSERT INTO discovered_topics (mqtt_topic, first_seen, last_seen, message_count, sample_payload, inferred_type)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (mqtt_topic) DO UPDATE SET
+			last_seen      = EXCLUDED.last_seen,
+			message_count  = discovered_topics.message_count + EXCLUDED.message_count,
+			sample_payload = EXCLUDED.sample_payload,
+			inferred_type  = EXCLUDED.inferred_type
+	`
+
+	// Celá dávka v jedné transakci - při chybě se nezapíše nic a dávku vrátíme do 'pending'
+	// (jinak by se část topiců zapsala a zbytek ztratil, nebo by se počty přičetly dvakrát).
+	if err := d.writeBatch(ctx, query, batch); err != nil {
+		d.restore(batch)
+		return err
+	}
+
+	d.logger.Info("Neznámé topicy uloženy do karantény", "topics", len(batch))
+	return nil
+}
+
+// writeBatch zapíše dávku upsertů v jedné transakci.
+func (d *DiscoveryService) writeBatch(ctx context.Context, query string, batch map[string]*discoveredSample) error {
+	tx, err := d.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("začátek transakce selhal: %w", err)
+	}
+	defer tx.Rollback(ctx) // Po Commitu je Rollback no-op
+
+	for topic, s := range batch {
+		if _, err := tx.Exec(ctx, query, topic, s.FirstSeen, s.LastSeen, s.Count, s.Payload, s.InferredType); err != nil {
+			return fmt.Errorf("upsert topicu %s selhal: %w", topic, err)
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// restore vrátí nezapsanou dávku do 'pending' a sloučí ji se zprávami, které mezitím
+// přibyly (ty jsou novější - jejich ukázka payloadu má přednost). Při dalším flushi se
+// zapíše znovu.
+func (d *DiscoveryService) restore(batch map[string]*discoveredSample) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for topic, old := range batch {
+		cur, ok := d.pending[topic]
+		if !ok {
+			d.pending[topic] = old
+			continue
+		}
+		cur.FirstSeen = old.FirstSeen
+		cur.Count += old.Count
+	}
+}
+
+// LoadIgnored načte z DB seznam trvale ignorovaných topiců.
+func (d *DiscoveryService) LoadIgnored(ctx context.Context) error {
+	rows, err := d.db.Query(ctx, `SELECT mqtt_topic FROM discovered_topics WHERE status = 'ignored'`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	ignored := make(map[string]bool)
+	for rows.Next() {
+		var topic string
+		if err := rows.Scan(&topic); err != nil {
+			return err
+		}
+		ignored[topic] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.ignored = ignored
+	d.mu.Unlock()
+	return nil
+}
+
+// StartAutoFlush periodicky zapisuje karanténu do DB a obnovuje seznam ignorovaných topiců.
+func (d *DiscoveryService) StartAutoFlush(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Poslední flush, ať o nasbíraná data nepřijdeme (vlastní context, ten hlavní je zrušený).
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := d.Flush(flushCtx); err != nil {
+				d.logger.Error("Závěrečný flush karantény selhal", "error", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := d.Flush(ctx); err != nil {
+				d.logger.Error("Flush karantény selhal", "error", err)
+			}
+			if err := d.LoadIgnored(ctx); err != nil {
+				d.logger.Error("Načtení ignorovaných topiců selhalo", "error", err)
+			}
+		}
+	}
+}
+
+// inferPayloadType odhadne typ hodnoty podle obsahu payloadu.
+// Admin podle něj snáze vybere typ senzoru při schvalování.
+func inferPayloadType(payload []byte) string {
+	s := strings.TrimSpace(string(payload))
+
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return "number"
+	}
+
+	switch strings.ToLower(s) {
+	case "true", "false", "on", "off":
+		return "boolean"
+	}
+
+	if (strings.HasPrefix(s, "{") || strings.HasPrefix(s, "[")) && json.Valid([]byte(s)) {
+		return "json"
+	}
+
+	return "text"
+}
+
+// truncateSample zkrátí payload na maxSampleLen bajtů (bez rozseknutí UTF-8 znaku).
+func truncateSample(payload []byte) string {
+	s := string(payload)
+	if len(s) <= maxSampleLen {
+		return s
+	}
+	s = s[:maxSampleLen]
+	// Odřízneme případný neúplný vícebajtový znak na konci.
+	return strings.ToValidUTF8(s, "")
+}
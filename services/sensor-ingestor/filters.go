@@ -0,0 +1,290 @@
+package ingestor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// --- FILTRY ŠPIČEK A ODLEHLÝCH HODNOT ---
+// Statické min/max z 'sensor_types' nezachytí teploměr, který na jedno měření skočí z 21 na 79 °C
+// (obojí je v rozsahu), a takový bod rozbije měřítko grafu. Filtry porovnávají hodnotu
+// s nedávnou historií senzoru, kterou držíme v paměti:
+//
+//   - rate:   maximální rychlost změny (jednotek za minutu) vůči poslední přijaté hodnotě
+//   - median: max. odchylka od mediánu posledních N přijatých hodnot (klasický "despiking")
+//   - zscore: max. počet směrodatných odchylek od průměru klouzavého okna
+//
+// Podezřelou hodnotu filtr podle nastavení senzoru buď zahodí ('drop'), nebo jen označí ('flag')
+// a hodnota projde dál. Každé rozhodnutí se zapíše do tabulky 'filter_decisions' pro pozdější audit.
+
+// ErrFiltered značí zprávu zahozenou filtrem (není to chyba zařízení ani konfigurace).
+var ErrFiltered = errors.New("hodnota zahozena filtrem")
+
+const (
+	// maxConsecutiveRejects: Po tolika odmítnutích za sebou bereme změnu jako skutečnou
+	// (senzor přemístěn, zapnuté topení) a historii resetujeme. Jinak by filtr novou úroveň
+	// odmítal navždy, protože odmítnuté hodnoty se do historie nedostanou.
+	maxConsecutiveRejects = 5
+
+	// maxPendingDecisions chrání paměť, pokud DB delší dobu nepřijímá zápisy.
+	maxPendingDecisions = 10000
+)
+
+// FilterConfig je nastavení filtrů jednoho senzoru (tabulka 'sensor_filters').
+// nil u jednotlivého filtru = filtr vypnutý.
+type FilterConfig struct {
+	MaxRatePerMin      *float64
+	MedianWindow       *int
+	MedianMaxDeviation *float64
+	ZScoreWindow       *int
+	ZScoreThreshold    *float64
+	Action             string // 'drop' nebo 'flag'
+}
+
+// FilterDecision je jeden záznam auditu.
+type FilterDecision struct {
+	SensorID  int64
+	Time      time.Time
+	Value     float64
+	Filter    string  // rate | median | zscore
+	Action    string  // dropped | flagged | accepted (reset po sérii odmítnutí)
+	Reference float64 // S čím jsme porovnávali (poslední hodnota, medián, průměr)
+	Detail    string
+}
+
+// sensorHistory je krátkodobá paměť jednoho senzoru.
+type sensorHistory struct {
+	values   []float64 // Poslední přijaté hodnoty (nejstarší první)
+	lastTime time.Time
+	rejects  int // Počet odmítnutí v řadě
+}
+
+// FilterService drží historie senzorů a sbírá rozhodnutí pro audit.
+type FilterService struct {
+	db     *pgxpool.Pool
+	logger *slog.Logger
+
+	// mu chrání historie i frontu rozhodnutí - Check volá MQTT handler, Flush jiná goroutina.
+	mu        sync.Mutex
+	histories map[int64]*sensorHistory
+	pending   []FilterDecision
+}
+
+// NewFilterService - konstruktor
+func NewFilterService(db *pgxpool.Pool, logger *slog.Logger) *FilterService {
+	return &FilterService{
+		db:        db,
+		logger:    logger,
+		histories: make(map[int64]*sensorHistory),
+	}
+}
+
+// Check prožene hodnotu filtry senzoru. keep = false, pokud se má hodnota zahodit;
+// suspect = true, pokud hodnota neprošla filtrem, ale senzor má akci 'flag' (projde označená).
+// Senzor bez konfigurace filtrů projde vždy (a žádnou historii si nedržíme), stejně tak
+// každá hodnota při f == nil.
+func (f *FilterService) Check(sensorID int64, cfg *FilterConfig, value float64, t time.Time) (keep, suspect bool) {
+	if f == nil || cfg == nil {
+		return true, false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	h, ok := f.histories[sensorID]
+	if !ok {
+		h = &sensorHistory{}
+		f.histories[sensorID] = h
+	}
+
+	filter, ref, detail := evaluateFilters(cfg, h, value, t)
+	if filter == "" {
+		h.accept(value, t, historySize(cfg))
+		return true, false
+	}
+
+	decision := FilterDecision{SensorID: sensorID, Time: t, Value: value, Filter: filter, Reference: ref, Detail: detail}
+
+	if cfg.Action == "flag" {
+		// Označená hodnota projde a počítá se do historie jako každá jiná.
+		decision.Action = "flagged"
+		f.record(decision)
+		h.accept(value, t, historySize(cfg))
+		return true, true
+	}
+
+	h.rejects++
+	if h.rejects >= maxConsecutiveRejects {
+		// Série odmítnutí = skutečná změna úrovně. Přijmeme a začneme s čistou historií.
+		decision.Action = "accepted"
+		decision.Detail += fmt.Sprintf(" (po %d odmítnutích v řadě bráno jako skutečná změna, historie resetována)", h.rejects)
+		f.record(decision)
+		*h = sensorHistory{}
+		h.accept(value, t, historySize(cfg))
+		return true, false
+	}
+
+	decision.Action = "dropped"
+	f.record(decision)
+	return false, false
+}
+
+// evaluateFilters vrátí první filtr, kterým hodnota neprošla ("" = prošla všemi).
+func evaluateFilters(cfg *FilterConfig, h *sensorHistory, value float64, t time.Time) (filter string, ref float64, detail string) {
+	if len(h.values) == 0 {
+		return "", 0, "" // První hodnota - není s čím porovnávat
+	}
+	last := h.values[len(h.values)-1]
+
+	// 1. Rychlost změny. Krátký interval zdola omezíme na 1 s (dvě zprávy ve stejném okamžiku).
+	if cfg.MaxRatePerMin != nil {
+		minutes := math.Max(t.Sub(h.lastTime).Minutes(), 1.0/60)
+		if rate := math.Abs(value-last) / minutes; rate > *cfg.MaxRatePerMin {
+			return "rate", last, fmt.Sprintf("změna %.3f/min > limit %.3f/min", rate, *cfg.MaxRatePerMin)
+		}
+	}
+
+	// 2. Odchylka od mediánu posledních N hodnot (až když je okno plné)
+	if cfg.MedianWindow != nil && cfg.MedianMaxDeviation != nil && len(h.values) >= *cfg.MedianWindow {
+		med := median(h.values[len(h.values)-*cfg.MedianWindow:])
+		if dev := math.Abs(value - med); dev > *cfg.MedianMaxDeviation {
+			return "median", med, fmt.Sprintf("odchylka od mediánu %.3f > limit %.3f", dev, *cfg.MedianMaxDeviation)
+		}
+	}
+
+	// 3. Z-skóre vůči klouzavému oknu (až když je okno plné). Konstantní signál (std = 0) nehodnotíme.
+	if cfg.ZScoreWindow != nil && cfg.ZScoreThreshold != nil && len(h.values) >= *cfg.ZScoreWindow {
+		mean, std := meanStd(h.values[len(h.values)-*cfg.ZScoreWindow:])
+		if std > 0 {
+			if z := math.Abs(value-mean) / std; z > *cfg.ZScoreThreshold {
+				return "zscore", mean, fmt.Sprintf("z-skóre %.2f > limit %.2f", z, *cfg.ZScoreThreshold)
+			}
+		}
+	}
+
+	return "", 0, ""
+}
+
+// accept přidá hodnotu do historie a ořízne ji na 'size' posledních hodnot.
+func (h *sensorHistory) accept(value float64, t time.Time, size int) {
+	h.values = append(h.values, value)
+	if len(h.values) > size {
+		h.values = h.values[len(h.values)-size:]
+	}
+	h.lastTime = t
+	h.rejects = 0
+}
+
+// historySize: kolik hodnot si pamatovat (největší z oken, minimálně 1 pro filtr rychlosti).
+func historySize(cfg *FilterConfig) int {
+	size := 1
+	if cfg.MedianWindow != nil && *cfg.MedianWindow > size {
+		size = *cfg.MedianWindow
+	}
+	if cfg.ZScoreWindow != nil && *cfg.ZScoreWindow > size {
+		size = *cfg.ZScoreWindow
+	}
+	return size
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+func meanStd(values []float64) (mean, std float64) {
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	for _, v := range values {
+		std += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(std / float64(len(values)))
+}
+
+// record zařadí rozhodnutí do fronty pro zápis. Volat pod zámkem.
+func (f *FilterService) record(d FilterDecision) {
+	f.logger.Debug("Filtr zasáhl", "sensor_id", d.SensorID, "filter", d.Filter, "action", d.Action, "value", d.Value, "detail", d.Detail)
+	if len(f.pending) >= maxPendingDecisions {
+		return // Přetečení - audit je "best effort", zpracování dat má přednost
+	}
+	f.pending = append(f.pending, d)
+}
+
+// Flush zapíše nasbíraná rozhodnutí do DB (COPY - rychlé i pro tisíce řádků).
+func (f *FilterService) Flush(ctx context.Context) error {
+	f.mu.Lock()
+	batch := f.pending
+	f.pending = nil
+	f.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	_, err := f.db.CopyFrom(ctx,
+		pgx.Identifier{"filter_decisions"},
+		[]string{"sensor_id", "time", "value", "filter", "action", "reference_value", "detail"},
+		pgx.CopyFromSlice(len(batch), func(i int) ([]any, error) {
+			d := batch[i]
+			return []any{d.SensorID, d.Time, d.Value, d.Filter, d.Action, d.Reference, d.Detail}, nil
+		}),
+	)
+	if err != nil {
+		// COPY je jeden příkaz - při chybě se nezapsalo nic, dávku zkusíme při dalším flushi
+		f.restore(batch)
+		return err
+	}
+
+	f.logger.Info("Rozhodnutí filtrů uložena", "count", len(batch))
+	return nil
+}
+
+// restore vrátí nezapsanou dávku na začátek 'pending' (před rozhodnutí, která mezitím přibyla).
+// Limit maxPendingDecisions platí dál - při přetečení zahodíme nejnovější, jako record.
+func (f *FilterService) restore(batch []FilterDecision) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.pending = append(batch, f.pending...)
+	if len(f.pending) > maxPendingDecisions {
+		f.pending = f.pending[:maxPendingDecisions]
+	}
+}
+
+// StartAutoFlush periodicky zapisuje audit filtrů do DB.
+func (f *FilterService) StartAutoFlush(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := f.Flush(flushCtx); err != nil {
+				f.logger.Error("Závěrečný flush auditu filtrů selhal", "error", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := f.Flush(ctx); err != nil {
+				f.logger.Error("Flush auditu filtrů selhal", "error", err)
+			}
+		}
+	}
+}
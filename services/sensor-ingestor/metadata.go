@@ -1,4 +1,4 @@
-package main
+package ingestor
 
 import (
 	"context"
@@ -8,10 +8,11 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"storage"
 )
 
 // SensorMetadata drží informace o senzoru nutné pro zpracování zprávy.
-// Slouží jako cache záznamu z tabulek 'sensors' a 'sensor_types'.
+// Slouží jako cache záznamu z tabulek 'sensors' a 'sensor_types' (přes storage.MetadataStore).
 type SensorMetadata struct {
 	ID int64 // ID z tabulky sensors (bude se ukládat do data tabulky)
 
@@ -19,12 +20,25 @@ type SensorMetadata struct {
 	// nil = limit není nastaven.
 	MinValue *float64
 	MaxValue *float64
+
+	// Kind: Druh hodnoty typu (storage.Kind*) a pro výčet jeho povolené stavy (viz values.go).
+	Kind       string
+	EnumValues []string
+
+	// Calibrations: Verze kalibrace seřazené podle platnosti (viz storage/calibration.go).
+	// Obsahuje poslední už platnou a všechny budoucí - přepnutí tak proběhne přesně
+	// v 'effective_from', i když se cache obnovuje jen jednou za minutu.
+	Calibrations []storage.Calibration
+
+	// Filter: Nastavení filtrů špiček (viz filters.go). nil = senzor se nefiltruje.
+	Filter *FilterConfig
 }
 
 // MetadataService se stará o načítání a poskytování informací o senzorech.
 // Implementuje thread-safe přístup k mapě (cache).
 type MetadataService struct {
-	db     *pgxpool.Pool // Connection pool do DB
+	store  storage.MetadataStore // Senzory a limity (TimescaleDB nebo vestavěné úložiště)
+	db     *pgxpool.Pool         // Kalibrace a filtry; nil = bez DB (kalibrace ani filtry se nenačtou)
 	logger *slog.Logger
 
 	// mu (RWMutex) chrání mapu 'cache' před souběžným zápisem a čtením.
@@ -37,58 +51,81 @@ type MetadataService struct {
 }
 
 // NewMetadataService - konstruktor
-func NewMetadataService(db *pgxpool.Pool, logger *slog.Logger) *MetadataService {
+func NewMetadataService(store storage.MetadataStore, db *pgxpool.Pool, logger *slog.Logger) *MetadataService {
 	return &MetadataService{
+		store:  store,
 		db:     db,
 		logger: logger,
 		cache:  make(map[string]SensorMetadata),
 	}
 }
 
-// LoadSensors provede SQL dotaz a aktualizuje lokální cache v paměti.
+// LoadSensors načte senzory z úložiště (a kalibrace/filtry z DB) a aktualizuje lokální cache v paměti.
 // Tato operace je "drahá" (IO, síť), proto ji děláme jen při startu nebo periodicky.
 func (s *MetadataService) LoadSensors(ctx context.Context) error {
 	s.logger.Info("Starting sensor metadata refresh from DB...")
 
-	// SQL DOTAZ: Spojuje tabulku senzorů s jejich typy, abychom získali limity.
-	// Filtrujeme jen aktivní senzory (is_active = true).
-	query := `
-		SELECT 
-			s.mqtt_topic, 
-			s.id, 
-			st.min_value, 
-			st.max_value
-		FROM sensors s
-		JOIN sensor_types st ON s.sensor_type_id = st.id
-		WHERE s.is_active = true
-	`
-
-	rows, err := s.db.Query(ctx, query)
+	// Senzory a limity jejich typů bereme z úložiště (TimescaleDB nebo vestavěný backend).
+	// Úložiště vrací jen aktivní senzory (is_active = true).
+	sensors, err := s.store.ActiveSensors(ctx)
 	if err != nil {
-		return fmt.Errorf("SQL query failed: %w", err)
+		return fmt.Errorf("načtení senzorů selhalo: %w", err)
 	}
-	defer rows.Close() // Důležité: Vždy zavřít rows pro uvolnění spojení v poolu
 
 	// Vytvoříme novou, dočasnou mapu.
-	// Důvod: Nechceme blokovat hlavní cache (zámkem) po celou dobu iterace přes DB.
-	newCache := make(map[string]SensorMetadata)
+	// Důvod: Nechceme blokovat hlavní cache (zámkem) po celou dobu sestavování.
+	newCache := make(map[string]SensorMetadata, len(sensors))
 	count := 0
 
-	for rows.Next() {
-		var topic string
-		var meta SensorMetadata
+	for _, sensor := range sensors {
+		// Limity mohou být nil (v DB NULL) = limit není nastaven.
+		newCache[sensor.Topic] = SensorMetadata{
+			ID:       sensor.ID,
+			MinValue: sensor.MinValue,
+			MaxValue: sensor.MaxValue,
 
-		// Scan mapuje sloupce z SELECTu do proměnných.
-		// Pokud je v DB hodnota NULL, pgx ji umí nahrát do pointeru (*float64).
-		if err := rows.Scan(&topic, &meta.ID, &meta.MinValue, &meta.MaxValue); err != nil {
-			s.logger.Error("Failed to scan row", "error", err)
-			continue
+			Kind:       sensor.Kind,
+			EnumValues: sensor.EnumValues,
 		}
-
-		newCache[topic] = meta
 		count++
 	}
 
+	// Kalibrace a filtry žijí jen v TimescaleDB. Bez DB (vestavěné úložiště) je přeskočíme.
+	if s.db == nil {
+		s.swap(newCache, count)
+		return nil
+	}
+
+	// Kalibrace načítáme zvlášť a přiřadíme je k senzorům podle ID.
+	calibrations, err := s.loadCalibrations(ctx)
+	if err != nil {
+		return err
+	}
+	for topic, meta := range newCache {
+		if list, ok := calibrations[meta.ID]; ok {
+			meta.Calibrations = list
+			newCache[topic] = meta
+		}
+	}
+
+	// Filtry špiček - stejný postup jako u kalibrací.
+	filters, err := s.loadFilters(ctx)
+	if err != nil {
+		return err
+	}
+	for topic, meta := range newCache {
+		if f, ok := filters[meta.ID]; ok {
+			meta.Filter = f
+			newCache[topic] = meta
+		}
+	}
+
+	s.swap(newCache, count)
+	return nil
+}
+
+// swap nahradí cache nově sestavenou mapou.
+func (s *MetadataService) swap(newCache map[string]SensorMetadata, count int) {
 	// KRITICKÁ SEKCE (Critical Section)
 	// Zde na zlomek vteřiny zamkneme cache pro zápis a prohodíme pointery.
 	// Pattern "Read-Copy-Update": Připravili jsme data bokem a teď je atomicky prohodíme.
@@ -97,7 +134,85 @@ func (s *MetadataService) LoadSensors(ctx context.Context) error {
 	s.mu.Unlock()
 
 	s.logger.Info("Sensor metadata reloaded", "loaded_sensors", count)
-	return nil
+}
+
+// loadCalibrations načte kalibrace: pro každý senzor poslední už platnou a všechny budoucí.
+// Neplatná tabulka bodů se zaloguje a verze se přeskočí - senzor pak jede na poslední
+// PLATNÉ starší verzi. Proto se čtou všechny verze a ořezávají až tady (v SQL by "poslední
+// platná" znamenala parsovat JSON bodů v dotazu).
+func (s *MetadataService) loadCalibrations(ctx context.Context) (map[int64][]storage.Calibration, error) {
+	query := `
+		SELECT sensor_id, effective_from, scale, offset_value, points
+		FROM sensor_calibrations
+		ORDER BY sensor_id, effective_from ASC
+	`
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("SQL query (calibrations) failed: %w", err)
+	}
+	defer rows.Close()
+
+	// 1. Všechny platné verze
+	result := make(map[int64][]storage.Calibration)
+	for rows.Next() {
+		var sensorID int64
+		var c storage.Calibration
+		var points []byte
+		if err := rows.Scan(&sensorID, &c.EffectiveFrom, &c.Scale, &c.Offset, &points); err != nil {
+			s.logger.Error("Failed to scan calibration row", "error", err)
+			continue
+		}
+		if c.Points, err = storage.ParseCalibrationPoints(points); err != nil {
+			s.logger.Error("Neplatná kalibrační tabulka, přeskakuji", "sensor_id", sensorID, "effective_from", c.EffectiveFrom, "error", err)
+			continue
+		}
+		result[sensorID] = append(result[sensorID], c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 2. Historii před poslední už platnou verzí nepotřebujeme (zprávy jdou v reálném čase)
+	now := time.Now()
+	for sensorID, list := range result {
+		start := 0
+		for i, c := range list {
+			if !c.EffectiveFrom.After(now) {
+				start = i
+			}
+		}
+		result[sensorID] = list[start:]
+	}
+	return result, nil
+}
+
+// loadFilters načte zapnutá nastavení filtrů špiček.
+// Okno a práh se uplatní jen v páru - samotné okno bez prahu nemá co porovnávat.
+func (s *MetadataService) loadFilters(ctx context.Context) (map[int64]*FilterConfig, error) {
+	query := `
+		SELECT sensor_id, max_rate_per_min, median_window, median_max_deviation,
+		       zscore_window, zscore_threshold, action
+		FROM sensor_filters
+		WHERE enabled = true
+	`
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("SQL query (filters) failed: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[int64]*FilterConfig)
+	for rows.Next() {
+		var sensorID int64
+		var f FilterConfig
+		if err := rows.Scan(&sensorID, &f.MaxRatePerMin, &f.MedianWindow, &f.MedianMaxDeviation,
+			&f.ZScoreWindow, &f.ZScoreThreshold, &f.Action); err != nil {
+			s.logger.Error("Failed to scan filter row", "error", err)
+			continue
+		}
+		result[sensorID] = &f
+	}
+	return result, rows.Err()
 }
 
 // GetMetadata je metoda, kterou volá Ingestor pro každou příchozí zprávu.
@@ -1,7 +1,10 @@
-package main
+package ingestor
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
@@ -40,3 +43,33 @@ func (w *MqttLogWriter) Write(p []byte) (n int, err error) {
 
 	return len(p), nil
 }
+
+// teeHandler posílá každý záznam do dvou slog handlerů (např. stdout volajícího + MQTT).
+// Díky tomu si logger předaný do Run ponechá svůj výstup i atributy (v all-in-one "service")
+// a ingestor k němu jen "přilepí" kopii do MQTT.
+type teeHandler struct {
+	a, b slog.Handler
+}
+
+func (h teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.a.Enabled(ctx, level) || h.b.Enabled(ctx, level)
+}
+
+func (h teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errA, errB error
+	if h.a.Enabled(ctx, r.Level) {
+		errA = h.a.Handle(ctx, r.Clone())
+	}
+	if h.b.Enabled(ctx, r.Level) {
+		errB = h.b.Handle(ctx, r.Clone())
+	}
+	return errors.Join(errA, errB)
+}
+
+func (h teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return teeHandler{h.a.WithAttrs(attrs), h.b.WithAttrs(attrs)}
+}
+
+func (h teeHandler) WithGroup(name string) slog.Handler {
+	return teeHandler{h.a.WithGroup(name), h.b.WithGroup(name)}
+}
@@ -0,0 +1,374 @@
+package ingestor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"storage"
+)
+
+// --- AUTOMATICKÁ REGISTRACE SENZORŮ ---
+// Zařízení bez přístupu do DB (např. system-monitor na dalším Raspberry Pi) pošle při startu
+// přihlášku se seznamem svých senzorů. Ingestor chybějící typy a senzory založí,
+// obnoví cache metadat a odpoví potvrzením na topic 'reply_to'.
+// Operace je idempotentní - opakovaná registrace stejného hostu nic nerozbije.
+
+// SensorTypeSpec odpovídá řádku v tabulce sensor_types.
+type SensorTypeSpec struct {
+	Name        string   `json:"name"`
+	Unit        string   `json:"unit"`
+	Description string   `json:"description"`
+	MinValue    *float64 `json:"min_value,omitempty"`
+	MaxValue    *float64 `json:"max_value,omitempty"`
+
+	// StaleAfterSeconds: Po kolika sekundách bez hodnoty je senzor zastaralý (0 = výchozí práh API).
+	StaleAfterSeconds int `json:"stale_after_seconds,omitempty"`
+
+	// ValueKind: Druh hodnoty (number, boolean, enum, text, geo). Prázdné = number.
+	// EnumValues: Povolené stavy pro ValueKind "enum".
+	ValueKind  string   `json:"value_kind,omitempty"`
+	EnumValues []string `json:"enum_values,omitempty"`
+
+	// Counter: Hodnota je kumulativní počítadlo (vodoměr, elektroměr, pulzy) - jen číselný typ.
+	// CounterMax: Hodnota, po které počítadlo přeteče na 0 (např. 65536). Viz home-api/consumption.go.
+	Counter    bool     `json:"counter,omitempty"`
+	CounterMax *float64 `json:"counter_max,omitempty"`
+}
+
+// SensorSpec odpovídá řádku v tabulce sensors.
+type SensorSpec struct {
+	Topic        string         `json:"topic"`
+	FriendlyName string         `json:"friendly_name"`
+	Location     string         `json:"location"`
+	Type         SensorTypeSpec `json:"type"`
+}
+
+// DiagnosticSpec je topic s diagnostikou zařízení (řádek device_diagnostics).
+type DiagnosticSpec struct {
+	Topic    string `json:"topic"`
+	JSONPath string `json:"json_path,omitempty"` // Pole JSONu ("a.b"), prázdné = celý payload
+}
+
+// DeviceSpec odpovídá řádku v tabulce devices (viz devices.go). Senzory z přihlášky se k němu připojí.
+type DeviceSpec struct {
+	Name              string `json:"name"` // Identifikátor zařízení (unikátní)
+	FriendlyName      string `json:"friendly_name"`
+	Model             string `json:"model"`
+	Location          string `json:"location"`
+	AvailabilityTopic string `json:"availability_topic,omitempty"` // Topic s LWT
+	PayloadOnline     string `json:"payload_online,omitempty"`     // Výchozí "online"
+	PayloadOffline    string `json:"payload_offline,omitempty"`    // Výchozí "offline"
+
+	// Diagnostics: battery | rssi | firmware -> topic
+	Diagnostics map[string]DiagnosticSpec `json:"diagnostics,omitempty"`
+}
+
+// RegistrationRequest je přihláška, kterou posílá zařízení.
+type RegistrationRequest struct {
+	Host    string       `json:"host"`
+	ReplyTo string       `json:"reply_to"`
+	Sensors []SensorSpec `json:"sensors"`
+	Device  *DeviceSpec  `json:"device,omitempty"` // Volitelné: fyzické zařízení (jen s TimescaleDB)
+}
+
+// RegistrationAck je odpověď pro zařízení.
+type RegistrationAck struct {
+	Host       string `json:"host"`
+	Registered int    `json:"registered"`
+	Error      string `json:"error,omitempty"`
+}
+
+// RegistryService zakládá senzory na základě přihlášek z MQTT.
+type RegistryService struct {
+	db            *pgxpool.Pool         // nil = bez DB, senzory zakládáme přes 'store'
+	store         storage.MetadataStore // Vestavěné úložiště (použije se jen bez DB)
+	meta          *MetadataService
+	devices       *DeviceService // nil = bez DB (zařízení se neukládají)
+	logger        *slog.Logger
+	allowedPrefix string
+}
+
+// NewRegistryService - konstruktor
+func NewRegistryService(db *pgxpool.Pool, store storage.MetadataStore, meta *MetadataService, devices *DeviceService, allowedPrefix string, logger *slog.Logger) *RegistryService {
+	return &RegistryService{
+		db:            db,
+		store:         store,
+		meta:          meta,
+		devices:       devices,
+		logger:        logger,
+		allowedPrefix: allowedPrefix,
+	}
+}
+
+// HandleAnnounce je MQTT handler pro topic s přihláškami.
+func (r *RegistryService) HandleAnnounce(client mqtt.Client, msg mqtt.Message) {
+	var req RegistrationRequest
+	if err := json.Unmarshal(msg.Payload(), &req); err != nil {
+		r.logger.Warn("Neplatná žádost o registraci", "payload", string(msg.Payload()), "error", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ack := RegistrationAck{Host: req.Host}
+	created, err := r.Register(ctx, req)
+	if err != nil {
+		r.logger.Error("Registrace senzorů selhala", "host", req.Host, "error", err)
+		ack.Error = err.Error()
+	} else {
+		ack.Registered = created
+		r.logger.Info("Registrace senzorů dokončena", "host", req.Host, "sensors", len(req.Sensors), "new", created)
+	}
+
+	// Bez reply_to nemáme kam odpovědět (zařízení nečeká na ACK).
+	if req.ReplyTo == "" {
+		return
+	}
+
+	payload, _ := json.Marshal(ack)
+	if token := client.Publish(req.ReplyTo, 1, false, payload); token.Wait() && token.Error() != nil {
+		r.logger.Error("Odeslání ACK registrace selhalo", "topic", req.ReplyTo, "error", token.Error())
+	}
+}
+
+// Register založí chybějící typy a senzory v jedné transakci a obnoví cache metadat.
+// Vrací počet nově založených senzorů.
+func (r *RegistryService) Register(ctx context.Context, req RegistrationRequest) (int, error) {
+	return r.register(ctx, req, true)
+}
+
+// RegisterTrusted je Register bez kontroly REGISTRY_ALLOWED_PREFIX - pro přihlášky, které
+// sestavuje sám ingestor (např. ze Sparkplug BIRTH zpráv, viz sparkplug.go) s vlastními topicy.
+func (r *RegistryService) RegisterTrusted(ctx context.Context, req RegistrationRequest) (int, error) {
+	return r.register(ctx, req, false)
+}
+
+// register je společná část Register a RegisterTrusted (checkPrefix = kontrola povoleného prefixu).
+func (r *RegistryService) register(ctx context.Context, req RegistrationRequest, checkPrefix bool) (int, error) {
+	// 1. Validace - nechceme, aby kdokoliv na brokeru zakládal libovolné topicy.
+	if len(req.Sensors) == 0 {
+		return 0, fmt.Errorf("žádost neobsahuje žádné senzory")
+	}
+	for _, s := range req.Sensors {
+		if checkPrefix && !strings.HasPrefix(s.Topic, r.allowedPrefix) {
+			return 0, fmt.Errorf("topic %s není pod povoleným prefixem %s", s.Topic, r.allowedPrefix)
+		}
+		if s.Type.Name == "" {
+			return 0, fmt.Errorf("senzor %s nemá vyplněný typ", s.Topic)
+		}
+		switch s.Type.ValueKind {
+		case "", storage.KindNumber, storage.KindBoolean, storage.KindText, storage.KindGeo:
+		case storage.KindEnum:
+			if len(s.Type.EnumValues) == 0 {
+				return 0, fmt.Errorf("typ %s je výčet, ale nemá povolené stavy (enum_values)", s.Type.Name)
+			}
+		default:
+			return 0, fmt.Errorf("typ %s má neznámý druh hodnoty %q", s.Type.Name, s.Type.ValueKind)
+		}
+		if s.Type.Counter && storage.IsStateKind(s.Type.ValueKind) {
+			return 0, fmt.Errorf("typ %s: počítadlo musí být číselné (value_kind %s)", s.Type.Name, s.Type.ValueKind)
+		}
+		if s.Type.CounterMax != nil && (!s.Type.Counter || *s.Type.CounterMax <= 0) {
+			return 0, fmt.Errorf("typ %s: counter_max musí být kladné a jen u počítadla", s.Type.Name)
+		}
+	}
+
+	if err := r.validateDevice(req.Device, checkPrefix); err != nil {
+		return 0, err
+	}
+
+	// 2. Bez DB (vestavěné úložiště) zakládáme přes MetadataStore, viz registerStore.
+	if r.db == nil {
+		return r.registerStore(ctx, req)
+	}
+
+	// 3. Transakce - buď se založí vše, nebo nic.
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("začátek transakce selhal: %w", err)
+	}
+	defer tx.Rollback(ctx) // Po Commitu je Rollback no-op
+
+	// 3b. Zařízení (volitelné) - senzory z přihlášky k němu připojíme
+	var deviceID *int64
+	if req.Device != nil {
+		id, err := upsertDevice(ctx, tx, *req.Device)
+		if err != nil {
+			return 0, err
+		}
+		deviceID = &id
+	}
+
+	created := 0
+	for _, s := range req.Sensors {
+		// Typ senzoru: pokud už existuje, necháme ho beze změny (limity mohl upravit admin).
+		_, err := tx.Exec(ctx, `
+			INSERT INTO sensor_types (name, unit, description, min_value, max_value, stale_after_seconds, value_kind, enum_values,
+			                          is_counter, counter_max)
+			VALUES ($1, NULLIF($2, ''), $3, $4, $5, NULLIF($6, 0), COALESCE(NULLIF($7, ''), 'number'), $8, $9, $10)
+			ON CONFLICT (name) DO NOTHING`,
+			s.Type.Name, s.Type.Unit, s.Type.Description, s.Type.MinValue, s.Type.MaxValue, s.Type.StaleAfterSeconds,
+			s.Type.ValueKind, s.Type.EnumValues, s.Type.Counter, s.Type.CounterMax)
+		if err != nil {
+			return 0, fmt.Errorf("insert typu %s selhal: %w", s.Type.Name, err)
+		}
+
+		// Senzor: existující (i deaktivovaný) senzor nepřepisujeme.
+		tag, err := tx.Exec(ctx, `
+			INSERT INTO sensors (sensor_type_id, mqtt_topic, friendly_name, location, is_active, device_id)
+			VALUES ((SELECT id FROM sensor_types WHERE name = $1), $2, $3, NULLIF($4, ''), true, $5)
+			ON CONFLICT (mqtt_topic) DO NOTHING`,
+			s.Type.Name, s.Topic, s.FriendlyName, s.Location, deviceID)
+		if err != nil {
+			return 0, fmt.Errorf("insert senzoru %s selhal: %w", s.Topic, err)
+		}
+		created += int(tag.RowsAffected())
+
+		// Existující senzor bez zařízení připojíme (přiřazení adminem nepřepisujeme).
+		if deviceID != nil && tag.RowsAffected() == 0 {
+			if _, err := tx.Exec(ctx, `UPDATE sensors SET device_id = $2 WHERE mqtt_topic = $1 AND device_id IS NULL`,
+				s.Topic, *deviceID); err != nil {
+				return 0, fmt.Errorf("připojení senzoru %s k zařízení selhalo: %w", s.Topic, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("commit selhal: %w", err)
+	}
+
+	// Nové topicy zařízení začneme sledovat hned (jinak až při příštím DEVICE_FLUSH_INTERVAL).
+	if req.Device != nil && r.devices != nil {
+		if err := r.devices.Load(ctx); err != nil {
+			r.logger.Error("Načtení topiců zařízení po registraci selhalo", "error", err)
+		}
+	}
+
+	return created, r.reload(ctx, created)
+}
+
+// registerStore zakládá senzory přes vestavěné úložiště. Každý senzor je samostatný zápis
+// (EnsureSensor je idempotentní), takže po chybě stačí registraci zopakovat.
+// Popis typu, umístění senzoru ani zařízení vestavěné úložiště nedrží.
+func (r *RegistryService) registerStore(ctx context.Context, req RegistrationRequest) (int, error) {
+	if req.Device != nil {
+		r.logger.Debug("Zařízení z registrace se bez TimescaleDB neukládá", "device", req.Device.Name)
+	}
+	created := 0
+	for _, s := range req.Sensors {
+		var unit *string
+		if s.Type.Unit != "" {
+			unit = &s.Type.Unit
+		}
+		_, isNew, err := r.store.EnsureSensor(ctx, storage.Sensor{
+			Topic:    s.Topic,
+			Name:     s.FriendlyName,
+			Type:     s.Type.Name,
+			Unit:     unit,
+			MinValue: s.Type.MinValue,
+			MaxValue: s.Type.MaxValue,
+			Active:   true,
+
+			StaleAfter: time.Duration(s.Type.StaleAfterSeconds) * time.Second,
+			Kind:       s.Type.ValueKind,
+			EnumValues: s.Type.EnumValues,
+			Counter:    s.Type.Counter,
+			CounterMax: s.Type.CounterMax,
+		})
+		if err != nil {
+			return created, fmt.Errorf("založení senzoru %s selhalo: %w", s.Topic, err)
+		}
+		if isNew {
+			created++
+		}
+	}
+	return created, r.reload(ctx, created)
+}
+
+// reload obnoví cache hned, aby první data po ACK už nebyla odmítnuta.
+func (r *RegistryService) reload(ctx context.Context, created int) error {
+	if created == 0 {
+		return nil
+	}
+	if err := r.meta.LoadSensors(ctx); err != nil {
+		return fmt.Errorf("obnova cache po registraci selhala: %w", err)
+	}
+	return nil
+}
+
+// validateDevice zkontroluje zařízení z přihlášky. Jeho topicy musí být pod povoleným prefixem
+// jako topicy senzorů (jiné topicy, např. Tasmota 'tele/...', může zadat jen admin v DB).
+func (r *RegistryService) validateDevice(dev *DeviceSpec, checkPrefix bool) error {
+	if dev == nil {
+		return nil
+	}
+	if strings.TrimSpace(dev.Name) == "" {
+		return fmt.Errorf("zařízení nemá vyplněný název (name)")
+	}
+	if checkPrefix && dev.AvailabilityTopic != "" && !strings.HasPrefix(dev.AvailabilityTopic, r.allowedPrefix) {
+		return fmt.Errorf("topic dostupnosti %s není pod povoleným prefixem %s", dev.AvailabilityTopic, r.allowedPrefix)
+	}
+	for field, diag := range dev.Diagnostics {
+		switch field {
+		case DiagBattery, DiagRSSI, DiagFirmware:
+		default:
+			return fmt.Errorf("zařízení %s: neznámá diagnostika %q (battery, rssi, firmware)", dev.Name, field)
+		}
+		if checkPrefix && !strings.HasPrefix(diag.Topic, r.allowedPrefix) {
+			return fmt.Errorf("topic diagnostiky %s není pod povoleným prefixem %s", diag.Topic, r.allowedPrefix)
+		}
+	}
+	return nil
+}
+
+// upsertDevice založí nebo aktualizuje zařízení a jeho diagnostické topicy. Zařízení o sobě ví
+// nejlépe, kde hlásí dostupnost - topicy a model proto přepisujeme. Jméno a umístění nastavené
+// adminem zůstávají (COALESCE).
+func upsertDevice(ctx context.Context, tx pgx.Tx, dev DeviceSpec) (int64, error) {
+	online, offline := dev.PayloadOnline, dev.PayloadOffline
+	if online == "" {
+		online = "online"
+	}
+	if offline == "" {
+		offline = "offline"
+	}
+
+	var id int64
+	err := tx.QueryRow(ctx, `
+		INSERT INTO devices (name, friendly_name, model, location, availability_topic, payload_online, payload_offline)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), $6, $7)
+		ON CONFLICT (name) DO UPDATE SET
+			friendly_name      = COALESCE(devices.friendly_name, EXCLUDED.friendly_name),
+			location           = COALESCE(devices.location, EXCLUDED.location),
+			model              = COALESCE(EXCLUDED.model, devices.model),
+			availability_topic = EXCLUDED.availability_topic,
+			payload_online     = EXCLUDED.payload_online,
+			payload_offline    = EXCLUDED.payload_offline
+		RETURNING id`,
+		dev.Name, dev.FriendlyName, dev.Model, dev.Location, dev.AvailabilityTopic, online, offline).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("uložení zařízení %s selhalo: %w", dev.Name, err)
+	}
+
+	for field, diag := range dev.Diagnostics {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO device_diagnostics (device_id, field, mqtt_topic, json_path)
+			VALUES ($1, $2, $3, NULLIF($4, ''))
+			ON CONFLICT (device_id, field) DO UPDATE SET
+				mqtt_topic = EXCLUDED.mqtt_topic,
+				json_path  = EXCLUDED.json_path`,
+			id, field, diag.Topic, diag.JSONPath)
+		if err != nil {
+			return 0, fmt.Errorf("uložení diagnostiky %s zařízení %s selhalo: %w", field, dev.Name, err)
+		}
+	}
+	return id, nil
+}
@@ -0,0 +1,286 @@
+package ingestor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"presence"
+	"storage"
+)
+
+// Run spustí Sensor Ingestor a blokuje, dokud není zrušen ctx (signál, all-in-one shutdown).
+// Chyba se vrací jen při startu (DB, MQTT, subscribe) - o ukončení procesu rozhoduje volající.
+// logger: výstup na stdout; ingestor k němu po připojení přidá kopii logů do MQTT.
+func Run(ctx context.Context, cfg Config, logger *slog.Logger) error {
+	// MQTT Client musí být inicializován DŘÍVE než Logger, pokud chceme logovat start!
+	// To je problém slepice-vejce.
+	// ŘEŠENÍ: Nejprve uděláme klienta, pak logger.
+
+	// Presence (stav služby pro ostatní) - Last Will se musí nastavit ještě před připojením.
+	pres := presence.New("sensor-ingestor", cfg.PresenceTopic, cfg.PresenceInterval, logger)
+
+	opts := mqtt.NewClientOptions().AddBroker(cfg.MQTTBroker).SetClientID(cfg.MQTTClientID).
+		SetCustomOpenConnectionFn(cfg.MQTTConnect)
+	pres.SetWill(opts)
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		// Bez MQTT nemá ingestor co dělat - chybu vrátíme volajícímu (ten ji zaloguje a skončí)
+		return fmt.Errorf("připojení k MQTT selhalo: %w", token.Error())
+	}
+	// Odpojení s timeoutem 250ms při ukončení. Defery běží pozpátku - "offline" odejde před odpojením.
+	defer client.Disconnect(250)
+	defer pres.Offline(client)
+	pres.AddCheck("mqtt", presence.MQTTProbe(client))
+
+	// --- SETUP LOGGERU ---
+	// 1. Writer pro MQTT
+	mqttWriter := NewMqttLogWriter(client, "sensor-ingestor")
+
+	// 2. Tee: Píše do obou (logger volajícího na stdout + JSON do MQTT)
+	// 3. Vytvoření loggeru s tímto "rozdvojeným" handlerem
+	logger = slog.New(teeHandler{logger.Handler(), slog.NewJSONHandler(mqttWriter, nil)})
+
+	logger.Info("Ingestor startuje (Loguji do MQTT i Stdout)")
+	// 5. Spuštění Healthcheck serveru (pro Docker/K8s)
+	// Prázdný port = bez health serveru (all-in-one má jeden společný /health).
+	if cfg.HTTPPort != "" {
+		go pres.ServeHealth(ctx, cfg.HTTPPort)
+	}
+
+	logger.Info("Spouštím službu Sensor Ingestor", "config", cfg)
+
+	// 3. Inicializace DB Connection Pool
+	// pgxpool spravuje sadu otevřených spojení do DB. Je thread-safe.
+	// Prázdná POSTGRES_URL = běh bez TimescaleDB (vestavěné úložiště předané v cfg.Store).
+	var dbPool *pgxpool.Pool
+	if cfg.PostgresURL != "" {
+		var err error
+		dbPool, err = pgxpool.New(ctx, cfg.PostgresURL)
+		if err != nil {
+			// Pokud se nelze připojit k DB při startu, nemá smysl pokračovat -> Crash.
+			// Docker kontejner se restartuje a zkusí to znovu.
+			return fmt.Errorf("nelze se připojit k DB: %w", err)
+		}
+		defer dbPool.Close() // Zajistí uzavření spojení při ukončení
+		pres.AddCheck("postgres", dbPool.Ping)
+	}
+
+	// 3b. Úložiště metadat senzorů: předané zvenku, jinak TimescaleDB přes stejný pool.
+	store := cfg.Store
+	if store == nil {
+		if dbPool == nil {
+			return fmt.Errorf("bez POSTGRES_URL je nutné předat úložiště (Config.Store)")
+		}
+		store = storage.NewPostgres(dbPool, nil)
+	}
+	if dbPool == nil {
+		logger.Warn("Běžím bez TimescaleDB - karanténa topiců, filtry, kalibrace, zařízení a ukládání odmítnutých zpráv jsou vypnuté")
+	}
+
+	// 4. Inicializace Metadata Service
+	metaService := NewMetadataService(store, dbPool, logger)
+
+	// První, blokující načtení dat. Musíme mít data, než začneme poslouchat MQTT.
+	if err := metaService.LoadSensors(ctx); err != nil {
+		return fmt.Errorf("nepodařilo se načíst metadata senzorů: %w", err)
+	}
+
+	// Spuštění automatického obnovování cache na pozadí (goroutina)
+	// Context zrušíme při shutdownu - ukončí i všechny goroutiny níže.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go metaService.StartAutoRefresh(ctx)
+
+	// 5. Karanténa neznámých topiců
+	// Zprávy z topiců, které nejsou v DB, ukládáme do 'discovered_topics' ke schválení.
+	// Karanténa i filtry potřebují tabulky v TimescaleDB - bez DB zůstanou nil.
+	var discovery *DiscoveryService
+	var filters *FilterService
+	var devices *DeviceService
+	if dbPool != nil {
+		discovery = NewDiscoveryService(dbPool, logger)
+		if err := discovery.LoadIgnored(ctx); err != nil {
+			logger.Error("Nepodařilo se načíst ignorované topicy", "error", err)
+		}
+		go discovery.StartAutoFlush(ctx, cfg.DiscoveryFlushInterval)
+
+		// 5b. Filtry špiček a odlehlých hodnot (nastavení v 'sensor_filters', audit v 'filter_decisions')
+		filters = NewFilterService(dbPool, logger)
+		go filters.StartAutoFlush(ctx, cfg.FilterFlushInterval)
+
+		// 5c. Zařízení: dostupnost (LWT) a diagnostika (baterie, RSSI, firmware), viz devices.go
+		// Topicy pod INPUT_TOPIC a Sparkplug odebíráme sami - DeviceService je nesmí odebírat znovu.
+		devices = NewDeviceService(dbPool, client, []string{cfg.InputTopic, cfg.SparkplugTopic}, logger)
+		if err := devices.Load(ctx); err != nil {
+			logger.Error("Nepodařilo se načíst topicy zařízení", "error", err)
+		}
+		go devices.StartAutoFlush(ctx, cfg.DeviceFlushInterval)
+	}
+
+	// 5d. Dead-letter pro zprávy, které neprošly validací
+	deadLetter := NewDeadLetterService(client, dbPool, cfg.DeadLetterTopic, cfg.DeadLetterMaxRows, logger)
+	go deadLetter.StartAutoFlush(ctx, cfg.DeadLetterFlushInterval)
+
+	// 6. Nastavení MQTT Klienta
+	//opts := mqtt.NewClientOptions()
+	//opts.AddBroker(cfg.MQTTBroker)
+	//opts.SetClientID(cfg.MQTTClientID)
+
+	// --- HLAVNÍ LOOP ZPRACOVÁNÍ ZPRÁV ---
+	// Handler předáváme přímo do Subscribe. Pozor: NewClient si 'opts' zkopíruje,
+	// takže SetDefaultPublishHandler volaný až po vytvoření klienta nemá žádný efekt.
+	// publishEvent pošle validní JSON dál (do Persisteru).
+	publishEvent := func(client mqtt.Client, normalizedBytes []byte) {
+		token := client.Publish(cfg.OutputTopic, 0, false, normalizedBytes)
+		token.Wait()
+
+		if token.Error() != nil {
+			logger.Error("Chyba při publikaci do MQTT", "error", token.Error())
+		} else {
+			// V Debug levelu můžeme vidět každou zprávu, v Info ne (aby logy nebyly obří)
+			logger.Debug("Zpráva úspěšně zpracována a odeslána")
+		}
+	}
+
+	// ingest zpracuje jednu hodnotu: ProcessMessage a podle výsledku publikace, karanténa,
+	// nebo dead-letter. Volá ho handleMessage a SparkplugService (hodnoty metrik pod
+	// kanonickým topicem, viz sparkplug.go). deviceTopic = topic patří zařízení (není neznámý).
+	ingest := func(topic string, payload []byte, receivedAt time.Time, filters *FilterService, deviceTopic bool) {
+		// A. Zavoláme naši logiku (service.go)
+		normalizedBytes, err := ProcessMessage(topic, payload, receivedAt, metaService, filters, nil)
+
+		if errors.Is(err, ErrUnknownTopic) {
+			if deviceTopic {
+				return // Topic zařízení není neznámý, jen nemá senzor
+			}
+			// Neznámý topic nezahazujeme, ale dáme do karantény ke schválení (jen s DB).
+			if discovery != nil && discovery.Record(topic, payload) {
+				logger.Debug("Neznámý topic zařazen do karantény", "topic", topic)
+			}
+			return
+		}
+
+		if errors.Is(err, ErrFiltered) {
+			// Zahození filtrem je očekávané a zapisuje se do auditu - warning by jen zahltil logy.
+			logger.Debug("Zpráva zahozena filtrem", "topic", topic, "důvod", err)
+			return
+		}
+
+		var rej *RejectError
+		if errors.As(err, &rej) {
+			// Validace selhala - zpráva jde na dead-letter (topic + tabulka), ať je vidět, co zařízení poslalo.
+			deadLetter.Reject(topic, payload, receivedAt, rej)
+			logger.Warn("Zpráva odmítnuta", "topic", topic, "reason", rej.Reason, "důvod", err)
+			return
+		}
+
+		if err != nil {
+			// Jiná chyba (např. serializace). NEUKONČUJEME službu, jen zahodíme tuto jednu zprávu.
+			logger.Warn("Zpráva odmítnuta", "topic", topic, "důvod", err)
+			return
+		}
+
+		// B. Odeslání validního JSONu dál (do Persisteru)
+		publishEvent(client, normalizedBytes)
+	}
+
+	handleMessage := func(_ mqtt.Client, msg mqtt.Message) {
+		receivedAt := time.Now().UTC()
+
+		// Sparkplug (protobuf) zpracuje SparkplugService, i když topic spadá i pod INPUT_TOPIC
+		if cfg.SparkplugTopic != "" && topicMatches(cfg.SparkplugTopic, msg.Topic()) {
+			return
+		}
+
+		// Topic dostupnosti nebo diagnostiky zařízení (může být zároveň senzorem - zpracujeme oba)
+		deviceTopic := devices != nil && devices.Observe(msg.Topic(), msg.Payload())
+
+		ingest(msg.Topic(), msg.Payload(), receivedAt, filters, deviceTopic)
+	}
+
+	// handleResubmit zpracuje zprávu znovu odeslanou z dead-letteru (po opravě metadat).
+	// Používáme původní čas přijetí a filtry špiček přeskočíme - historie filtrů je "teď",
+	// stará hodnota by v ní neměla smysl. Pokud zpráva neprojde ani teď, vznikne nový záznam.
+	handleResubmit := func(client mqtt.Client, msg mqtt.Message) {
+		var req ResubmitMessage
+		if err := json.Unmarshal(msg.Payload(), &req); err != nil || req.Topic == "" || req.ReceivedAt.IsZero() {
+			logger.Warn("Neplatná žádost o znovuzpracování", "payload", string(msg.Payload()), "error", err)
+			return
+		}
+
+		normalizedBytes, err := ProcessMessage(req.Topic, req.Payload, req.ReceivedAt.UTC(), metaService, nil,
+			[]string{QualityResubmitted})
+
+		var rej *RejectError
+		if errors.As(err, &rej) {
+			deadLetter.Reject(req.Topic, req.Payload, req.ReceivedAt.UTC(), rej)
+			logger.Warn("Znovu odeslaná zpráva opět odmítnuta", "reject_id", req.RejectID, "reason", rej.Reason, "důvod", err)
+			return
+		}
+		if err != nil {
+			logger.Warn("Znovu odeslanou zprávu nelze zpracovat", "reject_id", req.RejectID, "důvod", err)
+			return
+		}
+
+		publishEvent(client, normalizedBytes)
+		logger.Info("Odmítnutá zpráva znovu zpracována", "reject_id", req.RejectID, "topic", req.Topic)
+	}
+
+	logger.Info("Připojeno k MQTT", "broker", cfg.MQTTBroker)
+
+	// 7. Subscribe (Odběr zpráv)
+	if token := client.Subscribe(cfg.InputTopic, 0, handleMessage); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("subscribe %s selhal: %w", cfg.InputTopic, token.Error())
+	}
+	logger.Info("Poslouchám na topicu", "topic", cfg.InputTopic)
+
+	// 7b. Registrace nových senzorů (handshake se system-monitorem)
+	// QoS 1: Přihláška nesmí "vypadnout", jinak by zařízení zbytečně čekalo na timeout.
+	registry := NewRegistryService(dbPool, store, metaService, devices, cfg.RegistryAllowedPrefix, logger)
+	if token := client.Subscribe(cfg.RegistryTopic, 1, registry.HandleAnnounce); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("subscribe %s selhal: %w", cfg.RegistryTopic, token.Error())
+	}
+	logger.Info("Přijímám registrace senzorů", "topic", cfg.RegistryTopic)
+
+	// 7c. Znovu odeslané odmítnuté zprávy (z dashboardu přes Home API)
+	if token := client.Subscribe(cfg.ResubmitTopic, 1, handleResubmit); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("subscribe %s selhal: %w", cfg.ResubmitTopic, token.Error())
+	}
+	logger.Info("Přijímám znovu odeslané zprávy", "topic", cfg.ResubmitTopic)
+
+	// 7d. Sparkplug B: protobuf zprávy průmyslových zařízení (viz sparkplug.go)
+	if cfg.SparkplugTopic != "" {
+		sparkplug := NewSparkplugService(client, devices, registry, cfg.SparkplugAutoRegister, cfg.SparkplugRebirth,
+			func(topic string, payload []byte, at time.Time, historical bool) {
+				// Dohrávané starší hodnoty by rozhodily historii filtrů špiček - přeskočíme je
+				f := filters
+				if historical {
+					f = nil
+				}
+				ingest(topic, payload, at, f, false)
+			}, logger)
+		go sparkplug.StartRegistration(ctx)
+		// QoS 1: NDEATH (Last Will uzlu) nesmí vypadnout
+		if token := client.Subscribe(cfg.SparkplugTopic, 1, sparkplug.HandleMessage); token.Wait() && token.Error() != nil {
+			return fmt.Errorf("subscribe %s selhal: %w", cfg.SparkplugTopic, token.Error())
+		}
+		logger.Info("Přijímám Sparkplug B", "topic", cfg.SparkplugTopic, "auto_register", cfg.SparkplugAutoRegister)
+	}
+
+	// 7e. Presence: služba je připravená - "online" + stav závislostí, obnova každý PRESENCE_INTERVAL
+	go pres.Run(ctx, client)
+
+	// 8. Graceful Shutdown (Čekání na zrušení contextu)
+	// Blokujeme, dokud volající nezruší ctx (SIGINT/SIGTERM v cmd/, nebo shutdown all-in-one).
+	<-ctx.Done()
+
+	logger.Info("Ukončuji službu...")
+	// Zde proběhnou defery (cancel contextu, close db pool, disconnect mqtt)
+	return nil
+}
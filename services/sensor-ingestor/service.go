@@ -1,16 +1,25 @@
-package main
+package ingestor
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"time"
+
+	"storage"
 )
 
+// ErrUnknownTopic značí zprávu z topicu, který není v cache metadat.
+// Volající podle ní pozná, že zprávu má předat do karantény (DiscoveryService).
+var ErrUnknownTopic = errors.New("neznámý MQTT topic")
+
 // ProcessMessage zapouzdřuje logiku zpracování jedné zprávy.
-// Vstupy: topic, raw payload a služba pro metadata.
-// Výstup: JSON bytes nebo chyba.
-func ProcessMessage(topic string, payload []byte, metaService *MetadataService) ([]byte, error) {
+// Vstupy: topic, raw payload, čas přijetí, služba pro metadata a filtry špiček
+// (filters = nil -> filtry se přeskočí, viz znovu odeslané zprávy v run.go)
+// a příznaky kvality, které volající zná předem (např. QualityResubmitted).
+// Výstup: JSON bytes nebo chyba. Chyby validace jsou typu *RejectError (s kódem důvodu).
+func ProcessMessage(topic string, payload []byte, receivedAt time.Time, metaService *MetadataService, filters *FilterService, quality []string) ([]byte, error) {
 
 	// KROK 1: Identifikace (Lookup)
 	// Podíváme se do paměti (cache), jestli tento topic známe.
@@ -19,15 +28,43 @@ func ProcessMessage(topic string, payload []byte, metaService *MetadataService)
 		// Pokud topic není v DB, považujeme zprávu za "odpad" nebo neznámou.
 		// Vracíme error, aby volající věděl, že se nemá nic posílat dál.
 		// Tím chráníme DB před insertem dat bez vazby (Integrity Constraint Violation).
-		return nil, fmt.Errorf("neznámý MQTT topic (není v DB): %s", topic)
+		return nil, fmt.Errorf("%w (není v DB): %s", ErrUnknownTopic, topic)
+	}
+
+	// KROK 1b: Potvrzení příkazu přichází jako JSON s 'value' a 'correlation_id' - dál
+	// zpracujeme jen hodnotu (correlation ID čte home-api, které state topic odebírá samo).
+	payload = unwrapValue(payload)
+
+	// KROK 2a: Nečíselné hodnoty (boolean, enum, text, geo - viz values.go)
+	// Kalibrace, limity ani filtry pro ně nemají smysl - jen přečíst, zvalidovat a poslat dál.
+	if storage.IsStateKind(meta.Kind) {
+		state, err := parseState(meta, payload)
+		if err != nil {
+			return nil, &RejectError{Reason: ReasonInvalidValue, SensorID: meta.ID, Err: err}
+		}
+		return json.Marshal(SensorEvent{
+			SensorID:  meta.ID,
+			Value:     stateValue(state),
+			State:     state,
+			Timestamp: receivedAt,
+			Quality:   quality,
+		})
 	}
 
 	// KROK 2: Parsing
-	// Předpokládáme, že payload je prosté číslo (např. "24.5").
+	// Číselný senzor: předpokládáme, že payload je prosté číslo (např. "24.5").
 	valStr := string(payload)
 	val, err := strconv.ParseFloat(valStr, 64)
 	if err != nil {
-		return nil, fmt.Errorf("hodnota '%s' není platné číslo: %w", valStr, err)
+		return nil, &RejectError{Reason: ReasonInvalidNumber, SensorID: meta.ID,
+			Err: fmt.Errorf("hodnota '%s' není platné číslo: %w", valStr, err)}
+	}
+
+	// KROK 2b: Kalibrace (scale/offset, případně tabulka bodů)
+	// Limity níže platí pro SKUTEČNOU hodnotu, proto kalibrujeme před validací.
+	// Čas přijetí rozhoduje i o verzi kalibrace (u znovu odeslané zprávy je v minulosti).
+	if cal, ok := storage.ActiveCalibration(meta.Calibrations, receivedAt); ok {
+		val = cal.Apply(val)
 	}
 
 	// KROK 3: Business Validace (Limity)
@@ -36,12 +73,25 @@ func ProcessMessage(topic string, payload []byte, metaService *MetadataService)
 	// Kontrola MIN
 	if meta.MinValue != nil && val < *meta.MinValue {
 		// Příklad: Teplota -500°C je fyzikální nesmysl (chyba senzoru).
-		return nil, fmt.Errorf("hodnota %.2f je pod minimálním limitem %.2f pro senzor ID %d", val, *meta.MinValue, meta.ID)
+		return nil, &RejectError{Reason: ReasonBelowMin, SensorID: meta.ID,
+			Err: fmt.Errorf("hodnota %.2f je pod minimálním limitem %.2f pro senzor ID %d", val, *meta.MinValue, meta.ID)}
 	}
 
 	// Kontrola MAX
 	if meta.MaxValue != nil && val > *meta.MaxValue {
-		return nil, fmt.Errorf("hodnota %.2f je nad maximálním limitem %.2f pro senzor ID %d", val, *meta.MaxValue, meta.ID)
+		return nil, &RejectError{Reason: ReasonAboveMax, SensorID: meta.ID,
+			Err: fmt.Errorf("hodnota %.2f je nad maximálním limitem %.2f pro senzor ID %d", val, *meta.MaxValue, meta.ID)}
+	}
+
+	// KROK 3b: Filtry špiček a odlehlých hodnot (rychlost změny, medián, z-skóre)
+	// Běží až po min/max - fyzikálně nemožná hodnota nemá co dělat v historii filtrů.
+	keep, suspect := filters.Check(meta.ID, meta.Filter, val, receivedAt)
+	if !keep {
+		return nil, fmt.Errorf("%w: hodnota %.2f pro senzor ID %d", ErrFiltered, val, meta.ID)
+	}
+	if suspect {
+		// Označená hodnota jde dál, ale s příznakem - dashboard ji ukáže jako podezřelou.
+		quality = append(quality, QualitySuspect)
 	}
 
 	// KROK 4: Transformace na DTO (Data Transfer Object)
@@ -49,7 +99,8 @@ func ProcessMessage(topic string, payload []byte, metaService *MetadataService)
 	event := SensorEvent{
 		SensorID:  meta.ID,
 		Value:     val,
-		Timestamp: time.Now().UTC(),
+		Timestamp: receivedAt,
+		Quality:   quality,
 	}
 
 	// Serializace do JSON pro odeslání do fronty
@@ -0,0 +1,619 @@
+package ingestor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"storage"
+)
+
+// --- SPARKPLUG B ---
+// Průmyslová zařízení (PLC, brány) posílají data podle specifikace Sparkplug B:
+//
+//	spBv1.0/<group>/<typ>/<edge_node>[/<device>]   payload = protobuf (viz sparkplug_pb.go)
+//
+// Typy zpráv:
+//   - NBIRTH / DBIRTH: "rodný list" uzlu / zařízení - všechny metriky se jménem, typem, aliasem
+//     a aktuální hodnotou. Další zprávy už smí metriku označit jen číselným aliasem.
+//   - NDATA / DDATA: změněné hodnoty (jménem nebo aliasem).
+//   - NDEATH / DDEATH: uzel / zařízení je offline. NDEATH posílá broker jako Last Will uzlu -
+//     platí jen, když její bdSeq odpovídá poslednímu NBIRTH (jinak jde o zpožděnou smrt
+//     předchozího spojení).
+//
+// Všechny zprávy uzlu (kromě NDEATH) nesou pořadové číslo seq 0-255. Mezera v sekvenci, data
+// bez BIRTH nebo neznámý alias znamenají, že nám něco uniklo - uzlu pošleme příkaz
+// NCMD "Node Control/Rebirth" a on znovu pošle všechny BIRTH (SPARKPLUG_REBIRTH).
+//
+// Metrika se mapuje na senzor přes "kanonický" topic bez typu zprávy:
+//
+//	spBv1.0/<group>/<edge_node>[/<device>]/<metrika>    např. spBv1.0/plant1/plc1/pump3/Temperature
+//
+// Hodnota pak jde stejnou cestou jako běžná zpráva (ProcessMessage - kalibrace, limity, filtry,
+// karanténa neznámých topiců, dead-letter) jako text ("24.5", "true"). Senzory lze založit ručně,
+// schválit z karantény, nebo nechat založit z BIRTH (SPARKPLUG_AUTO_REGISTER). Uzel i zařízení
+// se pak evidují v tabulce 'devices' s topicem dostupnosti <kanonický topic>/$state - online
+// po BIRTH, offline po DEATH (viz devices.go).
+//
+// Primary Host (STATE zprávy) ingestor neohlašuje - edge nodes nesmí čekat na primární hostitele.
+
+// Řídicí metriky Sparkplugu (nejsou to měření).
+const (
+	spRebirthMetric = "Node Control/Rebirth"
+	spBdSeqMetric   = "bdSeq"
+)
+
+// spRebirthInterval: Nejkratší odstup dvou žádostí o Rebirth téhož uzlu.
+const spRebirthInterval = 10 * time.Second
+
+// spRegisterQueue: Kolik BIRTH registrací může čekat na zápis do DB. Plná fronta (DB stojí)
+// = registrace se zahodí, uzel ji zopakuje při dalším BIRTH.
+const spRegisterQueue = 64
+
+// spRegisterTimeout: Nejdelší zápis jedné registrace z BIRTH.
+const spRegisterTimeout = 10 * time.Second
+
+// spStateSuffix: Poslední úroveň kanonického topicu dostupnosti uzlu / zařízení.
+const spStateSuffix = "$state"
+
+// spTopic je rozebraný Sparkplug topic.
+type spTopic struct {
+	Group  string
+	Type   string // NBIRTH, NDATA, DDATA, ...
+	Node   string
+	Device string // "" = zpráva samotného uzlu
+}
+
+// base vrací kanonický topic uzlu / zařízení (bez typu zprávy).
+func (t spTopic) base() string {
+	base := "spBv1.0/" + t.Group + "/" + t.Node
+	if t.Device != "" {
+		base += "/" + t.Device
+	}
+	return base
+}
+
+// spMetricDef je metrika z BIRTH (alias a typ platí až do další smrti uzlu).
+type spMetricDef struct {
+	Name     string
+	DataType uint32
+}
+
+// spDevice drží metriky uzlu nebo jednoho jeho zařízení.
+type spDevice struct {
+	byAlias map[uint64]spMetricDef
+	byName  map[string]spMetricDef
+}
+
+// spNode je stav edge nodu mezi zprávami.
+type spNode struct {
+	born        bool // Přišel NBIRTH (a od té doby ne NDEATH)
+	bdSeq       uint64
+	hasBdSeq    bool
+	seq         uint64
+	devices     map[string]*spDevice // "" = uzel samotný
+	lastRebirth time.Time
+}
+
+// spValue je hodnota metriky připravená pro ProcessMessage.
+type spValue struct {
+	Topic      string
+	Payload    []byte
+	At         time.Time
+	Historical bool // Dohrávka starších hodnot (filtry špiček se přeskočí)
+}
+
+// spResult je, co z jedné zprávy plyne (provádí se až mimo zámek).
+type spResult struct {
+	values       []spValue
+	availability map[string]bool      // Kanonický topic dostupnosti -> online
+	register     *RegistrationRequest // Senzory a zařízení z BIRTH
+	rebirth      bool
+}
+
+// spJob je práce pro registrační frontu: registrace z BIRTH a hodnoty, které musí počkat,
+// až bude registrace zapsaná (jinak by skončily v karanténě neznámých topiců).
+type spJob struct {
+	node     string               // "<group>/<edge_node>"
+	register *RegistrationRequest // nil = jen hodnoty uzlu, který ještě čeká na registraci
+	values   []spValue
+}
+
+// SparkplugService dekóduje Sparkplug B zprávy a předává hodnoty metrik dál.
+type SparkplugService struct {
+	client       mqtt.Client
+	devices      *DeviceService   // nil = bez DB (dostupnost se neukládá)
+	registry     *RegistryService // Automatická registrace z BIRTH
+	autoRegister bool
+	rebirth      bool
+
+	// ingest zpracuje hodnotu jako zprávu z topicu (ProcessMessage, publikace, karanténa...)
+	ingest func(topic string, payload []byte, at time.Time, historical bool)
+	logger *slog.Logger
+
+	// jobs: Registrace z BIRTH zapisuje StartRegistration mimo MQTT handler - paho doručuje
+	// zprávy postupně a pomalá DB by zastavila příjem všech topiců.
+	jobs chan spJob
+
+	// mu chrání stav uzlů (MQTT handler může běžet souběžně pro různé topicy).
+	mu      sync.Mutex
+	nodes   map[string]*spNode // "<group>/<edge_node>" -> stav
+	pending map[string]int     // "<group>/<edge_node>" -> úlohy ve frontě (hodnoty jdou za nimi)
+}
+
+// NewSparkplugService - konstruktor
+func NewSparkplugService(client mqtt.Client, devices *DeviceService, registry *RegistryService, autoRegister, rebirth bool,
+	ingest func(topic string, payload []byte, at time.Time, historical bool), logger *slog.Logger) *SparkplugService {
+	return &SparkplugService{
+		client:       client,
+		devices:      devices,
+		registry:     registry,
+		autoRegister: autoRegister,
+		rebirth:      rebirth,
+		ingest:       ingest,
+		logger:       logger,
+		jobs:         make(chan spJob, spRegisterQueue),
+		nodes:        make(map[string]*spNode),
+		pending:      make(map[string]int),
+	}
+}
+
+// StartRegistration zapisuje registrace z BIRTH (v pořadí příchodu) a po každé z nich předá
+// hodnoty, které na ni čekaly. Blokuje do zrušení ctx.
+func (s *SparkplugService) StartRegistration(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-s.jobs:
+			if job.register != nil {
+				regCtx, cancel := context.WithTimeout(ctx, spRegisterTimeout)
+				created, err := s.registry.RegisterTrusted(regCtx, *job.register)
+				cancel()
+				if err != nil {
+					s.logger.Error("Registrace Sparkplug metrik selhala", "node", job.register.Host, "error", err)
+				} else if created > 0 {
+					s.logger.Info("Sparkplug metriky zaregistrovány", "node", job.register.Host, "new", created)
+				}
+			}
+			for _, v := range job.values {
+				s.ingest(v.Topic, v.Payload, v.At, v.Historical)
+			}
+
+			s.mu.Lock()
+			if s.pending[job.node]--; s.pending[job.node] <= 0 {
+				delete(s.pending, job.node)
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// HandleMessage je MQTT handler pro Sparkplug topicy.
+func (s *SparkplugService) HandleMessage(_ mqtt.Client, msg mqtt.Message) {
+	receivedAt := time.Now().UTC()
+
+	t, ok := parseSparkplugTopic(msg.Topic())
+	if !ok {
+		// STATE zprávy hostitelů, příkazy NCMD/DCMD (i naše vlastní Rebirth) a cizí topicy
+		return
+	}
+
+	payload, err := decodeSparkplug(msg.Payload())
+	if err != nil {
+		s.logger.Warn("Neplatný Sparkplug payload", "topic", msg.Topic(), "error", err)
+		return
+	}
+
+	// 1. Stav uzlu a převod metrik (pod zámkem)
+	s.mu.Lock()
+	var res spResult
+	switch t.Type {
+	case "NBIRTH", "DBIRTH":
+		res = s.birth(t, payload, receivedAt)
+	case "NDATA", "DDATA":
+		res = s.data(t, payload, receivedAt)
+	case "NDEATH":
+		res = s.nodeDeath(t, payload)
+	case "DDEATH":
+		res = s.deviceDeath(t, payload)
+	}
+	if res.rebirth {
+		res.rebirth = s.rebirthDue(t, receivedAt)
+	}
+
+	// 2. Registrace z BIRTH jde do fronty (StartRegistration) i s hodnotami - ty musí počkat,
+	// ať nejdou do karantény. Dokud uzel na registraci čeká, řadí se za ni i jeho další hodnoty.
+	key := t.Group + "/" + t.Node
+	queued := false
+	if res.register != nil || s.pending[key] > 0 {
+		select {
+		case s.jobs <- spJob{node: key, register: res.register, values: res.values}:
+			s.pending[key]++
+			queued = true
+		default:
+			s.logger.Warn("Fronta Sparkplug registrací je plná, registraci přeskakuji", "node", key)
+		}
+	}
+	s.mu.Unlock()
+
+	// 3. Dostupnost uzlu / zařízení
+	if s.devices != nil {
+		for topic, online := range res.availability {
+			state := "offline"
+			if online {
+				state = "online"
+			}
+			s.devices.Observe(topic, []byte(state))
+		}
+	}
+
+	// 4. Hodnoty metrik (pokud nečekají ve frontě na registraci)
+	if !queued {
+		for _, v := range res.values {
+			s.ingest(v.Topic, v.Payload, v.At, v.Historical)
+		}
+	}
+
+	// 5. Žádost o nový BIRTH
+	if res.rebirth {
+		s.requestRebirth(t, receivedAt)
+	}
+}
+
+// birth zpracuje NBIRTH / DBIRTH: nová tabulka aliasů, online, hodnoty a případná registrace.
+func (s *SparkplugService) birth(t spTopic, p *spPayload, receivedAt time.Time) spResult {
+	var res spResult
+	key := t.Group + "/" + t.Node
+	node := s.nodes[key]
+
+	if t.Device == "" {
+		// NBIRTH začíná nové spojení uzlu - vše staré zapomeneme (aliasy se mohly změnit)
+		last := time.Time{}
+		if node != nil {
+			last = node.lastRebirth
+		}
+		node = &spNode{born: true, devices: make(map[string]*spDevice), lastRebirth: last}
+		s.nodes[key] = node
+		node.seq = p.Seq
+		for _, m := range p.Metrics {
+			if m.Name == spBdSeqMetric {
+				node.bdSeq, node.hasBdSeq = m.LongValue, true
+			}
+		}
+	} else {
+		// DBIRTH patří do sekvence uzlu - bez NBIRTH nevíme, ke kterému spojení patří
+		if node == nil || !node.born {
+			s.logger.Debug("Sparkplug DBIRTH bez NBIRTH uzlu", "node", key, "device", t.Device)
+			return spResult{rebirth: true}
+		}
+		res.rebirth = !node.checkSeq(p)
+	}
+
+	dev := &spDevice{byAlias: make(map[uint64]spMetricDef), byName: make(map[string]spMetricDef)}
+	node.devices[t.Device] = dev
+
+	var sensors []SensorSpec
+	for _, m := range p.Metrics {
+		if m.Name == "" {
+			continue // BIRTH musí metriku pojmenovat
+		}
+		def := spMetricDef{Name: m.Name, DataType: m.DataType}
+		dev.byName[m.Name] = def
+		if m.HasAlias {
+			dev.byAlias[m.Alias] = def
+		}
+
+		if isControlMetric(m.Name) {
+			continue
+		}
+		if kind, ok := spValueKind(m.DataType); ok {
+			sensors = append(sensors, spSensorSpec(t, m, kind))
+		}
+		if v, ok := spMetricValue(t, m, def, p, receivedAt); ok {
+			res.values = append(res.values, v)
+		}
+	}
+
+	res.availability = map[string]bool{t.base() + "/" + spStateSuffix: true}
+	if s.autoRegister && s.registry != nil && len(sensors) > 0 {
+		friendly := t.Node
+		if t.Device != "" {
+			friendly = t.Device
+		}
+		res.register = &RegistrationRequest{
+			Host:    t.base(),
+			Sensors: sensors,
+			Device: &DeviceSpec{
+				Name:              t.base(),
+				FriendlyName:      friendly,
+				Model:             "Sparkplug B",
+				AvailabilityTopic: t.base() + "/" + spStateSuffix,
+				PayloadOnline:     "online",
+				PayloadOffline:    "offline",
+			},
+		}
+	}
+	return res
+}
+
+// data zpracuje NDATA / DDATA: metriky podle jména nebo aliasu z BIRTH.
+func (s *SparkplugService) data(t spTopic, p *spPayload, receivedAt time.Time) spResult {
+	key := t.Group + "/" + t.Node
+	node := s.nodes[key]
+	if node == nil || !node.born {
+		// Typicky po restartu ingestoru - aliasy neznáme, data bez BIRTH nepřečteme
+		s.logger.Debug("Sparkplug data bez NBIRTH uzlu", "node", key)
+		return spResult{rebirth: true}
+	}
+
+	var res spResult
+	res.rebirth = !node.checkSeq(p)
+	if res.rebirth {
+		s.logger.Warn("Mezera ve Sparkplug sekvenci", "node", key, "seq", p.Seq)
+	}
+
+	dev := node.devices[t.Device]
+	if dev == nil {
+		s.logger.Debug("Sparkplug data bez DBIRTH zařízení", "node", key, "device", t.Device)
+		res.rebirth = true
+		return res
+	}
+
+	for _, m := range p.Metrics {
+		def, ok := dev.byName[m.Name]
+		if m.Name == "" {
+			def, ok = dev.byAlias[m.Alias]
+		}
+		if !ok {
+			s.logger.Debug("Neznámá Sparkplug metrika", "node", key, "device", t.Device, "name", m.Name, "alias", m.Alias)
+			res.rebirth = true
+			continue
+		}
+		if isControlMetric(def.Name) {
+			continue
+		}
+		if v, ok := spMetricValue(t, m, def, p, receivedAt); ok {
+			res.values = append(res.values, v)
+		}
+	}
+	return res
+}
+
+// nodeDeath zpracuje NDEATH: uzel i všechna jeho zařízení jsou offline.
+func (s *SparkplugService) nodeDeath(t spTopic, p *spPayload) spResult {
+	key := t.Group + "/" + t.Node
+	node := s.nodes[key]
+	if node == nil || !node.born {
+		return spResult{availability: map[string]bool{t.base() + "/" + spStateSuffix: false}}
+	}
+
+	// Last Will předchozího spojení může dorazit až po novém NBIRTH - podle bdSeq ho poznáme.
+	for _, m := range p.Metrics {
+		if m.Name == spBdSeqMetric && node.hasBdSeq && m.LongValue != node.bdSeq {
+			s.logger.Debug("Zpožděný Sparkplug NDEATH, ignoruji", "node", key, "bdSeq", m.LongValue, "current", node.bdSeq)
+			return spResult{}
+		}
+	}
+
+	res := spResult{availability: make(map[string]bool)}
+	for device := range node.devices {
+		dt := t
+		dt.Device = device
+		res.availability[dt.base()+"/"+spStateSuffix] = false
+	}
+	res.availability[t.base()+"/"+spStateSuffix] = false
+
+	// Aliasy po smrti neplatí - další data musí přijít až po novém NBIRTH
+	node.born = false
+	node.devices = make(map[string]*spDevice)
+	return res
+}
+
+// deviceDeath zpracuje DDEATH: zařízení je offline (uzel běží dál).
+func (s *SparkplugService) deviceDeath(t spTopic, p *spPayload) spResult {
+	res := spResult{availability: map[string]bool{t.base() + "/" + spStateSuffix: false}}
+	node := s.nodes[t.Group+"/"+t.Node]
+	if node == nil || !node.born {
+		return res
+	}
+	res.rebirth = !node.checkSeq(p)
+	delete(node.devices, t.Device)
+	return res
+}
+
+// checkSeq ověří, že zpráva navazuje na předchozí (seq je 0-255 a pak znovu od 0).
+func (n *spNode) checkSeq(p *spPayload) bool {
+	if !p.HasSeq {
+		return true // Starší edge nodes seq neposílají - nemáme co kontrolovat
+	}
+	expected := (n.seq + 1) % 256
+	n.seq = p.Seq
+	return p.Seq == expected
+}
+
+// rebirthDue rozhodne, zda o Rebirth požádat (jen se zapnutým SPARKPLUG_REBIRTH a nejvýš
+// jednou za spRebirthInterval - jedna chybějící BIRTH by jinak spustila žádost s každou zprávou).
+func (s *SparkplugService) rebirthDue(t spTopic, now time.Time) bool {
+	if !s.rebirth {
+		return false
+	}
+	key := t.Group + "/" + t.Node
+	node := s.nodes[key]
+	if node == nil {
+		node = &spNode{devices: make(map[string]*spDevice)}
+		s.nodes[key] = node
+	}
+	if now.Sub(node.lastRebirth) < spRebirthInterval {
+		return false
+	}
+	node.lastRebirth = now
+	return true
+}
+
+// requestRebirth pošle uzlu NCMD "Node Control/Rebirth". Nečekáme na potvrzení - jsme
+// v MQTT handleru a QoS 0 stačí (při neúspěchu požádáme znovu s další zprávou).
+func (s *SparkplugService) requestRebirth(t spTopic, now time.Time) {
+	topic := "spBv1.0/" + t.Group + "/NCMD/" + t.Node
+	s.client.Publish(topic, 0, false, encodeRebirth(uint64(now.UnixMilli())))
+	s.logger.Info("Žádám Sparkplug uzel o Rebirth", "topic", topic)
+}
+
+// parseSparkplugTopic rozebere spBv1.0/<group>/<typ>/<edge_node>[/<device>].
+// Vrací false pro STATE, příkazy (NCMD/DCMD) a topicy mimo Sparkplug.
+func parseSparkplugTopic(topic string) (spTopic, bool) {
+	parts := strings.Split(topic, "/")
+	if len(parts) < 4 || len(parts) > 5 || parts[0] != "spBv1.0" {
+		return spTopic{}, false
+	}
+	t := spTopic{Group: parts[1], Type: parts[2], Node: parts[3]}
+	if len(parts) == 5 {
+		t.Device = parts[4]
+	}
+
+	switch t.Type {
+	case "NBIRTH", "NDATA", "NDEATH":
+		return t, t.Device == ""
+	case "DBIRTH", "DDATA", "DDEATH":
+		return t, t.Device != ""
+	default:
+		return spTopic{}, false
+	}
+}
+
+// isControlMetric vrátí true pro řídicí metriky (bdSeq, Node Control/..., Device Control/...).
+func isControlMetric(name string) bool {
+	return name == spBdSeqMetric || strings.HasPrefix(name, "Node Control/") || strings.HasPrefix(name, "Device Control/")
+}
+
+// spValueKind mapuje Sparkplug DataType na druh hodnoty senzoru. Data sety, šablony,
+// soubory a DateTime senzorem nejsou.
+func spValueKind(dataType uint32) (string, bool) {
+	switch dataType {
+	case spInt8, spInt16, spInt32, spInt64, spUInt8, spUInt16, spUInt32, spUInt64, spFloat, spDouble:
+		return storage.KindNumber, true
+	case spBoolean:
+		return storage.KindBoolean, true
+	case spString, spText, spUUID:
+		return storage.KindText, true
+	default:
+		return "", false
+	}
+}
+
+// spMetricValue převede metriku na hodnotu pro ProcessMessage. Typ z DATA má přednost
+// (smí se vynechat - pak platí typ z BIRTH). Čas: metrika, pak payload, pak čas přijetí.
+func spMetricValue(t spTopic, m spMetric, def spMetricDef, p *spPayload, receivedAt time.Time) (spValue, bool) {
+	if m.IsNull || !m.HasValue {
+		return spValue{}, false
+	}
+	dataType := m.DataType
+	if dataType == 0 {
+		dataType = def.DataType
+	}
+
+	var text string
+	switch dataType {
+	case spInt8:
+		text = strconv.FormatInt(int64(int8(uint8(m.IntValue))), 10)
+	case spInt16:
+		text = strconv.FormatInt(int64(int16(uint16(m.IntValue))), 10)
+	case spInt32:
+		text = strconv.FormatInt(int64(int32(m.IntValue)), 10)
+	case spInt64:
+		text = strconv.FormatInt(int64(m.LongValue), 10)
+	case spUInt8, spUInt16, spUInt32:
+		text = strconv.FormatUint(uint64(m.IntValue), 10)
+	case spUInt64:
+		text = strconv.FormatUint(m.LongValue, 10)
+	case spFloat:
+		text = strconv.FormatFloat(float64(m.FloatValue), 'f', -1, 32)
+	case spDouble:
+		text = strconv.FormatFloat(m.DoubleValue, 'f', -1, 64)
+	case spBoolean:
+		text = strconv.FormatBool(m.BoolValue)
+	case spString, spText, spUUID:
+		text = m.StringValue
+	default:
+		return spValue{}, false
+	}
+
+	at := receivedAt
+	switch {
+	case m.Timestamp != 0:
+		at = time.UnixMilli(int64(m.Timestamp)).UTC()
+	case p.Timestamp != 0:
+		at = time.UnixMilli(int64(p.Timestamp)).UTC()
+	}
+
+	return spValue{
+		Topic:      t.base() + "/" + def.Name,
+		Payload:    []byte(text),
+		At:         at,
+		Historical: m.IsHistorical,
+	}, true
+}
+
+// Délky sloupců v DB (postgres.sql): sensor_types.name a unit VARCHAR(50), sensors.friendly_name
+// VARCHAR(100). Přesah by shodil transakci registrace celého BIRTH.
+const (
+	spMaxTypeName     = 50
+	spMaxUnit         = 50
+	spMaxFriendlyName = 100
+)
+
+// spSensorSpec sestaví senzor pro automatickou registraci z metriky v BIRTH.
+// Typ senzoru je společný pro druh hodnoty a jednotku (vlastnost engUnit), např. "sparkplug_number_°C".
+func spSensorSpec(t spTopic, m spMetric, kind string) SensorSpec {
+	// Jméno typu z CELÉ jednotky (i když se do 'unit' vejde jen začátek)
+	typeName := spTypeName(kind, m.Properties["engUnit"])
+	unit := truncateRunes(m.Properties["engUnit"], spMaxUnit)
+
+	name := m.Name
+	if t.Device != "" {
+		name = t.Device + " " + m.Name
+	}
+	name = truncateRunes(name, spMaxFriendlyName)
+	return SensorSpec{
+		Topic:        t.base() + "/" + m.Name,
+		FriendlyName: name,
+		Type: SensorTypeSpec{
+			Name:        typeName,
+			Unit:        unit,
+			Description: "Sparkplug B metrika",
+			ValueKind:   kind,
+		},
+	}
+}
+
+// spTypeName sestaví jméno typu "sparkplug_<druh>_<jednotka>". Když by bylo delší než
+// spMaxTypeName, jednotka se zkrátí a doplní hashem celé jednotky - dvě dlouhé jednotky se
+// stejným začátkem tak nesplynou do jednoho typu. Jednotka sama zůstává v 'unit'.
+func spTypeName(kind, unit string) string {
+	name := "sparkplug_" + kind
+	if unit == "" {
+		return name
+	}
+	name += "_"
+	if utf8.RuneCountInString(name)+utf8.RuneCountInString(unit) <= spMaxTypeName {
+		return name + unit
+	}
+	sum := sha256.Sum256([]byte(unit))
+	suffix := "~" + hex.EncodeToString(sum[:4])
+	return name + truncateRunes(unit, spMaxTypeName-utf8.RuneCountInString(name)-len(suffix)) + suffix
+}
+
+// truncateRunes zkrátí text na nejvýše n znaků (VARCHAR v Postgres počítá znaky, ne bajty).
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
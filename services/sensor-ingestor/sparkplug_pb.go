@@ -0,0 +1,285 @@
+package ingestor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// --- SPARKPLUG B: PROTOBUF ---
+// Payload Sparkplug B je protobuf zpráva podle sparkplug_b.proto (Eclipse Tahu). Potřebujeme
+// z ní jen pár polí, proto ji čteme přímo z drátového formátu - bez generovaného kódu
+// a bez další závislosti. Neznámá pole (DataSet, Template, metadata...) přeskakujeme.
+//
+// Drátový formát: každé pole začíná klíčem (varint = číslo_pole<<3 | typ) a za ním hodnota:
+//
+//	typ 0 = varint, 1 = 8 bajtů (double), 2 = délka + bajty (string, vnořená zpráva), 5 = 4 bajty (float)
+
+// Typy hodnot metrik (Sparkplug DataType).
+const (
+	spInt8     = 1
+	spInt16    = 2
+	spInt32    = 3
+	spInt64    = 4
+	spUInt8    = 5
+	spUInt16   = 6
+	spUInt32   = 7
+	spUInt64   = 8
+	spFloat    = 9
+	spDouble   = 10
+	spBoolean  = 11
+	spString   = 12
+	spDateTime = 13
+	spText     = 14
+	spUUID     = 15
+)
+
+// Drátové typy protobufu.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// spPayload je dekódovaný Payload (jen pole, která používáme).
+type spPayload struct {
+	Timestamp uint64 // ms od epochy, 0 = chybí
+	Seq       uint64
+	HasSeq    bool
+	Metrics   []spMetric
+}
+
+// spMetric je jedna metrika. Hodnota je v poli podle typu (DataType); IsNull = bez hodnoty.
+type spMetric struct {
+	Name         string
+	Alias        uint64
+	HasAlias     bool
+	Timestamp    uint64
+	DataType     uint32
+	IsHistorical bool
+	IsNull       bool
+
+	IntValue    uint32 // Int8-32, UInt8-32 (znaménkové typy ve dvojkovém doplňku)
+	LongValue   uint64 // Int64, UInt64, DateTime
+	FloatValue  float32
+	DoubleValue float64
+	BoolValue   bool
+	StringValue string
+	HasValue    bool // Přišla některá z hodnot výše
+
+	Properties map[string]string // Textové vlastnosti metriky (např. engUnit)
+}
+
+// errTruncated: Zpráva skončila uprostřed pole.
+var errTruncated = errors.New("zkrácená protobuf zpráva")
+
+// pbField je jedno přečtené pole zprávy.
+type pbField struct {
+	Num   uint64
+	Wire  uint64
+	Int   uint64 // varint, fixed32, fixed64
+	Bytes []byte // wireBytes
+}
+
+// pbReader čte pole protobuf zprávy jedno po druhém.
+type pbReader struct {
+	buf []byte
+}
+
+// next vrátí další pole. ok = false na konci zprávy.
+func (r *pbReader) next() (f pbField, ok bool, err error) {
+	if len(r.buf) == 0 {
+		return f, false, nil
+	}
+	key, err := r.varint()
+	if err != nil {
+		return f, false, err
+	}
+	f.Num, f.Wire = key>>3, key&7
+
+	switch f.Wire {
+	case wireVarint:
+		f.Int, err = r.varint()
+	case wireFixed64:
+		if len(r.buf) < 8 {
+			return f, false, errTruncated
+		}
+		f.Int, r.buf = binary.LittleEndian.Uint64(r.buf), r.buf[8:]
+	case wireFixed32:
+		if len(r.buf) < 4 {
+			return f, false, errTruncated
+		}
+		f.Int, r.buf = uint64(binary.LittleEndian.Uint32(r.buf)), r.buf[4:]
+	case wireBytes:
+		var n uint64
+		if n, err = r.varint(); err != nil {
+			return f, false, err
+		}
+		if n > uint64(len(r.buf)) {
+			return f, false, errTruncated
+		}
+		f.Bytes, r.buf = r.buf[:n], r.buf[n:]
+	default:
+		// Skupiny (typ 3/4) Sparkplug nepoužívá
+		return f, false, fmt.Errorf("nepodporovaný drátový typ %d (pole %d)", f.Wire, f.Num)
+	}
+	return f, err == nil, err
+}
+
+// varint přečte číslo v kódování varint (7 bitů na bajt, nejnižší napřed).
+func (r *pbReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		return 0, errTruncated
+	}
+	r.buf = r.buf[n:]
+	return v, nil
+}
+
+// decodeSparkplug dekóduje Payload zprávy Sparkplug B.
+func decodeSparkplug(data []byte) (*spPayload, error) {
+	p := &spPayload{}
+	r := pbReader{buf: data}
+	for {
+		f, ok, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return p, nil
+		}
+		switch {
+		case f.Num == 1 && f.Wire == wireVarint:
+			p.Timestamp = f.Int
+		case f.Num == 2 && f.Wire == wireBytes:
+			m, err := decodeMetric(f.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("metrika %d: %w", len(p.Metrics)+1, err)
+			}
+			p.Metrics = append(p.Metrics, m)
+		case f.Num == 3 && f.Wire == wireVarint:
+			p.Seq, p.HasSeq = f.Int, true
+		}
+	}
+}
+
+// decodeMetric dekóduje zprávu Metric.
+func decodeMetric(data []byte) (spMetric, error) {
+	var m spMetric
+	r := pbReader{buf: data}
+	for {
+		f, ok, err := r.next()
+		if err != nil {
+			return m, err
+		}
+		if !ok {
+			return m, nil
+		}
+		switch f.Num {
+		case 1:
+			m.Name = string(f.Bytes)
+		case 2:
+			m.Alias, m.HasAlias = f.Int, true
+		case 3:
+			m.Timestamp = f.Int
+		case 4:
+			m.DataType = uint32(f.Int)
+		case 5:
+			m.IsHistorical = f.Int != 0
+		case 7:
+			m.IsNull = f.Int != 0
+		case 9:
+			if m.Properties, err = decodeProperties(f.Bytes); err != nil {
+				return m, fmt.Errorf("vlastnosti: %w", err)
+			}
+		case 10:
+			m.IntValue, m.HasValue = uint32(f.Int), true
+		case 11:
+			m.LongValue, m.HasValue = f.Int, true
+		case 12:
+			m.FloatValue, m.HasValue = math.Float32frombits(uint32(f.Int)), true
+		case 13:
+			m.DoubleValue, m.HasValue = math.Float64frombits(f.Int), true
+		case 14:
+			m.BoolValue, m.HasValue = f.Int != 0, true
+		case 15:
+			m.StringValue, m.HasValue = string(f.Bytes), true
+		}
+	}
+}
+
+// decodeProperties přečte PropertySet (paralelní seznamy klíčů a hodnot). Zajímají nás jen
+// textové hodnoty (engUnit, description) - ostatní typy vlastností přeskočíme.
+func decodeProperties(data []byte) (map[string]string, error) {
+	var keys []string
+	var values []string
+	r := pbReader{buf: data}
+	for {
+		f, ok, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		switch f.Num {
+		case 1:
+			keys = append(keys, string(f.Bytes))
+		case 2:
+			// PropertyValue: string_value je pole 8
+			var value string
+			vr := pbReader{buf: f.Bytes}
+			for {
+				vf, ok, err := vr.next()
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					break
+				}
+				if vf.Num == 8 && vf.Wire == wireBytes {
+					value = string(vf.Bytes)
+				}
+			}
+			values = append(values, value)
+		}
+	}
+
+	props := make(map[string]string)
+	for i, k := range keys {
+		if i < len(values) && values[i] != "" {
+			props[k] = values[i]
+		}
+	}
+	return props, nil
+}
+
+// encodeRebirth sestaví Payload příkazu NCMD "Node Control/Rebirth" = true
+// (žádost, aby edge node znovu poslal NBIRTH a DBIRTH).
+func encodeRebirth(timestampMs uint64) []byte {
+	var metric []byte
+	metric = appendBytesField(metric, 1, []byte(spRebirthMetric))
+	metric = appendVarintField(metric, 3, timestampMs)
+	metric = appendVarintField(metric, 4, spBoolean)
+	metric = appendVarintField(metric, 14, 1)
+
+	var payload []byte
+	payload = appendVarintField(payload, 1, timestampMs)
+	payload = appendBytesField(payload, 2, metric)
+	return payload
+}
+
+// appendVarintField připojí pole typu varint.
+func appendVarintField(buf []byte, num, v uint64) []byte {
+	buf = binary.AppendUvarint(buf, num<<3|wireVarint)
+	return binary.AppendUvarint(buf, v)
+}
+
+// appendBytesField připojí pole typu délka + bajty.
+func appendBytesField(buf []byte, num uint64, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, num<<3|wireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
@@ -0,0 +1,205 @@
+package ingestor
+
+import (
+	"encoding/hex"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// Testovací payloady odpovídají sparkplug_b.proto z Eclipse Tahu (stejné zprávy, jaké posílají
+// Tahu klienti). Zakódované jsou referenční protobuf knihovnou (google.golang.org/protobuf)
+// z deskriptoru Tahu, deterministicky - bajty se mezi běhy nemění.
+//
+// Znaménkové typy posílají Tahu klienti dvojím způsobem: Java zapisuje int8/16/32 do uint32
+// jako 32bitový dvojkový doplněk (-2 = 0xFFFFFFFE), Python jako doplněk v šířce typu (-128 = 0x80).
+// Dekodér musí zvládnout obojí.
+
+// spNBirthHex: NBIRTH uzlu se seq 0.
+//   - bdSeq (UInt64 3) a Node Control/Rebirth (Boolean false) bez aliasu
+//   - Sensors/Temperature alias 2, Float 21.5, vlastnosti engUnit "°C" (string) a Quality 192 (int)
+//   - Sensors/Offset alias 3, Int8 -2 (Java: 0xFFFFFFFE)
+//   - Sensors/Delta alias 4, Int16 -300 (Python: 65236)
+//   - Sensors/Power alias 5, Int32 -1500
+//   - Sensors/Energy alias 6, Int64 -42
+//   - Properties/Firmware alias 7, String "1.4.2" s metadaty (popis)
+const spNBirthHex = "0880d095ffbc3112120a0562645365711880d095ffbc312008580312210a144e6f646520436f6e74726f6c2f52656269727468" +
+	"1880d095ffbc31200b700012490a1353656e736f72732f54656d706572617475726510021880d095ffbc3120094a220a07656e67556e69" +
+	"740a075175616c6974791207080c4203c2b0431205080318c001650000ac4112210a0e53656e736f72732f4f666673657410031880d095" +
+	"ffbc31200150feffffff0f121e0a0d53656e736f72732f44656c746110041880d095ffbc31200250d4fd0312200a0d53656e736f7273" +
+	"2f506f77657210051880d095ffbc31200350a4f4ffff0f12260a0e53656e736f72732f456e6572677910061880d095ffbc31200458d6ff" +
+	"ffffffffffffff0112390a1350726f706572746965732f4669726d7761726510071880d095ffbc31200c4210420e7665727a6520666972" +
+	"6d776172757a05312e342e321800"
+
+// spDDataHex: DDATA se seq 1, metriky jen aliasem.
+//   - alias 2 Float -3.25
+//   - alias 3 Int8 -128 (Python: 0x80)
+//   - alias 5 Int32 MinInt32
+//   - alias 6 Int64 MinInt64
+//   - alias 4 Int16 is_null
+//   - alias 2 Float 20, is_historical, vlastní časová značka
+const spDDataHex = "0888f795ffbc31121010021888f795ffbc31200965000050c0120e10031888f795ffbc312001508001121110051888f795ffbc312003" +
+	"508080808008121610061888f795ffbc3120045880808080808080808001120d10041888f795ffbc31200238011212100218e8d795ff" +
+	"bc3120092801650000a0411801"
+
+// spNDeathHex: NDEATH (Last Will uzlu) - jen bdSeq, bez seq.
+const spNDeathHex = "08a89696ffbc3112120a05626453657118a89696ffbc3120085803"
+
+// spTestTimestamp: Časová značka NBIRTH v payloadech výše (ms od epochy).
+const spTestTimestamp = 1700000000000
+
+func decodeHex(t *testing.T, s string) *spPayload {
+	t.Helper()
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("neplatný hex: %v", err)
+	}
+	p, err := decodeSparkplug(data)
+	if err != nil {
+		t.Fatalf("decodeSparkplug: %v", err)
+	}
+	return p
+}
+
+func TestDecodeSparkplugNBirth(t *testing.T) {
+	p := decodeHex(t, spNBirthHex)
+
+	if p.Timestamp != spTestTimestamp || !p.HasSeq || p.Seq != 0 {
+		t.Fatalf("hlavička: timestamp=%d seq=%d hasSeq=%v", p.Timestamp, p.Seq, p.HasSeq)
+	}
+	if len(p.Metrics) != 8 {
+		t.Fatalf("počet metrik: %d, čekáno 8", len(p.Metrics))
+	}
+
+	bdSeq := p.Metrics[0]
+	if bdSeq.Name != "bdSeq" || bdSeq.HasAlias || bdSeq.DataType != spUInt64 || bdSeq.LongValue != 3 {
+		t.Errorf("bdSeq: %+v", bdSeq)
+	}
+	rebirth := p.Metrics[1]
+	if rebirth.Name != spRebirthMetric || rebirth.DataType != spBoolean || !rebirth.HasValue || rebirth.BoolValue {
+		t.Errorf("rebirth: %+v", rebirth)
+	}
+
+	temp := p.Metrics[2]
+	if temp.Name != "Sensors/Temperature" || !temp.HasAlias || temp.Alias != 2 || temp.DataType != spFloat {
+		t.Errorf("teplota: %+v", temp)
+	}
+	if temp.FloatValue != 21.5 || temp.Timestamp != spTestTimestamp {
+		t.Errorf("teplota: hodnota %v, čas %d", temp.FloatValue, temp.Timestamp)
+	}
+	// Textová vlastnost se přečte, číselná (Quality) se přeskočí
+	if temp.Properties["engUnit"] != "°C" {
+		t.Errorf("engUnit: %q", temp.Properties["engUnit"])
+	}
+	if _, ok := temp.Properties["Quality"]; ok {
+		t.Errorf("číselná vlastnost Quality nemá být v mapě: %v", temp.Properties)
+	}
+
+	// Metadata (pole 8) se přeskočí, hodnota za nimi se přečte
+	fw := p.Metrics[7]
+	if fw.Name != "Properties/Firmware" || fw.Alias != 7 || fw.DataType != spString || fw.StringValue != "1.4.2" {
+		t.Errorf("firmware: %+v", fw)
+	}
+}
+
+func TestDecodeSparkplugDData(t *testing.T) {
+	p := decodeHex(t, spDDataHex)
+
+	if !p.HasSeq || p.Seq != 1 || len(p.Metrics) != 6 {
+		t.Fatalf("hlavička: seq=%d hasSeq=%v metrik=%d", p.Seq, p.HasSeq, len(p.Metrics))
+	}
+	for i, m := range p.Metrics {
+		if m.Name != "" || !m.HasAlias {
+			t.Errorf("metrika %d: DDATA má posílat jen alias, je %+v", i, m)
+		}
+	}
+	if m := p.Metrics[0]; m.Alias != 2 || m.FloatValue != -3.25 {
+		t.Errorf("alias 2: %+v", m)
+	}
+	if m := p.Metrics[4]; m.Alias != 4 || !m.IsNull || m.HasValue {
+		t.Errorf("null metrika: %+v", m)
+	}
+	if m := p.Metrics[5]; !m.IsHistorical || m.FloatValue != 20 || m.Timestamp != spTestTimestamp+1000 {
+		t.Errorf("historická metrika: %+v", m)
+	}
+}
+
+func TestDecodeSparkplugNDeath(t *testing.T) {
+	p := decodeHex(t, spNDeathHex)
+
+	if p.HasSeq {
+		t.Errorf("NDEATH nemá seq, dekodér hlásí %d", p.Seq)
+	}
+	if len(p.Metrics) != 1 || p.Metrics[0].Name != "bdSeq" || p.Metrics[0].LongValue != 3 {
+		t.Fatalf("bdSeq: %+v", p.Metrics)
+	}
+}
+
+func TestSparkplugSignedValues(t *testing.T) {
+	birth := decodeHex(t, spNBirthHex)
+	data := decodeHex(t, spDDataHex)
+	topic := spTopic{Group: "plant", Type: "DDATA", Node: "edge1", Device: "meter"}
+
+	cases := []struct {
+		name   string
+		metric spMetric
+		want   string
+	}{
+		{"Int8 Java -2", birth.Metrics[3], "-2"},
+		{"Int8 Python -128", data.Metrics[1], "-128"},
+		{"Int16 Python -300", birth.Metrics[4], "-300"},
+		{"Int32 -1500", birth.Metrics[5], "-1500"},
+		{"Int32 min", data.Metrics[2], "-2147483648"},
+		{"Int64 -42", birth.Metrics[6], "-42"},
+		{"Int64 min", data.Metrics[3], "-9223372036854775808"},
+		{"UInt32 max", spMetric{DataType: spUInt32, IntValue: math.MaxUint32, HasValue: true}, "4294967295"},
+		{"UInt64 max", spMetric{DataType: spUInt64, LongValue: math.MaxUint64, HasValue: true}, "18446744073709551615"},
+		{"Float", data.Metrics[0], "-3.25"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// Typ z BIRTH se použije, když ho DATA zpráva neposílá
+			def := spMetricDef{Name: "x", DataType: c.metric.DataType}
+			v, ok := spMetricValue(topic, c.metric, def, data, time.Now())
+			if !ok {
+				t.Fatalf("hodnota nepřečtena: %+v", c.metric)
+			}
+			if string(v.Payload) != c.want {
+				t.Errorf("hodnota %q, čekáno %q", v.Payload, c.want)
+			}
+		})
+	}
+
+	// Null metrika hodnotu nemá
+	if _, ok := spMetricValue(topic, data.Metrics[4], spMetricDef{Name: "x", DataType: spInt16}, data, time.Now()); ok {
+		t.Error("null metrika nemá vracet hodnotu")
+	}
+}
+
+func TestEncodeRebirthRoundTrip(t *testing.T) {
+	const ts = uint64(spTestTimestamp + 42)
+	p, err := decodeSparkplug(encodeRebirth(ts))
+	if err != nil {
+		t.Fatalf("decodeSparkplug(encodeRebirth): %v", err)
+	}
+	if p.Timestamp != ts || p.HasSeq {
+		t.Errorf("hlavička: timestamp=%d hasSeq=%v (NCMD seq nemá)", p.Timestamp, p.HasSeq)
+	}
+	if len(p.Metrics) != 1 {
+		t.Fatalf("počet metrik: %d", len(p.Metrics))
+	}
+	m := p.Metrics[0]
+	if m.Name != spRebirthMetric || m.DataType != spBoolean || !m.HasValue || !m.BoolValue || m.Timestamp != ts {
+		t.Errorf("metrika rebirth: %+v", m)
+	}
+}
+
+func TestDecodeSparkplugTruncated(t *testing.T) {
+	data, _ := hex.DecodeString(spNBirthHex)
+	for _, n := range []int{1, 20, len(data) - 1} {
+		if _, err := decodeSparkplug(data[:n]); !errors.Is(err, errTruncated) {
+			t.Errorf("zkrácení na %d bajtů: chyba %v, čekáno %v", n, err, errTruncated)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package ingestor
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSparkplugSensorSpecLimits(t *testing.T) {
+	topic := spTopic{Group: "plant", Type: "DBIRTH", Node: "edge1", Device: strings.Repeat("d", 80)}
+	longUnit := "kilowatthodiny na metr krychlový zemního plynu při 15 °C"
+	metric := func(unit string) spMetric {
+		return spMetric{Name: strings.Repeat("m", 60), Properties: map[string]string{"engUnit": unit}}
+	}
+
+	// Krátká jednotka zůstane ve jménu typu celá
+	if got := spSensorSpec(topic, metric("°C"), "number").Type.Name; got != "sparkplug_number_°C" {
+		t.Errorf("jméno typu: %q", got)
+	}
+
+	spec := spSensorSpec(topic, metric(longUnit), "number")
+	if n := utf8.RuneCountInString(spec.Type.Name); n > spMaxTypeName {
+		t.Errorf("jméno typu má %d znaků (max %d): %q", n, spMaxTypeName, spec.Type.Name)
+	}
+	if spec.Type.Unit != truncateRunes(longUnit, spMaxUnit) {
+		t.Errorf("jednotka: %q", spec.Type.Unit)
+	}
+	if n := utf8.RuneCountInString(spec.FriendlyName); n > spMaxFriendlyName {
+		t.Errorf("název senzoru má %d znaků (max %d)", n, spMaxFriendlyName)
+	}
+
+	// Dlouhé jednotky se stejným začátkem nesmí splynout do jednoho typu
+	other := spSensorSpec(topic, metric("kilowatthodiny na metr krychlový zemního plynu při 20 °C"), "number")
+	if other.Type.Name == spec.Type.Name {
+		t.Errorf("různé jednotky, stejný typ %q", spec.Type.Name)
+	}
+}
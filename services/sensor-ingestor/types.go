@@ -1,6 +1,10 @@
-package main
+package ingestor
 
-import "time"
+import (
+	"time"
+
+	"storage"
+)
 
 // SensorEvent je finální struktura, kterou posíláme dál do systému (do fronty events/...).
 // Oproti původní verzi zde už není string 'SensorID', ale int64.
@@ -10,8 +14,22 @@ type SensorEvent struct {
 	SensorID int64 `json:"sensor_id"`
 
 	// Value: Naměřená hodnota (teplota, tlak...).
+	// U nečíselných senzorů číselná podoba stavu (boolean = 1/0, ostatní 0) - viz State.
 	Value float64 `json:"value"`
 
+	// State: Hodnota nečíselného senzoru (boolean, enum, text, geo). nil = číselný senzor.
+	State *storage.State `json:"state,omitempty"`
+
 	// Timestamp: Čas měření. Vždy v UTC pro konzistenci napříč časovými pásmy.
 	Timestamp time.Time `json:"timestamp"`
+
+	// Quality: Příznaky kvality hodnoty (viz konstanty Quality*). Prázdné = hodnota bez výhrad.
+	Quality []string `json:"quality,omitempty"`
 }
+
+// Příznaky kvality (SensorEvent.Quality). Persister je uloží k poslední hodnotě
+// a dashboard je zobrazí u senzoru.
+const (
+	QualitySuspect     = "suspect"     // Filtr špiček hodnotu označil (akce 'flag'), ale propustil
+	QualityResubmitted = "resubmitted" // Znovu odeslaná zpráva z dead-letteru (původní čas přijetí)
+)
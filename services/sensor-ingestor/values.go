@@ -0,0 +1,160 @@
+package ingestor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"storage"
+)
+
+// --- NEČÍSELNÉ HODNOTY ---
+// Druh hodnoty patří typu senzoru (sensor_types.value_kind, viz postgres.sql sekce 18).
+// Číselné senzory jdou původní cestou (kalibrace, limity, filtry). Ostatní druhy se jen
+// přečtou a zvalidují - výsledkem je storage.State, který putuje v SensorEvent.State.
+
+// maxTextLength: Delší text je skoro jistě chyba zařízení (nebo binární smetí).
+const maxTextLength = 256
+
+// boolWords: Payloady, které zařízení běžně posílají pro dvoustavové hodnoty (malými písmeny).
+var boolWords = map[string]bool{
+	"true": true, "on": true, "1": true, "yes": true, "open": true, "opened": true,
+	"false": false, "off": false, "0": false, "no": false, "closed": false, "close": false,
+}
+
+// unwrapValue vybalí hodnotu z JSON obálky {"value": 1, "correlation_id": "..."}, kterou
+// zařízení potvrzují příkazy (home-api/commands.go) na svém state topicu - potvrzení je zároveň
+// nový stav a musí projít stejnou cestou jako prostý payload "1". Textová hodnota se vrací
+// bez uvozovek ({"value":"armed_home"} -> armed_home). Ostatní payloady (i JSON polohy, který
+// klíč 'value' nemá) vrací beze změny.
+func unwrapValue(payload []byte) []byte {
+	raw := bytes.TrimSpace(payload)
+	if len(raw) == 0 || raw[0] != '{' {
+		return payload
+	}
+	var msg struct {
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &msg); err != nil || len(msg.Value) == 0 || string(msg.Value) == "null" {
+		return payload
+	}
+	var text string
+	if json.Unmarshal(msg.Value, &text) == nil {
+		return []byte(text)
+	}
+	return msg.Value
+}
+
+// parseState přečte payload podle druhu hodnoty senzoru. Chyba = neplatná hodnota
+// (volající ji odmítne s ReasonInvalidValue).
+func parseState(meta SensorMetadata, payload []byte) (*storage.State, error) {
+	raw := strings.TrimSpace(string(payload))
+	state := &storage.State{Kind: meta.Kind}
+
+	switch meta.Kind {
+	case storage.KindBoolean:
+		b, ok := boolWords[strings.ToLower(raw)]
+		if !ok {
+			return nil, fmt.Errorf("hodnota '%s' není dvoustavová (true/false, on/off, 1/0, open/closed)", raw)
+		}
+		state.Bool = &b
+
+	case storage.KindEnum:
+		// Stav porovnáváme přesně - "armed_home" a "Armed_Home" jsou pro nás různé hodnoty.
+		if !slices.Contains(meta.EnumValues, raw) {
+			return nil, fmt.Errorf("stav '%s' není mezi povolenými %v", raw, meta.EnumValues)
+		}
+		state.Text = &raw
+
+	case storage.KindText:
+		if !utf8.ValidString(raw) {
+			return nil, fmt.Errorf("text není platné UTF-8")
+		}
+		if len(raw) > maxTextLength {
+			return nil, fmt.Errorf("text je delší než %d B (%d B)", maxTextLength, len(raw))
+		}
+		state.Text = &raw
+
+	case storage.KindGeo:
+		geo, err := parseGeo(raw)
+		if err != nil {
+			return nil, err
+		}
+		state.Geo = geo
+
+	default:
+		return nil, fmt.Errorf("neznámý druh hodnoty %q", meta.Kind)
+	}
+	return state, nil
+}
+
+// parseGeo přečte polohu jako JSON {"lat":50.08,"lon":14.42,"alt":240,"acc":5}
+// (typicky GPS tracker přes OwnTracks/Tasmotu) nebo jako text "50.08,14.42[,240]".
+func parseGeo(raw string) (*storage.GeoPoint, error) {
+	var geo storage.GeoPoint
+	if strings.HasPrefix(raw, "{") {
+		// Pointery rozliší chybějící souřadnici od nuly (0,0 je platné místo v Guinejském zálivu).
+		var in struct {
+			Lat *float64 `json:"lat"`
+			Lon *float64 `json:"lon"`
+			Alt *float64 `json:"alt"`
+			Acc *float64 `json:"acc"`
+		}
+		if err := json.Unmarshal([]byte(raw), &in); err != nil {
+			return nil, fmt.Errorf("poloha není platný JSON: %w", err)
+		}
+		if in.Lat == nil || in.Lon == nil {
+			return nil, fmt.Errorf("poloha musí obsahovat 'lat' i 'lon'")
+		}
+		geo = storage.GeoPoint{Lat: *in.Lat, Lon: *in.Lon, Alt: in.Alt, Acc: in.Acc}
+	} else {
+		parts := strings.Split(raw, ",")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("poloha '%s' není ve tvaru 'lat,lon[,alt]'", raw)
+		}
+		nums := make([]float64, len(parts))
+		for i, p := range parts {
+			v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil {
+				return nil, fmt.Errorf("souřadnice '%s' není číslo", p)
+			}
+			nums[i] = v
+		}
+		geo = storage.GeoPoint{Lat: nums[0], Lon: nums[1]}
+		if len(nums) == 3 {
+			geo.Alt = &nums[2]
+		}
+	}
+
+	// Rozsahy WGS84. NaN/Inf neprojdou žádným z porovnání, proto je kontrolujeme zvlášť.
+	for _, v := range []float64{geo.Lat, geo.Lon} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("souřadnice není konečné číslo")
+		}
+	}
+	if geo.Lat < -90 || geo.Lat > 90 {
+		return nil, fmt.Errorf("zeměpisná šířka %.6f je mimo rozsah -90..90", geo.Lat)
+	}
+	if geo.Lon < -180 || geo.Lon > 180 {
+		return nil, fmt.Errorf("zeměpisná délka %.6f je mimo rozsah -180..180", geo.Lon)
+	}
+	if geo.Acc != nil && *geo.Acc < 0 {
+		return nil, fmt.Errorf("přesnost polohy nesmí být záporná")
+	}
+	return &geo, nil
+}
+
+// stateValue: Číselná podoba stavu pro SensorEvent.Value. Dvoustavová hodnota je 1/0,
+// takže s ní pravidla (rules-engine) a virtuální senzory pracují jako dřív se 'switch'.
+// Ostatní druhy číselnou podobu nemají (0).
+func stateValue(st *storage.State) float64 {
+	if st.Bool != nil && *st.Bool {
+		return 1
+	}
+	return 0
+}
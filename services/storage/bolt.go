@@ -0,0 +1,459 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bolt je vestavěný backend: jeden soubor (bbolt = B+strom, čisté Go, bez CGO).
+// Nepotřebuje žádný server - vhodný pro malé instalace a testovací běhy.
+//
+// POZOR: Soubor může mít otevřený jen JEDEN proces (zámek souboru). Proto dává smysl
+// hlavně v režimu all-in-one, kde ingestor, persister i Home API sdílejí jednu instanci.
+//
+// Uspořádání souboru (buckety):
+//
+//	types   : název typu       -> JSON boltType (jednotka, limity)
+//	sensors : ID (8 B)         -> JSON boltSensor
+//	topics  : MQTT topic       -> ID (8 B)          (index pro EnsureSensor)
+//	series  : ID (8 B)         -> pod-bucket { čas (8 B) -> hodnota (8 B) }
+//	states  : ID (8 B)         -> pod-bucket { čas (8 B) -> JSON State }   (nečíselné senzory)
+//	latest  : ID (8 B)         -> JSON boltLatest (hodnota, čas, kvalita, seq, vypršení)
+//
+// Klíče jsou big-endian, takže bbolt je drží seřazené - průchod kurzorem jde podle ID/času.
+type Bolt struct {
+	db        *bolt.DB
+	retention time.Duration
+
+	stop chan struct{}  // Ukončí goroutinu retence
+	wg   sync.WaitGroup // Close čeká na její doběhnutí
+}
+
+var (
+	bucketTypes   = []byte("types")
+	bucketSensors = []byte("sensors")
+	bucketTopics  = []byte("topics")
+	bucketSeries  = []byte("series")
+	bucketStates  = []byte("states")
+	bucketLatest  = []byte("latest")
+)
+
+// boltType a boltSensor jsou uložené podoby záznamů (JSON - čitelné i nástrojem 'bbolt').
+type boltType struct {
+	Unit              *string  `json:"unit,omitempty"`
+	MinValue          *float64 `json:"min_value,omitempty"`
+	MaxValue          *float64 `json:"max_value,omitempty"`
+	StaleAfterSeconds int64    `json:"stale_after_seconds,omitempty"`
+	Kind              string   `json:"kind,omitempty"` // "" = number
+	EnumValues        []string `json:"enum_values,omitempty"`
+	Counter           bool     `json:"counter,omitempty"`
+	CounterMax        *float64 `json:"counter_max,omitempty"`
+}
+
+type boltLatest struct {
+	Value     float64   `json:"v"`
+	Time      time.Time `json:"t"`
+	Quality   []string  `json:"q,omitempty"`
+	State     *State    `json:"s,omitempty"`
+	Seq       int64     `json:"seq"`
+	ExpiresAt time.Time `json:"exp"` // Stejné chování jako TTL klíče ve Valkey
+}
+
+type boltSensor struct {
+	Topic  string `json:"topic"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Active bool   `json:"active"`
+}
+
+// OpenBolt otevře (nebo vytvoří) soubor databáze. retention > 0 zapne mazání starých bodů
+// (při otevření a pak pravidelně na pozadí).
+func OpenBolt(path string, retention time.Duration) (*Bolt, error) {
+	if path == "" {
+		return nil, fmt.Errorf("cesta k souboru bolt databáze není nastavena")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("nelze vytvořit adresář pro %s: %w", path, err)
+	}
+
+	// Timeout: pokud soubor drží jiný proces, nečekáme na zámek věčně.
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("nelze otevřít %s (nepoužívá ho jiný proces?): %w", path, err)
+	}
+
+	// Buckety založíme hned, ať je zbytek kódu nemusí kontrolovat.
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketTypes, bucketSensors, bucketTopics, bucketSeries, bucketStates, bucketLatest} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("inicializace %s selhala: %w", path, err)
+	}
+
+	b := &Bolt{db: db, retention: retention, stop: make(chan struct{})}
+	if retention > 0 {
+		b.wg.Add(1)
+		go b.retentionLoop()
+	}
+	return b, nil
+}
+
+// Close zastaví retenci a zavře soubor.
+func (b *Bolt) Close() error {
+	close(b.stop)
+	b.wg.Wait()
+	return b.db.Close()
+}
+
+// retentionLoop maže body starší než retence. Interval = desetina retence (1 min až 1 h),
+// takže data nikdy nepřesáhnou retenci o víc než ~10 %.
+func (b *Bolt) retentionLoop() {
+	defer b.wg.Done()
+
+	interval := min(max(b.retention/10, time.Minute), time.Hour)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if deleted, err := b.Prune(time.Now().Add(-b.retention)); err != nil {
+			slog.Error("Retence bolt úložiště selhala", "error", err)
+		} else if deleted > 0 {
+			slog.Info("Retence bolt úložiště: smazány staré body", "deleted", deleted, "retention", b.retention)
+		}
+
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prune smaže body historie (čísla i stavy) starší než 'before' (všechny senzory).
+// Vrací počet smazaných bodů.
+func (b *Bolt) Prune(before time.Time) (int, error) {
+	deleted := 0
+	limit := timeKey(before)
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketSeries, bucketStates} {
+			if err := pruneBucket(tx.Bucket(name), limit[:], &deleted); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// pruneBucket smaže z pod-bucketů 'series' (jeden na senzor) klíče menší než 'limit'.
+func pruneBucket(series *bolt.Bucket, limit []byte, deleted *int) error {
+	return series.ForEachBucket(func(id []byte) error {
+		bucket := series.Bucket(id)
+		// Klíče jsou seřazené podle času - staré body jsou na začátku.
+		// Nejdřív je posbíráme (kopie klíčů), mazání během průchodu kurzorem je křehké.
+		var old [][]byte
+		c := bucket.Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, limit) < 0; k, _ = c.Next() {
+			old = append(old, bytes.Clone(k))
+		}
+		for _, k := range old {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		*deleted += len(old)
+		return nil
+	})
+}
+
+// --- KÓDOVÁNÍ KLÍČŮ ---
+
+func idKey(id int64) []byte {
+	var k [8]byte
+	binary.BigEndian.PutUint64(k[:], uint64(id))
+	return k[:]
+}
+
+// timeKey: Čas jako 8 B big-endian. Přehozený znaménkový bit zachová řazení i pro časy před rokem 1970.
+func timeKey(t time.Time) [8]byte {
+	var k [8]byte
+	binary.BigEndian.PutUint64(k[:], uint64(t.UnixNano())^(1<<63))
+	return k
+}
+
+func keyTime(k []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(k)^(1<<63))).UTC()
+}
+
+func floatBytes(v float64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], math.Float64bits(v))
+	return b[:]
+}
+
+func bytesFloat(b []byte) float64 {
+	return math.Float64frombits(binary.BigEndian.Uint64(b))
+}
+
+// --- METADATA ---
+
+// loadSensor spojí záznam senzoru s jeho typem (jako JOIN v SQL).
+func loadSensor(tx *bolt.Tx, id int64, raw []byte) (Sensor, error) {
+	var bs boltSensor
+	if err := json.Unmarshal(raw, &bs); err != nil {
+		return Sensor{}, fmt.Errorf("poškozený záznam senzoru %d: %w", id, err)
+	}
+	s := Sensor{ID: id, Topic: bs.Topic, Name: bs.Name, Type: bs.Type, Active: bs.Active}
+	if rawType := tx.Bucket(bucketTypes).Get([]byte(bs.Type)); rawType != nil {
+		var bt boltType
+		if err := json.Unmarshal(rawType, &bt); err != nil {
+			return Sensor{}, fmt.Errorf("poškozený záznam typu %q: %w", bs.Type, err)
+		}
+		s.Unit, s.MinValue, s.MaxValue = bt.Unit, bt.MinValue, bt.MaxValue
+		s.StaleAfter = time.Duration(bt.StaleAfterSeconds) * time.Second
+		s.Kind, s.EnumValues = bt.Kind, bt.EnumValues
+		s.Counter, s.CounterMax = bt.Counter, bt.CounterMax
+	}
+	if s.Kind == "" {
+		s.Kind = KindNumber
+	}
+	return s, nil
+}
+
+func (b *Bolt) ActiveSensors(ctx context.Context) ([]Sensor, error) {
+	var sensors []Sensor
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketSensors).ForEach(func(k, v []byte) error {
+			s, err := loadSensor(tx, int64(binary.BigEndian.Uint64(k)), v)
+			if err != nil {
+				return err
+			}
+			if s.Active {
+				sensors = append(sensors, s)
+			}
+			return nil
+		})
+	})
+	return sensors, err
+}
+
+func (b *Bolt) SensorByID(ctx context.Context, id int64) (Sensor, error) {
+	var s Sensor
+	err := b.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(bucketSensors).Get(idKey(id))
+		if raw == nil {
+			return ErrNotFound
+		}
+		var err error
+		s, err = loadSensor(tx, id, raw)
+		return err
+	})
+	return s, err
+}
+
+func (b *Bolt) EnsureSensor(ctx context.Context, s Sensor) (int64, bool, error) {
+	if s.Topic == "" || s.Type == "" {
+		return 0, false, fmt.Errorf("senzor musí mít topic i typ")
+	}
+	var id int64
+	created := false
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		// 1. Existující senzor (podle topicu) necháme beze změny
+		if existing := tx.Bucket(bucketTopics).Get([]byte(s.Topic)); existing != nil {
+			id = int64(binary.BigEndian.Uint64(existing))
+			return nil
+		}
+
+		// 2. Chybějící typ založíme (existující nepřepisujeme)
+		types := tx.Bucket(bucketTypes)
+		if types.Get([]byte(s.Type)) == nil {
+			rawType, err := json.Marshal(boltType{Unit: s.Unit, MinValue: s.MinValue, MaxValue: s.MaxValue,
+				StaleAfterSeconds: int64(s.StaleAfter / time.Second), Kind: s.Kind, EnumValues: s.EnumValues,
+				Counter: s.Counter, CounterMax: s.CounterMax})
+			if err != nil {
+				return err
+			}
+			if err := types.Put([]byte(s.Type), rawType); err != nil {
+				return err
+			}
+		}
+
+		// 3. Nový senzor s ID ze sekvence bucketu + index topicu
+		sensors := tx.Bucket(bucketSensors)
+		seq, err := sensors.NextSequence()
+		if err != nil {
+			return err
+		}
+		id = int64(seq)
+		raw, err := json.Marshal(boltSensor{Topic: s.Topic, Name: s.Name, Type: s.Type, Active: s.Active})
+		if err != nil {
+			return err
+		}
+		if err := sensors.Put(idKey(id), raw); err != nil {
+			return err
+		}
+		created = true
+		return tx.Bucket(bucketTopics).Put([]byte(s.Topic), idKey(id))
+	})
+	return id, created, err
+}
+
+func (b *Bolt) SetSensorActive(ctx context.Context, id int64, active bool) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		sensors := tx.Bucket(bucketSensors)
+		raw := sensors.Get(idKey(id))
+		if raw == nil {
+			return ErrNotFound
+		}
+		var bs boltSensor
+		if err := json.Unmarshal(raw, &bs); err != nil {
+			return fmt.Errorf("poškozený záznam senzoru %d: %w", id, err)
+		}
+		bs.Active = active
+		raw, err := json.Marshal(bs)
+		if err != nil {
+			return err
+		}
+		return sensors.Put(idKey(id), raw)
+	})
+}
+
+// --- HISTORIE ---
+
+func (b *Bolt) WritePoints(ctx context.Context, points []Point) error {
+	if len(points) == 0 {
+		return nil
+	}
+	// Jedna transakce pro celou dávku - bbolt dělá fsync při každém commitu.
+	return b.db.Update(func(tx *bolt.Tx) error {
+		series, states := tx.Bucket(bucketSeries), tx.Bucket(bucketStates)
+		for _, p := range points {
+			// Stav jde jako JSON do 'states', číslo jako 8 B do 'series'
+			parent, value := series, floatBytes(p.Value)
+			if p.State != nil {
+				raw, err := json.Marshal(p.State)
+				if err != nil {
+					return err
+				}
+				parent, value = states, raw
+			}
+			bucket, err := parent.CreateBucketIfNotExists(idKey(p.SensorID))
+			if err != nil {
+				return err
+			}
+			// Bod se stejným časem přepíše předchozí (klíč = čas).
+			k := timeKey(p.Time)
+			if err := bucket.Put(k[:], value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *Bolt) ReadRange(ctx context.Context, sensorID int64, from, to time.Time) ([]Point, error) {
+	points := make([]Point, 0, 100)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketSeries).Bucket(idKey(sensorID))
+		if bucket == nil {
+			return nil // Senzor zatím nemá žádná data
+		}
+		start, end := timeKey(from), timeKey(to)
+		c := bucket.Cursor()
+		for k, v := c.Seek(start[:]); k != nil && bytes.Compare(k, end[:]) < 0; k, v = c.Next() {
+			points = append(points, Point{SensorID: sensorID, Time: keyTime(k), Value: bytesFloat(v)})
+		}
+		return nil
+	})
+	return points, err
+}
+
+func (b *Bolt) ReadStates(ctx context.Context, sensorID int64, from, to time.Time) ([]Point, error) {
+	points := make([]Point, 0, 100)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketStates).Bucket(idKey(sensorID))
+		if bucket == nil {
+			return nil // Senzor zatím nemá žádné stavy
+		}
+		start, end := timeKey(from), timeKey(to)
+		c := bucket.Cursor()
+		for k, v := c.Seek(start[:]); k != nil && bytes.Compare(k, end[:]) < 0; k, v = c.Next() {
+			var st State
+			if err := json.Unmarshal(v, &st); err != nil {
+				return fmt.Errorf("poškozený stav senzoru %d: %w", sensorID, err)
+			}
+			points = append(points, Point{SensorID: sensorID, Time: keyTime(k), State: &st})
+		}
+		return nil
+	})
+	return points, err
+}
+
+// --- POSLEDNÍ HODNOTY ---
+
+func (b *Bolt) SetLatest(ctx context.Context, v LatestValue) (bool, error) {
+	written := false
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		latest := tx.Bucket(bucketLatest)
+		var prev boltLatest
+		// Nečitelný záznam (starší binární formát) prostě přepíšeme.
+		if raw := latest.Get(idKey(v.SensorID)); raw != nil && json.Unmarshal(raw, &prev) == nil {
+			// Starší hodnota uloženou nepřepíše (vypršelý záznam už neplatí)
+			if prev.ExpiresAt.After(time.Now()) && prev.Time.After(v.Time) {
+				return nil
+			}
+		}
+		raw, err := json.Marshal(boltLatest{
+			Value:     v.Value,
+			Time:      v.Time.UTC(),
+			Quality:   v.Quality,
+			State:     v.State,
+			Seq:       prev.Seq + 1,
+			ExpiresAt: time.Now().Add(LatestTTL),
+		})
+		if err != nil {
+			return err
+		}
+		written = true
+		return latest.Put(idKey(v.SensorID), raw)
+	})
+	return written, err
+}
+
+func (b *Bolt) Latest(ctx context.Context, ids []int64) (map[int64]LatestValue, error) {
+	result := make(map[int64]LatestValue, len(ids))
+	now := time.Now()
+	err := b.db.View(func(tx *bolt.Tx) error {
+		latest := tx.Bucket(bucketLatest)
+		for _, id := range ids {
+			raw := latest.Get(idKey(id))
+			if raw == nil {
+				continue // Senzor ještě neposlal data
+			}
+			var bl boltLatest
+			if err := json.Unmarshal(raw, &bl); err != nil || bl.ExpiresAt.Before(now) {
+				continue // Vypršela (nebo starší binární formát - přepíše ji další zápis)
+			}
+			result[id] = LatestValue{SensorID: id, Value: bl.Value, Time: bl.Time, Quality: bl.Quality, State: bl.State, Seq: bl.Seq}
+		}
+		return nil
+	})
+	return result, err
+}
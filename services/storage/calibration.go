@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// --- KALIBRACE ---
+// Levné senzory měří s chybou (DS18B20 ukazuje o 0.7 °C víc), jiné posílají desetiny stupně
+// nebo Fahrenheity. Kalibrace převede surovou hodnotu na skutečnou ještě před validací min/max.
+//
+// Postup výpočtu:
+//  1. value = raw * Scale + Offset   (jednotky, desetiny, °F -> °C, posun nuly)
+//  2. Pokud je zadaná tabulka Points, value se přepočte lineární interpolací mezi body
+//     (nelineární senzory; mimo rozsah tabulky se extrapoluje krajním úsekem).
+//
+// Kalibrace se v DB nepřepisuje, ale přidává s novým 'effective_from'. Historie změn tak zůstane
+// a je jasné, která data vznikla s jakou kalibrací.
+//
+// Výpočet sdílí Ingestor (hodnoty v reálném čase) a backfill v Home API (historická data
+// z SD karty musí vyjít stejně, jako by je Ingestor přepočítal v čase měření).
+
+// CalibrationPoint je jeden bod tabulky: hodnota po kroku 1 -> skutečná hodnota.
+type CalibrationPoint struct {
+	Raw    float64 `json:"raw"`
+	Actual float64 `json:"actual"`
+}
+
+// Calibration je jedna verze kalibrace senzoru.
+type Calibration struct {
+	EffectiveFrom time.Time
+	Scale         float64
+	Offset        float64
+	Points        []CalibrationPoint // Seřazené podle Raw, nil = bez tabulky
+}
+
+// Apply přepočte surovou hodnotu.
+func (c Calibration) Apply(raw float64) float64 {
+	v := raw*c.Scale + c.Offset
+	if len(c.Points) < 2 {
+		return v
+	}
+
+	// Najdeme úsek tabulky, do kterého hodnota padne (krajní úseky i pro extrapolaci).
+	i := sort.Search(len(c.Points), func(i int) bool { return c.Points[i].Raw >= v })
+	switch {
+	case i == 0:
+		i = 1
+	case i == len(c.Points):
+		i = len(c.Points) - 1
+	}
+	a, b := c.Points[i-1], c.Points[i]
+	return a.Actual + (v-a.Raw)*(b.Actual-a.Actual)/(b.Raw-a.Raw)
+}
+
+// ParseCalibrationPoints načte a ověří tabulku z JSONB sloupce.
+func ParseCalibrationPoints(raw []byte) ([]CalibrationPoint, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var points []CalibrationPoint
+	if err := json.Unmarshal(raw, &points); err != nil {
+		return nil, err
+	}
+	if len(points) == 1 {
+		return nil, fmt.Errorf("tabulka musí mít alespoň 2 body")
+	}
+
+	sort.Slice(points, func(i, j int) bool { return points[i].Raw < points[j].Raw })
+	for i := 1; i < len(points); i++ {
+		if points[i].Raw == points[i-1].Raw {
+			return nil, fmt.Errorf("duplicitní bod raw=%v", points[i].Raw)
+		}
+	}
+	return points, nil
+}
+
+// ActiveCalibration vybere kalibraci platnou v okamžiku 't' (poslední s effective_from <= t).
+// Seznam musí být seřazený podle EffectiveFrom vzestupně.
+func ActiveCalibration(list []Calibration, t time.Time) (Calibration, bool) {
+	for i := len(list) - 1; i >= 0; i-- {
+		if !list[i].EffectiveFrom.After(t) {
+			return list[i], true
+		}
+	}
+	return Calibration{}, false
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"storage"
+	"storage/storagetest"
+)
+
+// storage-conformance spustí sadu storagetest proti zvolenému backendu. Stejnou sadu pouští
+// i 'go test' (storage_test.go) - příkaz slouží k ověření konkrétní (např. produkční kopie) DB.
+//
+// Příklady:
+//
+//	go run ./cmd/storage-conformance -backend bolt
+//	go run ./cmd/storage-conformance -backend postgres -postgres-url postgres://... -valkey-addr localhost:6379
+//
+// Návratový kód 1 = některý test neprošel (nebo se backend nepodařilo otevřít).
+func main() {
+	var opts storage.Options
+	flag.StringVar(&opts.Backend, "backend", storage.BackendBolt, "postgres | bolt")
+	flag.StringVar(&opts.PostgresURL, "postgres-url", os.Getenv("POSTGRES_URL"), "připojení k TESTOVACÍ databázi")
+	flag.StringVar(&opts.ValkeyAddr, "valkey-addr", os.Getenv("VALKEY_ADDR"), "adresa Valkey")
+	flag.StringVar(&opts.BoltPath, "bolt-path", "", "soubor bolt databáze (default: dočasný soubor, na konci se smaže)")
+	flag.Parse()
+
+	// Bolt bez cesty: dočasný adresář, ať test nezanechá stopy
+	if opts.Backend == storage.BackendBolt && opts.BoltPath == "" {
+		dir, err := os.MkdirTemp("", "storage-conformance-")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Nelze vytvořit dočasný adresář:", err)
+			os.Exit(1)
+		}
+		defer os.RemoveAll(dir)
+		opts.BoltPath = filepath.Join(dir, "conformance.db")
+	}
+
+	os.Exit(run(opts))
+}
+
+func run(opts storage.Options) int {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	store, err := storage.Open(ctx, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Nelze otevřít úložiště:", err)
+		return 1
+	}
+	defer store.Close()
+
+	failed := 0
+	for _, r := range storagetest.Run(ctx, store) {
+		if r.Skipped {
+			fmt.Printf("skip  %-36s %v\n", r.Name, r.Err)
+			continue
+		}
+		if r.Err != nil {
+			failed++
+			fmt.Printf("FAIL  %-36s %v\n", r.Name, r.Err)
+			continue
+		}
+		fmt.Printf("ok    %-36s %s\n", r.Name, r.Duration.Round(time.Millisecond))
+	}
+
+	if failed > 0 {
+		fmt.Printf("\n%s: %d test(ů) neprošlo\n", opts.Backend, failed)
+		return 1
+	}
+	fmt.Printf("\n%s: všechny testy prošly\n", opts.Backend)
+	return 0
+}
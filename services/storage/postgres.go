@@ -0,0 +1,421 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+)
+
+// Postgres je produkční backend: metadata a historie v TimescaleDB, poslední hodnoty ve Valkey.
+// Formát dat je beze změny (tabulky sensors/sensor_types/sensor_data, klíče "sensor:last:{id}"),
+// takže služby lze přepínat postupně a staré nástroje dál fungují.
+type Postgres struct {
+	db    *pgxpool.Pool
+	redis *redis.Client // nil = služba poslední hodnoty nepotřebuje (LatestStore vrací chybu)
+	owned bool          // true = spojení jsme otevřeli my (OpenPostgres), Close je uzavře
+}
+
+// errNoValkey: LatestStore zavolán na backendu bez Valkey klienta.
+var errNoValkey = errors.New("backend nemá připojený Valkey")
+
+// NewPostgres obalí EXISTUJÍCÍ spojení služby. Close je neuzavírá (patří volajícímu).
+// rdb může být nil, pokud služba nepracuje s posledními hodnotami (např. ingestor).
+func NewPostgres(db *pgxpool.Pool, rdb *redis.Client) *Postgres {
+	return &Postgres{db: db, redis: rdb}
+}
+
+// OpenPostgres připojí a ověří obě databáze. Prázdná valkeyAddr = bez Valkey.
+func OpenPostgres(ctx context.Context, postgresURL, valkeyAddr string) (*Postgres, error) {
+	pool, err := pgxpool.New(ctx, postgresURL)
+	if err != nil {
+		return nil, fmt.Errorf("chyba konfigurace DB: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("DB není dostupná: %w", err)
+	}
+
+	p := &Postgres{db: pool, owned: true}
+	if valkeyAddr != "" {
+		p.redis = redis.NewClient(&redis.Options{Addr: valkeyAddr})
+		if err := p.redis.Ping(ctx).Err(); err != nil {
+			p.Close()
+			return nil, fmt.Errorf("Valkey není dostupný: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// Close uzavře spojení, pokud je backend sám otevřel.
+func (p *Postgres) Close() error {
+	if !p.owned {
+		return nil
+	}
+	p.db.Close()
+	if p.redis != nil {
+		return p.redis.Close()
+	}
+	return nil
+}
+
+// --- METADATA ---
+
+// sensorColumns: společný SELECT pro ActiveSensors i SensorByID (pořadí = scanSensor).
+const sensorColumns = `
+	SELECT s.id, s.mqtt_topic, COALESCE(s.friendly_name, ''), st.name, st.unit,
+	       st.min_value, st.max_value, COALESCE(st.stale_after_seconds, 0), COALESCE(s.is_active, false),
+	       (s.command_topic IS NOT NULL AND st.name = 'switch') AS controllable,
+	       (EXISTS (SELECT 1 FROM virtual_sensors v WHERE v.sensor_id = s.id) OR
+	        EXISTS (SELECT 1 FROM sensor_transforms t WHERE t.sensor_id = s.id)) AS is_virtual,
+	       COALESCE(st.value_kind, 'number'), COALESCE(st.enum_values, '{}'),
+	       COALESCE(st.is_counter, false), st.counter_max
+	FROM sensors s
+	JOIN sensor_types st ON s.sensor_type_id = st.id
+`
+
+func scanSensor(row pgx.Row) (Sensor, error) {
+	var s Sensor
+	var staleSec int64
+	err := row.Scan(&s.ID, &s.Topic, &s.Name, &s.Type, &s.Unit,
+		&s.MinValue, &s.MaxValue, &staleSec, &s.Active, &s.Controllable, &s.Virtual, &s.Kind, &s.EnumValues,
+		&s.Counter, &s.CounterMax)
+	s.StaleAfter = time.Duration(staleSec) * time.Second
+	return s, err
+}
+
+func (p *Postgres) ActiveSensors(ctx context.Context) ([]Sensor, error) {
+	rows, err := p.db.Query(ctx, sensorColumns+` WHERE s.is_active = true ORDER BY s.id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("SQL query (sensors) failed: %w", err)
+	}
+	defer rows.Close()
+
+	var sensors []Sensor
+	for rows.Next() {
+		s, err := scanSensor(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		sensors = append(sensors, s)
+	}
+	return sensors, rows.Err()
+}
+
+func (p *Postgres) SensorByID(ctx context.Context, id int64) (Sensor, error) {
+	s, err := scanSensor(p.db.QueryRow(ctx, sensorColumns+` WHERE s.id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Sensor{}, ErrNotFound
+	}
+	return s, err
+}
+
+func (p *Postgres) EnsureSensor(ctx context.Context, s Sensor) (int64, bool, error) {
+	// Typ a senzor zakládáme v jedné transakci - senzor bez typu nesmí vzniknout.
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback(ctx) // Po Commit už nic neudělá
+
+	// Existující typ necháme beze změny (ON CONFLICT DO NOTHING)
+	kind := s.Kind
+	if kind == "" {
+		kind = KindNumber
+	}
+	var enumValues []string // nil -> NULL (typ bez výčtu)
+	if len(s.EnumValues) > 0 {
+		enumValues = s.EnumValues
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO sensor_types (name, unit, min_value, max_value, stale_after_seconds, value_kind, enum_values,
+		                          is_counter, counter_max)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), $6, $7, $8, $9)
+		ON CONFLICT (name) DO NOTHING`, s.Type, s.Unit, s.MinValue, s.MaxValue, int64(s.StaleAfter/time.Second),
+		kind, enumValues, s.Counter, s.CounterMax)
+	if err != nil {
+		return 0, false, fmt.Errorf("insert typu %q selhal: %w", s.Type, err)
+	}
+
+	// RETURNING vrátí řádek jen při skutečném insertu; jinak dohledáme existující ID.
+	var id int64
+	created := true
+	err = tx.QueryRow(ctx, `
+		INSERT INTO sensors (sensor_type_id, mqtt_topic, friendly_name, is_active)
+		VALUES ((SELECT id FROM sensor_types WHERE name = $1), $2, $3, $4)
+		ON CONFLICT (mqtt_topic) DO NOTHING
+		RETURNING id`, s.Type, s.Topic, s.Name, s.Active).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		created = false
+		err = tx.QueryRow(ctx, `SELECT id FROM sensors WHERE mqtt_topic = $1`, s.Topic).Scan(&id)
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("insert senzoru %q selhal: %w", s.Topic, err)
+	}
+	return id, created, tx.Commit(ctx)
+}
+
+func (p *Postgres) SetSensorActive(ctx context.Context, id int64, active bool) error {
+	tag, err := p.db.Exec(ctx, `UPDATE sensors SET is_active = $2 WHERE id = $1`, id, active)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// --- HISTORIE ---
+
+func (p *Postgres) WritePoints(ctx context.Context, points []Point) error {
+	// Stavy (boolean, enum, text, geo) mají vlastní hypertabulku 'sensor_states'.
+	var states []Point
+	if slices.ContainsFunc(points, func(pt Point) bool { return pt.State != nil }) {
+		numbers := make([]Point, 0, len(points))
+		for _, pt := range points {
+			if pt.State != nil {
+				states = append(states, pt)
+			} else {
+				numbers = append(numbers, pt)
+			}
+		}
+		points = numbers
+	}
+	if err := p.writeStates(ctx, states); err != nil {
+		return err
+	}
+
+	switch len(points) {
+	case 0:
+		return nil
+	case 1:
+		// Jeden bod (běžný případ persisteru) - obyčejný INSERT je levnější než COPY.
+		_, err := p.db.Exec(ctx, `INSERT INTO sensor_data (time, sensor_id, value) VALUES ($1, $2, $3)`,
+			points[0].Time, points[0].SensorID, points[0].Value)
+		if err != nil {
+			return fmt.Errorf("chyba insertu do PG: %w", err)
+		}
+		return nil
+	}
+
+	_, err := p.db.CopyFrom(ctx, pgx.Identifier{"sensor_data"}, []string{"time", "sensor_id", "value"},
+		pgx.CopyFromSlice(len(points), func(i int) ([]any, error) {
+			return []any{points[i].Time, points[i].SensorID, points[i].Value}, nil
+		}))
+	if err != nil {
+		return fmt.Errorf("chyba COPY do PG: %w", err)
+	}
+	return nil
+}
+
+func (p *Postgres) ReadRange(ctx context.Context, sensorID int64, from, to time.Time) ([]Point, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT time, value
+		FROM sensor_data
+		WHERE sensor_id = $1 AND time >= $2 AND time < $3
+		ORDER BY time ASC`, sensorID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("history query failed: %w", err)
+	}
+	defer rows.Close()
+
+	points := make([]Point, 0, 100)
+	for rows.Next() {
+		pt := Point{SensorID: sensorID}
+		if err := rows.Scan(&pt.Time, &pt.Value); err != nil {
+			return nil, err
+		}
+		pt.Time = pt.Time.UTC()
+		points = append(points, pt)
+	}
+	return points, rows.Err()
+}
+
+// stateColumns: Sloupce 'sensor_states' (pořadí = stateRow).
+var stateColumns = []string{"time", "sensor_id", "kind", "value_bool", "value_text", "latitude", "longitude", "altitude", "accuracy"}
+
+// stateRow rozloží stav do sloupců tabulky (nevyplněné = NULL).
+func stateRow(pt Point) []any {
+	st := pt.State
+	row := []any{pt.Time, pt.SensorID, st.Kind, st.Bool, st.Text, nil, nil, nil, nil}
+	if st.Geo != nil {
+		row[5], row[6], row[7], row[8] = st.Geo.Lat, st.Geo.Lon, st.Geo.Alt, st.Geo.Acc
+	}
+	return row
+}
+
+func (p *Postgres) writeStates(ctx context.Context, points []Point) error {
+	switch len(points) {
+	case 0:
+		return nil
+	case 1:
+		_, err := p.db.Exec(ctx, `
+			INSERT INTO sensor_states (time, sensor_id, kind, value_bool, value_text, latitude, longitude, altitude, accuracy)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`, stateRow(points[0])...)
+		if err != nil {
+			return fmt.Errorf("chyba insertu stavu do PG: %w", err)
+		}
+		return nil
+	}
+	_, err := p.db.CopyFrom(ctx, pgx.Identifier{"sensor_states"}, stateColumns,
+		pgx.CopyFromSlice(len(points), func(i int) ([]any, error) {
+			return stateRow(points[i]), nil
+		}))
+	if err != nil {
+		return fmt.Errorf("chyba COPY stavů do PG: %w", err)
+	}
+	return nil
+}
+
+func (p *Postgres) ReadStates(ctx context.Context, sensorID int64, from, to time.Time) ([]Point, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT time, kind, value_bool, value_text, latitude, longitude, altitude, accuracy
+		FROM sensor_states
+		WHERE sensor_id = $1 AND time >= $2 AND time < $3
+		ORDER BY time ASC`, sensorID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("state history query failed: %w", err)
+	}
+	defer rows.Close()
+
+	points := make([]Point, 0, 100)
+	for rows.Next() {
+		pt := Point{SensorID: sensorID, State: &State{}}
+		var lat, lon *float64
+		var geo GeoPoint
+		if err := rows.Scan(&pt.Time, &pt.State.Kind, &pt.State.Bool, &pt.State.Text, &lat, &lon, &geo.Alt, &geo.Acc); err != nil {
+			return nil, err
+		}
+		if lat != nil && lon != nil {
+			geo.Lat, geo.Lon = *lat, *lon
+			pt.State.Geo = &geo
+		}
+		pt.Time = pt.Time.UTC()
+		points = append(points, pt)
+	}
+	return points, rows.Err()
+}
+
+// --- POSLEDNÍ HODNOTY ---
+
+// latestKey: Hash ve Valkey, např. "sensor:latest:5" s poli
+//
+//	v   - hodnota
+//	t   - čas měření (unix mikrosekundy)
+//	q   - příznaky kvality oddělené čárkou ("" = bez výhrad)
+//	seq - pořadové číslo zápisu (HINCRBY)
+//	s   - stav jako JSON u nečíselných senzorů ("" = číselný senzor)
+//
+// Dřívější řetězcové klíče "sensor:last:{id}" (jen hodnota) se nepoužívají a samy vyprší.
+func latestKey(id int64) string {
+	return fmt.Sprintf("sensor:latest:%d", id)
+}
+
+// setLatestScript zapíše hodnotu jen tehdy, když není starší než uložená - porovnání a zápis
+// musí proběhnout atomicky (persister může zapisovat souběžně z více goroutin).
+// ARGV: hodnota, čas (µs), kvalita, TTL (ms), stav (JSON). Vrací 1 = zapsáno, 0 = uložená hodnota je novější.
+var setLatestScript = redis.NewScript(`
+local t = redis.call('HGET', KEYS[1], 't')
+if t and tonumber(t) > tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'v', ARGV[1], 't', ARGV[2], 'q', ARGV[3], 's', ARGV[5])
+redis.call('HINCRBY', KEYS[1], 'seq', 1)
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return 1
+`)
+
+func (p *Postgres) SetLatest(ctx context.Context, v LatestValue) (bool, error) {
+	if p.redis == nil {
+		return false, errNoValkey
+	}
+	state := ""
+	if v.State != nil {
+		raw, err := json.Marshal(v.State)
+		if err != nil {
+			return false, err
+		}
+		state = string(raw)
+	}
+	written, err := setLatestScript.Run(ctx, p.redis, []string{latestKey(v.SensorID)},
+		strconv.FormatFloat(v.Value, 'g', -1, 64),
+		v.Time.UnixMicro(),
+		strings.Join(v.Quality, ","),
+		LatestTTL.Milliseconds(),
+		state,
+	).Int()
+	if err != nil {
+		return false, fmt.Errorf("chyba update Valkey: %w", err)
+	}
+	return written == 1, nil
+}
+
+func (p *Postgres) Latest(ctx context.Context, ids []int64) (map[int64]LatestValue, error) {
+	if p.redis == nil {
+		return nil, errNoValkey
+	}
+
+	// Jeden round-trip pro všechny senzory: HMGET každého klíče v pipeline.
+	cmds := make([]*redis.SliceCmd, len(ids))
+	_, err := p.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.HMGet(ctx, latestKey(id), "v", "t", "q", "seq", "s")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Valkey HMGET (pipeline) selhal: %w", err)
+	}
+
+	result := make(map[int64]LatestValue, len(ids))
+	for i, id := range ids {
+		fields := cmds[i].Val()
+		if len(fields) != 5 || fields[0] == nil {
+			continue // Senzor ještě neposlal data (nebo hodnota vypršela)
+		}
+		lv, err := parseLatest(id, fields)
+		if err != nil {
+			return nil, fmt.Errorf("poškozený záznam %s: %w", latestKey(id), err)
+		}
+		result[id] = lv
+	}
+	return result, nil
+}
+
+// parseLatest převede pole hashe (v, t, q, seq, s - jako řetězce) na LatestValue.
+func parseLatest(id int64, fields []any) (LatestValue, error) {
+	str := func(i int) string {
+		s, _ := fields[i].(string)
+		return s
+	}
+	lv := LatestValue{SensorID: id}
+	var err error
+	if lv.Value, err = strconv.ParseFloat(str(0), 64); err != nil {
+		return lv, err
+	}
+	micros, err := strconv.ParseInt(str(1), 10, 64)
+	if err != nil {
+		return lv, err
+	}
+	lv.Time = time.UnixMicro(micros).UTC()
+	if q := str(2); q != "" {
+		lv.Quality = strings.Split(q, ",")
+	}
+	lv.Seq, _ = strconv.ParseInt(str(3), 10, 64) // Chybějící seq (ruční zápis) = 0
+	if st := str(4); st != "" {
+		lv.State = &State{}
+		if err := json.Unmarshal([]byte(st), lv.State); err != nil {
+			return lv, err
+		}
+	}
+	return lv, nil
+}
@@ -0,0 +1,222 @@
+// Package storage odděluje služby od konkrétní databáze.
+//
+// Služby (ingestor, persister, Home API) dosud pracovaly přímo s *pgxpool.Pool a *redis.Client.
+// Tři nejdůležitější oblasti jsou teď schované za rozhraními:
+//   - MetadataStore: senzory a jejich typy (topic -> ID, jednotka, limity),
+//   - SeriesStore:   historie měření (časové řady),
+//   - LatestStore:   poslední hodnota senzoru (cache pro dashboard).
+//
+// Implementace:
+//   - Postgres (postgres.go): TimescaleDB + Valkey - produkční nasazení,
+//   - Bolt (bolt.go): vestavěný soubor (bbolt, čisté Go) s retencí - malá instalace
+//     nebo testovací běh bez externích databází (typicky all-in-one).
+//
+// Obě implementace musí projít stejnou sadou testů (balíček storagetest,
+// spuštění: go test, nebo go run ./cmd/storage-conformance -backend bolt|postgres).
+//
+// Mimo úložiště je tu i výpočet kalibrace (calibration.go) - sdílí ho Ingestor a backfill v Home API.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotFound: hledaný záznam (senzor) neexistuje.
+var ErrNotFound = errors.New("záznam nenalezen")
+
+// Sensor je senzor včetně údajů o svém typu.
+type Sensor struct {
+	ID    int64
+	Topic string // MQTT topic (unikátní)
+	Name  string // Friendly name (např. "Teplota Obývák")
+	Type  string // Název typu (např. "temperature")
+
+	// Jednotka a limity patří TYPU senzoru - platí pro všechny senzory stejného typu.
+	// nil = není nastaveno.
+	Unit     *string
+	MinValue *float64
+	MaxValue *float64
+
+	Active bool // false = senzor je "soft-deleted" (data zůstávají)
+
+	// StaleAfter: Po jaké době bez nové hodnoty je senzor "zastaralý" (patří typu, jako limity).
+	// 0 = typ práh nemá, platí výchozí práh služby.
+	StaleAfter time.Duration
+
+	// Odvozené příznaky z dalších tabulek (příkazy, virtuální senzory a transformace).
+	// EnsureSensor je nezapisuje; vestavěný backend je vrací vždy false.
+	Controllable bool
+	Virtual      bool
+
+	// Kind: Druh hodnoty (patří typu, viz Kind* konstanty). "" = KindNumber.
+	Kind string
+	// EnumValues: Povolené stavy typu s Kind == KindEnum (např. "disarmed", "armed_home").
+	EnumValues []string
+
+	// Counter: Hodnota je kumulativní počítadlo (vodoměr, pulzy) - graf ukazuje stav počítadla,
+	// spotřebu za období počítá Home API z rozdílů. Patří typu.
+	// CounterMax: Hodnota, po které počítadlo přeteče na 0 (např. 65536); nil = nepřetéká.
+	Counter    bool
+	CounterMax *float64
+}
+
+// Druhy hodnot senzorů (sensor_types.value_kind).
+// Číselné hodnoty jdou do historie 'sensor_data' (agregace, statistiky, grafy). Ostatní
+// druhy jsou STAVY - ukládají se zvlášť (Point.State) a čtou se přes ReadStates.
+const (
+	KindNumber  = "number"  // Číslo (teplota, výkon...) - výchozí
+	KindBoolean = "boolean" // Zapnuto/vypnuto, otevřeno/zavřeno
+	KindEnum    = "enum"    // Jeden z vyjmenovaných stavů (Sensor.EnumValues)
+	KindText    = "text"    // Volný text (verze firmware, stav zařízení)
+	KindGeo     = "geo"     // Poloha (GPS)
+)
+
+// IsStateKind: Druh, jehož hodnoty se ukládají jako stavy (ne jako čísla).
+func IsStateKind(kind string) bool {
+	return kind != "" && kind != KindNumber
+}
+
+// GeoPoint je poloha (WGS84). Výška a přesnost jsou volitelné.
+type GeoPoint struct {
+	Lat float64  `json:"lat"`
+	Lon float64  `json:"lon"`
+	Alt *float64 `json:"alt,omitempty"` // Nadmořská výška (m)
+	Acc *float64 `json:"acc,omitempty"` // Přesnost (m)
+}
+
+// State je nečíselná hodnota senzoru. Vyplněné je jen pole odpovídající Kind
+// (Text slouží pro KindEnum i KindText).
+type State struct {
+	Kind string    `json:"kind"`
+	Bool *bool     `json:"bool,omitempty"`
+	Text *string   `json:"text,omitempty"`
+	Geo  *GeoPoint `json:"geo,omitempty"`
+}
+
+// Equal porovná dva stavy (nil == nil). Používá persister pro deadband - stejný stav
+// se do historie znovu nezapisuje.
+func (s *State) Equal(o *State) bool {
+	if s == nil || o == nil {
+		return s == o
+	}
+	if s.Kind != o.Kind {
+		return false
+	}
+	switch {
+	case s.Bool != nil || o.Bool != nil:
+		return s.Bool != nil && o.Bool != nil && *s.Bool == *o.Bool
+	case s.Text != nil || o.Text != nil:
+		return s.Text != nil && o.Text != nil && *s.Text == *o.Text
+	case s.Geo != nil || o.Geo != nil:
+		return s.Geo != nil && o.Geo != nil && s.Geo.Lat == o.Geo.Lat && s.Geo.Lon == o.Geo.Lon &&
+			eqFloatPtr(s.Geo.Alt, o.Geo.Alt)
+	}
+	return true
+}
+
+func eqFloatPtr(a, b *float64) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+// Point je jeden bod časové řady.
+type Point struct {
+	SensorID int64
+	Time     time.Time
+	Value    float64
+
+	// State: Nečíselná hodnota (boolean, enum, text, geo). Bod se stavem se ukládá
+	// do historie stavů (ReadStates), ne do číselné historie (ReadRange); Value se pak ignoruje.
+	State *State
+}
+
+// MetadataStore: senzory a jejich typy.
+type MetadataStore interface {
+	// ActiveSensors vrací aktivní senzory seřazené podle ID.
+	ActiveSensors(ctx context.Context) ([]Sensor, error)
+	// SensorByID vrací senzor (i neaktivní). Neexistující -> ErrNotFound.
+	SensorByID(ctx context.Context, id int64) (Sensor, error)
+	// EnsureSensor založí senzor, pokud senzor se stejným topicem ještě neexistuje.
+	// Existující senzor (i deaktivovaný) ani existující typ NEMĚNÍ - limity mohl upravit admin.
+	// Chybějící typ se založí s jednotkou, limity a druhem hodnoty ze 's'. Vrací ID a zda byl senzor založen.
+	EnsureSensor(ctx context.Context, s Sensor) (id int64, created bool, err error)
+	// SetSensorActive zapne/vypne senzor (soft-delete). Neexistující -> ErrNotFound.
+	SetSensorActive(ctx context.Context, id int64, active bool) error
+}
+
+// SeriesStore: historie měření.
+type SeriesStore interface {
+	// WritePoints uloží body (v libovolném pořadí, i pro více senzorů najednou).
+	WritePoints(ctx context.Context, points []Point) error
+	// ReadRange vrací body senzoru v intervalu [from, to) seřazené podle času (v UTC).
+	ReadRange(ctx context.Context, sensorID int64, from, to time.Time) ([]Point, error)
+	// ReadStates je ReadRange pro historii stavů (body s vyplněným State).
+	ReadStates(ctx context.Context, sensorID int64, from, to time.Time) ([]Point, error)
+}
+
+// LatestValue je poslední známý stav senzoru (záznam v cache pro dashboard).
+type LatestValue struct {
+	SensorID int64
+	Value    float64
+	Time     time.Time // Čas MĚŘENÍ (ne zápisu) - podle něj se pozná zastaralý senzor
+	Quality  []string  // Příznaky kvality (např. "suspect"); prázdné = hodnota bez výhrad
+	State    *State    // Nečíselná hodnota (nil = číselný senzor, platí Value)
+
+	// Seq: Pořadové číslo zápisu - roste s každou uloženou hodnotou senzoru.
+	// Klient podle něj pozná novou hodnotu, i když je číselně stejná. SetLatest ho ignoruje.
+	Seq int64
+}
+
+// LatestStore: poslední hodnoty senzorů (záznam po LatestTTL bez aktualizace vyprší).
+type LatestStore interface {
+	// SetLatest uloží poslední hodnotu. Hodnota STARŠÍ než uložená (např. znovu odeslaná
+	// zpráva) uloženou nepřepíše - pak vrací false.
+	SetLatest(ctx context.Context, v LatestValue) (bool, error)
+	// Latest vrací poslední hodnoty zadaných senzorů (jedním dotazem). Senzor bez hodnoty v mapě chybí.
+	Latest(ctx context.Context, ids []int64) (map[int64]LatestValue, error)
+}
+
+// Store sdružuje všechna rozhraní jednoho backendu.
+type Store interface {
+	MetadataStore
+	SeriesStore
+	LatestStore
+	Close() error
+}
+
+// LatestTTL: Po jaké době bez aktualizace poslední hodnota vyprší (mrtvé senzory zmizí z cache).
+// O "zastaralosti" rozhoduje čas měření a práh typu (Sensor.StaleAfter) - TTL jen uklízí.
+const LatestTTL = 7 * 24 * time.Hour
+
+// Backendy pro Options.Backend
+const (
+	BackendPostgres = "postgres"
+	BackendBolt     = "bolt"
+)
+
+// Options vybírá a konfiguruje backend pro Open.
+type Options struct {
+	Backend string // postgres | bolt
+
+	// Backend "postgres"
+	PostgresURL string
+	ValkeyAddr  string
+
+	// Backend "bolt"
+	BoltPath  string        // Cesta k souboru databáze (vytvoří se)
+	Retention time.Duration // Starší body historie se mažou; 0 = bez retence
+}
+
+// Open otevře backend podle Options. Store vlastní svá spojení - Close je uzavře.
+func Open(ctx context.Context, opts Options) (Store, error) {
+	switch opts.Backend {
+	case BackendPostgres, "":
+		return OpenPostgres(ctx, opts.PostgresURL, opts.ValkeyAddr)
+	case BackendBolt:
+		return OpenBolt(opts.BoltPath, opts.Retention)
+	default:
+		return nil, fmt.Errorf("neznámý backend úložiště %q (povoleno: postgres, bolt)", opts.Backend)
+	}
+}
@@ -0,0 +1,56 @@
+package storage_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"storage"
+	"storage/storagetest"
+)
+
+// Sada storagetest nad oběma backendy. Bolt běží vždy (dočasný soubor), Postgres jen
+// s nastavenou POSTGRES_URL (a volitelně VALKEY_ADDR) - pouštějte proti TESTOVACÍ databázi.
+
+func TestBoltConformance(t *testing.T) {
+	store, err := storage.OpenBolt(filepath.Join(t.TempDir(), "conformance.db"), 0)
+	if err != nil {
+		t.Fatalf("OpenBolt: %v", err)
+	}
+	defer store.Close()
+	runSuite(t, store)
+}
+
+func TestPostgresConformance(t *testing.T) {
+	url := os.Getenv("POSTGRES_URL")
+	if url == "" {
+		t.Skip("POSTGRES_URL není nastavená")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	store, err := storage.OpenPostgres(ctx, url, os.Getenv("VALKEY_ADDR"))
+	if err != nil {
+		t.Fatalf("OpenPostgres: %v", err)
+	}
+	defer store.Close()
+	runSuite(t, store)
+}
+
+// runSuite spustí sadu a každý její test ohlásí jako podtest.
+func runSuite(t *testing.T, store storage.Store) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	for _, r := range storagetest.Run(ctx, store) {
+		t.Run(r.Name, func(t *testing.T) {
+			switch {
+			case r.Skipped:
+				t.Skip(r.Err)
+			case r.Err != nil:
+				t.Fatal(r.Err)
+			}
+		})
+	}
+}
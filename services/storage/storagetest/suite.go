@@ -0,0 +1,542 @@
+// Package storagetest je sada testů, kterou musí projít KAŽDÁ implementace storage.Store.
+// Tím je zaručeno, že se služby chovají stejně nad TimescaleDB/Valkey i nad vestavěným bbolt.
+//
+// Sada běží proti živému backendu: z 'go test' (storage_test.go - bolt vždy, Postgres při
+// nastavené POSTGRES_URL) nebo z cmd/storage-conformance. Zakládá senzory s unikátním
+// prefixem topicu a typu; na konci je deaktivuje (soft-delete) - v Postgres data zůstanou,
+// proto ji pouštějte proti testovací databázi.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"storage"
+)
+
+// Result je výsledek jednoho testu sady.
+type Result struct {
+	Name     string
+	Err      error // nil = prošel; u přeskočeného testu důvod
+	Skipped  bool  // Test se na backend nevztahuje (např. retenci Postgres řeší politika TimescaleDB)
+	Duration time.Duration
+}
+
+// errSkip: Test se na backend nevztahuje - Run ho vrátí jako přeskočený.
+var errSkip = errors.New("přeskočeno")
+
+// Pruner implementuje backend, který retenci historie řeší sám (bolt). V Postgres maže staré
+// body politika TimescaleDB (postgres.sql, sekce 17), ne kód úložiště.
+type Pruner interface {
+	// Prune smaže body historie (čísla i stavy) starší než 'before'. Vrací počet smazaných bodů.
+	Prune(before time.Time) (int, error)
+}
+
+// check je jeden test. Dostává společný stav běhu (unikátní prefix, založené senzory).
+type check struct {
+	name string
+	run  func(ctx context.Context, s storage.Store, r *run) error
+}
+
+// run drží stav jednoho běhu sady.
+type run struct {
+	prefix  string  // Unikátní prefix topiců a typů (běhy se navzájem neovlivní)
+	created []int64 // Založené senzory (na konci je deaktivujeme)
+}
+
+// Run spustí celou sadu a vrátí výsledky všech testů (neskončí u první chyby).
+func Run(ctx context.Context, s storage.Store) []Result {
+	r := &run{prefix: fmt.Sprintf("conformance_%d", time.Now().UnixNano())}
+
+	var results []Result
+	for _, c := range checks {
+		start := time.Now()
+		err := c.run(ctx, s, r)
+		results = append(results, Result{Name: c.name, Err: err, Skipped: errors.Is(err, errSkip), Duration: time.Since(start)})
+	}
+
+	// Úklid: deaktivace (fyzicky mazat nelze - v Postgres na senzory odkazuje historie)
+	for _, id := range r.created {
+		s.SetSensorActive(ctx, id, false)
+	}
+	return results
+}
+
+// sensor vytvoří testovací senzor (topic a typ s prefixem běhu) a zapamatuje si ho k úklidu.
+func (r *run) sensor(ctx context.Context, s storage.Store, name, typ string, minV, maxV *float64) (int64, error) {
+	unit := "u_" + typ
+	id, created, err := s.EnsureSensor(ctx, storage.Sensor{
+		Topic:    "/" + r.prefix + "/" + name,
+		Name:     name,
+		Type:     r.prefix + "_" + typ,
+		Unit:     &unit,
+		MinValue: minV,
+		MaxValue: maxV,
+		Active:   true,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("EnsureSensor(%s): %w", name, err)
+	}
+	if id <= 0 || !created {
+		return 0, fmt.Errorf("EnsureSensor(%s) vrátil ID %d, created=%v", name, id, created)
+	}
+	r.created = append(r.created, id)
+	return id, nil
+}
+
+func ptr(v float64) *float64 { return &v }
+
+func eqPtr(a, b *float64) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+// checks: pořadí je důležité jen pro čitelnost výstupu, testy na sobě nezávisí.
+var checks = []check{
+	{"metadata/put-and-get", func(ctx context.Context, s storage.Store, r *run) error {
+		id, err := r.sensor(ctx, s, "temp", "temperature", ptr(-30), ptr(80))
+		if err != nil {
+			return err
+		}
+		got, err := s.SensorByID(ctx, id)
+		if err != nil {
+			return fmt.Errorf("SensorByID: %w", err)
+		}
+		want := "/" + r.prefix + "/temp"
+		if got.ID != id || got.Topic != want || got.Name != "temp" || got.Type != r.prefix+"_temperature" || !got.Active {
+			return fmt.Errorf("SensorByID vrátil %+v", got)
+		}
+		if got.Unit == nil || *got.Unit != "u_temperature" || !eqPtr(got.MinValue, ptr(-30)) || !eqPtr(got.MaxValue, ptr(80)) {
+			return fmt.Errorf("jednotka/limity typu nesedí: unit=%v min=%v max=%v", got.Unit, got.MinValue, got.MaxValue)
+		}
+		return nil
+	}},
+
+	{"metadata/type-stale-after", func(ctx context.Context, s storage.Store, r *run) error {
+		id, _, err := s.EnsureSensor(ctx, storage.Sensor{
+			Topic: "/" + r.prefix + "/stale", Name: "stale", Type: r.prefix + "_slow", Active: true,
+			StaleAfter: 10 * time.Minute,
+		})
+		if err != nil {
+			return fmt.Errorf("EnsureSensor: %w", err)
+		}
+		r.created = append(r.created, id)
+		plain, err := r.sensor(ctx, s, "not_stale", "generic_stale", nil, nil)
+		if err != nil {
+			return err
+		}
+		for id, want := range map[int64]time.Duration{id: 10 * time.Minute, plain: 0} {
+			got, err := s.SensorByID(ctx, id)
+			if err != nil {
+				return err
+			}
+			if got.StaleAfter != want {
+				return fmt.Errorf("senzor %d: StaleAfter = %v, čekáno %v", id, got.StaleAfter, want)
+			}
+		}
+		return nil
+	}},
+
+	{"metadata/value-kind", func(ctx context.Context, s storage.Store, r *run) error {
+		id, _, err := s.EnsureSensor(ctx, storage.Sensor{
+			Topic: "/" + r.prefix + "/alarm", Name: "alarm", Type: r.prefix + "_alarm", Active: true,
+			Kind: storage.KindEnum, EnumValues: []string{"disarmed", "armed_home", "armed_away"},
+		})
+		if err != nil {
+			return fmt.Errorf("EnsureSensor: %w", err)
+		}
+		r.created = append(r.created, id)
+		plain, err := r.sensor(ctx, s, "plain_kind", "generic_kind", nil, nil)
+		if err != nil {
+			return err
+		}
+		got, err := s.SensorByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if got.Kind != storage.KindEnum || !slices.Equal(got.EnumValues, []string{"disarmed", "armed_home", "armed_away"}) {
+			return fmt.Errorf("druh typu nesedí: kind=%q enum=%v", got.Kind, got.EnumValues)
+		}
+		// Typ bez udaného druhu je číselný
+		if got, err = s.SensorByID(ctx, plain); err != nil {
+			return err
+		}
+		if got.Kind != storage.KindNumber || len(got.EnumValues) != 0 {
+			return fmt.Errorf("výchozí druh: kind=%q enum=%v, čekáno number bez výčtu", got.Kind, got.EnumValues)
+		}
+		if got.Counter || got.CounterMax != nil {
+			return fmt.Errorf("výchozí typ není počítadlo: counter=%v max=%v", got.Counter, got.CounterMax)
+		}
+		return nil
+	}},
+
+	{"metadata/counter", func(ctx context.Context, s storage.Store, r *run) error {
+		wrap := 65536.0
+		id, _, err := s.EnsureSensor(ctx, storage.Sensor{
+			Topic: "/" + r.prefix + "/water", Name: "water", Type: r.prefix + "_water", Active: true,
+			Counter: true, CounterMax: &wrap,
+		})
+		if err != nil {
+			return fmt.Errorf("EnsureSensor: %w", err)
+		}
+		r.created = append(r.created, id)
+		got, err := s.SensorByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !got.Counter || got.CounterMax == nil || *got.CounterMax != wrap {
+			return fmt.Errorf("počítadlo nesedí: counter=%v max=%v", got.Counter, got.CounterMax)
+		}
+		return nil
+	}},
+
+	{"metadata/existing-sensor-untouched", func(ctx context.Context, s storage.Store, r *run) error {
+		id, err := r.sensor(ctx, s, "existing", "generic", nil, nil)
+		if err != nil {
+			return err
+		}
+		again, created, err := s.EnsureSensor(ctx, storage.Sensor{
+			Topic: "/" + r.prefix + "/existing", Name: "přejmenovaný", Type: r.prefix + "_other", Active: true,
+		})
+		if err != nil {
+			return fmt.Errorf("druhý EnsureSensor: %w", err)
+		}
+		if again != id || created {
+			return fmt.Errorf("stejný topic: ID %d (původně %d), created=%v", again, id, created)
+		}
+		got, err := s.SensorByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if got.Name != "existing" || got.Type != r.prefix+"_generic" {
+			return fmt.Errorf("existující senzor byl přepsán: %+v", got)
+		}
+		return nil
+	}},
+
+	{"metadata/existing-type-untouched", func(ctx context.Context, s storage.Store, r *run) error {
+		a, err := r.sensor(ctx, s, "shared_a", "shared", ptr(0), ptr(10))
+		if err != nil {
+			return err
+		}
+		// Druhý senzor stejného typu s jinými limity -> typ už existuje, limity zůstanou
+		b, err := r.sensor(ctx, s, "shared_b", "shared", ptr(5), nil)
+		if err != nil {
+			return err
+		}
+		for _, id := range []int64{a, b} {
+			got, err := s.SensorByID(ctx, id)
+			if err != nil {
+				return err
+			}
+			if !eqPtr(got.MinValue, ptr(0)) || !eqPtr(got.MaxValue, ptr(10)) {
+				return fmt.Errorf("senzor %d: limity typu změněny na min=%v max=%v", id, got.MinValue, got.MaxValue)
+			}
+		}
+		return nil
+	}},
+
+	{"metadata/active-and-soft-delete", func(ctx context.Context, s storage.Store, r *run) error {
+		first, err := r.sensor(ctx, s, "active_1", "generic", nil, nil)
+		if err != nil {
+			return err
+		}
+		second, err := r.sensor(ctx, s, "active_2", "generic", nil, nil)
+		if err != nil {
+			return err
+		}
+		ids, err := activeIDs(ctx, s)
+		if err != nil {
+			return err
+		}
+		if !slices.IsSorted(ids) {
+			return fmt.Errorf("ActiveSensors není seřazený podle ID: %v", ids)
+		}
+		if !slices.Contains(ids, first) || !slices.Contains(ids, second) {
+			return fmt.Errorf("ActiveSensors neobsahuje nové senzory %d, %d", first, second)
+		}
+
+		if err := s.SetSensorActive(ctx, second, false); err != nil {
+			return fmt.Errorf("SetSensorActive: %w", err)
+		}
+		if ids, err = activeIDs(ctx, s); err != nil {
+			return err
+		}
+		if slices.Contains(ids, second) {
+			return fmt.Errorf("deaktivovaný senzor %d je stále mezi aktivními", second)
+		}
+		got, err := s.SensorByID(ctx, second)
+		if err != nil {
+			return fmt.Errorf("SensorByID na neaktivní senzor: %w", err)
+		}
+		if got.Active {
+			return fmt.Errorf("SensorByID vrací Active=true u deaktivovaného senzoru")
+		}
+
+		// Nové "ohlášení" stejného topicu deaktivovaný senzor znovu nezapne
+		if _, created, err := s.EnsureSensor(ctx, storage.Sensor{
+			Topic: got.Topic, Name: got.Name, Type: got.Type, Active: true,
+		}); err != nil || created {
+			return fmt.Errorf("EnsureSensor na deaktivovaný senzor: created=%v, err=%v", created, err)
+		}
+		if ids, err = activeIDs(ctx, s); err != nil {
+			return err
+		}
+		if slices.Contains(ids, second) {
+			return fmt.Errorf("EnsureSensor znovu aktivoval deaktivovaný senzor %d", second)
+		}
+		return nil
+	}},
+
+	{"metadata/not-found", func(ctx context.Context, s storage.Store, r *run) error {
+		const missing = math.MaxInt32 - 7
+		if _, err := s.SensorByID(ctx, missing); !errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("SensorByID(neexistující) = %v, čekáno ErrNotFound", err)
+		}
+		if err := s.SetSensorActive(ctx, missing, false); !errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("SetSensorActive(neexistující) = %v, čekáno ErrNotFound", err)
+		}
+		return nil
+	}},
+
+	{"series/write-and-read-range", func(ctx context.Context, s storage.Store, r *run) error {
+		a, err := r.sensor(ctx, s, "series_a", "generic", nil, nil)
+		if err != nil {
+			return err
+		}
+		b, err := r.sensor(ctx, s, "series_b", "generic", nil, nil)
+		if err != nil {
+			return err
+		}
+		base := time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+		at := func(min int) time.Time { return base.Add(time.Duration(min) * time.Minute) }
+
+		// Záměrně mimo pořadí a promíchané se druhým senzorem
+		err = s.WritePoints(ctx, []storage.Point{
+			{SensorID: a, Time: at(20), Value: 2},
+			{SensorID: b, Time: at(15), Value: 99},
+			{SensorID: a, Time: at(10), Value: 1},
+			{SensorID: a, Time: at(30), Value: 3},
+			{SensorID: a, Time: at(0), Value: 0},
+		})
+		if err != nil {
+			return fmt.Errorf("WritePoints: %w", err)
+		}
+		// Jeden bod zvlášť (persister zapisuje po jednom)
+		if err := s.WritePoints(ctx, []storage.Point{{SensorID: a, Time: at(25), Value: 2.5}}); err != nil {
+			return fmt.Errorf("WritePoints (1 bod): %w", err)
+		}
+
+		// Interval [at(10), at(30)): at(10) patří dovnitř, at(30) už ne
+		got, err := s.ReadRange(ctx, a, at(10), at(30))
+		if err != nil {
+			return fmt.Errorf("ReadRange: %w", err)
+		}
+		want := []storage.Point{
+			{SensorID: a, Time: at(10), Value: 1},
+			{SensorID: a, Time: at(20), Value: 2},
+			{SensorID: a, Time: at(25), Value: 2.5},
+		}
+		if len(got) != len(want) {
+			return fmt.Errorf("ReadRange vrátil %d bodů, čekáno %d: %v", len(got), len(want), got)
+		}
+		for i := range want {
+			if got[i].SensorID != want[i].SensorID || !got[i].Time.Equal(want[i].Time) ||
+				got[i].Value != want[i].Value || got[i].Time.Location() != time.UTC {
+				return fmt.Errorf("bod %d: %+v, čekáno %+v (v UTC)", i, got[i], want[i])
+			}
+		}
+		return nil
+	}},
+
+	{"series/empty-range", func(ctx context.Context, s storage.Store, r *run) error {
+		id, err := r.sensor(ctx, s, "series_empty", "generic", nil, nil)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		got, err := s.ReadRange(ctx, id, now.Add(-time.Hour), now)
+		if err != nil {
+			return fmt.Errorf("ReadRange bez dat: %w", err)
+		}
+		if len(got) != 0 {
+			return fmt.Errorf("senzor bez dat vrátil %d bodů", len(got))
+		}
+		return nil
+	}},
+
+	{"states/write-and-read", func(ctx context.Context, s storage.Store, r *run) error {
+		id, err := r.sensor(ctx, s, "states", "generic_states", nil, nil)
+		if err != nil {
+			return err
+		}
+		base := time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+		at := func(min int) time.Time { return base.Add(time.Duration(min) * time.Minute) }
+		on, text, alt := true, "1.2.3", 245.5
+		want := []storage.Point{
+			{SensorID: id, Time: at(0), State: &storage.State{Kind: storage.KindBoolean, Bool: &on}},
+			{SensorID: id, Time: at(5), State: &storage.State{Kind: storage.KindText, Text: &text}},
+			{SensorID: id, Time: at(10), State: &storage.State{Kind: storage.KindGeo, Geo: &storage.GeoPoint{Lat: 50.0875, Lon: 14.4214, Alt: &alt}}},
+		}
+		// Stav i číslo v jedné dávce - každý jde do své historie
+		batch := append([]storage.Point{{SensorID: id, Time: at(7), Value: 42}}, want[2], want[0])
+		if err := s.WritePoints(ctx, batch); err != nil {
+			return fmt.Errorf("WritePoints: %w", err)
+		}
+		if err := s.WritePoints(ctx, []storage.Point{want[1]}); err != nil {
+			return fmt.Errorf("WritePoints (1 stav): %w", err)
+		}
+
+		got, err := s.ReadStates(ctx, id, at(0), at(60))
+		if err != nil {
+			return fmt.Errorf("ReadStates: %w", err)
+		}
+		if len(got) != len(want) {
+			return fmt.Errorf("ReadStates vrátil %d bodů, čekáno %d", len(got), len(want))
+		}
+		for i := range want {
+			if !got[i].Time.Equal(want[i].Time) || got[i].Time.Location() != time.UTC || !got[i].State.Equal(want[i].State) {
+				return fmt.Errorf("stav %d: %+v @ %s, čekáno %+v @ %s", i, got[i].State, got[i].Time, want[i].State, want[i].Time)
+			}
+		}
+		numbers, err := s.ReadRange(ctx, id, at(0), at(60))
+		if err != nil {
+			return fmt.Errorf("ReadRange: %w", err)
+		}
+		if len(numbers) != 1 || numbers[0].Value != 42 || numbers[0].State != nil {
+			return fmt.Errorf("ReadRange vrátil %v, čekáno jen číslo 42 (stavy patří do ReadStates)", numbers)
+		}
+		return nil
+	}},
+
+	{"latest/state", func(ctx context.Context, s storage.Store, r *run) error {
+		id, err := r.sensor(ctx, s, "latest_state", "generic", nil, nil)
+		if err != nil {
+			return err
+		}
+		state := "armed_home"
+		lv := storage.LatestValue{SensorID: id, Time: time.Now().UTC().Truncate(time.Microsecond),
+			State: &storage.State{Kind: storage.KindEnum, Text: &state}}
+		if _, err := s.SetLatest(ctx, lv); err != nil {
+			return fmt.Errorf("SetLatest: %w", err)
+		}
+		got, err := s.Latest(ctx, []int64{id})
+		if err != nil {
+			return fmt.Errorf("Latest: %w", err)
+		}
+		if v, ok := got[id]; !ok || !v.State.Equal(lv.State) {
+			return fmt.Errorf("Latest[%d].State = %+v (ok=%v), čekáno %+v", id, v.State, ok, lv.State)
+		}
+		return nil
+	}},
+
+	{"latest/set-and-get", func(ctx context.Context, s storage.Store, r *run) error {
+		a, err := r.sensor(ctx, s, "latest_a", "generic", nil, nil)
+		if err != nil {
+			return err
+		}
+		silent, err := r.sensor(ctx, s, "latest_silent", "generic", nil, nil)
+		if err != nil {
+			return err
+		}
+		// Čas na mikrosekundy - tak ho drží Valkey
+		now := time.Now().UTC().Truncate(time.Microsecond)
+		writes := []struct {
+			lv   storage.LatestValue
+			want bool
+		}{
+			{storage.LatestValue{SensorID: a, Time: now.Add(-time.Minute), Value: 1.5}, true},
+			{storage.LatestValue{SensorID: a, Time: now, Value: -2.25, Quality: []string{"suspect"}}, true},
+			// Starší hodnota (např. znovu odeslaná zpráva) novější nepřepíše
+			{storage.LatestValue{SensorID: a, Time: now.Add(-time.Hour), Value: 99}, false},
+		}
+		for _, w := range writes {
+			written, err := s.SetLatest(ctx, w.lv)
+			if err != nil {
+				return fmt.Errorf("SetLatest: %w", err)
+			}
+			if written != w.want {
+				return fmt.Errorf("SetLatest(%v @ %s) = %v, čekáno %v", w.lv.Value, w.lv.Time.Format(time.RFC3339), written, w.want)
+			}
+		}
+		got, err := s.Latest(ctx, []int64{a, silent})
+		if err != nil {
+			return fmt.Errorf("Latest: %w", err)
+		}
+		v, ok := got[a]
+		if !ok || v.Value != -2.25 || !v.Time.Equal(now) || !slices.Equal(v.Quality, []string{"suspect"}) || v.Seq != 2 {
+			return fmt.Errorf("Latest[%d] = %+v (ok=%v), čekáno -2.25 @ %s, quality [suspect], seq 2", a, v, ok, now.Format(time.RFC3339Nano))
+		}
+		if _, ok := got[silent]; ok {
+			return fmt.Errorf("senzor bez hodnoty nemá být ve výsledku Latest")
+		}
+		return nil
+	}},
+
+	{"retention/prune", func(ctx context.Context, s storage.Store, r *run) error {
+		pruner, ok := s.(Pruner)
+		if !ok {
+			return fmt.Errorf("%w: backend retenci neřeší sám", errSkip)
+		}
+		id, err := r.sensor(ctx, s, "retention", "generic_retention", nil, nil)
+		if err != nil {
+			return err
+		}
+		// Daleko v minulosti, ať Prune nesmaže body ostatních testů (ty píšou poslední hodinu)
+		cutoff := time.Now().UTC().Truncate(time.Second).AddDate(0, 0, -30)
+		on := true
+		old := []storage.Point{
+			{SensorID: id, Time: cutoff.Add(-2 * time.Hour), Value: 1},
+			{SensorID: id, Time: cutoff.Add(-time.Second), Value: 2},
+			{SensorID: id, Time: cutoff.Add(-time.Hour), State: &storage.State{Kind: storage.KindBoolean, Bool: &on}},
+		}
+		kept := []storage.Point{
+			{SensorID: id, Time: cutoff, Value: 3}, // Přesně na hranici zůstává
+			{SensorID: id, Time: cutoff.Add(time.Hour), Value: 4},
+			{SensorID: id, Time: cutoff.Add(time.Hour), State: &storage.State{Kind: storage.KindBoolean, Bool: &on}},
+		}
+		if err := s.WritePoints(ctx, append(append([]storage.Point{}, old...), kept...)); err != nil {
+			return fmt.Errorf("WritePoints: %w", err)
+		}
+
+		deleted, err := pruner.Prune(cutoff)
+		if err != nil {
+			return fmt.Errorf("Prune: %w", err)
+		}
+		if deleted < len(old) {
+			return fmt.Errorf("Prune smazal %d bodů, čekáno alespoň %d", deleted, len(old))
+		}
+
+		from, to := cutoff.Add(-24*time.Hour), cutoff.Add(24*time.Hour)
+		numbers, err := s.ReadRange(ctx, id, from, to)
+		if err != nil {
+			return fmt.Errorf("ReadRange: %w", err)
+		}
+		if len(numbers) != 2 || numbers[0].Value != 3 || numbers[1].Value != 4 {
+			return fmt.Errorf("po Prune zbylo %v, čekány hodnoty 3 a 4", numbers)
+		}
+		states, err := s.ReadStates(ctx, id, from, to)
+		if err != nil {
+			return fmt.Errorf("ReadStates: %w", err)
+		}
+		if len(states) != 1 || !states[0].Time.Equal(cutoff.Add(time.Hour)) {
+			return fmt.Errorf("po Prune zbyly stavy %v, čekán jen stav @ %s", states, cutoff.Add(time.Hour))
+		}
+		return nil
+	}},
+}
+
+func activeIDs(ctx context.Context, s storage.Store) ([]int64, error) {
+	sensors, err := s.ActiveSensors(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ActiveSensors: %w", err)
+	}
+	ids := make([]int64, len(sensors))
+	for i, sensor := range sensors {
+		ids[i] = sensor.ID
+	}
+	return ids, nil
+}
@@ -1,16 +1,52 @@
-package main
+package sysmonitor
 
 import (
 	"os"
+	"strings"
 	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
 type Config struct {
 	MQTTBroker   string
 	MQTTClientID string
 
+	// MQTTConnect: Vlastní otevření spojení k brokeru (režim all-in-one: spojení v paměti
+	// na vestavěný broker). Nenačítá se z ENV; nil = běžné síťové spojení podle MQTTBroker.
+	MQTTConnect mqtt.OpenConnectionFunc `json:"-"`
+
 	// Interval měření (např. "60s", "1m")
 	Interval time.Duration
+
+	// Host: Identita stroje, kterou vkládáme do topicu (/msh/system/<host>/cpu).
+	// Díky tomu může běžet více monitorů (např. na více Raspberry Pi) najednou.
+	Host string
+
+	// TopicPrefix: Kořen topiců pro systémové metriky (bez koncového lomítka).
+	TopicPrefix string
+
+	// RegistryTopic: Topic, kam posíláme žádost o registraci senzorů (handshake s Ingestorem).
+	RegistryTopic string
+
+	// RegistryTimeout: Jak dlouho čekáme na potvrzení registrace, než to zkusíme znovu.
+	RegistryTimeout time.Duration
+
+	// RegistryRetryMax: Strop prodlevy mezi neúspěšnými pokusy o registraci (prodleva se
+	// zdvojuje od RegistryTimeout). Registrace se zkouší, dokud neprojde.
+	RegistryRetryMax time.Duration
+
+	// RegistryRefresh: Jak často se i po úspěšné registraci přihlášení zopakuje (Ingestor ho
+	// zpracuje idempotentně). 0 = znovu jen po obnovení spojení s brokerem.
+	RegistryRefresh time.Duration
+
+	// Presence: retained stav služby (online/offline) a interval jeho obnovy, viz modul presence.
+	// Výchozí topic obsahuje host - monitorů běží víc. Prázdný topic = presence se neposílá.
+	PresenceTopic    string
+	PresenceInterval time.Duration
+
+	// HTTPPort: Port health serveru (/health/live, /health/ready); prázdný = health server se nespouští.
+	HTTPPort string
 }
 
 func LoadConfig() Config {
@@ -20,13 +56,60 @@ func LoadConfig() Config {
 		interval = 60 * time.Second
 	}
 
+	registryTimeout, err := time.ParseDuration(getEnv("REGISTRY_TIMEOUT", "10s"))
+	if err != nil {
+		registryTimeout = 10 * time.Second
+	}
+
+	registryRetryMax, err := time.ParseDuration(getEnv("REGISTRY_RETRY_MAX", "5m"))
+	if err != nil {
+		registryRetryMax = 5 * time.Minute
+	}
+
+	registryRefresh, err := time.ParseDuration(getEnv("REGISTRY_REFRESH", "1h"))
+	if err != nil {
+		registryRefresh = time.Hour
+	}
+
+	// Výchozí identita je hostname stroje. V Dockeru je to ale ID kontejneru,
+	// proto doporučujeme nastavit MONITOR_HOST explicitně.
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "localhost"
+	}
+
+	host := sanitizeTopicLevel(getEnv("MONITOR_HOST", hostname))
+
+	presenceInterval, err := time.ParseDuration(getEnv("PRESENCE_INTERVAL", "30s"))
+	if err != nil {
+		presenceInterval = 30 * time.Second
+	}
+
 	return Config{
-		MQTTBroker:   getEnv("MQTT_BROKER", "tcp://mqtt:1883"),
-		MQTTClientID: getEnv("MQTT_CLIENT_ID", "system-monitor"),
-		Interval:     interval,
+		MQTTBroker:      getEnv("MQTT_BROKER", "tcp://mqtt:1883"),
+		MQTTClientID:    getEnv("MQTT_CLIENT_ID", "system-monitor-"+host),
+		Interval:        interval,
+		Host:            host,
+		TopicPrefix:     strings.TrimSuffix(getEnv("TOPIC_PREFIX", "/msh/system"), "/"),
+		RegistryTopic:   getEnv("REGISTRY_TOPIC", "registry/announce"),
+		RegistryTimeout: registryTimeout,
+
+		RegistryRetryMax: registryRetryMax,
+		RegistryRefresh:  registryRefresh,
+
+		PresenceTopic:    getEnv("PRESENCE_TOPIC", "presence/system-monitor-"+host),
+		PresenceInterval: presenceInterval,
+		HTTPPort:         getEnv("HTTP_PORT", "8080"),
 	}
 }
 
+// sanitizeTopicLevel upraví řetězec tak, aby byl použitelný jako jedna úroveň MQTT topicu.
+// Lomítko by vytvořilo další úroveň a znaky '+' a '#' jsou v MQTT wildcardy.
+func sanitizeTopicLevel(s string) string {
+	replacer := strings.NewReplacer("/", "_", "+", "_", "#", "_", " ", "_")
+	return strings.ToLower(replacer.Replace(strings.TrimSpace(s)))
+}
+
 func getEnv(key, fallback string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
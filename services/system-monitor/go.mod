@@ -20,3 +20,8 @@ require (
 	golang.org/x/sync v0.17.0 // indirect
 	golang.org/x/sys v0.36.0 // indirect
 )
+
+require presence v0.0.0
+
+// Sdílený balíček presence není publikovaný modul - bereme ho ze sousedního adresáře.
+replace presence => ../presence
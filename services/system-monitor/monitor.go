@@ -1,4 +1,4 @@
-package main
+package sysmonitor
 
 import (
 	"log/slog"
@@ -0,0 +1,225 @@
+package sysmonitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// --- REGISTRAČNÍ HANDSHAKE ---
+// Monitor nemá přístup do databáze. Aby mohl běžet na libovolném stroji bez ručního
+// seedování tabulky 'sensors', pošle při startu Ingestoru "přihlášku" se seznamem svých metrik.
+// Ingestor (má DB) chybějící typy a senzory založí a odpoví potvrzením (ACK).
+//
+// Průběh:
+//  1. Monitor se přihlásí k odběru svého ACK topicu (registry/ack/<host>).
+//  2. Publikuje RegistrationRequest do REGISTRY_TOPIC.
+//  3. Čeká na RegistrationAck. Pokud nepřijde včas, zkusí to znovu (s rostoucí prodlevou).
+//  4. Po obnovení spojení s brokerem (a každý REGISTRY_REFRESH) se přihlásí znovu -
+//     Ingestor přihlášku zpracuje idempotentně. Viz KeepRegistered.
+
+// SensorTypeSpec popisuje typ senzoru (řádek v tabulce sensor_types).
+type SensorTypeSpec struct {
+	Name        string   `json:"name"`
+	Unit        string   `json:"unit"`
+	Description string   `json:"description"`
+	MinValue    *float64 `json:"min_value,omitempty"`
+	MaxValue    *float64 `json:"max_value,omitempty"`
+}
+
+// SensorSpec popisuje jeden senzor (řádek v tabulce sensors).
+type SensorSpec struct {
+	Topic        string         `json:"topic"`
+	FriendlyName string         `json:"friendly_name"`
+	Location     string         `json:"location"`
+	Type         SensorTypeSpec `json:"type"`
+}
+
+// RegistrationRequest je zpráva, kterou monitor posílá při startu.
+type RegistrationRequest struct {
+	Host    string       `json:"host"`
+	ReplyTo string       `json:"reply_to"` // Topic, kam má Ingestor poslat ACK
+	Sensors []SensorSpec `json:"sensors"`
+}
+
+// RegistrationAck je odpověď Ingestoru.
+type RegistrationAck struct {
+	Host       string `json:"host"`
+	Registered int    `json:"registered"` // Počet NOVĚ založených senzorů (0 = vše už existovalo)
+	Error      string `json:"error,omitempty"`
+}
+
+// MetricDef spojuje název metriky (poslední úroveň topicu) s jejím typem
+// a funkcí, která z naměřeného snímku vytáhne hodnotu.
+type MetricDef struct {
+	Key   string // např. "cpu" -> /msh/system/<host>/cpu
+	Name  string // Čitelný název (doplní se o host)
+	Type  SensorTypeSpec
+	Value func(s *SystemStats) float64
+}
+
+func limit(v float64) *float64 { return &v }
+
+var (
+	typeCPU  = SensorTypeSpec{Name: "cpu_load", Unit: "%", Description: "Zátěž procesoru", MinValue: limit(0), MaxValue: limit(100)}
+	typeRAM  = SensorTypeSpec{Name: "ram_usage", Unit: "MB", Description: "Využití paměti", MinValue: limit(0), MaxValue: limit(64000)}
+	typeDisk = SensorTypeSpec{Name: "disk_usage", Unit: "GB", Description: "Využití disku", MinValue: limit(0), MaxValue: limit(10000)}
+)
+
+// systemMetrics je jediné místo, kde je definováno, co monitor měří a kam to posílá.
+// Registrace i periodické odesílání používají stejný seznam, takže se nemohou rozejít.
+var systemMetrics = []MetricDef{
+	{Key: "cpu", Name: "System CPU Load", Type: typeCPU, Value: func(s *SystemStats) float64 { return s.CPULoad }},
+	{Key: "ram_used", Name: "System RAM Used", Type: typeRAM, Value: func(s *SystemStats) float64 { return s.RamUsedMB }},
+	{Key: "ram_total", Name: "System RAM Total", Type: typeRAM, Value: func(s *SystemStats) float64 { return s.RamTotalMB }},
+	{Key: "app_ram", Name: "IoT Stack RAM", Type: typeRAM, Value: func(s *SystemStats) float64 { return s.AppRamUsedMB }},
+	{Key: "disk_used", Name: "Root Disk Used", Type: typeDisk, Value: func(s *SystemStats) float64 { return s.DiskUsedGB }},
+	{Key: "disk_total", Name: "System Disk Total", Type: typeDisk, Value: func(s *SystemStats) float64 { return s.DiskTotalGB }},
+}
+
+// metricTopic sestaví topic metriky pro daný host: /msh/system/<host>/<key>
+func metricTopic(cfg Config, key string) string {
+	return fmt.Sprintf("%s/%s/%s", cfg.TopicPrefix, cfg.Host, key)
+}
+
+// buildRegistrationRequest připraví přihlášku se všemi metrikami tohoto hostu.
+func buildRegistrationRequest(cfg Config) RegistrationRequest {
+	req := RegistrationRequest{
+		Host:    cfg.Host,
+		ReplyTo: "registry/ack/" + cfg.Host,
+	}
+	for _, m := range systemMetrics {
+		req.Sensors = append(req.Sensors, SensorSpec{
+			Topic:        metricTopic(cfg, m.Key),
+			FriendlyName: fmt.Sprintf("%s (%s)", m.Name, cfg.Host),
+			Location:     cfg.Host,
+			Type:         m.Type,
+		})
+	}
+	return req
+}
+
+// KeepRegistered drží registraci senzorů u Ingestoru, dokud neskončí ctx. Běží na pozadí -
+// měření se odesílá i bez registrace (data se do ní odmítají, ale nic dalšího nečeká).
+//
+//  1. Hned po startu pošle přihlášku a čeká na ACK.
+//  2. Když ACK nepřijde (Ingestor ještě neběží) nebo ho Ingestor odmítne, zkusí to znovu
+//     s prodlevou zdvojovanou od RegistryTimeout až do RegistryRetryMax.
+//  3. Po potvrzení čeká na signál z 'reconnect' (obnovené spojení s brokerem - Ingestor mohl
+//     mezitím přijít o DB) nebo na RegistryRefresh a přihlásí se znovu.
+//
+// Opakovaná přihláška nevadí: Ingestor zakládá jen chybějící typy a senzory.
+func KeepRegistered(ctx context.Context, client mqtt.Client, reconnect <-chan struct{}, cfg Config, logger *slog.Logger) {
+	req := buildRegistrationRequest(cfg)
+	payload, err := json.Marshal(req)
+	if err != nil {
+		logger.Error("Serializace registrace selhala", "error", err)
+		return
+	}
+
+	var refresh <-chan time.Time
+	if cfg.RegistryRefresh > 0 {
+		ticker := time.NewTicker(cfg.RegistryRefresh)
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
+
+	for {
+		// Přihláška pokryje i reconnecty, které přišly mezitím (např. první připojení)
+		drain(reconnect)
+
+		// 1.+2. Pokusy do potvrzení (s rostoucí prodlevou)
+		backoff := cfg.RegistryTimeout
+		for attempt := 1; ; attempt++ {
+			err := registerOnce(ctx, client, req, payload, cfg, logger, attempt)
+			if err == nil {
+				break
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Warn("Registrace senzorů selhala, zkusím znovu", "error", err, "attempt", attempt, "retry_in", backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, max(cfg.RegistryRetryMax, cfg.RegistryTimeout))
+		}
+
+		// 3. Čekáme na důvod k nové přihlášce
+		select {
+		case <-ctx.Done():
+			return
+		case <-reconnect:
+			logger.Info("Spojení s brokerem obnoveno, obnovuji registraci senzorů")
+		case <-refresh:
+		}
+	}
+}
+
+// registerOnce pošle jednu přihlášku a počká na ACK (nejvýše RegistryTimeout).
+func registerOnce(ctx context.Context, client mqtt.Client, req RegistrationRequest, payload []byte, cfg Config, logger *slog.Logger, attempt int) error {
+	// Kanál s bufferem 1: handler MQTT knihovny nesmí nikdy blokovat.
+	ackChan := make(chan RegistrationAck, 1)
+
+	// 1. Nejdřív se přihlásíme k odběru odpovědi (jinak bychom ji mohli propásnout).
+	// Odběr se obnovuje při každém pokusu - po reconnectu (clean session) by jinak chyběl.
+	token := client.Subscribe(req.ReplyTo, 1, func(_ mqtt.Client, msg mqtt.Message) {
+		var ack RegistrationAck
+		if err := json.Unmarshal(msg.Payload(), &ack); err != nil {
+			logger.Warn("Neplatná odpověď registrace", "payload", string(msg.Payload()), "error", err)
+			return
+		}
+		select {
+		case ackChan <- ack:
+		default:
+		}
+	})
+	if !token.WaitTimeout(cfg.RegistryTimeout) {
+		return fmt.Errorf("subscribe na %s nestihl potvrzení", req.ReplyTo)
+	}
+	if token.Error() != nil {
+		return fmt.Errorf("subscribe na %s selhal: %w", req.ReplyTo, token.Error())
+	}
+	defer client.Unsubscribe(req.ReplyTo)
+
+	// 2. Pošleme přihlášku a čekáme na ACK.
+	logger.Info("Posílám registraci senzorů", "host", cfg.Host, "sensors", len(req.Sensors), "attempt", attempt)
+	token = client.Publish(cfg.RegistryTopic, 1, false, payload)
+	if !token.WaitTimeout(cfg.RegistryTimeout) {
+		return errors.New("publikace registrace nestihla potvrzení")
+	}
+	if token.Error() != nil {
+		return fmt.Errorf("publikace registrace selhala: %w", token.Error())
+	}
+
+	select {
+	case ack := <-ackChan:
+		if ack.Error != "" {
+			return fmt.Errorf("ingestor registraci odmítl: %s", ack.Error)
+		}
+		logger.Info("Registrace potvrzena", "host", ack.Host, "new_sensors", ack.Registered)
+		return nil
+	case <-time.After(cfg.RegistryTimeout):
+		return fmt.Errorf("registrace nepotvrzena do %s", cfg.RegistryTimeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drain vyprázdní signálový kanál (neblokuje).
+func drain(ch <-chan struct{}) {
+	for {
+		select {
+		case <-ch:
+		default:
+			return
+		}
+	}
+}
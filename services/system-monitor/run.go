@@ -0,0 +1,129 @@
+package sysmonitor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"presence"
+)
+
+// Run spustí System Monitor a blokuje, dokud není zrušen ctx (signál, all-in-one shutdown).
+// Chyba se vrací jen při startu (připojení k MQTT) - o ukončení procesu rozhoduje volající.
+func Run(ctx context.Context, cfg Config, logger *slog.Logger) error {
+	// 1.+2. Logger a konfiguraci dostáváme od volajícího (cmd/ nebo all-in-one)
+	logger.Info("Startuji System Monitor", "interval", cfg.Interval, "host", cfg.Host)
+
+	// 3. Konfigurace MQTT Klienta
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(cfg.MQTTBroker)
+	opts.SetClientID(cfg.MQTTClientID)
+	opts.SetCustomOpenConnectionFn(cfg.MQTTConnect)
+
+	// Presence: v host uvádíme identitu stroje z topiců (v Dockeru je hostname ID kontejneru).
+	// Last Will "offline" se musí nastavit před připojením.
+	pres := presence.New("system-monitor", cfg.PresenceTopic, cfg.PresenceInterval, logger)
+	pres.SetHost(cfg.Host)
+	pres.SetWill(opts)
+
+	// Každé (i obnovené) připojení k brokeru je důvod znovu poslat registraci senzorů
+	// (viz KeepRegistered). Handler MQTT knihovny nesmí blokovat - stačí jeden čekající signál.
+	reconnect := make(chan struct{}, 1)
+	opts.SetOnConnectHandler(func(mqtt.Client) {
+		select {
+		case reconnect <- struct{}{}:
+		default:
+		}
+	})
+
+	// Vytvoření instance klienta
+	client := mqtt.NewClient(opts)
+
+	// Připojení k brokeru (blokující operace s Tokenem)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("selhalo připojení k MQTT: %w", token.Error()) // Bez MQTT nemá smysl běžet
+	}
+	// Zajistíme odpojení při ukončení. Defery běží pozpátku - "offline" odejde před odpojením.
+	defer client.Disconnect(250)
+	defer pres.Offline(client)
+
+	// Jedinou závislostí je broker. Health a presence běží do zrušení ctx.
+	pres.AddCheck("mqtt", presence.MQTTProbe(client))
+	if cfg.HTTPPort != "" {
+		go pres.ServeHealth(ctx, cfg.HTTPPort)
+	}
+	go pres.Run(ctx, client)
+
+	// 4. Nastavení časovače (Ticker)
+	// Ticker bude posílat signál do kanálu ticker.C každých X sekund (podle configu).
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	// 5. Graceful Shutdown řeší volající zrušením ctx (CTRL+C, docker stop, konec all-in-one).
+
+	// Pomocná funkce (closure) pro odesílání dat.
+	// Zapouzdřuje logiku formátování a volání MQTT knihovny.
+	publish := func(topic string, value float64) {
+		// Převedeme float na string (např. 12.50)
+		payload := fmt.Sprintf("%.2f", value)
+
+		// Odeslání zprávy (QoS 0, Retained = false)
+		token := client.Publish(topic, 0, false, payload)
+		token.Wait() // Čekáme na potvrzení odeslání (lokální, ne od brokera u QoS 0)
+
+		// Logujeme odeslání (v Debug levelu, aby to nespamovalo, pokud si nepřejeme)
+		logger.Info("Metrika odeslána", "topic", topic, "val", payload)
+	}
+
+	// publishStats odešle všechny metriky jednoho snímku.
+	// Topicy se skládají z hostu, takže více monitorů si navzájem nepřepisuje data.
+	publishStats := func(stats *SystemStats) {
+		for _, m := range systemMetrics {
+			publish(metricTopic(cfg, m.Key), m.Value(stats))
+		}
+	}
+
+	// REGISTRACE SENZORŮ (Handshake s Ingestorem)
+	// Nový stroj si sám založí senzory v DB. Registrace běží na pozadí a zkouší se, dokud
+	// neprojde - do té doby budou data odmítána. Po reconnectu se opakuje.
+	go KeepRegistered(ctx, client, reconnect, cfg, logger)
+
+	// OKAMŽITÉ ODESLÁNÍ PŘI STARTU
+	// Nechceme čekat např. 60 sekund na první tik časovače.
+	// Spustíme to v anonymní goroutině, aby to neblokovalo start smyčky.
+	go func() {
+		logger.Info("Provádím prvotní měření...")
+		stats, err := CollectStats(logger)
+		if err == nil {
+			publishStats(stats)
+		}
+	}()
+
+	// 6. Hlavní nekonečná smyčka
+	logger.Info("Vstupuji do hlavní smyčky")
+	for {
+		select {
+		// A) Context zrušen (signál k ukončení)
+		case <-ctx.Done():
+			logger.Info("Přijat signál ukončení, vypínám...")
+			return nil // Vyskočí z Run(), spustí se defery
+
+		// B) Tiknul časovač (např. každou minutu)
+		case <-ticker.C:
+			// Sběr dat z HW (monitor.go)
+			// Tato operace může chvíli trvat (měření CPU trvá min 1s).
+			stats, err := CollectStats(logger)
+			if err != nil {
+				logger.Error("Chyba při měření", "error", err)
+				continue // Zkusíme to zase příště
+			}
+
+			// Odeslání všech metrik do MQTT
+			// Ingestor si je přebere podle topiců.
+			publishStats(stats)
+		}
+	}
+}
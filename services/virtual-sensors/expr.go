@@ -0,0 +1,426 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// --- JAZYK VÝRAZŮ ---
+// Bezpečný mini-jazyk pro virtuální senzory. Umí jen aritmetiku nad posledními hodnotami
+// jiných senzorů a pár funkcí - žádné proměnné, smyčky ani přístup k systému.
+//
+// Gramatika:
+//
+//	expr    := term (('+' | '-') term)*
+//	term    := unary (('*' | '/') unary)*
+//	unary   := '-' unary | power
+//	power   := primary ('^' unary)?
+//	primary := číslo | ref | funkce '(' expr (',' expr)* ')' | '(' expr ')'
+//	ref     := '$' ID senzoru | '${' MQTT topic '}'
+//
+// Příklady:
+//
+//	dewpoint($3, $4)
+//	100 * (1 - ${/msh/system/rpi1/ram_used} / ${/msh/system/rpi1/ram_total})
+//	$12 - $15
+
+const (
+	maxExprLength = 1024 // Delší výraz je téměř jistě chyba
+	maxExprDepth  = 32   // Ochrana zásobníku proti "((((((...))))))"
+)
+
+// ErrMissingInput značí, že některý vstupní senzor zatím nemá hodnotu.
+var ErrMissingInput = errors.New("chybí hodnota vstupního senzoru")
+
+// TopicResolver převede MQTT topic na ID senzoru (pro zápis ${topic}).
+type TopicResolver func(topic string) (int64, bool)
+
+// Expr je zkompilovaný výraz.
+type Expr struct {
+	Source string
+	Inputs []int64 // Senzory, na kterých výraz závisí (seřazené, bez duplicit)
+	root   node
+}
+
+// Eval vyhodnotí výraz nad hodnotami senzorů.
+func (e *Expr) Eval(values map[int64]float64) (float64, error) {
+	v, err := e.root.eval(values)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("výsledek není konečné číslo")
+	}
+	return v, nil
+}
+
+// CompileExpr rozparsuje výraz a ověří odkazy na senzory.
+func CompileExpr(src string, resolve TopicResolver) (*Expr, error) {
+	if len(src) > maxExprLength {
+		return nil, fmt.Errorf("výraz je delší než %d znaků", maxExprLength)
+	}
+
+	p := &parser{src: src, resolve: resolve, inputs: make(map[int64]struct{})}
+	root, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return nil, p.errorf("neočekávaný znak %q", p.src[p.pos])
+	}
+
+	inputs := make([]int64, 0, len(p.inputs))
+	for id := range p.inputs {
+		inputs = append(inputs, id)
+	}
+	sort.Slice(inputs, func(i, j int) bool { return inputs[i] < inputs[j] })
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("výraz neodkazuje na žádný senzor")
+	}
+
+	return &Expr{Source: src, Inputs: inputs, root: root}, nil
+}
+
+// --- AST ---
+
+type node interface {
+	eval(values map[int64]float64) (float64, error)
+}
+
+type numNode float64
+
+func (n numNode) eval(map[int64]float64) (float64, error) { return float64(n), nil }
+
+type refNode int64
+
+func (n refNode) eval(values map[int64]float64) (float64, error) {
+	v, ok := values[int64(n)]
+	if !ok {
+		return 0, fmt.Errorf("%w (senzor %d)", ErrMissingInput, int64(n))
+	}
+	return v, nil
+}
+
+type negNode struct{ x node }
+
+func (n negNode) eval(values map[int64]float64) (float64, error) {
+	v, err := n.x.eval(values)
+	return -v, err
+}
+
+type binNode struct {
+	op   byte
+	l, r node
+}
+
+func (n binNode) eval(values map[int64]float64) (float64, error) {
+	l, err := n.l.eval(values)
+	if err != nil {
+		return 0, err
+	}
+	r, err := n.r.eval(values)
+	if err != nil {
+		return 0, err
+	}
+
+	switch n.op {
+	case '+':
+		return l + r, nil
+	case '-':
+		return l - r, nil
+	case '*':
+		return l * r, nil
+	case '/':
+		if r == 0 {
+			return 0, fmt.Errorf("dělení nulou")
+		}
+		return l / r, nil
+	default: // '^'
+		return math.Pow(l, r), nil
+	}
+}
+
+type callNode struct {
+	fn   funcDef
+	args []node
+}
+
+func (n callNode) eval(values map[int64]float64) (float64, error) {
+	args := make([]float64, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(values)
+		if err != nil {
+			return 0, err
+		}
+		args[i] = v
+	}
+	return n.fn.call(args)
+}
+
+// --- FUNKCE ---
+
+type funcDef struct {
+	minArgs, maxArgs int // maxArgs -1 = libovolně
+	call             func(args []float64) (float64, error)
+}
+
+var functions = map[string]funcDef{
+	"abs": {1, 1, func(a []float64) (float64, error) { return math.Abs(a[0]), nil }},
+	"min": {1, -1, func(a []float64) (float64, error) {
+		m := a[0]
+		for _, v := range a[1:] {
+			m = math.Min(m, v)
+		}
+		return m, nil
+	}},
+	"max": {1, -1, func(a []float64) (float64, error) {
+		m := a[0]
+		for _, v := range a[1:] {
+			m = math.Max(m, v)
+		}
+		return m, nil
+	}},
+	"avg": {1, -1, func(a []float64) (float64, error) {
+		sum := 0.0
+		for _, v := range a {
+			sum += v
+		}
+		return sum / float64(len(a)), nil
+	}},
+	"dewpoint": {2, 2, dewpoint},
+}
+
+// dewpoint(teplota °C, relativní vlhkost %) - rosný bod podle Magnusova vzorce
+// (konstanty Sonntag 1990, přesnost ±0.35 °C v rozsahu -45 až 60 °C).
+func dewpoint(a []float64) (float64, error) {
+	t, rh := a[0], a[1]
+	if rh <= 0 || rh > 100 {
+		return 0, fmt.Errorf("dewpoint: vlhkost %.1f %% mimo rozsah (0, 100]", rh)
+	}
+	const b, c = 17.62, 243.12
+	gamma := math.Log(rh/100) + b*t/(c+t)
+	return c * gamma / (b - gamma), nil
+}
+
+// --- PARSER ---
+// Klasický "recursive descent": co funkce, to pravidlo gramatiky.
+
+type parser struct {
+	src     string
+	pos     int
+	resolve TopicResolver
+	inputs  map[int64]struct{}
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("pozice %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+// peek vrátí další znak (po mezerách), 0 na konci vstupu.
+func (p *parser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *parser) parseExpr(depth int) (node, error) {
+	if depth > maxExprDepth {
+		return nil, p.errorf("výraz je příliš zanořený")
+	}
+	left, err := p.parseTerm(depth)
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		right, err := p.parseTerm(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = binNode{op: op, l: left, r: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseTerm(depth int) (node, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = binNode{op: op, l: left, r: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary(depth int) (node, error) {
+	if depth > maxExprDepth {
+		return nil, p.errorf("výraz je příliš zanořený")
+	}
+	if p.peek() == '-' {
+		p.pos++
+		x, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return negNode{x: x}, nil
+	}
+	return p.parsePower(depth)
+}
+
+func (p *parser) parsePower(depth int) (node, error) {
+	base, err := p.parsePrimary(depth)
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() == '^' {
+		p.pos++
+		// Pravá asociativita: 2^3^2 = 2^(3^2)
+		exp, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return binNode{op: '^', l: base, r: exp}, nil
+	}
+	return base, nil
+}
+
+func (p *parser) parsePrimary(depth int) (node, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, p.errorf("neočekávaný konec výrazu")
+
+	case c == '(':
+		p.pos++
+		inner, err := p.parseExpr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, p.errorf("chybí ')'")
+		}
+		p.pos++
+		return inner, nil
+
+	case c == '$':
+		return p.parseRef()
+
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		text := p.src[start:p.pos]
+		v, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			p.pos = start
+			return nil, p.errorf("neplatné číslo %q", text)
+		}
+		return numNode(v), nil
+
+	case unicode.IsLetter(rune(c)):
+		return p.parseCall(depth)
+
+	default:
+		return nil, p.errorf("neočekávaný znak %q", c)
+	}
+}
+
+// parseRef: $12 nebo ${/msh/topic}
+func (p *parser) parseRef() (node, error) {
+	p.pos++ // '$'
+
+	if p.pos < len(p.src) && p.src[p.pos] == '{' {
+		end := strings.IndexByte(p.src[p.pos:], '}')
+		if end < 0 {
+			return nil, p.errorf("chybí '}'")
+		}
+		topic := p.src[p.pos+1 : p.pos+end]
+		if p.resolve == nil {
+			return nil, p.errorf("odkaz na topic není podporován")
+		}
+		id, ok := p.resolve(topic)
+		if !ok {
+			return nil, p.errorf("neznámý topic %q", topic)
+		}
+		p.pos += end + 1
+		p.inputs[id] = struct{}{}
+		return refNode(id), nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+		p.pos++
+	}
+	id, err := strconv.ParseInt(p.src[start:p.pos], 10, 64)
+	if err != nil || id <= 0 {
+		return nil, p.errorf("očekáváno ID senzoru za '$'")
+	}
+	p.inputs[id] = struct{}{}
+	return refNode(id), nil
+}
+
+// parseCall: jméno '(' argumenty ')'
+func (p *parser) parseCall(depth int) (node, error) {
+	start := p.pos
+	for p.pos < len(p.src) && (unicode.IsLetter(rune(p.src[p.pos])) || isDigit(p.src[p.pos]) || p.src[p.pos] == '_') {
+		p.pos++
+	}
+	name := strings.ToLower(p.src[start:p.pos])
+
+	fn, ok := functions[name]
+	if !ok {
+		p.pos = start
+		return nil, p.errorf("neznámá funkce %q", name)
+	}
+	if p.peek() != '(' {
+		return nil, p.errorf("za funkcí %s chybí '('", name)
+	}
+	p.pos++
+
+	var args []node
+	if p.peek() != ')' {
+		for {
+			arg, err := p.parseExpr(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.peek() != ',' {
+				break
+			}
+			p.pos++
+		}
+	}
+	if p.peek() != ')' {
+		return nil, p.errorf("chybí ')' za argumenty funkce %s", name)
+	}
+	p.pos++
+
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, fmt.Errorf("funkce %s: nesprávný počet argumentů (%d)", name, len(args))
+	}
+	return callNode{fn: fn, args: args}, nil
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
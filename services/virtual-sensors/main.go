@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"presence"
+)
+
+func main() {
+	// 1. Setup Logger
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	slog.SetDefault(logger)
+
+	cfg := LoadConfig()
+	logger.Info("Startuji Virtual Sensors", "config", cfg)
+
+	// 2. Připojení k DB
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dbPool, err := pgxpool.New(ctx, cfg.PostgresURL)
+	if err != nil {
+		logger.Error("Kritická chyba: Nelze se připojit k DB", "error", err)
+		os.Exit(1)
+	}
+	defer dbPool.Close()
+	store := NewStore(dbPool)
+
+	// 3. MQTT Klient
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(cfg.MQTTBroker)
+	opts.SetClientID(cfg.MQTTClientID)
+	opts.SetAutoReconnect(true)
+
+	// Presence: Last Will "offline" se musí nastavit před připojením (viz modul presence)
+	pres := presence.New("virtual-sensors", cfg.PresenceTopic, cfg.PresenceInterval, logger)
+	pres.SetWill(opts)
+
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		logger.Error("MQTT connection failed", "error", token.Error())
+		os.Exit(1)
+	}
+	// Defery běží pozpátku - "offline" odejde před odpojením
+	defer client.Disconnect(250)
+	defer pres.Offline(client)
+
+	// Závislosti: broker a DB. Health a presence běží do zrušení ctx.
+	pres.AddCheck("mqtt", presence.MQTTProbe(client))
+	pres.AddCheck("postgres", dbPool.Ping)
+	if cfg.HTTPPort != "" {
+		go pres.ServeHealth(ctx, cfg.HTTPPort)
+	}
+	go pres.Run(ctx, client)
+
+	evaluator := NewEvaluator(client, logger)
+	transformer := NewTransformer(client, logger)
+
+	// reload načte definice a zkompiluje výrazy. Neplatná definice se přeskočí.
+	reload := func() {
+		loadCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		rows, err := store.LoadVirtuals(loadCtx)
+		if err != nil {
+			logger.Error("Načtení virtuálních senzorů selhalo", "error", err)
+			return
+		}
+		topics, err := store.LoadTopics(loadCtx)
+		if err != nil {
+			logger.Error("Načtení topiců selhalo", "error", err)
+			return
+		}
+
+		resolve := func(topic string) (int64, bool) {
+			id, ok := topics[topic]
+			return id, ok
+		}
+		virtuals, failed := CompileVirtuals(rows, resolve)
+		for id, err := range failed {
+			logger.Error("Neplatný virtuální senzor, přeskakuji", "sensor_id", id, "error", err)
+		}
+		evaluator.SetVirtuals(virtuals)
+		logger.Debug("Virtuální senzory načteny", "count", len(virtuals))
+
+		// Časové transformace (integrál, derivace) - integrály navazují na poslední uložený součet
+		defs, err := store.LoadTransforms(loadCtx)
+		if err != nil {
+			logger.Error("Načtení transformací selhalo", "error", err)
+			return
+		}
+		transforms, failedTransforms := CheckTransforms(defs)
+		for id, err := range failedTransforms {
+			logger.Error("Neplatná transformace, přeskakuji", "sensor_id", id, "error", err)
+		}
+		var outputs []int64
+		for id, t := range transforms {
+			if t.Kind == TransformIntegral {
+				outputs = append(outputs, id)
+			}
+		}
+		totals, err := store.LoadTotals(loadCtx, outputs)
+		if err != nil {
+			logger.Error("Načtení součtů integrálů selhalo", "error", err)
+			return
+		}
+		transformer.SetTransforms(transforms, totals)
+		logger.Debug("Transformace načteny", "count", len(transforms))
+	}
+
+	// 4. Počáteční stav
+	seedCtx, seedCancel := context.WithTimeout(ctx, 10*time.Second)
+	if readings, err := store.LoadLastReadings(seedCtx); err != nil {
+		logger.Error("Načtení posledních hodnot selhalo, začínám bez nich", "error", err)
+	} else {
+		evaluator.Seed(readings)
+	}
+	seedCancel()
+	reload()
+
+	// 5. Subscribe na normalizované hodnoty (výstup Ingestoru) - výrazy i transformace
+	handleEvent := func(c mqtt.Client, msg mqtt.Message) {
+		evaluator.HandleEvent(c, msg)
+		transformer.HandleEvent(c, msg)
+	}
+	if token := client.Subscribe(cfg.EventsTopic, 0, handleEvent); token.Wait() && token.Error() != nil {
+		logger.Error("Subscribe failed", "topic", cfg.EventsTopic, "error", token.Error())
+		os.Exit(1)
+	}
+	logger.Info("Poslouchám na topicu", "topic", cfg.EventsTopic)
+
+	// 6. Periodický reload definic
+	ticker := time.NewTicker(cfg.ReloadInterval)
+	defer ticker.Stop()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	for {
+		select {
+		case <-sigChan:
+			logger.Info("Vypínám službu...")
+			return
+		case <-ticker.C:
+			reload()
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Store zapouzdřuje práci s DB.
+type Store struct {
+	db *pgxpool.Pool
+}
+
+// NewStore - konstruktor
+func NewStore(db *pgxpool.Pool) *Store {
+	return &Store{db: db}
+}
+
+// LoadVirtuals načte zapnuté virtuální senzory (jen ty, jejichž senzor je aktivní).
+func (s *Store) LoadVirtuals(ctx context.Context) ([]VirtualRow, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT v.sensor_id, COALESCE(s.friendly_name, s.mqtt_topic), s.mqtt_topic, v.expression, v.max_input_age_seconds
+		FROM virtual_sensors v
+		JOIN sensors s ON s.id = v.sensor_id
+		WHERE v.enabled = true AND COALESCE(s.is_active, false) = true
+		ORDER BY v.sensor_id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("SQL query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var result []VirtualRow
+	for rows.Next() {
+		var r VirtualRow
+		var maxAge int
+		if err := rows.Scan(&r.SensorID, &r.Name, &r.Topic, &r.Expression, &maxAge); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		r.MaxInputAge = time.Duration(maxAge) * time.Second
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// LoadTopics vrací mapu MQTT topic -> ID senzoru (pro odkazy ${topic} ve výrazech).
+func (s *Store) LoadTopics(ctx context.Context) (map[string]int64, error) {
+	rows, err := s.db.Query(ctx, `SELECT id, mqtt_topic FROM sensors`)
+	if err != nil {
+		return nil, fmt.Errorf("SQL query failed: %w", err)
+	}
+	defer rows.Close()
+
+	topics := make(map[string]int64)
+	for rows.Next() {
+		var id int64
+		var topic string
+		if err := rows.Scan(&id, &topic); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		topics[topic] = id
+	}
+	return topics, rows.Err()
+}
+
+// LoadLastReadings vrátí poslední hodnotu každého senzoru za poslední hodinu.
+func (s *Store) LoadLastReadings(ctx context.Context) (map[int64]Reading, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT DISTINCT ON (sensor_id) sensor_id, value, time
+		FROM sensor_data
+		WHERE time > NOW() - INTERVAL '1 hour'
+		ORDER BY sensor_id, time DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("SQL query failed: %w", err)
+	}
+	defer rows.Close()
+
+	readings := make(map[int64]Reading)
+	for rows.Next() {
+		var id int64
+		var r Reading
+		if err := rows.Scan(&id, &r.Value, &r.Time); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		readings[id] = r
+	}
+	return readings, rows.Err()
+}
+
+// LoadTransforms načte zapnuté časové transformace (jen s aktivním výstupním senzorem).
+func (s *Store) LoadTransforms(ctx context.Context) ([]Transform, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT t.sensor_id, COALESCE(s.friendly_name, s.mqtt_topic), s.mqtt_topic,
+		       t.source_sensor_id, COALESCE(st.is_counter, false),
+		       t.kind, t.time_unit_seconds, t.factor, t.max_gap_seconds
+		FROM sensor_transforms t
+		JOIN sensors s ON s.id = t.sensor_id
+		JOIN sensors src ON src.id = t.source_sensor_id
+		JOIN sensor_types st ON st.id = src.sensor_type_id
+		WHERE t.enabled = true AND COALESCE(s.is_active, false) = true
+		ORDER BY t.sensor_id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("SQL query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var result []Transform
+	for rows.Next() {
+		var t Transform
+		var unitSec, gapSec int
+		if err := rows.Scan(&t.SensorID, &t.Name, &t.Topic, &t.SourceID, &t.SourceCounter,
+			&t.Kind, &unitSec, &t.Factor, &gapSec); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		t.TimeUnit = time.Duration(unitSec) * time.Second
+		t.MaxGap = time.Duration(gapSec) * time.Second
+		result = append(result, t)
+	}
+	return result, rows.Err()
+}
+
+// LoadTotals vrátí poslední uloženou hodnotu zadaných senzorů bez ohledu na stáří
+// (integrál po restartu navazuje na dosavadní součet).
+func (s *Store) LoadTotals(ctx context.Context, ids []int64) (map[int64]float64, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT DISTINCT ON (sensor_id) sensor_id, value
+		FROM sensor_data
+		WHERE sensor_id = ANY($1)
+		ORDER BY sensor_id, time DESC`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("SQL query failed: %w", err)
+	}
+	defer rows.Close()
+
+	totals := make(map[int64]float64)
+	for rows.Next() {
+		var id int64
+		var v float64
+		if err := rows.Scan(&id, &v); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		totals[id] = v
+	}
+	return totals, rows.Err()
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// --- ČASOVÉ TRANSFORMACE (INTEGRÁL, DERIVACE) ---
+// Výraz virtuálního senzoru (virtual.go) počítá z POSLEDNÍCH hodnot vstupů. Energie z výkonu
+// nebo průtok z vodoměru ale potřebují i ČAS mezi měřeními:
+//
+//	integral:   výstup += (předchozí + nová) / 2 * dt / time_unit * factor   (lichoběžníky)
+//	derivative: výstup  = (nová - předchozí) / dt * time_unit * factor
+//
+// time_unit je jednotka času výsledku (3600 s: W -> Wh, 60 s: l -> l/min), factor převod
+// jednotky (0.001: Wh -> kWh). Časy jsou časy MĚŘENÍ z události, ne časy příjmu.
+//
+// Mezera delší než max_gap (senzor byl offline) se neintegruje - nevíme, co se v ní dělo.
+// Integrál na dalším bodu jen naváže, derivace se přes mezeru nepočítá.
+//
+// Integrál je kumulativní (typ výstupu má být počítadlo, viz postgres.sql sekce 19) - po restartu
+// služby navazuje na poslední uloženou hodnotu výstupního senzoru. Derivace počítadla přes reset
+// (pokles hodnoty) se přeskočí.
+
+// Druhy transformací (sensor_transforms.kind).
+const (
+	TransformIntegral   = "integral"
+	TransformDerivative = "derivative"
+)
+
+// transformState je průběžný stav jedné transformace.
+type transformState struct {
+	def   Transform
+	last  *Reading // Poslední bod zdroje (nil = čekáme na první)
+	total float64  // Integrál: dosavadní součet
+}
+
+// CheckTransforms odmítne neplatné definice a cykly (integrál A ze zdroje B, derivace B z A).
+// Vrací platné transformace a chyby neplatných (podle ID výstupního senzoru).
+func CheckTransforms(defs []Transform) (map[int64]Transform, map[int64]error) {
+	valid := make(map[int64]Transform)
+	failed := make(map[int64]error)
+	for _, t := range defs {
+		switch {
+		case t.Kind != TransformIntegral && t.Kind != TransformDerivative:
+			failed[t.SensorID] = fmt.Errorf("neznámý druh transformace %q", t.Kind)
+		case t.TimeUnit <= 0 || t.MaxGap <= 0:
+			failed[t.SensorID] = fmt.Errorf("time_unit i max_gap musí být kladné")
+		case t.SourceID == t.SensorID:
+			failed[t.SensorID] = fmt.Errorf("transformace nemůže mít za zdroj sama sebe")
+		default:
+			valid[t.SensorID] = t
+		}
+	}
+
+	// Cyklus: řetěz zdrojů se vrátí k výchozímu výstupu
+	for id := range valid {
+		seen := map[int64]bool{id: true}
+		for cur := valid[id].SourceID; ; {
+			next, ok := valid[cur]
+			if !ok {
+				break // Zdroj není výstupem transformace - konec řetězu
+			}
+			if seen[cur] {
+				failed[id] = fmt.Errorf("cyklická závislost transformací")
+				break
+			}
+			seen[cur] = true
+			cur = next.SourceID
+		}
+	}
+	for id := range failed {
+		delete(valid, id)
+	}
+	return valid, failed
+}
+
+// Transformer drží stav transformací a přepočítává je při nové hodnotě zdroje.
+type Transformer struct {
+	client mqtt.Client
+	logger *slog.Logger
+
+	// mu chrání mapy - HandleEvent běží v MQTT goroutině, SetTransforms v hlavní smyčce.
+	mu       sync.Mutex
+	states   map[int64]*transformState   // výstupní senzor -> stav
+	bySource map[int64][]*transformState // zdrojový senzor -> transformace, které z něj počítají
+}
+
+// NewTransformer - konstruktor
+func NewTransformer(client mqtt.Client, logger *slog.Logger) *Transformer {
+	return &Transformer{
+		client:   client,
+		logger:   logger,
+		states:   make(map[int64]*transformState),
+		bySource: make(map[int64][]*transformState),
+	}
+}
+
+// SetTransforms nahradí sadu transformací. Stav transformace, jejíž definice se nezměnila,
+// zůstává (reload nesmí ztratit rozpočítaný integrál). totals jsou poslední uložené hodnoty
+// výstupů - počáteční součet nové (nebo změněné) integrace.
+func (t *Transformer) SetTransforms(defs map[int64]Transform, totals map[int64]float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	states := make(map[int64]*transformState, len(defs))
+	bySource := make(map[int64][]*transformState)
+	for id, def := range defs {
+		st, ok := t.states[id]
+		if !ok || st.def != def {
+			st = &transformState{def: def, total: totals[id]}
+		}
+		states[id] = st
+		bySource[def.SourceID] = append(bySource[def.SourceID], st)
+	}
+	t.states = states
+	t.bySource = bySource
+}
+
+// HandleEvent je MQTT callback pro normalizované hodnoty (stejný topic jako Evaluator).
+func (t *Transformer) HandleEvent(_ mqtt.Client, msg mqtt.Message) {
+	var ev SensorEvent
+	if err := json.Unmarshal(msg.Payload(), &ev); err != nil {
+		return // Neplatnou zprávu už zalogoval Evaluator
+	}
+	if !ev.numeric() {
+		return // Integrál ani derivace ze stavu (enum, text, geo) nedávají smysl - viz Evaluator
+	}
+	if ev.Timestamp.IsZero() {
+		ev.Timestamp = time.Now()
+	}
+	r := Reading{Value: ev.Value, Time: ev.Timestamp}
+
+	// Výpočty pod zámkem, publikace až po jeho uvolnění (jako Evaluator).
+	type result struct {
+		def   Transform
+		value float64
+	}
+	var results []result
+	t.mu.Lock()
+	for _, st := range t.bySource[ev.SensorID] {
+		if value, ok := st.step(r); ok {
+			results = append(results, result{def: st.def, value: value})
+		}
+	}
+	t.mu.Unlock()
+
+	for _, res := range results {
+		t.publish(res.def, res.value)
+	}
+}
+
+// step započítá nový bod zdroje. Vrací výstup a zda se má publikovat. Volat pod zámkem.
+func (st *transformState) step(r Reading) (float64, bool) {
+	prev := st.last
+	if prev != nil && !r.Time.After(prev.Time) {
+		return 0, false // Starší nebo duplicitní bod (znovu odeslaná zpráva) - pořadí by rozbil
+	}
+	st.last = &r
+	if prev == nil {
+		// První bod: integrál ohlásí dosavadní součet, derivace potřebuje dva body
+		return st.total, st.def.Kind == TransformIntegral
+	}
+
+	dt := r.Time.Sub(prev.Time)
+	if dt > st.def.MaxGap {
+		// Mezera: úsek nepočítáme, od tohoto bodu se začíná znovu
+		return st.total, st.def.Kind == TransformIntegral
+	}
+	units := float64(dt) / float64(st.def.TimeUnit)
+
+	switch st.def.Kind {
+	case TransformIntegral:
+		st.total += (prev.Value + r.Value) / 2 * units * st.def.Factor
+		return st.total, true
+	default:
+		if st.def.SourceCounter && r.Value < prev.Value {
+			return 0, false // Reset počítadla - záporný průtok by byl nesmysl
+		}
+		return (r.Value - prev.Value) / units * st.def.Factor, true
+	}
+}
+
+// publish pošle výsledek na topic výstupního senzoru jako prosté číslo (viz Evaluator.publish).
+func (t *Transformer) publish(def Transform, value float64) {
+	payload := strconv.FormatFloat(value, 'f', -1, 64)
+	token := t.client.Publish(def.Topic, 0, false, payload)
+	if token.Wait() && token.Error() != nil {
+		t.logger.Error("Publikace transformace selhala", "sensor_id", def.SensorID, "error", token.Error())
+		return
+	}
+	t.logger.Debug("Transformace přepočítána", "sensor_id", def.SensorID, "name", def.Name, "kind", def.Kind, "value", value)
+}
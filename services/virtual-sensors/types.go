@@ -0,0 +1,52 @@
+package main
+
+import "time"
+
+// SensorEvent je normalizovaná zpráva z Ingestoru (topic events/data).
+// Musí odpovídat JSONu, který generuje služba 'sensor-ingestor'.
+type SensorEvent struct {
+	SensorID  int64       `json:"sensor_id"`
+	Value     float64     `json:"value"` // U nečíselného senzoru: boolean = 1/0, ostatní 0 (viz State)
+	State     *EventState `json:"state,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// EventState je hodnota nečíselného senzoru (odpovídá storage.State v ingestoru).
+// Výrazům stačí druh - text ani polohu do výpočtu dosadit nejde.
+type EventState struct {
+	Kind string `json:"kind"` // boolean | enum | text | geo
+}
+
+// numeric: Událost nese číselnou hodnotu. Dvoustavový senzor (boolean) posílá ve Value 1/0,
+// ve výrazu se chová jako 'switch'.
+func (ev SensorEvent) numeric() bool {
+	return ev.State == nil || ev.State.Kind == "boolean"
+}
+
+// VirtualRow je definice virtuálního senzoru z DB (virtual_sensors + sensors).
+type VirtualRow struct {
+	SensorID    int64
+	Name        string
+	Topic       string // Kam publikujeme výsledek (mqtt_topic senzoru)
+	Expression  string
+	MaxInputAge time.Duration // Starší vstupní hodnota = výsledek se nepočítá
+}
+
+// Reading je poslední známá hodnota senzoru.
+type Reading struct {
+	Value float64
+	Time  time.Time
+}
+
+// Transform je definice transformace z DB (sensor_transforms + sensors).
+type Transform struct {
+	SensorID      int64 // Výstupní senzor
+	Name          string
+	Topic         string // Kam publikujeme výsledek (mqtt_topic výstupního senzoru)
+	SourceID      int64
+	SourceCounter bool // Zdroj je počítadlo - pokles hodnoty je reset, ne záporný průtok
+	Kind          string
+	TimeUnit      time.Duration
+	Factor        float64
+	MaxGap        time.Duration
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Virtual je zkompilovaný virtuální senzor.
+type Virtual struct {
+	Row  VirtualRow
+	Expr *Expr
+}
+
+// CompileVirtuals zkompiluje definice a odmítne cykly (A závisí na B, B na A).
+// Virtuální senzor smí záviset na jiném virtuálním senzoru - výsledek projde Ingestorem
+// zpět na events topic a spustí přepočet dalšího v řadě. Cyklus by ale běžel donekonečna.
+// Vrací platné senzory a chyby neplatných (podle ID senzoru).
+func CompileVirtuals(rows []VirtualRow, resolve TopicResolver) (map[int64]*Virtual, map[int64]error) {
+	virtuals := make(map[int64]*Virtual)
+	failed := make(map[int64]error)
+
+	for _, row := range rows {
+		expr, err := CompileExpr(row.Expression, resolve)
+		if err != nil {
+			failed[row.SensorID] = err
+			continue
+		}
+		virtuals[row.SensorID] = &Virtual{Row: row, Expr: expr}
+	}
+
+	// Detekce cyklů průchodem do hloubky (0 = nenavštíven, 1 = na zásobníku, 2 = hotovo)
+	state := make(map[int64]int)
+	var visit func(id int64) bool
+	visit = func(id int64) bool {
+		v, ok := virtuals[id]
+		if !ok {
+			return false // Fyzický senzor - list grafu
+		}
+		switch state[id] {
+		case 1:
+			return true
+		case 2:
+			return false
+		}
+		state[id] = 1
+		for _, in := range v.Expr.Inputs {
+			if visit(in) {
+				return true
+			}
+		}
+		state[id] = 2
+		return false
+	}
+
+	for id := range virtuals {
+		if visit(id) {
+			failed[id] = fmt.Errorf("cyklická závislost virtuálních senzorů")
+		}
+	}
+	for id := range failed {
+		delete(virtuals, id)
+	}
+	return virtuals, failed
+}
+
+// Evaluator drží poslední hodnoty senzorů a přepočítává virtuální senzory při změně vstupu.
+type Evaluator struct {
+	client mqtt.Client
+	logger *slog.Logger
+
+	// mu chrání všechny mapy - HandleEvent běží v MQTT goroutině, SetVirtuals v hlavní smyčce.
+	mu         sync.Mutex
+	virtuals   map[int64]*Virtual
+	dependents map[int64][]*Virtual // vstupní senzor -> virtuální senzory, které na něm závisí
+	readings   map[int64]Reading
+}
+
+// NewEvaluator - konstruktor
+func NewEvaluator(client mqtt.Client, logger *slog.Logger) *Evaluator {
+	return &Evaluator{
+		client:     client,
+		logger:     logger,
+		virtuals:   make(map[int64]*Virtual),
+		dependents: make(map[int64][]*Virtual),
+		readings:   make(map[int64]Reading),
+	}
+}
+
+// Seed nastaví počáteční hodnoty senzorů (poslední hodnoty z DB).
+func (e *Evaluator) Seed(readings map[int64]Reading) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for id, r := range readings {
+		e.readings[id] = r
+	}
+}
+
+// SetVirtuals nahradí sadu virtuálních senzorů a přestaví index závislostí.
+func (e *Evaluator) SetVirtuals(virtuals map[int64]*Virtual) {
+	dependents := make(map[int64][]*Virtual)
+	for _, v := range virtuals {
+		for _, in := range v.Expr.Inputs {
+			dependents[in] = append(dependents[in], v)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.virtuals = virtuals
+	e.dependents = dependents
+}
+
+// HandleEvent je MQTT callback pro normalizované hodnoty.
+func (e *Evaluator) HandleEvent(_ mqtt.Client, msg mqtt.Message) {
+	var ev SensorEvent
+	if err := json.Unmarshal(msg.Payload(), &ev); err != nil {
+		e.logger.Warn("Neplatná zpráva události", "error", err)
+		return
+	}
+	if ev.Timestamp.IsZero() {
+		ev.Timestamp = time.Now()
+	}
+
+	e.mu.Lock()
+	if !ev.numeric() {
+		// Enum, text ani poloha číslem nejsou (Value je 0) - do výrazu je nedosadíme.
+		// Virtuální senzor nad takovým vstupem zůstane bez hodnoty (ErrMissingInput).
+		if deps := e.dependents[ev.SensorID]; len(deps) > 0 {
+			e.logger.Warn("Vstup virtuálního senzoru není číselný, hodnota ignorována",
+				"input_id", ev.SensorID, "kind", ev.State.Kind, "sensor_id", deps[0].Row.SensorID)
+		}
+		e.mu.Unlock()
+		return
+	}
+	e.readings[ev.SensorID] = Reading{Value: ev.Value, Time: ev.Timestamp}
+
+	// Výpočty uděláme pod zámkem, publikaci až po jeho uvolnění.
+	type result struct {
+		v     *Virtual
+		value float64
+	}
+	var results []result
+	now := time.Now()
+	for _, v := range e.dependents[ev.SensorID] {
+		value, err := e.evaluate(v, now)
+		if err != nil {
+			if !errors.Is(err, ErrMissingInput) {
+				e.logger.Warn("Výpočet virtuálního senzoru selhal", "sensor_id", v.Row.SensorID, "name", v.Row.Name, "error", err)
+			}
+			continue
+		}
+		results = append(results, result{v: v, value: value})
+	}
+	e.mu.Unlock()
+
+	for _, r := range results {
+		e.publish(r.v, r.value)
+	}
+}
+
+// evaluate spočítá hodnotu virtuálního senzoru. Volat pod zámkem.
+// Zastaralý vstup se bere jako chybějící: rosný bod z teploty před hodinou by byl nesmysl.
+func (e *Evaluator) evaluate(v *Virtual, now time.Time) (float64, error) {
+	values := make(map[int64]float64, len(v.Expr.Inputs))
+	for _, id := range v.Expr.Inputs {
+		r, ok := e.readings[id]
+		if !ok || now.Sub(r.Time) > v.Row.MaxInputAge {
+			continue // Eval vrátí ErrMissingInput
+		}
+		values[id] = r.Value
+	}
+	return v.Expr.Eval(values)
+}
+
+// publish pošle výsledek na topic virtuálního senzoru jako prosté číslo - přesně jako fyzický senzor.
+// Ingestor ho pak zvaliduje (min/max typu) a předá dál do DB, grafů i alertů.
+func (e *Evaluator) publish(v *Virtual, value float64) {
+	payload := strconv.FormatFloat(value, 'f', -1, 64)
+	token := e.client.Publish(v.Row.Topic, 0, false, payload)
+	if token.Wait() && token.Error() != nil {
+		e.logger.Error("Publikace virtuálního senzoru selhala", "sensor_id", v.Row.SensorID, "error", token.Error())
+		return
+	}
+	e.logger.Debug("Virtuální senzor přepočítán", "sensor_id", v.Row.SensorID, "name", v.Row.Name, "value", value)
+}
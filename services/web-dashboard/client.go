@@ -1,9 +1,15 @@
-package main
+package dashboard
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -22,40 +28,345 @@ type SensorDTO struct {
 	// CurrentValue je pointer (*float64), protože hodnota může být null (nil).
 	// Pokud senzor ještě neposlal data, nechceme zobrazit 0, ale "nic".
 	CurrentValue *float64 `json:"current_value"`
+
+	// LastSeen: Čas měření poslední hodnoty (nil = senzor zatím nic neposlal).
+	// IsStale: Hodnota je starší než práh typu senzoru - kartu zašedíme.
+	// Quality: Příznaky kvality ("suspect", "resubmitted").
+	LastSeen *time.Time `json:"last_seen"`
+	IsStale  bool       `json:"is_stale"`
+	Quality  []string   `json:"quality"`
+
+	// Controllable = senzor je akční člen (switch s command_topic), dashboard u něj ukáže přepínač.
+	Controllable bool `json:"controllable"`
+
+	// Virtual = hodnota je vypočtená z jiných senzorů (virtuální senzor).
+	Virtual bool `json:"virtual"`
+
+	// Counter = hodnota je kumulativní počítadlo (vodoměr, pulzy) - viz stránka Spotřeba.
+	Counter bool `json:"counter"`
+
+	// Kind: Druh hodnoty (number, boolean, enum, text, geo). U nečíselného senzoru je
+	// aktuální hodnota v CurrentState; EnumValues jsou povolené stavy výčtu.
+	Kind         string    `json:"kind"`
+	CurrentState *StateDTO `json:"current_state"`
+	EnumValues   []string  `json:"enum_values"`
+}
+
+// IsBinary: Dvoustavový senzor (spínač 0/1 nebo kontakt) - detail ukáže časovou osu
+// zapnuto/vypnuto a dobu zapnutí po dnech místo čárového grafu.
+func (s SensorDTO) IsBinary() bool {
+	return s.Kind == "boolean" || s.Type == "switch"
+}
+
+// IsState: Senzor má nečíselné hodnoty (stavy) - detail místo čárového grafu ukáže
+// časovou osu stavů, seznam textů nebo mapu.
+func (s SensorDTO) IsState() bool {
+	return s.Kind != "" && s.Kind != "number"
+}
+
+// GeoDTO je poloha (WGS84).
+type GeoDTO struct {
+	Lat float64  `json:"lat"`
+	Lon float64  `json:"lon"`
+	Alt *float64 `json:"alt,omitempty"`
+	Acc *float64 `json:"acc,omitempty"`
+}
+
+// StateDTO je hodnota nečíselného senzoru (vyplněné je jen pole odpovídající druhu).
+type StateDTO struct {
+	Kind string  `json:"kind"`
+	Bool *bool   `json:"bool,omitempty"`
+	Text *string `json:"text,omitempty"`
+	Geo  *GeoDTO `json:"geo,omitempty"`
 }
 
-// HistoryPoint reprezentuje jeden bod v grafu (čas a hodnota).
+// HistoryPoint reprezentuje jeden bod v grafu (čas a hodnota, u nečíselného senzoru stav).
 type HistoryPoint struct {
 	Time  time.Time `json:"t"`
 	Value float64   `json:"v"`
+	State *StateDTO `json:"s,omitempty"`
+}
+
+// SeriesDTO je jedna řada porovnání (hodnoty odpovídají MultiHistoryDTO.Times, nil = mezera).
+type SeriesDTO struct {
+	SensorID int64      `json:"sensor_id"`
+	Name     string     `json:"name"`
+	Unit     string     `json:"unit"`
+	Offset   string     `json:"offset"`
+	Values   []*float64 `json:"values"`
+}
+
+// MultiHistoryDTO je odpověď GET /api/history (řady zarovnané na společnou osu).
+type MultiHistoryDTO struct {
+	From          time.Time   `json:"from"`
+	To            time.Time   `json:"to"`
+	BucketSeconds int64       `json:"bucket_seconds"`
+	Times         []time.Time `json:"times"`
+	Series        []SeriesDTO `json:"series"`
+}
+
+// StatPointDTO je hodnota s časem (min, max, první, poslední).
+type StatPointDTO struct {
+	Value float64   `json:"v"`
+	Time  time.Time `json:"t"`
+}
+
+// ThresholdStatDTO je doba nad/pod prahem.
+type ThresholdStatDTO struct {
+	Threshold float64 `json:"threshold"`
+	Seconds   float64 `json:"seconds"`
+	Ratio     float64 `json:"ratio"`
+}
+
+// StatsDTO jsou statistiky jednoho okna (viz home-api stats.go).
+type StatsDTO struct {
+	Count            int               `json:"count"`
+	Min              *StatPointDTO     `json:"min"`
+	Max              *StatPointDTO     `json:"max"`
+	First            *StatPointDTO     `json:"first"`
+	Last             *StatPointDTO     `json:"last"`
+	Mean             *float64          `json:"mean"`
+	StdDev           *float64          `json:"stddev"`
+	P50              *float64          `json:"p50"`
+	P95              *float64          `json:"p95"`
+	CoveredSeconds   float64           `json:"covered_seconds"`
+	TimeWeightedMean *float64          `json:"time_weighted_mean"`
+	Integral         *float64          `json:"integral_h"`
+	Above            *ThresholdStatDTO `json:"above"`
+	Below            *ThresholdStatDTO `json:"below"`
+}
+
+// StatsBucketDTO jsou statistiky jednoho dne/týdne/měsíce.
+type StatsBucketDTO struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	StatsDTO
+}
+
+// SensorStatsDTO je odpověď GET /api/sensors/{id}/stats.
+type SensorStatsDTO struct {
+	Unit     string           `json:"unit"`
+	Timezone string           `json:"timezone"`
+	Summary  StatsDTO         `json:"summary"`
+	Bucket   string           `json:"bucket"`
+	Buckets  []StatsBucketDTO `json:"buckets"`
+}
+
+// OnTimeSummaryDTO jsou součty doby v každém stavu a počty přechodů.
+type OnTimeSummaryDTO struct {
+	OnSeconds      float64 `json:"on_seconds"`
+	OffSeconds     float64 `json:"off_seconds"`
+	UnknownSeconds float64 `json:"unknown_seconds"`
+	OnRatio        float64 `json:"on_ratio"`
+	Transitions    int     `json:"transitions"`
+	SwitchOns      int     `json:"switch_ons"`
+}
+
+// StateIntervalDTO je úsek se stejným stavem.
+type StateIntervalDTO struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Seconds float64   `json:"seconds"`
+	On      bool      `json:"on"`
+	Ongoing bool      `json:"ongoing"`
+}
+
+// BinaryIntervalsDTO je odpověď GET /api/sensors/{id}/intervals.
+type BinaryIntervalsDTO struct {
+	From      time.Time          `json:"from"`
+	To        time.Time          `json:"to"`
+	Summary   OnTimeSummaryDTO   `json:"summary"`
+	Intervals []StateIntervalDTO `json:"intervals"`
+}
+
+// OnTimeBucketDTO je doba zapnutí za jeden den/týden/měsíc.
+type OnTimeBucketDTO struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	OnTimeSummaryDTO
+}
+
+// OnTimeDTO je odpověď GET /api/sensors/{id}/on-time.
+type OnTimeDTO struct {
+	Timezone string            `json:"timezone"`
+	Bucket   string            `json:"bucket"`
+	Summary  OnTimeSummaryDTO  `json:"summary"`
+	Buckets  []OnTimeBucketDTO `json:"buckets"`
+}
+
+// SensorTypeDTO je typ senzoru (pro výběr ve formulářích).
+type SensorTypeDTO struct {
+	ID          int64   `json:"id"`
+	Name        string  `json:"name"`
+	Unit        *string `json:"unit"`
+	Description *string `json:"description"`
+	ValueKind   string  `json:"value_kind"`
+}
+
+// DiscoveredTopicDTO je neznámý topic v karanténě čekající na schválení.
+type DiscoveredTopicDTO struct {
+	ID            int64     `json:"id"`
+	Topic         string    `json:"topic"`
+	FirstSeen     time.Time `json:"first_seen"`
+	LastSeen      time.Time `json:"last_seen"`
+	MessageCount  int64     `json:"message_count"`
+	SamplePayload *string   `json:"sample_payload"`
+	InferredType  *string   `json:"inferred_type"`
+	Status        string    `json:"status"`
+	SensorID      *int64    `json:"sensor_id"`
+}
+
+// ApproveTopicRequest je tělo požadavku pro schválení topicu.
+type ApproveTopicRequest struct {
+	SensorTypeID int64  `json:"sensor_type_id"`
+	FriendlyName string `json:"friendly_name"`
+	Location     string `json:"location"`
+}
+
+// CommandRequest je tělo požadavku pro ovládání akčního členu.
+type CommandRequest struct {
+	Value float64 `json:"value"`
+}
+
+// CommandDTO je výsledek odeslaného příkazu.
+type CommandDTO struct {
+	ID             int64      `json:"id"`
+	CorrelationID  string     `json:"correlation_id"`
+	SensorID       int64      `json:"sensor_id"`
+	RequestedValue float64    `json:"requested_value"`
+	Status         string     `json:"status"` // pending | confirmed | timeout | failed
+	RequestedAt    time.Time  `json:"requested_at"`
+	ConfirmedAt    *time.Time `json:"confirmed_at"`
+	ConfirmedValue *float64   `json:"confirmed_value"`
+	Error          *string    `json:"error"`
+}
+
+// RejectDTO je zpráva odmítnutá Ingestorem (dead-letter).
+type RejectDTO struct {
+	ID            int64      `json:"id"`
+	ReceivedAt    time.Time  `json:"received_at"`
+	Topic         string     `json:"topic"`
+	Payload       string     `json:"payload"`
+	SensorID      *int64     `json:"sensor_id"`
+	SensorName    *string    `json:"sensor_name"`
+	Reason        string     `json:"reason"`
+	Detail        *string    `json:"detail"`
+	ResubmittedAt *time.Time `json:"resubmitted_at"`
+}
+
+// RejectSummaryDTO je počet odmítnutých zpráv podle senzoru a důvodu.
+type RejectSummaryDTO struct {
+	SensorID   *int64    `json:"sensor_id"`
+	SensorName *string   `json:"sensor_name"`
+	Reason     string    `json:"reason"`
+	Count      int64     `json:"count"`
+	LastAt     time.Time `json:"last_at"`
 }
 
 // APIClient zapouzdřuje logiku HTTP volání na backend.
 // Zbytek aplikace (Handlery) díky tomu neřeší URL adresy, JSON decoding ani status kódy.
 type APIClient struct {
 	BaseURL    string       // Adresa API (např. http://home-api:8080)
+	Units      string       // Soustava jednotek předávaná API (metric | imperial)
 	httpClient *http.Client // Instance http klienta (umožňuje nastavit timeouty)
+
+	// commandClient má delší timeout: API u příkazu čeká na potvrzení od zařízení
+	// (COMMAND_TIMEOUT, výchozí 5s), takže běžných 5s by nestačilo.
+	commandClient *http.Client
 }
 
 // NewAPIClient vytváří instanci klienta.
 // Důležité: Vždy nastavujeme Timeout! Defaultní http.Client v Go nemá timeout,
 // takže pokud by API neodpovídalo, Dashboard by "visel" navěky a došla by paměť.
-func NewAPIClient(baseURL string) *APIClient {
+func NewAPIClient(baseURL, units string) *APIClient {
 	return &APIClient{
 		BaseURL: baseURL,
+		Units:   units,
 		httpClient: &http.Client{
 			Timeout: 5 * time.Second, // Pokud API neodpoví do 5s, request selže.
 		},
+		commandClient: &http.Client{
+			Timeout: 20 * time.Second,
+		},
 	}
 }
 
+// SetTransport nahradí síťovou vrstvu obou HTTP klientů (timeouty zůstávají).
+// Používá se v all-in-one: rt = HandlerTransport(homeAPI.Handler()).
+func (c *APIClient) SetTransport(rt http.RoundTripper) {
+	c.httpClient.Transport = rt
+	c.commandClient.Transport = rt
+}
+
+// HandlerTransport je http.RoundTripper, který požadavek nepošle po síti,
+// ale rovnou ho předá http.Handleru ve stejném procesu a odpověď si "nahraje".
+func HandlerTransport(h http.Handler) http.RoundTripper {
+	return handlerTransport{h}
+}
+
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Server-side handler očekává vždy ne-nil Body a vyplněné RequestURI (jako od http.Server).
+	if req.Body == nil {
+		req.Body = http.NoBody
+	}
+	req.RequestURI = req.URL.RequestURI()
+
+	rec := &responseRecorder{header: make(http.Header)}
+	t.handler.ServeHTTP(rec, req)
+
+	// Klient mohl mezitím vzdát čekání (timeout) - chováme se jako síťový transport.
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	status := rec.status
+	if status == 0 {
+		status = http.StatusOK // Handler nic nezapsal = 200, stejně jako u http.Server
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        rec.header,
+		Body:          io.NopCloser(&rec.body),
+		ContentLength: int64(rec.body.Len()),
+		Request:       req,
+	}, nil
+}
+
+// responseRecorder je minimální http.ResponseWriter, který odpověď drží v paměti.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header { return r.header }
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(p)
+}
+
 // GetSensors zavolá endpoint GET /api/sensors a vrátí seznam objektů.
 func (c *APIClient) GetSensors() ([]SensorDTO, error) {
 	// Sestavení URL
-	url := c.BaseURL + "/api/sensors"
+	reqURL := c.BaseURL + "/api/sensors?units=" + url.QueryEscape(c.Units)
 
 	// Provedení GET požadavku
-	resp, err := c.httpClient.Get(url)
+	resp, err := c.httpClient.Get(reqURL)
 	if err != nil {
 		return nil, fmt.Errorf("chyba sítě při volání API: %w", err)
 	}
@@ -80,9 +391,9 @@ func (c *APIClient) GetSensors() ([]SensorDTO, error) {
 // GetHistory zavolá endpoint GET /api/sensors/{id}/history
 func (c *APIClient) GetHistory(sensorID int64, rangeStr string) ([]HistoryPoint, error) {
 	// Formátování URL s parametry
-	url := fmt.Sprintf("%s/api/sensors/%d/history?range=%s", c.BaseURL, sensorID, rangeStr)
+	reqURL := fmt.Sprintf("%s/api/sensors/%d/history?range=%s&units=%s", c.BaseURL, sensorID, rangeStr, url.QueryEscape(c.Units))
 
-	resp, err := c.httpClient.Get(url)
+	resp, err := c.httpClient.Get(reqURL)
 	if err != nil {
 		return nil, err
 	}
@@ -99,3 +410,321 @@ func (c *APIClient) GetHistory(sensorID int64, rangeStr string) ([]HistoryPoint,
 
 	return points, nil
 }
+
+// GetMultiHistory zavolá endpoint GET /api/history?series=...&range=...
+// Řada je "<id>" nebo "<id>@<posun>" (stejný senzor o posun dříve, např. "5@168h").
+func (c *APIClient) GetMultiHistory(series []string, rangeStr string) (*MultiHistoryDTO, error) {
+	q := url.Values{"series": series, "range": {rangeStr}, "units": {c.Units}}
+
+	var history MultiHistoryDTO
+	if err := c.getJSON("/api/history?"+q.Encode(), &history); err != nil {
+		return nil, err
+	}
+	return &history, nil
+}
+
+// GetSensorStats zavolá endpoint GET /api/sensors/{id}/stats. Parametry (range, bucket,
+// above, below...) se předávají beze změny; jednotky doplní klient.
+func (c *APIClient) GetSensorStats(sensorID int64, params url.Values) (*SensorStatsDTO, error) {
+	q := url.Values{}
+	for k, v := range params {
+		q[k] = v
+	}
+	q.Set("units", c.Units)
+
+	var stats SensorStatsDTO
+	if err := c.getJSON(fmt.Sprintf("/api/sensors/%d/stats?%s", sensorID, q.Encode()), &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// GetIntervals zavolá endpoint GET /api/sensors/{id}/intervals?range=...
+func (c *APIClient) GetIntervals(sensorID int64, rangeStr string) (*BinaryIntervalsDTO, error) {
+	var intervals BinaryIntervalsDTO
+	if err := c.getJSON(fmt.Sprintf("/api/sensors/%d/intervals?range=%s", sensorID, url.QueryEscape(rangeStr)), &intervals); err != nil {
+		return nil, err
+	}
+	return &intervals, nil
+}
+
+// GetOnTime zavolá endpoint GET /api/sensors/{id}/on-time?range=...&bucket=...
+func (c *APIClient) GetOnTime(sensorID int64, rangeStr, bucket string) (*OnTimeDTO, error) {
+	q := url.Values{"range": {rangeStr}, "bucket": {bucket}}
+	var onTime OnTimeDTO
+	if err := c.getJSON(fmt.Sprintf("/api/sensors/%d/on-time?%s", sensorID, q.Encode()), &onTime); err != nil {
+		return nil, err
+	}
+	return &onTime, nil
+}
+
+// ConsumptionBucketDTO je spotřeba jedné hodiny/dne/týdne/měsíce.
+type ConsumptionBucketDTO struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Consumption float64   `json:"consumption"`
+	Cost        *float64  `json:"cost"`
+}
+
+// ConsumptionDTO je odpověď GET /api/sensors/{id}/consumption.
+type ConsumptionDTO struct {
+	SensorID  int64                  `json:"sensor_id"`
+	Unit      string                 `json:"unit"`
+	Timezone  string                 `json:"timezone"`
+	Bucket    string                 `json:"bucket"`
+	Total     float64                `json:"total"`
+	Cost      *float64               `json:"cost"`
+	Currency  string                 `json:"currency"`
+	Readings  int                    `json:"readings"`
+	Resets    int                    `json:"resets"`
+	Rollovers int                    `json:"rollovers"`
+	Buckets   []ConsumptionBucketDTO `json:"buckets"`
+}
+
+// GetConsumption zavolá endpoint GET /api/sensors/{id}/consumption?range=...&bucket=...
+func (c *APIClient) GetConsumption(sensorID int64, rangeStr, bucket string) (*ConsumptionDTO, error) {
+	q := url.Values{"range": {rangeStr}, "bucket": {bucket}}
+	var consumption ConsumptionDTO
+	if err := c.getJSON(fmt.Sprintf("/api/sensors/%d/consumption?%s", sensorID, q.Encode()), &consumption); err != nil {
+		return nil, err
+	}
+	return &consumption, nil
+}
+
+// DeviceSensorDTO je senzor zařízení (zkrácený SensorDTO).
+type DeviceSensorDTO struct {
+	ID       int64      `json:"id"`
+	Name     string     `json:"name"`
+	Topic    string     `json:"topic"`
+	Unit     string     `json:"unit"`
+	Value    *float64   `json:"current_value"`
+	LastSeen *time.Time `json:"last_seen"`
+	IsStale  bool       `json:"is_stale"`
+}
+
+// DeviceDTO je fyzické zařízení se stavem, diagnostikou a senzory (GET /api/devices).
+type DeviceDTO struct {
+	ID           int64   `json:"id"`
+	Name         string  `json:"name"`
+	FriendlyName *string `json:"friendly_name"`
+	Model        *string `json:"model"`
+	Location     *string `json:"location"`
+
+	Status          string     `json:"status"`        // online | offline | unknown
+	StatusSource    string     `json:"status_source"` // availability | sensors
+	StatusChangedAt *time.Time `json:"status_changed_at"`
+	LastSeen        *time.Time `json:"last_seen"`
+
+	BatteryVoltage       *float64   `json:"battery_voltage"`
+	RSSI                 *float64   `json:"rssi"`
+	Firmware             *string    `json:"firmware"`
+	DiagnosticsUpdatedAt *time.Time `json:"diagnostics_updated_at"`
+
+	Sensors      []DeviceSensorDTO `json:"sensors"`
+	StaleSensors int               `json:"stale_sensors"`
+	Warnings     []string          `json:"warnings"` // offline, stale_sensors, low_battery, weak_signal, no_diagnostics
+}
+
+// DisplayName vrací čitelné jméno zařízení (friendly_name, jinak identifikátor).
+func (d DeviceDTO) DisplayName() string {
+	if d.FriendlyName != nil && *d.FriendlyName != "" {
+		return *d.FriendlyName
+	}
+	return d.Name
+}
+
+// GetDevices zavolá endpoint GET /api/devices
+func (c *APIClient) GetDevices() ([]DeviceDTO, error) {
+	var devices []DeviceDTO
+	if err := c.getJSON("/api/devices", &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// ServiceDependencyDTO je stav jedné závislosti služby (DB, Valkey, MQTT).
+type ServiceDependencyDTO struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // ok | error
+	Error  string `json:"error"`
+}
+
+// ServiceDTO je poslední presence zpráva služby (GET /api/services).
+type ServiceDTO struct {
+	Service         string                 `json:"service"`
+	Status          string                 `json:"status"` // Co služba hlásí: online | offline
+	Version         string                 `json:"version"`
+	Host            string                 `json:"host"`
+	StartedAt       *time.Time             `json:"started_at"`
+	UpdatedAt       *time.Time             `json:"updated_at"`
+	IntervalSeconds int                    `json:"interval_seconds"`
+	Dependencies    []ServiceDependencyDTO `json:"dependencies"`
+
+	Topic      string     `json:"topic"`
+	ReceivedAt *time.Time `json:"received_at"`
+	State      string     `json:"state"` // Vyhodnocený stav: online | degraded | stale | offline
+}
+
+// GetServices zavolá endpoint GET /api/services
+func (c *APIClient) GetServices() ([]ServiceDTO, error) {
+	var services []ServiceDTO
+	if err := c.getJSON("/api/services", &services); err != nil {
+		return nil, err
+	}
+	return services, nil
+}
+
+// CheckHealth ověří, že Home API žije (GET /health/live). Readiness dashboardu na ní závisí.
+func (c *APIClient) CheckHealth(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/health/live", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("chyba sítě při volání API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return apiError(resp)
+	}
+	return nil
+}
+
+// GetSensorTypes zavolá endpoint GET /api/sensor-types
+func (c *APIClient) GetSensorTypes() ([]SensorTypeDTO, error) {
+	var types []SensorTypeDTO
+	if err := c.getJSON("/api/sensor-types", &types); err != nil {
+		return nil, err
+	}
+	return types, nil
+}
+
+// GetDiscoveredTopics zavolá endpoint GET /api/discovered?status=...
+func (c *APIClient) GetDiscoveredTopics(status string) ([]DiscoveredTopicDTO, error) {
+	var topics []DiscoveredTopicDTO
+	if err := c.getJSON("/api/discovered?status="+url.QueryEscape(status), &topics); err != nil {
+		return nil, err
+	}
+	return topics, nil
+}
+
+// ApproveDiscoveredTopic zavolá endpoint POST /api/discovered/{id}/approve
+func (c *APIClient) ApproveDiscoveredTopic(id int64, req ApproveTopicRequest) error {
+	return c.postJSON(fmt.Sprintf("/api/discovered/%d/approve", id), req, nil)
+}
+
+// IgnoreDiscoveredTopic zavolá endpoint POST /api/discovered/{id}/ignore
+func (c *APIClient) IgnoreDiscoveredTopic(id int64) error {
+	return c.postJSON(fmt.Sprintf("/api/discovered/%d/ignore", id), nil, nil)
+}
+
+// SendCommand zavolá endpoint POST /api/sensors/{id}/command.
+// API vrací CommandDTO i při nepotvrzeném příkazu (504 timeout, 502 chyba MQTT),
+// proto tyto stavy nebereme jako chybu volání - výsledek je v cmd.Status.
+func (c *APIClient) SendCommand(sensorID int64, value float64) (*CommandDTO, error) {
+	buf, err := json.Marshal(CommandRequest{Value: value})
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/api/sensors/%d/command", c.BaseURL, sensorID)
+	resp, err := c.commandClient.Post(url, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		return nil, fmt.Errorf("chyba sítě při volání API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusGatewayTimeout, http.StatusBadGateway:
+		var cmd CommandDTO
+		if err := json.NewDecoder(resp.Body).Decode(&cmd); err != nil {
+			return nil, fmt.Errorf("chyba dekódování odpovědi příkazu: %w", err)
+		}
+		return &cmd, nil
+	default:
+		return nil, apiError(resp)
+	}
+}
+
+// GetRejects zavolá endpoint GET /api/rejects?sensor_id=...&reason=...
+// sensorID 0 a prázdný reason = bez filtru.
+func (c *APIClient) GetRejects(sensorID int64, reason string) ([]RejectDTO, error) {
+	q := url.Values{}
+	if sensorID > 0 {
+		q.Set("sensor_id", strconv.FormatInt(sensorID, 10))
+	}
+	if reason != "" {
+		q.Set("reason", reason)
+	}
+
+	var rejects []RejectDTO
+	if err := c.getJSON("/api/rejects?"+q.Encode(), &rejects); err != nil {
+		return nil, err
+	}
+	return rejects, nil
+}
+
+// GetRejectSummary zavolá endpoint GET /api/rejects/summary
+func (c *APIClient) GetRejectSummary() ([]RejectSummaryDTO, error) {
+	var summary []RejectSummaryDTO
+	if err := c.getJSON("/api/rejects/summary", &summary); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// ResubmitReject zavolá endpoint POST /api/rejects/{id}/resubmit
+func (c *APIClient) ResubmitReject(id int64) error {
+	return c.postJSON(fmt.Sprintf("/api/rejects/%d/resubmit", id), nil, nil)
+}
+
+// --- POMOCNÉ METODY ---
+// Společná logika pro jednoduché JSON endpointy (GET a POST).
+
+// getJSON provede GET a dekóduje JSON odpověď do 'out'.
+func (c *APIClient) getJSON(path string, out any) error {
+	resp, err := c.httpClient.Get(c.BaseURL + path)
+	if err != nil {
+		return fmt.Errorf("chyba sítě při volání API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return apiError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// postJSON pošle 'body' jako JSON (nil = prázdné tělo) a případnou odpověď dekóduje do 'out'.
+func (c *APIClient) postJSON(path string, body any, out any) error {
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(buf)
+	}
+
+	resp, err := c.httpClient.Post(c.BaseURL+path, "application/json", reader)
+	if err != nil {
+		return fmt.Errorf("chyba sítě při volání API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return apiError(resp)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// apiError sestaví chybu ze status kódu a textu, který API vrátilo (např. "topic už byl schválen").
+func apiError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("API vrátilo chybný status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+}
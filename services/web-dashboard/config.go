@@ -1,6 +1,12 @@
-package main
+package dashboard
 
-import "os"
+import (
+	"net/http"
+	"os"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
 
 // Config drží veškeré nastavení, které aplikace potřebuje k běhu.
 // Oddělení konfigurace od kódu (Code vs Config) je základem 12-Factor App metodiky.
@@ -15,6 +21,30 @@ type Config struct {
 	// který zobrazuje data získaná z API.
 	// Příklad v Docker síti: "http://home-api:8080"
 	APIURL string
+
+	// SystemTopicPrefix: Prefix topiců, pod kterými system-monitor publikuje metriky.
+	// Za prefixem následuje identita stroje: /msh/system/<host>/cpu
+	SystemTopicPrefix string
+
+	// Units: Soustava jednotek, ve které chceme hodnoty zobrazovat ("metric" nebo "imperial").
+	// Převod dělá Home API (parametr ?units=), dashboard jen předá volbu.
+	Units string
+
+	// MQTTBroker, MQTTClientID: Broker jen pro presence zprávu (data dashboard bere z Home API).
+	MQTTBroker   string
+	MQTTClientID string
+	// MQTTConnect: Vlastní otevření spojení k brokeru (režim all-in-one: spojení v paměti
+	// na vestavěný broker). Nenačítá se z ENV; nil = běžné síťové spojení podle MQTTBroker.
+	MQTTConnect mqtt.OpenConnectionFunc `json:"-"`
+
+	// Presence: retained stav služby (online/offline) a interval jeho obnovy, viz modul presence.
+	// Prázdný topic = presence se neposílá a dashboard se k brokeru vůbec nepřipojuje.
+	PresenceTopic    string
+	PresenceInterval time.Duration
+
+	// APIHandler: Home API běžící ve stejném procesu (režim all-in-one). Dashboard ho pak
+	// volá přímo v paměti místo HTTP přes síť. Nenačítá se z ENV; nil = volání na APIURL.
+	APIHandler http.Handler `json:"-"`
 }
 
 // LoadConfig načte konfiguraci z operačního systému (ENV variables).
@@ -23,6 +53,14 @@ func LoadConfig() Config {
 	return Config{
 		HTTPPort: getEnv("HTTP_PORT", "3000"),
 		APIURL:   getEnv("API_URL", "http://home-api:8080"),
+
+		SystemTopicPrefix: getEnv("SYSTEM_TOPIC_PREFIX", "/msh/system/"),
+		Units:             getEnv("UNITS", "metric"),
+
+		MQTTBroker:       getEnv("MQTT_BROKER", "tcp://mosquitto:1883"),
+		MQTTClientID:     getEnv("MQTT_CLIENT_ID", "web-dashboard"),
+		PresenceTopic:    getEnv("PRESENCE_TOPIC", "presence/web-dashboard"),
+		PresenceInterval: getEnvDuration("PRESENCE_INTERVAL", 30*time.Second),
 	}
 }
 
@@ -35,3 +73,13 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// getEnvDuration načte dobu trvání ve formátu Go (např. "30s", "1m").
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
@@ -1,27 +1,50 @@
-package main
+package dashboard
 
 import (
+	"embed"
 	"encoding/json"
+	"fmt"
 	"html/template"
 	"log/slog"
 	"net/http"
-	"path/filepath"
+	"net/url"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// templatesFS: HTML šablony zakompilované přímo do binárky (go:embed).
+// Binárka tak nezávisí na pracovním adresáři - běží stejně v Dockeru i v all-in-one.
+//
+//go:embed templates/*.html
+var templatesFS embed.FS
+
 // WebHandler řídí zpracování HTTP požadavků.
 // Drží oddělené šablony pro Index a Detail, aby nedocházelo ke kolizím názvů bloků.
 type WebHandler struct {
 	client     *APIClient         // Klient pro volání backend API
 	logger     *slog.Logger       // Logger
+	sysPrefix  string             // Prefix systémových topiců (např. "/msh/system/")
 	indexTmpl  *template.Template // Šablona pro Dashboard (přehled)
 	detailTmpl *template.Template // Šablona pro Graf (historie)
+
+	discoveredTmpl  *template.Template // Šablona pro karanténu neznámých topiců
+	rejectsTmpl     *template.Template // Šablona pro odmítnuté zprávy (dead-letter)
+	compareTmpl     *template.Template // Šablona pro porovnání více řad v jednom grafu
+	consumptionTmpl *template.Template // Šablona pro spotřebu z počítadel (vodoměr, pulzy)
+	devicesTmpl     *template.Template // Šablona pro zařízení (dostupnost, baterie, signál)
+	servicesTmpl    *template.Template // Šablona pro přehled služeb (presence)
 }
 
 // SystemWidgetData je pomocná struktura (ViewModel).
 // Slouží k tomu, abychom v Go kódu seskupili rozházené senzory do jednoho logického celku
 // pro zobrazení "System Status" widgetu v HTML.
+// Jedna instance = jeden monitorovaný stroj (topicy /msh/system/<host>/...).
 type SystemWidgetData struct {
+	Host string // Identita stroje (úroveň topicu za prefixem)
+
 	CPUPercent float64 // Vytížení CPU
 
 	RamUsed  float64 // Použitá RAM (MB)
@@ -36,7 +59,7 @@ type SystemWidgetData struct {
 }
 
 // NewWebHandler inicializuje handler a parsuje HTML šablony.
-func NewWebHandler(client *APIClient, logger *slog.Logger) (*WebHandler, error) {
+func NewWebHandler(client *APIClient, sysPrefix string, logger *slog.Logger) (*WebHandler, error) {
 
 	// 1. DEFINICE POMOCNÝCH FUNKCÍ (FuncMap)
 	// Tyto funkce můžeme volat přímo v HTML kódu (např. {{ .Value | deref }}).
@@ -51,6 +74,75 @@ func NewWebHandler(client *APIClient, logger *slog.Logger) (*WebHandler, error)
 			return *f
 		},
 
+		// "deref_str" / "deref_int" / "deref_bool": Totéž pro nepovinné textové, celočíselné
+		// a logické hodnoty.
+		"deref_str": func(s *string) string {
+			if s == nil {
+				return ""
+			}
+			return *s
+		},
+		"deref_int": func(i *int64) int64 {
+			if i == nil {
+				return 0
+			}
+			return *i
+		},
+		"deref_bool": func(b *bool) bool {
+			return b != nil && *b
+		},
+
+		// "ago": Jak dávno byla hodnota naměřena (např. "před 5 min"). nil = "nikdy".
+		"ago": func(t *time.Time) string {
+			if t == nil {
+				return "nikdy"
+			}
+			d := time.Since(*t)
+			switch {
+			case d < time.Minute:
+				return "před chvílí"
+			case d < time.Hour:
+				return fmt.Sprintf("před %d min", int(d.Minutes()))
+			case d < 48*time.Hour:
+				return fmt.Sprintf("před %d h", int(d.Hours()))
+			default:
+				return fmt.Sprintf("před %d dny", int(d.Hours()/24))
+			}
+		},
+
+		// "hours": Doba v sekundách jako hodiny a minuty (např. "3 h 25 min").
+		"hours": func(sec float64) string {
+			d := time.Duration(sec) * time.Second
+			return fmt.Sprintf("%d h %02d min", int(d.Hours()), int(d.Minutes())%60)
+		},
+
+		// "percent": Podíl 0-1 jako celá procenta (např. "42 %").
+		"percent": func(ratio float64) string {
+			return fmt.Sprintf("%.0f %%", ratio*100)
+		},
+
+		// "state": Stav nečíselného senzoru jako text (zapnuto/vypnuto, název stavu, souřadnice).
+		"state": func(st *StateDTO) string {
+			switch {
+			case st == nil:
+				return ""
+			case st.Bool != nil && *st.Bool:
+				return "zapnuto"
+			case st.Bool != nil:
+				return "vypnuto"
+			case st.Text != nil:
+				return *st.Text
+			case st.Geo != nil:
+				return fmt.Sprintf("%.5f, %.5f", st.Geo.Lat, st.Geo.Lon)
+			}
+			return ""
+		},
+
+		// "has": Obsahuje seznam (např. příznaky kvality) danou položku?
+		"has": func(list []string, item string) bool {
+			return slices.Contains(list, item)
+		},
+
 		// "to_json": Serializuje Go strukturu na JSON string.
 		// Klíčové pro předání dat do JavaScriptu (Chart.js).
 		// template.JS říká šabloně: "Neescapuj uvozovky, toto je bezpečný skript".
@@ -65,24 +157,56 @@ func NewWebHandler(client *APIClient, logger *slog.Logger) (*WebHandler, error)
 
 	// 2. NAČTENÍ ŠABLON (Izolace)
 	// Pro každou stránku vytváříme samostatnou instanci Template.
-	// Tím řešíme problém, kdy obě stránky definují blok {{define "content"}}.
+	// Tím řešíme problém, kdy všechny stránky definují blok {{define "content"}}.
+	parsePage := func(page string) (*template.Template, error) {
+		return template.New("layout.html").Funcs(funcMap).ParseFS(templatesFS,
+			"templates/layout.html",
+			"templates/"+page,
+		)
+	}
 
 	// A) Index (Dashboard)
-	indexTmpl := template.New("layout.html").Funcs(funcMap)
-	indexTmpl, err := indexTmpl.ParseFiles(
-		filepath.Join("templates", "layout.html"),
-		filepath.Join("templates", "index.html"),
-	)
+	indexTmpl, err := parsePage("index.html")
 	if err != nil {
 		return nil, err
 	}
 
 	// B) Detail (Graf)
-	detailTmpl := template.New("layout.html").Funcs(funcMap)
-	detailTmpl, err = detailTmpl.ParseFiles(
-		filepath.Join("templates", "layout.html"),
-		filepath.Join("templates", "detail.html"),
-	)
+	detailTmpl, err := parsePage("detail.html")
+	if err != nil {
+		return nil, err
+	}
+
+	// C) Karanténa neznámých topiců
+	discoveredTmpl, err := parsePage("discovered.html")
+	if err != nil {
+		return nil, err
+	}
+
+	// D) Odmítnuté zprávy
+	rejectsTmpl, err := parsePage("rejects.html")
+	if err != nil {
+		return nil, err
+	}
+
+	// E) Porovnání řad
+	compareTmpl, err := parsePage("compare.html")
+	if err != nil {
+		return nil, err
+	}
+
+	// F) Spotřeba z počítadel
+	consumptionTmpl, err := parsePage("consumption.html")
+	if err != nil {
+		return nil, err
+	}
+
+	// G) Zařízení
+	devicesTmpl, err := parsePage("devices.html")
+	if err != nil {
+		return nil, err
+	}
+	servicesTmpl, err := parsePage("services.html")
 	if err != nil {
 		return nil, err
 	}
@@ -90,8 +214,16 @@ func NewWebHandler(client *APIClient, logger *slog.Logger) (*WebHandler, error)
 	return &WebHandler{
 		client:     client,
 		logger:     logger,
+		sysPrefix:  sysPrefix,
 		indexTmpl:  indexTmpl,
 		detailTmpl: detailTmpl,
+
+		discoveredTmpl:  discoveredTmpl,
+		rejectsTmpl:     rejectsTmpl,
+		compareTmpl:     compareTmpl,
+		consumptionTmpl: consumptionTmpl,
+		devicesTmpl:     devicesTmpl,
+		servicesTmpl:    servicesTmpl,
 	}, nil
 }
 
@@ -106,51 +238,20 @@ func (h *WebHandler) HandleIndex(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 2. LOGIKA AGREGACE DAT PRO SYSTEM WIDGET
-	// Projdeme seznam senzorů a "vytaháme" z něj ty systémové podle MQTT topicu.
-	sysData := SystemWidgetData{}
-
-	for _, s := range sensors {
-		// Získáme hodnotu (dereference), pokud existuje.
-		val := 0.0
-		if s.CurrentValue != nil {
-			val = *s.CurrentValue
-		}
-
-		// Rozhodování podle Topiců (tyto topicy jsme definovali v DB).
-		switch s.Topic {
-		case "/msh/system/cpu":
-			sysData.CPUPercent = val
-			sysData.HasData = true // Našli jsme CPU, zapneme zobrazení widgetu
-		case "/msh/system/ram_used":
-			sysData.RamUsed = val
-		case "/msh/system/ram_total":
-			sysData.RamTotal = val
-		case "/msh/system/disk_used":
-			sysData.DiskUsed = val
-		case "/msh/system/disk_total":
-			sysData.DiskTotal = val
-		}
-	}
-
-	// 3. DOPOČTY (Business Logic ve View Layeru)
-	// Grafy potřebují "Used" a "Free". Senzory posílají "Used" a "Total".
-	// Musíme dopočítat zbytek.
-	if sysData.RamTotal > 0 {
-		sysData.RamFree = sysData.RamTotal - sysData.RamUsed
-	}
-	if sysData.DiskTotal > 0 {
-		sysData.DiskFree = sysData.DiskTotal - sysData.DiskUsed
-	}
+	// Ze seznamu senzorů vytaháme ty systémové a seskupíme je podle hostu.
+	systems := collectSystemWidgets(sensors, h.sysPrefix)
 
-	// 4. Příprava dat pro šablonu
+	// 3. Příprava dat pro šablonu
 	data := map[string]interface{}{
-		"Title":      "IoT Dashboard",
-		"Sensors":    sensors, // Seznam všech senzorů (pro spodní část stránky)
-		"SystemInfo": sysData, // Data pro koláčové grafy
-		"Page":       "index",
+		"Title":   "IoT Dashboard",
+		"Sensors": sensors, // Seznam všech senzorů (pro spodní část stránky)
+		"Systems": systems, // Data pro koláčové grafy (jeden panel na stroj)
+		"Page":    "index",
+		"Msg":     r.URL.Query().Get("msg"), // Výsledek posledního příkazu (přepínače)
+		"Error":   r.URL.Query().Get("err"),
 	}
 
-	// 5. Renderování
+	// 4. Renderování
 	err = h.indexTmpl.ExecuteTemplate(w, "layout.html", data)
 	if err != nil {
 		h.logger.Error("Chyba renderování indexu", "error", err)
@@ -187,12 +288,48 @@ func (h *WebHandler) HandleDetail(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Dvoustavový senzor: časová osa zapnuto/vypnuto a doba zapnutí po dnech.
+	// Chyba stránku neshodí - zbytek detailu se zobrazí i bez nich.
+	var intervals *BinaryIntervalsDTO
+	var onTime *OnTimeDTO
+	if currentSensor.IsBinary() {
+		if intervals, err = h.client.GetIntervals(id, rng); err != nil {
+			h.logger.Warn("Chyba API intervalů", "id", id, "error", err)
+		}
+		if onTime, err = h.client.GetOnTime(id, rng, "day"); err != nil {
+			h.logger.Warn("Chyba API doby zapnutí", "id", id, "error", err)
+		}
+	}
+
+	// Statistiky pod grafem (stejné okno, souhrny po dnech). Volitelné prahy bere z URL.
+	// Chyba statistik stránku neshodí - graf zobrazíme i bez nich.
+	// Nečíselný ani dvoustavový senzor (stavy, text, poloha, spínač) statistiky nemá.
+	q := r.URL.Query()
+	var stats *SensorStatsDTO
+	if !currentSensor.IsState() && !currentSensor.IsBinary() {
+		statsParams := url.Values{"range": {rng}, "bucket": {"day"}}
+		for _, key := range []string{"above", "below"} {
+			if v := q.Get(key); v != "" {
+				statsParams.Set(key, v)
+			}
+		}
+		if stats, err = h.client.GetSensorStats(id, statsParams); err != nil {
+			h.logger.Warn("Chyba API statistik", "id", id, "error", err)
+		}
+	}
+
 	data := map[string]interface{}{
 		"Title":  "Detail Senzoru",
 		"Sensor": currentSensor,
 		"Points": points,
-		"Page":   "detail",
-		"Range":  rng,
+		"Stats":  stats,
+
+		"Intervals": intervals,
+		"OnTime":    onTime,
+		"Above":     q.Get("above"),
+		"Below":     q.Get("below"),
+		"Page":      "detail",
+		"Range":     rng,
 	}
 
 	err = h.detailTmpl.ExecuteTemplate(w, "layout.html", data)
@@ -200,3 +337,464 @@ func (h *WebHandler) HandleDetail(w http.ResponseWriter, r *http.Request) {
 		h.logger.Error("Chyba renderování detailu", "error", err)
 	}
 }
+
+// HandleDiscovered: Stránka s karanténou neznámých topiců (GET /discovered?status=pending)
+func (h *WebHandler) HandleDiscovered(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "pending"
+	}
+
+	topics, err := h.client.GetDiscoveredTopics(status)
+	if err != nil {
+		h.logger.Error("Chyba API karantény", "error", err)
+		http.Error(w, "Backend API je nedostupné", http.StatusBadGateway)
+		return
+	}
+
+	// Typy senzorů pro <select> ve formuláři schválení.
+	types, err := h.client.GetSensorTypes()
+	if err != nil {
+		h.logger.Error("Chyba API typů senzorů", "error", err)
+		http.Error(w, "Backend API je nedostupné", http.StatusBadGateway)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Title":  "Nové topicy",
+		"Topics": topics,
+		"Types":  types,
+		"Status": status,
+		"Page":   "discovered",
+		"Msg":    r.URL.Query().Get("msg"),
+		"Error":  r.URL.Query().Get("err"),
+	}
+
+	if err := h.discoveredTmpl.ExecuteTemplate(w, "layout.html", data); err != nil {
+		h.logger.Error("Chyba renderování karantény", "error", err)
+	}
+}
+
+// HandleApproveDiscovered: POST /discovered/{id}/approve (HTML formulář)
+func (h *WebHandler) HandleApproveDiscovered(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Neplatné ID", http.StatusBadRequest)
+		return
+	}
+	typeID, _ := strconv.ParseInt(r.FormValue("sensor_type_id"), 10, 64)
+
+	req := ApproveTopicRequest{
+		SensorTypeID: typeID,
+		FriendlyName: r.FormValue("friendly_name"),
+		Location:     r.FormValue("location"),
+	}
+	if err := h.client.ApproveDiscoveredTopic(id, req); err != nil {
+		h.logger.Warn("Schválení topicu selhalo", "id", id, "error", err)
+		redirectWithFlash(w, r, "/discovered", "err", err.Error())
+		return
+	}
+	redirectWithFlash(w, r, "/discovered", "msg", "Topic schválen, Ingestor ho začne přijímat do minuty.")
+}
+
+// HandleIgnoreDiscovered: POST /discovered/{id}/ignore (HTML formulář)
+func (h *WebHandler) HandleIgnoreDiscovered(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Neplatné ID", http.StatusBadRequest)
+		return
+	}
+	if err := h.client.IgnoreDiscoveredTopic(id); err != nil {
+		h.logger.Warn("Ignorování topicu selhalo", "id", id, "error", err)
+		redirectWithFlash(w, r, "/discovered", "err", err.Error())
+		return
+	}
+	redirectWithFlash(w, r, "/discovered", "msg", "Topic bude trvale ignorován.")
+}
+
+// HandleCommand: POST /sensor/{id}/command (tlačítka ZAP/VYP u akčních členů)
+// Čeká na výsledek z API (potvrzení od zařízení) a výsledek ukáže na hlavní stránce.
+func (h *WebHandler) HandleCommand(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Neplatné ID", http.StatusBadRequest)
+		return
+	}
+	value, err := strconv.ParseFloat(r.FormValue("value"), 64)
+	if err != nil {
+		http.Error(w, "Neplatná hodnota", http.StatusBadRequest)
+		return
+	}
+
+	cmd, err := h.client.SendCommand(id, value)
+	if err != nil {
+		h.logger.Warn("Odeslání příkazu selhalo", "id", id, "error", err)
+		redirectWithFlash(w, r, "/", "err", err.Error())
+		return
+	}
+
+	switch cmd.Status {
+	case "confirmed":
+		redirectWithFlash(w, r, "/", "msg", "Zařízení potvrdilo nový stav.")
+	case "timeout":
+		redirectWithFlash(w, r, "/", "err", "Příkaz odeslán, ale zařízení stav nepotvrdilo.")
+	default:
+		msg := "Příkaz se nepodařilo odeslat."
+		if cmd.Error != nil {
+			msg += " " + *cmd.Error
+		}
+		redirectWithFlash(w, r, "/", "err", msg)
+	}
+}
+
+// rejectSensorOption je jedna položka výběru senzoru na stránce odmítnutých zpráv.
+type rejectSensorOption struct {
+	ID    int64
+	Name  string
+	Count int64
+}
+
+// HandleRejects: Odmítnuté zprávy (GET /rejects?sensor_id=5&reason=above_max)
+func (h *WebHandler) HandleRejects(w http.ResponseWriter, r *http.Request) {
+	sensorID, _ := strconv.ParseInt(r.URL.Query().Get("sensor_id"), 10, 64)
+	reason := r.URL.Query().Get("reason")
+
+	rejects, err := h.client.GetRejects(sensorID, reason)
+	if err != nil {
+		h.logger.Error("Chyba API odmítnutých zpráv", "error", err)
+		http.Error(w, "Backend API je nedostupné", http.StatusBadGateway)
+		return
+	}
+
+	summary, err := h.client.GetRejectSummary()
+	if err != nil {
+		h.logger.Error("Chyba API přehledu odmítnutých zpráv", "error", err)
+		http.Error(w, "Backend API je nedostupné", http.StatusBadGateway)
+		return
+	}
+
+	// Výběr senzoru skládáme z přehledu - nabízíme jen senzory, které nějaké odmítnutí mají.
+	var sensors []rejectSensorOption
+	index := make(map[int64]int)
+	for _, s := range summary {
+		if s.SensorID == nil {
+			continue // Senzor mezitím smazán
+		}
+		i, ok := index[*s.SensorID]
+		if !ok {
+			name := fmt.Sprintf("Senzor #%d", *s.SensorID)
+			if s.SensorName != nil {
+				name = *s.SensorName
+			}
+			index[*s.SensorID] = len(sensors)
+			sensors = append(sensors, rejectSensorOption{ID: *s.SensorID, Name: name})
+			i = len(sensors) - 1
+		}
+		sensors[i].Count += s.Count
+	}
+	sort.Slice(sensors, func(i, j int) bool { return sensors[i].Name < sensors[j].Name })
+
+	data := map[string]interface{}{
+		"Title":    "Odmítnuté zprávy",
+		"Rejects":  rejects,
+		"Summary":  summary,
+		"Sensors":  sensors,
+		"SensorID": sensorID,
+		"Reason":   reason,
+		"Reasons":  []string{"invalid_number", "invalid_value", "below_min", "above_max"},
+		"Page":     "rejects",
+		"Msg":      r.URL.Query().Get("msg"),
+		"Error":    r.URL.Query().Get("err"),
+	}
+
+	if err := h.rejectsTmpl.ExecuteTemplate(w, "layout.html", data); err != nil {
+		h.logger.Error("Chyba renderování odmítnutých zpráv", "error", err)
+	}
+}
+
+// HandleCompare: Porovnání více senzorů v jednom grafu (GET /compare?sensor=1&sensor=4&range=24h&previous=1)
+// previous=1 přidá ke každému senzoru i jeho předchozí období stejné délky ("tento vs. minulý týden").
+func (h *WebHandler) HandleCompare(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	rng := q.Get("range")
+	if rng == "" {
+		rng = "24h"
+	}
+	previous := q.Get("previous") == "1"
+
+	// Vybrané senzory (neplatná ID tiše přeskočíme - přišla z našeho formuláře)
+	selected := make(map[int64]bool)
+	var series []string
+	for _, v := range q["sensor"] {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || selected[id] {
+			continue
+		}
+		selected[id] = true
+		series = append(series, v)
+		if previous {
+			series = append(series, v+"@"+rng)
+		}
+	}
+
+	sensors, err := h.client.GetSensors()
+	if err != nil {
+		h.logger.Error("Chyba při volání API", "error", err)
+		http.Error(w, "Backend API je nedostupné", http.StatusBadGateway)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Title":    "Porovnání",
+		"Sensors":  sensors,
+		"Selected": selected,
+		"Range":    rng,
+		"Previous": previous,
+		"Page":     "compare",
+	}
+
+	// Bez výběru jen zobrazíme formulář
+	if len(series) > 0 {
+		history, err := h.client.GetMultiHistory(series, rng)
+		if err != nil {
+			h.logger.Warn("Chyba API porovnání", "series", series, "error", err)
+			data["Error"] = err.Error()
+		} else {
+			data["History"] = history
+		}
+	}
+
+	if err := h.compareTmpl.ExecuteTemplate(w, "layout.html", data); err != nil {
+		h.logger.Error("Chyba renderování porovnání", "error", err)
+	}
+}
+
+// MeterSummary je řádek přehledu počítadel na stránce Spotřeba (ViewModel).
+type MeterSummary struct {
+	Sensor      SensorDTO
+	Consumption *ConsumptionDTO // nil = API spotřebu nevrátilo
+}
+
+// HandleConsumption: Spotřeba z počítadel (GET /consumption?sensor=12&range=720h&bucket=day)
+// Přehled všech počítadel za zvolené období + sloupcový graf vybraného počítadla.
+func (h *WebHandler) HandleConsumption(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	rng := q.Get("range")
+	if rng == "" {
+		rng = "720h"
+	}
+	bucket := q.Get("bucket")
+	if bucket == "" {
+		bucket = "day"
+	}
+	selectedID, _ := strconv.ParseInt(q.Get("sensor"), 10, 64)
+
+	sensors, err := h.client.GetSensors()
+	if err != nil {
+		h.logger.Error("Chyba při volání API", "error", err)
+		http.Error(w, "Backend API je nedostupné", http.StatusBadGateway)
+		return
+	}
+
+	// Jen počítadla. Bez výběru ukážeme graf prvního z nich.
+	var meters []MeterSummary
+	var selected *MeterSummary
+	var apiErr string
+	for _, s := range sensors {
+		if !s.Counter {
+			continue
+		}
+		m := MeterSummary{Sensor: s}
+		if m.Consumption, err = h.client.GetConsumption(s.ID, rng, bucket); err != nil {
+			h.logger.Warn("Chyba API spotřeby", "id", s.ID, "error", err)
+			apiErr = err.Error()
+		}
+		meters = append(meters, m)
+	}
+	for i := range meters {
+		if selected == nil || meters[i].Sensor.ID == selectedID {
+			selected = &meters[i]
+		}
+	}
+
+	data := map[string]interface{}{
+		"Title":    "Spotřeba",
+		"Meters":   meters,
+		"Selected": selected,
+		"Range":    rng,
+		"Bucket":   bucket,
+		"Page":     "consumption",
+		"Error":    apiErr,
+	}
+	if err := h.consumptionTmpl.ExecuteTemplate(w, "layout.html", data); err != nil {
+		h.logger.Error("Chyba renderování spotřeby", "error", err)
+	}
+}
+
+// HandleDevices: Zařízení a jejich zdraví (GET /devices)
+// Problémová zařízení (offline, varování) řadíme nahoru, ať jsou vidět na první pohled.
+func (h *WebHandler) HandleDevices(w http.ResponseWriter, r *http.Request) {
+	// Chybu API (např. 503 bez TimescaleDB) ukážeme na stránce - výpadek celé stránky by nic neřekl.
+	devices, err := h.client.GetDevices()
+	var apiErr string
+	if err != nil {
+		h.logger.Error("Chyba API zařízení", "error", err)
+		apiErr = err.Error()
+	}
+
+	// Stabilní řazení: nejdřív offline, pak s varováním, pak ostatní (pořadí z API = podle jména)
+	rank := func(d DeviceDTO) int {
+		switch {
+		case d.Status == "offline":
+			return 0
+		case len(d.Warnings) > 0:
+			return 1
+		default:
+			return 2
+		}
+	}
+	sort.SliceStable(devices, func(i, j int) bool { return rank(devices[i]) < rank(devices[j]) })
+
+	counts := map[string]int{}
+	for _, d := range devices {
+		counts[d.Status]++
+		if len(d.Warnings) > 0 {
+			counts["warning"]++
+		}
+	}
+
+	data := map[string]interface{}{
+		"Title":   "Zařízení",
+		"Devices": devices,
+		"Counts":  counts,
+		"Page":    "devices",
+		"Error":   apiErr,
+	}
+	if err := h.devicesTmpl.ExecuteTemplate(w, "layout.html", data); err != nil {
+		h.logger.Error("Chyba renderování zařízení", "error", err)
+	}
+}
+
+// HandleServices: Přehled služeb systému (GET /services)
+// Služby mimo provoz (offline, zastaralé, se selhanou závislostí) řadíme nahoru.
+func (h *WebHandler) HandleServices(w http.ResponseWriter, r *http.Request) {
+	services, err := h.client.GetServices()
+	var apiErr string
+	if err != nil {
+		h.logger.Error("Chyba API služeb", "error", err)
+		apiErr = err.Error()
+	}
+
+	// Stabilní řazení podle závažnosti (pořadí z API = podle jména)
+	rank := map[string]int{"offline": 0, "stale": 1, "degraded": 2}
+	severity := func(s ServiceDTO) int {
+		if r, ok := rank[s.State]; ok {
+			return r
+		}
+		return 3
+	}
+	sort.SliceStable(services, func(i, j int) bool { return severity(services[i]) < severity(services[j]) })
+
+	counts := map[string]int{}
+	for _, s := range services {
+		counts[s.State]++
+	}
+
+	data := map[string]interface{}{
+		"Title":    "Služby",
+		"Services": services,
+		"Counts":   counts,
+		"Page":     "services",
+		"Error":    apiErr,
+	}
+	if err := h.servicesTmpl.ExecuteTemplate(w, "layout.html", data); err != nil {
+		h.logger.Error("Chyba renderování služeb", "error", err)
+	}
+}
+
+// HandleResubmitReject: POST /rejects/{id}/resubmit (HTML formulář)
+func (h *WebHandler) HandleResubmitReject(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Neplatné ID", http.StatusBadRequest)
+		return
+	}
+	if err := h.client.ResubmitReject(id); err != nil {
+		h.logger.Warn("Znovuodeslání zprávy selhalo", "id", id, "error", err)
+		redirectWithFlash(w, r, "/rejects", "err", err.Error())
+		return
+	}
+	redirectWithFlash(w, r, "/rejects", "msg", "Zpráva odeslána ke znovuzpracování. Pokud neprojde ani teď, objeví se v seznamu znovu.")
+}
+
+// redirectWithFlash přesměruje zpět na stránku (Post/Redirect/Get) a předá krátkou zprávu v URL.
+// 303 See Other zajistí, že refresh stránky formulář znovu neodešle.
+func redirectWithFlash(w http.ResponseWriter, r *http.Request, path, key, msg string) {
+	http.Redirect(w, r, path+"?"+url.Values{key: {msg}}.Encode(), http.StatusSeeOther)
+}
+
+// collectSystemWidgets projde senzory a z topiců tvaru <prefix><host>/<metrika>
+// sestaví jeden widget pro každý monitorovaný stroj. Výsledek je seřazený podle hostu,
+// aby se panely na stránce při každém obnovení nepřeskupovaly.
+func collectSystemWidgets(sensors []SensorDTO, prefix string) []SystemWidgetData {
+	byHost := make(map[string]*SystemWidgetData)
+
+	for _, s := range sensors {
+		rest, ok := strings.CutPrefix(s.Topic, prefix)
+		if !ok {
+			continue
+		}
+		host, metric, ok := strings.Cut(rest, "/")
+		if !ok || host == "" {
+			continue // Není to topic tvaru <host>/<metrika>
+		}
+
+		// Získáme hodnotu (dereference), pokud existuje.
+		val := 0.0
+		if s.CurrentValue != nil {
+			val = *s.CurrentValue
+		}
+
+		w, exists := byHost[host]
+		if !exists {
+			w = &SystemWidgetData{Host: host}
+			byHost[host] = w
+		}
+
+		// Rozhodování podle poslední úrovně topicu (definuje system-monitor).
+		switch metric {
+		case "cpu":
+			w.CPUPercent = val
+			w.HasData = true // Našli jsme CPU, zapneme zobrazení panelu
+		case "ram_used":
+			w.RamUsed = val
+		case "ram_total":
+			w.RamTotal = val
+		case "disk_used":
+			w.DiskUsed = val
+		case "disk_total":
+			w.DiskTotal = val
+		}
+	}
+
+	widgets := make([]SystemWidgetData, 0, len(byHost))
+	for _, w := range byHost {
+		if !w.HasData {
+			continue
+		}
+		// DOPOČTY (Business Logic ve View Layeru)
+		// Grafy potřebují "Used" a "Free". Senzory posílají "Used" a "Total".
+		if w.RamTotal > 0 {
+			w.RamFree = w.RamTotal - w.RamUsed
+		}
+		if w.DiskTotal > 0 {
+			w.DiskFree = w.DiskTotal - w.DiskUsed
+		}
+		widgets = append(widgets, *w)
+	}
+
+	sort.Slice(widgets, func(i, j int) bool { return widgets[i].Host < widgets[j].Host })
+	return widgets
+}
@@ -0,0 +1,139 @@
+package dashboard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"presence"
+)
+
+// Run spustí Web Dashboard a blokuje, dokud není zrušen ctx (signál, all-in-one shutdown).
+// Chyba se vrací při startu (šablony) nebo pádu HTTP serveru.
+func Run(ctx context.Context, cfg Config, logger *slog.Logger) error {
+	// 1.+2. Logger (strukturovaný JSON) a konfiguraci dostáváme od volajícího
+	logger.Info("Startuji Web Dashboard", "port", cfg.HTTPPort, "api_url", cfg.APIURL)
+
+	// 3. Inicializace komponent (Dependency Injection)
+	// Vytvoříme klienta, který umí komunikovat s API.
+	client := NewAPIClient(cfg.APIURL, cfg.Units)
+	if cfg.APIHandler != nil {
+		// all-in-one: API běží ve stejném procesu, voláme ho přímo (bez sítě)
+		client.SetTransport(HandlerTransport(cfg.APIHandler))
+	}
+
+	// Vytvoříme handler a předáme mu klienta a logger.
+	// Pokud handler vrátí chybu (např. chyba v šabloně), vrátíme ji volajícímu.
+	handler, err := NewWebHandler(client, cfg.SystemTopicPrefix, logger)
+	if err != nil {
+		return fmt.Errorf("nepodařilo se načíst HTML šablony: %w", err)
+	}
+
+	// 4. Nastavení Routování (ServeMux)
+	// ServeMux je HTTP router ze standardní knihovny.
+	mux := http.NewServeMux()
+
+	// Mapování URL cest na metody handleru
+	mux.HandleFunc("GET /", handler.HandleIndex)
+
+	// {id} je "wildcard" (parametr cesty), dostupný od Go 1.22.
+	mux.HandleFunc("GET /sensor/{id}", handler.HandleDetail)
+
+	// Porovnání více řad (senzorů / období) v jednom grafu
+	mux.HandleFunc("GET /compare", handler.HandleCompare)
+
+	// Spotřeba z počítadel (vodoměr, pulzy) po hodinách/dnech/měsících
+	mux.HandleFunc("GET /consumption", handler.HandleConsumption)
+
+	// Zařízení: dostupnost (LWT), baterie, signál a jejich senzory
+	mux.HandleFunc("GET /devices", handler.HandleDevices)
+
+	// Karanténa neznámých MQTT topiců (schválení / ignorování)
+	mux.HandleFunc("GET /discovered", handler.HandleDiscovered)
+	mux.HandleFunc("POST /discovered/{id}/approve", handler.HandleApproveDiscovered)
+	mux.HandleFunc("POST /discovered/{id}/ignore", handler.HandleIgnoreDiscovered)
+
+	// Odmítnuté zprávy (dead-letter) a jejich znovuodeslání
+	mux.HandleFunc("GET /rejects", handler.HandleRejects)
+	mux.HandleFunc("POST /rejects/{id}/resubmit", handler.HandleResubmitReject)
+
+	// Ovládání akčních členů (relé, zásuvky)
+	mux.HandleFunc("POST /sensor/{id}/command", handler.HandleCommand)
+
+	// Přehled služeb (presence zprávy sbírá Home API)
+	mux.HandleFunc("GET /services", handler.HandleServices)
+
+	// Health endpointy pro Docker (/health/live, /health/ready, /health - viz modul presence).
+	// Readiness = Home API odpovídá (bez něj dashboard nic nezobrazí). MQTT mezi závislosti
+	// nepatří - broker slouží jen presence zprávě, stránky fungují i bez něj.
+	pres := presence.New("web-dashboard", cfg.PresenceTopic, cfg.PresenceInterval, logger)
+	pres.AddCheck("home_api", client.CheckHealth)
+	pres.RegisterHealth(mux)
+
+	// Presence zpráva (online + Last Will offline), aby spadlý dashboard byl vidět v přehledu služeb
+	if cfg.PresenceTopic != "" {
+		mqttClient := connectPresence(ctx, cfg, pres, logger)
+		// Defery běží pozpátku - "offline" odejde před odpojením
+		defer mqttClient.Disconnect(250)
+		defer pres.Offline(mqttClient)
+	}
+
+	// 5. Spuštění HTTP serveru
+	server := &http.Server{
+		Addr:    ":" + cfg.HTTPPort, // např. ":3000"
+		Handler: mux,
+	}
+
+	// Po zrušení ctx necháme doběhnout rozpracované požadavky (max. 5 s).
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("Web server naslouchá", "address", server.Addr)
+
+	// ListenAndServe spustí smyčku serveru. Je to blokující volání (program zde "visí").
+	// ErrServerClosed = řádné ukončení přes Shutdown; jinou chybu (pád serveru) vracíme volajícímu.
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("server nečekaně spadl: %w", err)
+	}
+	return nil
+}
+
+// connectPresence připojí MQTT klienta pro presence zprávu a po připojení spustí pres.Run.
+// Start dashboardu na brokeru nečeká: nedostupný broker není důvod nezobrazit stránky,
+// paho se připojuje na pozadí (ConnectRetry) a presence naběhne, až se to povede.
+func connectPresence(ctx context.Context, cfg Config, pres *presence.Presence, logger *slog.Logger) mqtt.Client {
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(cfg.MQTTBroker)
+	opts.SetClientID(cfg.MQTTClientID)
+	opts.SetCustomOpenConnectionFn(cfg.MQTTConnect)
+	opts.SetConnectRetry(true)
+	opts.SetAutoReconnect(true)
+	// Last Will "offline" se musí nastavit před připojením
+	pres.SetWill(opts)
+
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	go func() {
+		select {
+		case <-token.Done():
+		case <-ctx.Done():
+			return
+		}
+		if token.Error() != nil {
+			logger.Error("Presence: připojení k MQTT selhalo", "error", token.Error())
+			return
+		}
+		logger.Info("Presence: připojeno k MQTT brokeru", "topic", cfg.PresenceTopic)
+		pres.Run(ctx, client)
+	}()
+	return client
+}